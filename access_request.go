@@ -0,0 +1,113 @@
+package classosbackend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidAccessRequest = errors.New("invalid access request")
+
+const (
+	AccessRequestPending      = "pending"
+	AccessRequestApprovedOnce = "approved_once"
+	AccessRequestApproved     = "approved"
+	AccessRequestRejected     = "rejected"
+)
+
+const (
+	// AccessDecisionOnce открывает ресурс только автору запроса до ExpiresAt
+	AccessDecisionOnce = "once"
+	// AccessDecisionPermanent добавляет ресурс в whitelist группы
+	AccessDecisionPermanent = "permanent"
+	AccessDecisionReject    = "reject"
+)
+
+const (
+	DefaultAccessGrantMinutes = 45
+	MaxAccessGrantMinutes     = 7 * 24 * 60
+	maxJustificationLength    = 1000
+)
+
+// AccessRequest - запрос ученика на доступ к заблокированному ресурсу
+type AccessRequest struct {
+	ID            int64      `json:"id" db:"id"`
+	UserID        int        `json:"user_id" db:"user_id"`
+	Username      string     `json:"username" db:"username"`
+	GroupID       int        `json:"group_id" db:"group_id"`
+	URL           string     `json:"url" db:"url"`
+	Value         string     `json:"value" db:"resource"`
+	Justification string     `json:"justification" db:"justification"`
+	Status        string     `json:"status" db:"status"`
+	Comment       string     `json:"comment" db:"comment"`
+	DecidedBy     *int       `json:"decided_by,omitempty" db:"decided_by"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty" db:"decided_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ActiveAt сообщает, действует ли разовое разрешение в момент at
+func (r AccessRequest) ActiveAt(at time.Time) bool {
+	if r.Status != AccessRequestApprovedOnce || r.ExpiresAt == nil {
+		return false
+	}
+
+	if r.DecidedAt != nil && at.Before(*r.DecidedAt) {
+		return false
+	}
+
+	return at.Before(*r.ExpiresAt)
+}
+
+type AccessRequestInput struct {
+	URL           string `json:"url" binding:"required"`
+	Justification string `json:"justification" binding:"required"`
+}
+
+func (i AccessRequestInput) Validate() error {
+	justification := strings.TrimSpace(i.Justification)
+	if justification == "" {
+		return fmt.Errorf("%w: justification is empty", ErrInvalidAccessRequest)
+	}
+
+	if len([]rune(justification)) > maxJustificationLength {
+		return fmt.Errorf("%w: justification must be at most %d characters", ErrInvalidAccessRequest, maxJustificationLength)
+	}
+
+	return nil
+}
+
+// AccessDecisionInput - решение по запросу. Value позволяет расширить или сузить ресурс
+// перед добавлением в whitelist, например заменить youtube.com/watch на *.youtube.com
+type AccessDecisionInput struct {
+	Decision        string `json:"decision" binding:"required"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Value           string `json:"value"`
+	EntrySet        string `json:"entry_set"`
+	Comment         string `json:"comment"`
+}
+
+func (i AccessDecisionInput) Validate() error {
+	switch i.Decision {
+	case AccessDecisionOnce:
+		if i.DurationMinutes < 0 || i.DurationMinutes > MaxAccessGrantMinutes {
+			return fmt.Errorf("%w: duration_minutes must be between 1 and %d", ErrInvalidAccessRequest, MaxAccessGrantMinutes)
+		}
+	case AccessDecisionPermanent, AccessDecisionReject:
+	default:
+		return fmt.Errorf("%w: decision must be %q, %q or %q", ErrInvalidAccessRequest,
+			AccessDecisionOnce, AccessDecisionPermanent, AccessDecisionReject)
+	}
+
+	return nil
+}
+
+// Duration возвращает срок разового разрешения или fallback, если учитель его не указал
+func (i AccessDecisionInput) Duration(fallback time.Duration) time.Duration {
+	if i.DurationMinutes == 0 {
+		return fallback
+	}
+
+	return time.Duration(i.DurationMinutes) * time.Minute
+}
@@ -118,7 +118,7 @@ func testBasicConnection() error {
 
 func testADService() error {
 	fmt.Println("Initializing AD Service...")
-	adService := service.NewADService()
+	adService := service.NewADService(service.NewSettingsService(nil))
 
 	fmt.Println("Testing AD Service connection...")
 	if err := adService.TestConnection(); err != nil {
@@ -41,20 +41,61 @@ func main() {
 
 	repos := repository.NewRepository(db)
 
-	adService := service.NewADService()
-	if err := adService.TestConnection(); err != nil {
-		logrus.Printf("Warning: AD connection failed: %v", err)
-		logrus.Printf("Application will work in DB-only mode")
+	settingsService := service.NewSettingsService(repos.Settings)
+
+	backend := viper.GetString("directory.backend")
+	if backend == "" {
+		backend = service.DirectoryAD
+	}
+	configured, err := service.NewDirectory(backend, settingsService)
+	if err != nil {
+		logrus.Fatalf("failed to configure directory: %s", err.Error())
+	}
+
+	mode, err := service.ResolveDirectoryMode(viper.GetString("directory.mode"), configured)
+	if err != nil {
+		logrus.Fatalf("failed to configure directory: %s", err.Error())
+	}
+
+	outbox := service.NewDirectoryOutbox(repos.DirectoryJournal)
+	directory := service.DirectoryForMode(mode, configured)
+	if mode == service.DirectoryModeDBOnly {
+		logrus.Printf("Directory backend %q in DB-only mode: directory changes are queued", backend)
 	} else {
-		logrus.Println("AD connection established successfully")
+		logrus.Printf("Directory backend %q in %s mode", backend, mode)
+	}
+
+	providers, err := service.NewCredentialProviders(viper.GetString("auth.provider"), repos, directory)
+	if err != nil {
+		logrus.Fatalf("failed to configure auth provider: %s", err.Error())
 	}
 
-	authService := service.NewAuthService(repos.Authorization)
+	authService := service.NewAuthService(repos.Authorization, repos.Role, settingsService, providers...)
+	policyService := service.NewPolicyService(repos.Whitelist, repos.Schedule, repos.User, repos.Group, repos.AccessRequest,
+		viper.GetString("dns_upstream"))
+	generator := service.NewCredentialGenerator(repos.User, directory, settingsService)
+	archiveService := service.NewArchiveService(repos.User, repos.Group, outbox, authService, settingsService)
+	userService := service.NewIntegratedUserService(repos.User, repos.Group, authService, directory, outbox, generator, archiveService)
 
 	services := &service.Service{
-		Authorization: authService,
-		Group:         service.NewIntegratedGroupService(repos.Group, adService),
-		User:          service.NewIntegratedUserService(repos.User, repos.Group, authService, adService),
+		Authorization:    authService,
+		Group:            service.NewIntegratedGroupService(repos.Group, outbox, archiveService),
+		User:             userService,
+		Archive:          archiveService,
+		UserImport:       service.NewUserImportService(userService, repos.User, repos.Group, directory, generator),
+		CredentialsSheet: service.NewCredentialsSheetService(repos.User, repos.Group, outbox, authService, settingsService, viper.GetString("credentials_sheet.font")),
+		PasswordReset:    service.NewPasswordResetService(repos.User, repos.Group, outbox, authService),
+		Whitelist:        service.NewWhitelistService(repos.Whitelist, repos.Group, policyService),
+		Policy:           policyService,
+		Schedule:         service.NewScheduleService(repos.Schedule, repos.Group, policyService),
+		AccessRequest:    service.NewAccessRequestService(repos.AccessRequest, repos.User, repos.Group, policyService, settingsService),
+		Teacher:          service.NewTeacherService(repos.Group, repos.User),
+		Role:             service.NewRoleService(repos.Role),
+		Profile:          service.NewProfileService(authService, repos.Authorization, repos.User, repos.AccessRequest, policyService, outbox),
+		Settings:         settingsService,
+		DirectoryAdmin:   service.NewDirectoryAdminService(backend, mode, configured, repos.DirectoryJournal, outbox),
+		Sync:             service.NewSyncService(repos.User, repos.Group, repos.DirectoryJournal, directory, outbox, archiveService, authService),
+		Drift:            service.NewDriftService(repos.User, repos.Group, directory),
 	}
 
 	handlers := handler.NewHandler(services)
@@ -80,12 +121,21 @@ func main() {
 
 	logrus.Printf("classOS_backend started on %s", address)
 
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	go archiveService.Run(workersCtx, service.ArchivePurgeInterval)
+	// Явно заданный db_only не трогает каталог; в auto очередь догонит AD, когда он станет доступен
+	if viper.GetString("directory.mode") != service.DirectoryModeDBOnly {
+		go outbox.Run(workersCtx, configured, service.DirectoryOutboxInterval)
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
 	<-quit
 
 	logrus.Print("classOS_backend shutting down")
 
+	stopWorkers()
+
 	if err := srv.Shutdown(context.Background()); err != nil {
 		logrus.Errorf("error occured on server shutting down: %s", err.Error())
 	}
@@ -0,0 +1,17 @@
+package classosbackend
+
+// CredentialsSheetInput - параметры листа с учётными данными группы
+type CredentialsSheetInput struct {
+	// ResetPasswords задаёт всем ученикам группы новые пароли; иначе поле пароля на карточке остаётся пустым
+	ResetPasswords bool `json:"reset_passwords"`
+	// MustChangePassword вместе с ResetPasswords требует сменить выданный пароль при первом входе
+	MustChangePassword bool `json:"must_change_password"`
+}
+
+// CredentialsSheet - готовый PDF. Пароли существуют только в Body и нигде не сохраняются
+type CredentialsSheet struct {
+	Filename    string
+	Body        []byte
+	Students    int
+	ResetFailed int
+}
@@ -0,0 +1,76 @@
+package classosbackend
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Операции каталога. Сервисы записывают их в журнал в одной транзакции с изменениями в БД,
+// а фоновый обработчик применяет к каталогу
+const (
+	DirectoryOpCreateUser          = "create_user"
+	DirectoryOpUpdateUser          = "update_user"
+	DirectoryOpDeleteUser          = "delete_user"
+	DirectoryOpChangePassword      = "change_password"
+	DirectoryOpResetPassword       = "reset_password"
+	DirectoryOpSetUserEnabled      = "set_user_enabled"
+	DirectoryOpCreateGroup         = "create_group"
+	DirectoryOpUpdateGroup         = "update_group"
+	DirectoryOpDeleteGroup         = "delete_group"
+	DirectoryOpAddUserToGroup      = "add_user_to_group"
+	DirectoryOpRemoveUserFromGroup = "remove_user_from_group"
+	DirectoryOpMoveUserToGroup     = "move_user_to_group"
+	DirectoryOpArchiveUser         = "archive_user"
+	DirectoryOpRestoreUser         = "restore_user"
+	DirectoryOpArchiveGroup        = "archive_group"
+	DirectoryOpRestoreGroup        = "restore_group"
+)
+
+// Состояния операции журнала: failed - попытки исчерпаны, операция ждёт повтора администратором
+const (
+	DirectoryOpPending = "pending"
+	DirectoryOpDone    = "done"
+	DirectoryOpFailed  = "failed"
+)
+
+// DirectoryOperationPayload - аргументы отложенной операции. Пароль в payload не попадает:
+// он хранится зашифрованным отдельно от него, PasswordSet отмечает его наличие.
+// NewName - новое имя группы или новый логин пользователя
+type DirectoryOperationPayload struct {
+	Username    string `json:"username,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Group       string `json:"group,omitempty"`
+	NewName     string `json:"new_name,omitempty"`
+	OriginalDN  string `json:"original_dn,omitempty"`
+	Enabled     *bool  `json:"enabled,omitempty"`
+	MustChange  *bool  `json:"must_change_password,omitempty"`
+	PasswordSet bool   `json:"password_set,omitempty"`
+}
+
+// DirectoryOperation - запись журнала операций каталога. Result - прежний DN объекта,
+// который вернула операция архивации
+type DirectoryOperation struct {
+	ID            int64           `json:"id" db:"id"`
+	Operation     string          `json:"operation" db:"operation"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	Status        string          `json:"status" db:"status"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     *string         `json:"last_error,omitempty" db:"last_error"`
+	Result        *string         `json:"-" db:"result"`
+	Secret        []byte          `json:"-" db:"secret"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	AppliedAt     *time.Time      `json:"applied_at,omitempty" db:"applied_at"`
+}
+
+// DirectoryStatus - состояние каталога для /api/admin/ad/status
+type DirectoryStatus struct {
+	Backend string `json:"backend"`
+	Mode    string `json:"mode"`
+	// Connected - результат проверки соединения в момент запроса; в режиме DB-only
+	// показывает, можно ли уже вернуться к работе с каталогом
+	Connected         bool   `json:"connected"`
+	Message           string `json:"message,omitempty"`
+	PendingOperations int    `json:"pending_operations"`
+	FailedOperations  int    `json:"failed_operations"`
+}
@@ -0,0 +1,73 @@
+package classosbackend
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+	"time"
+)
+
+// Виды расхождений между БД и OU classOS в AD
+const (
+	DriftMissingInAD = "missing_in_ad"
+	DriftMissingInDB = "missing_in_db"
+	DriftDisplayName = "display_name"
+	DriftMembership  = "membership"
+	DriftEnabled     = "enabled"
+)
+
+// DriftEntry - расхождение по одному пользователю. DB и AD - значения с каждой стороны:
+// имя, группы через запятую или true/false
+type DriftEntry struct {
+	Kind     string `json:"kind"`
+	Username string `json:"username"`
+	DB       string `json:"db,omitempty"`
+	AD       string `json:"ad,omitempty"`
+	Details  string `json:"details,omitempty"`
+}
+
+type DriftSummary struct {
+	MissingInAD int `json:"missing_in_ad"`
+	MissingInDB int `json:"missing_in_db"`
+	DisplayName int `json:"display_name"`
+	Membership  int `json:"membership"`
+	Enabled     int `json:"enabled"`
+	Total       int `json:"total"`
+}
+
+// DriftReport - расхождения БД и AD на момент GeneratedAt; отчёт ничего не меняет
+type DriftReport struct {
+	GeneratedAt time.Time    `json:"generated_at"`
+	DBUsers     int          `json:"db_users"`
+	ADUsers     int          `json:"ad_users"`
+	Summary     DriftSummary `json:"summary"`
+	Entries     []DriftEntry `json:"entries"`
+}
+
+// WriteCSV выводит расхождения в CSV для скачивания. Значения из AD и БД экранируются, чтобы
+// табличный редактор не выполнил их как формулы
+func (r DriftReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"kind", "username", "db", "ad", "details"}); err != nil {
+		return err
+	}
+
+	for _, entry := range r.Entries {
+		if err := writer.Write([]string{entry.Kind, csvCell(entry.Username), csvCell(entry.DB), csvCell(entry.AD), csvCell(entry.Details)}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvCell добавляет апостроф перед значением, которое начинается с символа формулы.
+// Табуляцию и возврат каретки в начале ячейки Excel тоже пропускает перед разбором формулы
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
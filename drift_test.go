@@ -0,0 +1,37 @@
+package classosbackend
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestDriftReportWriteCSVEscapesFormulas(t *testing.T) {
+	report := DriftReport{Entries: []DriftEntry{{
+		Kind:     DriftDisplayName,
+		Username: "ivanov",
+		DB:       "Ivanov Ivan",
+		AD:       "=cmd|'/c calc'!A1",
+		Details:  "\r@SUM(A1)",
+	}}}
+
+	var b bytes.Buffer
+	if err := report.WriteCSV(&b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want header and one entry", len(records))
+	}
+
+	want := []string{DriftDisplayName, "ivanov", "Ivanov Ivan", "'=cmd|'/c calc'!A1", "'\r@SUM(A1)"}
+	for i, value := range want {
+		if records[1][i] != value {
+			t.Errorf("column %s: got %q, want %q", records[0][i], records[1][i], value)
+		}
+	}
+}
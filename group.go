@@ -8,20 +8,62 @@ import (
 type Group struct {
 	ID   int64  `json:"id" db:"id"`
 	Name string `json:"name" db:"name" binding:"required"`
+	// ArchivedAt задан у архивированной группы: она скрыта из списков и ждёт окончательного удаления
+	ArchivedAt   *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+	ArchivedFrom *string    `json:"-" db:"archived_from"`
 }
 
-type WhitelistEntry struct {
-	ID        int64     `json:"id"`
-	GroupID   int64     `json:"group_id"`
-	Value     string    `json:"value"`
-	CreatedAt time.Time `json:"created_at"`
+// GroupScope - группы, которыми может управлять пользователь: администратор и роли с правом
+// groups.all - всеми, остальные - закреплёнными за ними. ManagesRoles - администратор или роль
+// с правом roles.manage: только они назначают и меняют роли пользователей
+type GroupScope struct {
+	Role         string
+	All          bool
+	ManagesRoles bool
+	GroupIDs     []int
+}
+
+func (s GroupScope) Allows(groupId int) bool {
+	if s.All {
+		return true
+	}
+
+	for _, id := range s.GroupIDs {
+		if id == groupId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ManagesUser сообщает, может ли пользователь с этой областью управлять учётной записью user.
+// Учитель управляет только учениками своих групп
+func (s GroupScope) ManagesUser(user User) bool {
+	if s.All {
+		return true
+	}
+
+	return user.Role == RoleClient && user.GroupID != nil && s.Allows(*user.GroupID)
+}
+
+// ModifiesUser - ManagesUser для изменений: учётную запись администратора меняет, сбрасывает
+// и архивирует только администратор, даже если у роли есть доступ ко всем группам
+func (s GroupScope) ModifiesUser(user User) bool {
+	if user.Role == RoleAdmin && s.Role != RoleAdmin {
+		return false
+	}
+
+	return s.ManagesUser(user)
 }
 
-type Settings struct {
-	ID        int64     `json:"id"`
-	Key       string    `json:"key"`
-	Value     string    `json:"value"`
-	UpdatedAt time.Time `json:"updated_at"`
+type WhitelistEntry struct {
+	ID        int64     `json:"id" db:"id"`
+	GroupID   int64     `json:"group_id" db:"group_id"`
+	Value     string    `json:"value" db:"resource"`
+	EntrySet  string    `json:"entry_set" db:"entry_set"`
+	Action    string    `json:"action" db:"action"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
 type UpdateGroupInput struct {
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
+)
+
+type getAccessRequestsResponse struct {
+	Data []classosbackend.AccessRequest `json:"data"`
+}
+
+func (h *Handler) createAccessRequest(c *gin.Context) {
+	userId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	var input classosbackend.AccessRequestInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	request, err := h.services.AccessRequest.Create(userId, input)
+	if err != nil {
+		newAccessRequestErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+func (h *Handler) getMyAccessRequests(c *gin.Context) {
+	userId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	requests, err := h.services.AccessRequest.GetByUser(userId)
+	if err != nil {
+		newAccessRequestErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getAccessRequestsResponse{
+		Data: requests,
+	})
+}
+
+// getAccessRequests по умолчанию показывает ожидающие запросы; ?status=all снимает фильтр
+func (h *Handler) getAccessRequests(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId := 0
+	if value := c.Query("group_id"); value != "" {
+		groupId, err = strconv.Atoi(value)
+		if err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid group_id param")
+			return
+		}
+	}
+
+	status := c.DefaultQuery("status", classosbackend.AccessRequestPending)
+	if status == "all" {
+		status = ""
+	}
+
+	requests, err := h.services.AccessRequest.GetAll(checkerId, groupId, status)
+	if err != nil {
+		newAccessRequestErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getAccessRequestsResponse{
+		Data: requests,
+	})
+}
+
+func (h *Handler) decideAccessRequest(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	requestId, err := strconv.ParseInt(c.Param("requestId"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid request id in params")
+		return
+	}
+
+	var input classosbackend.AccessDecisionInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	request, err := h.services.AccessRequest.Decide(checkerId, requestId, input)
+	if err != nil {
+		newAccessRequestErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+func newAccessRequestErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, classosbackend.ErrInvalidAccessRequest), errors.Is(err, classosbackend.ErrInvalidWhitelistValue):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		newErrorResponse(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrAccessRequestNotFound), errors.Is(err, service.ErrGroupNotFound),
+		errors.Is(err, service.ErrUserNotFound):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrAccessRequestDecided):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -1,23 +1,157 @@
 package handler
 
 import (
+	"bytes"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
 )
 
-func (h *Handler) syncFromAD(c *gin.Context) {
-	// Предполагаем, что IntegratedUserService имеет метод SyncAllFromAD
-	// Этот метод нужно будет добавить в интерфейс User
-	c.JSON(http.StatusOK, statusResponse{
-		Status: "Sync started",
-	})
+const defaultJournalLimit = 100
+
+// getSyncPlan показывает, что изменит сверка, ничего не меняя. По умолчанию - направление db_to_ad
+func (h *Handler) getSyncPlan(c *gin.Context) {
+	plan, err := h.services.Sync.Plan(c.DefaultQuery("direction", classosbackend.SyncDBToAD))
+	if err != nil {
+		newSyncErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// applySync строит план и применяет его. Изменения AD выполняет очередь каталога, поэтому
+// applied для них значит "поставлено в очередь"
+func (h *Handler) applySync(c *gin.Context) {
+	var input classosbackend.SyncInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	plan, err := h.services.Sync.Apply(input)
+	if err != nil {
+		newSyncErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
 }
 
+// getDirectoryDrift показывает расхождения пользователей БД и AD, ?format=csv возвращает их файлом
+func (h *Handler) getDirectoryDrift(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		newErrorResponse(c, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	report, err := h.services.Drift.Drift()
+	if err != nil {
+		newSyncErrorResponse(c, err)
+		return
+	}
+
+	if format == "csv" {
+		var body bytes.Buffer
+		if err := report.WriteCSV(&body); err != nil {
+			newErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="ad-drift.csv"`)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", body.Bytes())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// checkADConnection показывает каталог, режим работы и число ожидающих и неудавшихся операций
 func (h *Handler) checkADConnection(c *gin.Context) {
-	// Предполагаем, что IntegratedUserService имеет метод ValidateADConnection
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "connected",
-		"message": "AD connection is working",
+	status, err := h.services.DirectoryAdmin.Status()
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+type getDirectoryJournalResponse struct {
+	Data []classosbackend.DirectoryOperation `json:"data"`
+}
+
+// getDirectoryJournal возвращает операции очереди каталога от старых к новым.
+// ?status=failed показывает операции, исчерпавшие попытки
+func (h *Handler) getDirectoryJournal(c *gin.Context) {
+	limit := defaultJournalLimit
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid limit param")
+			return
+		}
+	}
+
+	status := c.DefaultQuery("status", classosbackend.DirectoryOpPending)
+
+	operations, err := h.services.DirectoryAdmin.GetJournal(status, limit)
+	if err != nil {
+		newDirectoryErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getDirectoryJournalResponse{
+		Data: operations,
 	})
 }
+
+func (h *Handler) retryDirectoryOperation(c *gin.Context) {
+	operationId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id param")
+		return
+	}
+
+	operation, err := h.services.DirectoryAdmin.Retry(operationId)
+	if err != nil {
+		newDirectoryErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, operation)
+}
+
+func newDirectoryErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidOperationStatus):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrDirectoryOperationNotFound):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrDirectoryOperationNotFailed):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func newSyncErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, classosbackend.ErrInvalidSync):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrSyncPending), errors.Is(err, service.ErrSyncPlanChanged),
+		errors.Is(err, service.ErrSyncInProgress), errors.Is(err, service.ErrSyncConfirmationRequired),
+		errors.Is(err, service.ErrADOUNotFound):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrADUnavailable):
+		newErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
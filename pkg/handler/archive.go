@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) getArchivedUsers(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	users, err := h.services.Archive.GetUsers(checkerId)
+	if err != nil {
+		newUserErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+func (h *Handler) restoreUser(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	if err := h.services.Archive.RestoreUser(checkerId, userId); err != nil {
+		newUserErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{"ok"})
+}
+
+func (h *Handler) getArchivedGroups(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groups, err := h.services.Archive.GetGroups(checkerId)
+	if err != nil {
+		newGroupErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getAllGroupsResponse{
+		Data: groups,
+	})
+}
+
+func (h *Handler) restoreGroup(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	if err := h.services.Archive.RestoreGroup(checkerId, groupId); err != nil {
+		newGroupErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{"ok"})
+}
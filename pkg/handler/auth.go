@@ -42,17 +42,124 @@ func (h *Handler) signIn(c *gin.Context) {
 		return
 	}
 
-	token, err := h.services.Authorization.GenerateToken(input.Username, input.Password)
+	tokens, err := h.services.Authorization.GenerateToken(input.Username, input.Password)
 	if err != nil {
 		if errors.Is(err, service.ErrInvalidCredentials) {
 			newErrorResponse(c, http.StatusUnauthorized, err.Error()) // 401
 			return
 		}
+		if errors.Is(err, service.ErrUserDisabled) {
+			newErrorResponse(c, http.StatusForbidden, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrPasswordChangeRequired) {
+			// Клиент должен предложить сменить пароль через /auth/change-password
+			c.AbortWithStatusJSON(http.StatusForbidden, signInStateResponse{
+				State:   signInPasswordChangeRequired,
+				Message: err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrADUnavailable) {
+			newErrorResponse(c, http.StatusServiceUnavailable, err.Error()) // 503
+			return
+		}
 		newErrorResponse(c, http.StatusInternalServerError, "something went wrong at server") // 500
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]interface{}{
-		"token": token,
-	})
+	c.JSON(http.StatusOK, tokens)
+}
+
+const signInPasswordChangeRequired = "password_change_required"
+
+type signInStateResponse struct {
+	State   string `json:"state"`
+	Message string `json:"message"`
+}
+
+// changeRequiredPassword принимает текущий пароль вместо токена и после смены пароля выдаёт пару токенов
+func (h *Handler) changeRequiredPassword(c *gin.Context) {
+	var input classosbackend.RequiredPasswordChangeInput
+
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tokens, err := h.services.Profile.ChangeRequiredPassword(input)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			newErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrUserDisabled) {
+			newErrorResponse(c, http.StatusForbidden, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrADUnavailable) {
+			newErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+type refreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func (h *Handler) refreshToken(c *gin.Context) {
+	var input refreshInput
+
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tokens, err := h.services.Authorization.Refresh(input.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			newErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		newErrorResponse(c, http.StatusInternalServerError, "something went wrong at server")
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+type logoutInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+	// Everywhere завершает все сессии пользователя, а не только текущую
+	Everywhere bool `json:"everywhere"`
+}
+
+func (h *Handler) logout(c *gin.Context) {
+	var input logoutInput
+
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.services.Authorization.Logout(input.RefreshToken, input.Everywhere); err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			newErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		newErrorResponse(c, http.StatusInternalServerError, "something went wrong at server")
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{"ok"})
 }
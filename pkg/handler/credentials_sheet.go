@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
+)
+
+// createCredentialsSheet возвращает PDF с карточками учеников группы. Тело запроса необязательно;
+// при reset_passwords число учеников, которым не удалось сменить пароль, передаётся в X-Password-Reset-Failed
+func (h *Handler) createCredentialsSheet(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	var input classosbackend.CredentialsSheetInput
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&input); err != nil {
+			newErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	sheet, err := h.services.CredentialsSheet.Generate(checkerId, groupId, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrForbidden):
+			newErrorResponse(c, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrGroupNotFound), errors.Is(err, service.ErrNoStudents):
+			newErrorResponse(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrADUnavailable):
+			newErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+		default:
+			newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	// Лист может содержать пароли: его нельзя кешировать ни браузеру, ни прокси
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", `attachment; filename="`+sheet.Filename+`"`)
+	if input.ResetPasswords {
+		c.Header("X-Password-Reset-Failed", strconv.Itoa(sheet.ResetFailed))
+	}
+	c.Data(http.StatusOK, "application/pdf", sheet.Body)
+}
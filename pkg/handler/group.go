@@ -1,11 +1,13 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
 )
 
 func (h *Handler) createGroup(c *gin.Context) {
@@ -22,7 +24,7 @@ func (h *Handler) createGroup(c *gin.Context) {
 
 	id, err := h.services.Group.Create(checkerId, input)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newGroupErrorResponse(c, err)
 		return
 	}
 
@@ -44,7 +46,7 @@ func (h *Handler) getAllGroups(c *gin.Context) {
 
 	groups, err := h.services.Group.GetAll(checkerId)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newGroupErrorResponse(c, err)
 		return
 	}
 
@@ -67,7 +69,7 @@ func (h *Handler) getGroupById(c *gin.Context) {
 
 	group, err := h.services.Group.GetById(checkerId, id)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newGroupErrorResponse(c, err)
 		return
 	}
 
@@ -95,7 +97,7 @@ func (h *Handler) updateGroup(c *gin.Context) {
 
 
 	if err := h.services.Group.Update(checkerId, id, input); err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newGroupErrorResponse(c, err)
 		return
 	}
 
@@ -118,11 +120,27 @@ func (h *Handler) deleteGroup(c *gin.Context) {
 
 	err = h.services.Group.Delete(checkerId, id)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newGroupErrorResponse(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, statusResponse{
 		Status: "ok",
 	})
-}
\ No newline at end of file
+}
+func newGroupErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		newErrorResponse(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrGroupNotFound):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrArchived), errors.Is(err, service.ErrNotArchived):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrArchiveExpired):
+		newErrorResponse(c, http.StatusGone, err.Error())
+	case errors.Is(err, service.ErrADUnavailable):
+		newErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -3,6 +3,7 @@ package handler
 
 import (
 	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/rinat0880/classOS_backend/pkg/service"
 )
 
@@ -21,37 +22,123 @@ func (h *Handler) InitRoutes() *gin.Engine {
 	{
 		auth.POST("/sign-up", h.signUp)
 		auth.POST("/sign-in", h.signIn)
+		auth.POST("/change-password", h.changeRequiredPassword)
+		auth.POST("/refresh", h.refreshToken)
+		auth.POST("/logout", h.logout)
 	}
 
-	api := router.Group("/api", h.userIdentity, h.adminOnly)
+	// Запросы доступа подают ученики, поэтому эти маршруты не требуют прав сотрудника
+	clientRequests := router.Group("/api/access-requests", h.userIdentity, h.require(classosbackend.PermissionAccessRequestsCreate))
 	{
+		clientRequests.POST("/", h.createAccessRequest)
+		clientRequests.GET("/my", h.getMyAccessRequests)
+	}
+
+	// Область групп (все или закреплённые) дополнительно проверяют сервисы
+	api := router.Group("/api", h.userIdentity)
+	{
+		// Свою учётную запись может посмотреть любой вошедший пользователь
+		me := api.Group("/me")
+		{
+			me.GET("/", h.getMe)
+			me.POST("/password", h.changeMyPassword)
+			me.GET("/whitelist", h.getMyWhitelist)
+			me.GET("/sessions", h.getMySessions)
+		}
+
 		groups := api.Group("/groups")
 		{
-			groups.GET("/", h.getAllGroups)
-			groups.POST("/", h.createGroup)
-			groups.GET("/:id", h.getGroupById)
-			groups.PATCH("/:id", h.updateGroup)
-			groups.DELETE("/:id", h.deleteGroup)
+			groups.GET("/", h.require(classosbackend.PermissionGroupsRead), h.getAllGroups)
+			groups.POST("/", h.require(classosbackend.PermissionGroupsManage), h.createGroup)
+			groups.GET("/archived", h.require(classosbackend.PermissionGroupsRead), h.getArchivedGroups)
+			groups.GET("/:id", h.require(classosbackend.PermissionGroupsRead), h.getGroupById)
+			groups.PATCH("/:id", h.require(classosbackend.PermissionGroupsManage), h.updateGroup)
+			groups.DELETE("/:id", h.require(classosbackend.PermissionGroupsManage), h.deleteGroup)
+			groups.POST("/:id/restore", h.require(classosbackend.PermissionGroupsManage), h.restoreGroup)
+			groups.GET("/:id/policy", h.require(classosbackend.PermissionPolicyRead), h.getGroupPolicy)
+			groups.POST("/:id/credentials-sheet", h.require(classosbackend.PermissionUsersWrite), h.createCredentialsSheet)
 
 			users := groups.Group(":id/users")
 			{
-				users.POST("/", h.createUser)
+				users.POST("/", h.require(classosbackend.PermissionUsersWrite), h.createUser)
+			}
+
+			whitelist := groups.Group(":id/whitelist")
+			{
+				whitelist.GET("/", h.require(classosbackend.PermissionWhitelistRead), h.getGroupWhitelist)
+				whitelist.GET("/export", h.require(classosbackend.PermissionPolicyRead), h.exportWhitelist)
+				whitelist.POST("/", h.require(classosbackend.PermissionWhitelistEdit), h.addWhitelistEntries)
+				whitelist.PUT("/", h.require(classosbackend.PermissionWhitelistEdit), h.replaceWhitelist)
+				whitelist.DELETE("/", h.require(classosbackend.PermissionWhitelistEdit), h.deleteWhitelistEntries)
+				whitelist.DELETE("/:entryId", h.require(classosbackend.PermissionWhitelistEdit), h.deleteWhitelistEntry)
+			}
+
+			schedules := groups.Group(":id/schedules")
+			{
+				schedules.GET("/", h.require(classosbackend.PermissionWhitelistRead), h.getGroupSchedules)
+				schedules.POST("/", h.require(classosbackend.PermissionWhitelistEdit), h.createSchedule)
+				schedules.PUT("/:ruleId", h.require(classosbackend.PermissionWhitelistEdit), h.updateSchedule)
+				schedules.DELETE("/:ruleId", h.require(classosbackend.PermissionWhitelistEdit), h.deleteSchedule)
 			}
 		}
 
 		users := api.Group("/users")
 		{
-			users.GET("/", h.getAllUsers)
-			users.GET("/:id", h.getUserById)
-			users.PATCH("/:id", h.updateUser)
-			users.DELETE("/:id", h.deleteUser)
-			users.POST("/:id/password", h.changePassword)
+			users.GET("/", h.require(classosbackend.PermissionUsersRead), h.getAllUsers)
+			users.POST("/import", h.require(classosbackend.PermissionUsersWrite), h.importUsers)
+			users.POST("/password-reset", h.require(classosbackend.PermissionUsersWrite), h.resetPasswords)
+			users.GET("/archived", h.require(classosbackend.PermissionUsersRead), h.getArchivedUsers)
+			users.GET("/:id", h.require(classosbackend.PermissionUsersRead), h.getUserById)
+			users.PATCH("/:id", h.require(classosbackend.PermissionUsersWrite), h.updateUser)
+			users.DELETE("/:id", h.require(classosbackend.PermissionUsersWrite), h.deleteUser)
+			users.POST("/:id/password", h.require(classosbackend.PermissionUsersWrite), h.changePassword)
+			users.POST("/:id/disable", h.require(classosbackend.PermissionUsersWrite), h.disableUser)
+			users.POST("/:id/enable", h.require(classosbackend.PermissionUsersWrite), h.enableUser)
+			users.POST("/:id/restore", h.require(classosbackend.PermissionUsersWrite), h.restoreUser)
+		}
+
+		accessRequests := api.Group("/access-requests", h.require(classosbackend.PermissionAccessRequestsDecide))
+		{
+			accessRequests.GET("/", h.getAccessRequests)
+			accessRequests.POST("/:requestId/decision", h.decideAccessRequest)
+		}
+
+		api.GET("/teachers/:id/groups", h.require(classosbackend.PermissionGroupsRead), h.getTeacherGroups)
+
+		policy := api.Group("/policy")
+		{
+			policy.GET("/check", h.checkPolicy)
 		}
 
 		admin := api.Group("/admin")
 		{
-			admin.POST("/sync", h.syncFromAD)
-			admin.GET("/ad/status", h.checkADConnection)
+			admin.POST("/sync", h.require(classosbackend.PermissionADSync), h.applySync)
+			admin.GET("/sync/plan", h.require(classosbackend.PermissionADSync), h.getSyncPlan)
+			admin.GET("/ad/status", h.require(classosbackend.PermissionADSync), h.checkADConnection)
+			admin.GET("/ad/drift", h.require(classosbackend.PermissionADSync), h.getDirectoryDrift)
+			admin.GET("/ad/journal", h.require(classosbackend.PermissionADSync), h.getDirectoryJournal)
+			admin.POST("/ad/journal/:id/retry", h.require(classosbackend.PermissionADSync), h.retryDirectoryOperation)
+			admin.GET("/settings", h.require(classosbackend.PermissionSettingsRead), h.getSettings)
+			admin.PUT("/settings", h.require(classosbackend.PermissionSettingsWrite), h.updateSettings)
+			admin.PUT("/teachers/:id/groups", h.require(classosbackend.PermissionTeachersManage), h.setTeacherGroups)
+
+			globalWhitelist := admin.Group("/whitelist")
+			{
+				globalWhitelist.GET("/", h.require(classosbackend.PermissionWhitelistRead), h.getGlobalWhitelist)
+				globalWhitelist.POST("/", h.require(classosbackend.PermissionWhitelistGlobal), h.addGlobalWhitelistEntries)
+				globalWhitelist.PUT("/", h.require(classosbackend.PermissionWhitelistGlobal), h.replaceGlobalWhitelist)
+				globalWhitelist.DELETE("/", h.require(classosbackend.PermissionWhitelistGlobal), h.deleteGlobalWhitelistEntries)
+				globalWhitelist.DELETE("/:entryId", h.require(classosbackend.PermissionWhitelistGlobal), h.deleteGlobalWhitelistEntry)
+			}
+
+			roles := admin.Group("/roles", h.require(classosbackend.PermissionRolesManage))
+			{
+				roles.GET("/", h.getRoles)
+				roles.GET("/permissions", h.getPermissions)
+				roles.POST("/", h.createRole)
+				roles.PATCH("/:name", h.updateRole)
+				roles.DELETE("/:name", h.deleteRole)
+			}
 		}
 	}
 	return router
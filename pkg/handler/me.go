@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
+)
+
+type getSessionsResponse struct {
+	Data []classosbackend.Session `json:"data"`
+}
+
+func (h *Handler) getMe(c *gin.Context) {
+	identity, err := getIdentity(c)
+	if err != nil {
+		return
+	}
+
+	profile, err := h.services.Profile.Get(identity)
+	if err != nil {
+		newProfileErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// changeMyPassword возвращает новую пару токенов: смена пароля завершает все входы, включая текущий
+func (h *Handler) changeMyPassword(c *gin.Context) {
+	userId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	var input classosbackend.ChangeOwnPasswordInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tokens, err := h.services.Profile.ChangePassword(userId, input)
+	if err != nil {
+		newProfileErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *Handler) getMyWhitelist(c *gin.Context) {
+	userId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	// Без ?at= сервис сравнивает сроки разрешений со временем БД
+	var at time.Time
+	if c.Query("at") != "" {
+		at, err = parseAtQuery(c)
+		if err != nil {
+			newErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	whitelist, err := h.services.Profile.GetWhitelist(userId, at)
+	if err != nil {
+		newProfileErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, whitelist)
+}
+
+func (h *Handler) getMySessions(c *gin.Context) {
+	identity, err := getIdentity(c)
+	if err != nil {
+		return
+	}
+
+	sessions, err := h.services.Profile.GetSessions(identity)
+	if err != nil {
+		newProfileErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getSessionsResponse{
+		Data: sessions,
+	})
+}
+
+func newProfileErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrWrongCurrentPassword):
+		newErrorResponse(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrNoGroup), errors.Is(err, service.ErrGroupNotFound):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrADUnavailable):
+		newErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -6,11 +6,13 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
 )
 
 const (
 	authorizationHeader = "Authorization"
 	userCtx = "checkerId"
+	identityCtx = "identity"
 )
 
 func (h *Handler) userIdentity(c *gin.Context) {
@@ -26,14 +28,15 @@ func (h *Handler) userIdentity(c *gin.Context) {
 		return
 	}
 
-	checkerId, role, err := h.services.Authorization.ParseToken(headerParts[1])
+	identity, err := h.services.Authorization.ParseToken(headerParts[1])
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Set("checkerId", checkerId)
-	c.Set("role", role)
+	c.Set("checkerId", identity.UserID)
+	c.Set("role", identity.Role)
+	c.Set(identityCtx, identity)
 	c.Next()
 }
 
@@ -53,19 +56,31 @@ func getUserId(c *gin.Context) (int, error) {
 	return idInt, nil
 }
 
-func (h *Handler) adminOnly(c *gin.Context) {
-	roleVal, exists := c.Get("role")
-	if !exists {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "role not found"})
-		return
-	}
-
-	role := roleVal.(string)
-	if role != "admin" {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
-		return
+func getIdentity(c *gin.Context) (classosbackend.Identity, error) {
+	identity, ok := c.Get(identityCtx)
+	if !ok {
+		newErrorResponse(c, http.StatusInternalServerError, "identity not found")
+		return classosbackend.Identity{}, errors.New("identity not found")
 	}
 
-	c.Next()
+	return identity.(classosbackend.Identity), nil
 }
 
+// require пропускает запрос, только если в access-токене есть право permission
+func (h *Handler) require(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identityVal, exists := c.Get(identityCtx)
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "identity not found"})
+			return
+		}
+
+		identity := identityVal.(classosbackend.Identity)
+		if !identity.Can(permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission required: " + permission})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
+)
+
+func (h *Handler) checkPolicy(c *gin.Context) {
+	var input classosbackend.PolicyCheckInput
+	if err := c.BindQuery(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	identity, err := getIdentity(c)
+	if err != nil {
+		return
+	}
+
+	decision, err := h.services.Policy.Check(identity, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidURL):
+			newErrorResponse(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrForbidden):
+			newErrorResponse(c, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrUserNotFound):
+			newErrorResponse(c, http.StatusNotFound, err.Error())
+		default:
+			newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, decision)
+}
+
+func (h *Handler) getGroupPolicy(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	at, err := parseAtQuery(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	preview, err := h.services.Policy.Preview(checkerId, groupId, at)
+	if err != nil {
+		newWhitelistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+func (h *Handler) exportWhitelist(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	at, err := parseAtQuery(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := c.DefaultQuery("format", classosbackend.ExportFormatJSON)
+
+	export, err := h.services.Policy.Export(checkerId, groupId, format, at)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnsupportedExportFormat):
+			newErrorResponse(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrForbidden):
+			newErrorResponse(c, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrGroupNotFound):
+			newErrorResponse(c, http.StatusNotFound, err.Error())
+		default:
+			newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.Header("ETag", export.ETag)
+	c.Header("Cache-Control", "no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), export.ETag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, export.ContentType, export.Body)
+}
+
+// etagMatches разбирает If-None-Match, который может содержать список тегов или *
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseAtQuery читает момент времени из ?at= в формате RFC3339, по умолчанию текущий
+func parseAtQuery(c *gin.Context) (time.Time, error) {
+	value := c.Query("at")
+	if value == "" {
+		return time.Now(), nil
+	}
+
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("invalid at param: expected RFC3339 timestamp")
+	}
+
+	return at, nil
+}
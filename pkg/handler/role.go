@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
+)
+
+type getRolesResponse struct {
+	Data []classosbackend.Role `json:"data"`
+}
+
+type getPermissionsResponse struct {
+	Data []classosbackend.PermissionDefinition `json:"data"`
+}
+
+func (h *Handler) getRoles(c *gin.Context) {
+	roles, err := h.services.Role.GetAll()
+	if err != nil {
+		newRoleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getRolesResponse{
+		Data: roles,
+	})
+}
+
+func (h *Handler) getPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, getPermissionsResponse{
+		Data: h.services.Role.GetPermissions(),
+	})
+}
+
+func (h *Handler) createRole(c *gin.Context) {
+	var input classosbackend.Role
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	role, err := h.services.Role.Create(input)
+	if err != nil {
+		newRoleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+func (h *Handler) updateRole(c *gin.Context) {
+	var input classosbackend.UpdateRoleInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	role, err := h.services.Role.Update(c.Param("name"), input)
+	if err != nil {
+		newRoleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+func (h *Handler) deleteRole(c *gin.Context) {
+	if err := h.services.Role.Delete(c.Param("name")); err != nil {
+		newRoleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{"ok"})
+}
+
+func newRoleErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, classosbackend.ErrInvalidRole):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrRoleNotFound):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrRoleExists), errors.Is(err, service.ErrRoleProtected), errors.Is(err, service.ErrRoleInUse):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
+)
+
+type getSchedulesResponse struct {
+	Data []classosbackend.ScheduleRule `json:"data"`
+}
+
+func (h *Handler) getGroupSchedules(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	rules, err := h.services.Schedule.GetAll(checkerId, groupId)
+	if err != nil {
+		newScheduleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getSchedulesResponse{
+		Data: rules,
+	})
+}
+
+func (h *Handler) createSchedule(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	var input classosbackend.ScheduleRule
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := h.services.Schedule.Create(checkerId, groupId, input)
+	if err != nil {
+		newScheduleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"id": id,
+	})
+}
+
+func (h *Handler) updateSchedule(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	ruleId, err := strconv.ParseInt(c.Param("ruleId"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid rule id in params")
+		return
+	}
+
+	var input classosbackend.ScheduleRule
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.services.Schedule.Update(checkerId, groupId, ruleId, input); err != nil {
+		newScheduleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{"ok"})
+}
+
+func (h *Handler) deleteSchedule(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	ruleId, err := strconv.ParseInt(c.Param("ruleId"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid rule id in params")
+		return
+	}
+
+	if err := h.services.Schedule.Delete(checkerId, groupId, ruleId); err != nil {
+		newScheduleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{"ok"})
+}
+
+func newScheduleErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, classosbackend.ErrInvalidSchedule):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		newErrorResponse(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrGroupNotFound), errors.Is(err, service.ErrScheduleNotFound):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
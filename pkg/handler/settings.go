@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type getSettingsResponse struct {
+	Data []classosbackend.SettingValue `json:"data"`
+}
+
+func (h *Handler) getSettings(c *gin.Context) {
+	settings, err := h.services.Settings.GetAll()
+	if err != nil {
+		newSettingsErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getSettingsResponse{
+		Data: settings,
+	})
+}
+
+func (h *Handler) updateSettings(c *gin.Context) {
+	var input classosbackend.UpdateSettingsInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	settings, err := h.services.Settings.Update(input)
+	if err != nil {
+		newSettingsErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getSettingsResponse{
+		Data: settings,
+	})
+}
+
+func newSettingsErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, classosbackend.ErrInvalidSetting), errors.Is(err, classosbackend.ErrUnknownSetting):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
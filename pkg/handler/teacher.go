@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
+)
+
+type getTeacherGroupsResponse struct {
+	Data []classosbackend.Group `json:"data"`
+}
+
+func (h *Handler) getTeacherGroups(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	teacherId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	groups, err := h.services.Teacher.GetGroups(checkerId, teacherId)
+	if err != nil {
+		newTeacherErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getTeacherGroupsResponse{
+		Data: groups,
+	})
+}
+
+func (h *Handler) setTeacherGroups(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	teacherId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	var input classosbackend.TeacherGroupsInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	groups, err := h.services.Teacher.SetGroups(checkerId, teacherId, input)
+	if err != nil {
+		newTeacherErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getTeacherGroupsResponse{
+		Data: groups,
+	})
+}
+
+func newTeacherErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrNotTeacher):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		newErrorResponse(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrGroupNotFound):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -1,11 +1,13 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
 )
 
 func (h *Handler) createUser(c *gin.Context) {
@@ -20,21 +22,19 @@ func (h *Handler) createUser(c *gin.Context) {
 		return
 	}
 
-	var input classosbackend.User
+	var input classosbackend.CreateUserInput
 	if err := c.BindJSON(&input); err != nil {
 		newErrorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	id, err := h.services.User.Create(checkerId, groupId, input)
+	created, err := h.services.User.Create(checkerId, groupId, input.User())
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newUserErrorResponse(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]interface{}{
-		"id": id,
-	})
+	c.JSON(http.StatusOK, created)
 }
 
 func (h *Handler) getAllUsers(c *gin.Context) {
@@ -45,7 +45,7 @@ func (h *Handler) getAllUsers(c *gin.Context) {
 
 	users, err := h.services.User.GetAll(checkerId)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newUserErrorResponse(c, err)
 		return
 	}
 
@@ -66,7 +66,7 @@ func (h *Handler) getUserById(c *gin.Context) {
 
 	user, err := h.services.User.GetById(checkerId, user_id)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newUserErrorResponse(c, err)
 		return
 	}
 
@@ -91,9 +91,15 @@ func (h *Handler) updateUser(c *gin.Context) {
 		return
 	}
 
+	if input.Username != nil {
+		if err := classosbackend.ValidateUsername(*input.Username); err != nil {
+			newErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 
 	if err := h.services.User.Update(checkerId, id, input); err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newUserErrorResponse(c, err)
 		return
 	}
 
@@ -116,7 +122,7 @@ func (h *Handler) deleteUser(c *gin.Context) {
 
 	err = h.services.User.Delete(checkerId, user_id)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newUserErrorResponse(c, err)
 		return
 	}
 
@@ -149,7 +155,7 @@ func (h *Handler) changePassword(c *gin.Context) {
 	}
 
 	if err := h.services.User.Update(checkerId, userId, updateInput); err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newUserErrorResponse(c, err)
 		return
 	}
 
@@ -157,3 +163,77 @@ func (h *Handler) changePassword(c *gin.Context) {
 		Status: "Password changed successfully",
 	})
 }
+
+func (h *Handler) disableUser(c *gin.Context) {
+	h.setUserEnabled(c, false)
+}
+
+func (h *Handler) enableUser(c *gin.Context) {
+	h.setUserEnabled(c, true)
+}
+
+func (h *Handler) setUserEnabled(c *gin.Context, enabled bool) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	if err := h.services.User.SetEnabled(checkerId, userId, enabled); err != nil {
+		newUserErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{"ok"})
+}
+
+// resetPasswords возвращает новые пароли в ответе: сервер их не хранит, повторно получить их нельзя
+func (h *Handler) resetPasswords(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	var input classosbackend.PasswordResetInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.services.PasswordReset.Reset(checkerId, input)
+	if err != nil {
+		newUserErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, report)
+}
+
+func newUserErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrForbidden), errors.Is(err, service.ErrDisableSelf), errors.Is(err, service.ErrArchiveSelf),
+		errors.Is(err, service.ErrArchiveAdmin):
+		newErrorResponse(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrGroupNotFound), errors.Is(err, service.ErrNoStudents):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrNoFreeUsername), errors.Is(err, service.ErrUsernameTaken), errors.Is(err, service.ErrArchived), errors.Is(err, service.ErrNotArchived):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrArchiveExpired):
+		newErrorResponse(c, http.StatusGone, err.Error())
+	case errors.Is(err, service.ErrADUnavailable):
+		newErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
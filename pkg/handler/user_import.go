@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
+)
+
+const maxImportFileSize = 10 << 20
+
+// importUsers принимает файл в поле file формы multipart/form-data.
+// ?dry_run=true только проверяет строки, ?format=csv возвращает отчёт файлом
+func (h *Handler) importUsers(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	dryRun := false
+	if value := c.Query("dry_run"); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid dry_run param")
+			return
+		}
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		newErrorResponse(c, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "file is required: "+err.Error())
+		return
+	}
+	if fileHeader.Size > maxImportFileSize {
+		newErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("file must be at most %d MB", maxImportFileSize>>20))
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.services.UserImport.Import(checkerId, data, dryRun)
+	if err != nil {
+		switch {
+		case errors.Is(err, classosbackend.ErrInvalidImport):
+			newErrorResponse(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrForbidden):
+			newErrorResponse(c, http.StatusForbidden, err.Error())
+		default:
+			newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	if format == "csv" {
+		var body bytes.Buffer
+		if err := report.WriteCSV(&body); err != nil {
+			newErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="import-report.csv"`)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", body.Bytes())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/service"
+)
+
+type getWhitelistResponse struct {
+	Data []classosbackend.WhitelistEntry `json:"data"`
+}
+
+func (h *Handler) getGroupWhitelist(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	entries, err := h.services.Whitelist.GetAll(checkerId, groupId, c.Query("entry_set"))
+	if err != nil {
+		newWhitelistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getWhitelistResponse{
+		Data: entries,
+	})
+}
+
+func (h *Handler) addWhitelistEntries(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	var input classosbackend.WhitelistInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := h.services.Whitelist.Add(checkerId, groupId, input)
+	if err != nil {
+		newWhitelistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getWhitelistResponse{
+		Data: entries,
+	})
+}
+
+func (h *Handler) replaceWhitelist(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	var input classosbackend.WhitelistInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := h.services.Whitelist.Replace(checkerId, groupId, input)
+	if err != nil {
+		newWhitelistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getWhitelistResponse{
+		Data: entries,
+	})
+}
+
+func (h *Handler) deleteWhitelistEntries(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	var input classosbackend.WhitelistInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deleted, err := h.services.Whitelist.DeleteValues(checkerId, groupId, input)
+	if err != nil {
+		newWhitelistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"deleted": deleted,
+	})
+}
+
+func (h *Handler) deleteWhitelistEntry(c *gin.Context) {
+	checkerId, err := getUserId(c)
+	if err != nil {
+		return
+	}
+
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id in params")
+		return
+	}
+
+	entryId, err := strconv.ParseInt(c.Param("entryId"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid entry id in params")
+		return
+	}
+
+	if err := h.services.Whitelist.Delete(checkerId, groupId, entryId); err != nil {
+		newWhitelistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{"ok"})
+}
+
+type getGlobalWhitelistResponse struct {
+	Data []classosbackend.GlobalWhitelistEntry `json:"data"`
+}
+
+func (h *Handler) getGlobalWhitelist(c *gin.Context) {
+	entries, err := h.services.Whitelist.GetGlobal()
+	if err != nil {
+		newWhitelistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getGlobalWhitelistResponse{
+		Data: entries,
+	})
+}
+
+func (h *Handler) addGlobalWhitelistEntries(c *gin.Context) {
+	var input classosbackend.WhitelistInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := h.services.Whitelist.AddGlobal(input)
+	if err != nil {
+		newWhitelistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getGlobalWhitelistResponse{
+		Data: entries,
+	})
+}
+
+func (h *Handler) replaceGlobalWhitelist(c *gin.Context) {
+	var input classosbackend.WhitelistInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := h.services.Whitelist.ReplaceGlobal(input)
+	if err != nil {
+		newWhitelistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getGlobalWhitelistResponse{
+		Data: entries,
+	})
+}
+
+func (h *Handler) deleteGlobalWhitelistEntries(c *gin.Context) {
+	var input classosbackend.WhitelistInput
+	if err := c.BindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deleted, err := h.services.Whitelist.DeleteGlobalValues(input)
+	if err != nil {
+		newWhitelistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"deleted": deleted,
+	})
+}
+
+func (h *Handler) deleteGlobalWhitelistEntry(c *gin.Context) {
+	entryId, err := strconv.ParseInt(c.Param("entryId"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid entry id in params")
+		return
+	}
+
+	if err := h.services.Whitelist.DeleteGlobal(entryId); err != nil {
+		newWhitelistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{"ok"})
+}
+
+func newWhitelistErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, classosbackend.ErrInvalidWhitelistValue):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		newErrorResponse(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrGroupNotFound), errors.Is(err, service.ErrWhitelistEntryNotFound):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
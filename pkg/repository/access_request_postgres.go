@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type AccessRequestPostgres struct {
+	db *sqlx.DB
+}
+
+func NewAccessRequestPostgres(db *sqlx.DB) *AccessRequestPostgres {
+	return &AccessRequestPostgres{db: db}
+}
+
+const accessRequestColumns = `
+	r.id, r.user_id, u.username, r.group_id, r.url, r.resource, r.justification, r.status,
+	r.comment, r.decided_by, r.decided_at, r.expires_at, r.created_at`
+
+// Create сохраняет запрос; повторный запрос того же ресурса, пока первый ждёт решения,
+// обновляет обоснование вместо создания дубля
+func (r *AccessRequestPostgres) Create(request classosbackend.AccessRequest) (int64, error) {
+	var id int64
+	query := fmt.Sprintf(`
+		INSERT INTO %s (user_id, group_id, url, resource, justification)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, resource) WHERE status = 'pending'
+		DO UPDATE SET url = EXCLUDED.url, justification = EXCLUDED.justification, group_id = EXCLUDED.group_id
+		RETURNING id`, accessRequestsTable)
+	row := r.db.QueryRow(query, request.UserID, request.GroupID, request.URL, request.Value, request.Justification)
+	if err := row.Scan(&id); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *AccessRequestPostgres) GetById(requestId int64) (classosbackend.AccessRequest, error) {
+	var request classosbackend.AccessRequest
+	query := fmt.Sprintf(`
+		SELECT %s FROM %s r
+		JOIN %s u ON u.id = r.user_id
+		WHERE r.id = $1`, accessRequestColumns, accessRequestsTable, usersTable)
+	err := r.db.Get(&request, query, requestId)
+	return request, err
+}
+
+func (r *AccessRequestPostgres) GetAll(groupIds []int, status string) ([]classosbackend.AccessRequest, error) {
+	requests := make([]classosbackend.AccessRequest, 0)
+	query := fmt.Sprintf(`
+		SELECT %s FROM %s r
+		JOIN %s u ON u.id = r.user_id
+		WHERE ($1::int[] IS NULL OR r.group_id = ANY($1)) AND ($2 = '' OR r.status = $2)
+		ORDER BY r.created_at DESC`, accessRequestColumns, accessRequestsTable, usersTable)
+	err := r.db.Select(&requests, query, pq.Array(groupIds), status)
+	return requests, err
+}
+
+func (r *AccessRequestPostgres) GetByUser(userId int) ([]classosbackend.AccessRequest, error) {
+	requests := make([]classosbackend.AccessRequest, 0)
+	query := fmt.Sprintf(`
+		SELECT %s FROM %s r
+		JOIN %s u ON u.id = r.user_id
+		WHERE r.user_id = $1
+		ORDER BY r.created_at DESC`, accessRequestColumns, accessRequestsTable, usersTable)
+	err := r.db.Select(&requests, query, userId)
+	return requests, err
+}
+
+// GetGrants возвращает разовые разрешения пользователя, не истёкшие к моменту at;
+// нулевой at - текущее время БД, от которого ApproveOnce отсчитывает срок
+func (r *AccessRequestPostgres) GetGrants(userId int, at time.Time) ([]classosbackend.AccessRequest, error) {
+	requests := make([]classosbackend.AccessRequest, 0)
+	query := fmt.Sprintf(`
+		SELECT %s FROM %s r
+		JOIN %s u ON u.id = r.user_id
+		WHERE r.user_id = $1 AND r.status = $2 AND r.expires_at > COALESCE($3, now())
+		ORDER BY r.resource`, accessRequestColumns, accessRequestsTable, usersTable)
+	err := r.db.Select(&requests, query, userId, classosbackend.AccessRequestApprovedOnce, sql.NullTime{Time: at, Valid: !at.IsZero()})
+	return requests, err
+}
+
+// ApproveOnce отсчитывает срок разрешения от времени БД, чтобы расхождение часов приложения и БД
+// не укорачивало и не продлевало его
+func (r *AccessRequestPostgres) ApproveOnce(requestId int64, decidedBy int, duration time.Duration, comment string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET status = $1, decided_by = $2, decided_at = now(), expires_at = now() + make_interval(secs => $3), comment = $4
+		WHERE id = $5 AND status = $6`, accessRequestsTable)
+	res, err := r.db.Exec(query, classosbackend.AccessRequestApprovedOnce, decidedBy, duration.Seconds(), comment,
+		requestId, classosbackend.AccessRequestPending)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// ApprovePermanent закрывает запрос и добавляет ресурс в whitelist группы в одной транзакции
+func (r *AccessRequestPostgres) ApprovePermanent(requestId int64, decidedBy int, entrySet, value, comment string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var groupId int
+	query := fmt.Sprintf(`
+		UPDATE %s SET status = $1, decided_by = $2, decided_at = now(), resource = $3, comment = $4
+		WHERE id = $5 AND status = $6
+		RETURNING group_id`, accessRequestsTable)
+	row := tx.QueryRow(query, classosbackend.AccessRequestApproved, decidedBy, value, comment,
+		requestId, classosbackend.AccessRequestPending)
+	if err := row.Scan(&groupId); err != nil {
+		return err
+	}
+
+	if err := insertWhitelistValues(tx, groupId, entrySet, classosbackend.WhitelistActionAllow, []string{value}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *AccessRequestPostgres) Reject(requestId int64, decidedBy int, comment string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET status = $1, decided_by = $2, decided_at = now(), comment = $3
+		WHERE id = $4 AND status = $5`, accessRequestsTable)
+	res, err := r.db.Exec(query, classosbackend.AccessRequestRejected, decidedBy, comment,
+		requestId, classosbackend.AccessRequestPending)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
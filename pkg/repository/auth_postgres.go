@@ -25,10 +25,114 @@ func (r *AuthPostgres) CreateUser(user classosbackend.User) (int, error) {
 	return id, nil
 }
 
-func (r *AuthPostgres) GetUser(username, password string) (classosbackend.User, error) {
+// GetUser возвращает пользователя вместе с хешем пароля; сам пароль проверяет сервис
+func (r *AuthPostgres) GetUser(username string) (classosbackend.User, error) {
 	var user classosbackend.User
-	query := fmt.Sprintf("SELECT id, role FROM %s WHERE username=$1 AND password_hash=$2", usersTable)
-	err := r.db.Get(&user, query, username, password)
-	
+	query := fmt.Sprintf("SELECT id, role, password_hash, token_version, must_change_password, enabled, archived_at FROM %s WHERE username=$1", usersTable)
+	err := r.db.Get(&user, query, username)
+
+	return user, err
+}
+
+func (r *AuthPostgres) UpdatePasswordHash(userId int, passwordHash string) error {
+	query := fmt.Sprintf("UPDATE %s SET password_hash = $1 WHERE id = $2", usersTable)
+	res, err := r.db.Exec(query, passwordHash, userId)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// GetTokenState возвращает актуальные роль и версию токенов пользователя
+func (r *AuthPostgres) GetTokenState(userId int) (classosbackend.User, error) {
+	var user classosbackend.User
+	query := fmt.Sprintf("SELECT id, role, token_version FROM %s WHERE id = $1", usersTable)
+	err := r.db.Get(&user, query, userId)
 	return user, err
 }
+
+func (r *AuthPostgres) CreateRefreshToken(token classosbackend.RefreshToken) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (user_id, token_hash, family, token_version, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`, refreshTokensTable)
+	_, err := r.db.Exec(query, token.UserID, token.TokenHash, token.Family, token.TokenVersion, token.ExpiresAt)
+	return err
+}
+
+func (r *AuthPostgres) GetRefreshToken(tokenHash string) (classosbackend.RefreshToken, error) {
+	var token classosbackend.RefreshToken
+	query := fmt.Sprintf(`
+		SELECT id, user_id, token_hash, family, token_version, expires_at, revoked_at, created_at
+		FROM %s WHERE token_hash = $1`, refreshTokensTable)
+	err := r.db.Get(&token, query, tokenHash)
+	return token, err
+}
+
+// RotateRefreshToken отзывает использованный токен и выдаёт следующий в той же цепочке.
+// Если токен уже отозван параллельным запросом, возвращает sql.ErrNoRows
+func (r *AuthPostgres) RotateRefreshToken(oldId int64, token classosbackend.RefreshToken) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	revokeQuery := fmt.Sprintf("UPDATE %s SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL", refreshTokensTable)
+	res, err := tx.Exec(revokeQuery, oldId)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return err
+	}
+
+	insertQuery := fmt.Sprintf(`
+		INSERT INTO %s (user_id, token_hash, family, token_version, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`, refreshTokensTable)
+	if _, err := tx.Exec(insertQuery, token.UserID, token.TokenHash, token.Family, token.TokenVersion, token.ExpiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *AuthPostgres) RevokeRefreshTokenFamily(family string) error {
+	query := fmt.Sprintf("UPDATE %s SET revoked_at = now() WHERE family = $1 AND revoked_at IS NULL", refreshTokensTable)
+	_, err := r.db.Exec(query, family)
+	return err
+}
+
+// RevokeUserTokens делает недействительными все access- и refresh-токены пользователя
+func (r *AuthPostgres) RevokeUserTokens(userId int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET token_version = token_version + 1 WHERE id = $1", usersTable), userId); err != nil {
+		return err
+	}
+
+	revokeQuery := fmt.Sprintf("UPDATE %s SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL", refreshTokensTable)
+	if _, err := tx.Exec(revokeQuery, userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *AuthPostgres) GetSessions(userId int) ([]classosbackend.Session, error) {
+	sessions := make([]classosbackend.Session, 0)
+	query := fmt.Sprintf(`
+		SELECT t.family, t.created_at AS last_used_at, t.expires_at,
+			(SELECT MIN(f.created_at) FROM %[1]s f WHERE f.family = t.family) AS started_at
+		FROM %[1]s t
+		JOIN %[2]s u ON u.id = t.user_id
+		WHERE t.user_id = $1 AND t.revoked_at IS NULL AND t.expires_at > now()
+			AND t.token_version = u.token_version
+		ORDER BY t.created_at DESC`, refreshTokensTable, usersTable)
+	err := r.db.Select(&sessions, query, userId)
+	return sessions, err
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+const directoryOperationColumns = `id, operation, payload, status, attempts, next_attempt_at, last_error, result, secret,
+	created_at, applied_at`
+
+type DirectoryJournalPostgres struct {
+	db *sqlx.DB
+}
+
+func NewDirectoryJournalPostgres(db *sqlx.DB) *DirectoryJournalPostgres {
+	return &DirectoryJournalPostgres{db: db}
+}
+
+func (r *DirectoryJournalPostgres) BeginTransaction() (*sql.Tx, error) {
+	return r.db.Begin()
+}
+
+func (r *DirectoryJournalPostgres) TryLockWithTx(tx *sql.Tx, key int64) (bool, error) {
+	var locked bool
+	err := tx.QueryRow("SELECT pg_try_advisory_xact_lock($1)", key).Scan(&locked)
+	return locked, err
+}
+
+func (r *DirectoryJournalPostgres) Add(operation string, objectKeys []string, payload, secret []byte) (int64, error) {
+	var id int64
+	query := fmt.Sprintf(`
+		INSERT INTO %s (operation, object_keys, payload, secret) VALUES ($1, $2, $3, $4) RETURNING id`, directoryJournalTable)
+	// jsonb принимает текст: []byte драйвер передал бы как bytea
+	err := r.db.QueryRow(query, operation, pq.Array(objectKeys), string(payload), secret).Scan(&id)
+	return id, err
+}
+
+func (r *DirectoryJournalPostgres) AddWithTx(tx *sql.Tx, operation string, objectKeys []string, payload, secret []byte) (int64, error) {
+	var id int64
+	query := fmt.Sprintf(`
+		INSERT INTO %s (operation, object_keys, payload, secret) VALUES ($1, $2, $3, $4) RETURNING id`, directoryJournalTable)
+	err := tx.QueryRow(query, operation, pq.Array(objectKeys), string(payload), secret).Scan(&id)
+	return id, err
+}
+
+// GetByStatus возвращает операции в порядке записи
+func (r *DirectoryJournalPostgres) GetByStatus(status string, limit int) ([]classosbackend.DirectoryOperation, error) {
+	operations := make([]classosbackend.DirectoryOperation, 0)
+	query := fmt.Sprintf(`
+		SELECT %s FROM %s
+		WHERE status = $1
+		ORDER BY id
+		LIMIT $2`, directoryOperationColumns, directoryJournalTable)
+	err := r.db.Select(&operations, query, status, limit)
+	return operations, err
+}
+
+func (r *DirectoryJournalPostgres) CountByStatus(status string) (int, error) {
+	var count int
+	query := fmt.Sprintf("SELECT count(*) FROM %s WHERE status = $1", directoryJournalTable)
+	err := r.db.Get(&count, query, status)
+	return count, err
+}
+
+// ClaimNext захватывает на lease самую раннюю готовую операцию, у которой нет более ранних
+// ожидающих операций с общими объектами. Строка блокируется только на время захвата: SKIP LOCKED
+// не даёт двум обработчикам взять одну операцию, а locked_until - взять её повторно, пока первый
+// обращается к каталогу. sql.ErrNoRows - готовых операций нет
+func (r *DirectoryJournalPostgres) ClaimNext(lease time.Duration) (classosbackend.DirectoryOperation, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return classosbackend.DirectoryOperation{}, err
+	}
+	defer tx.Rollback()
+
+	var op classosbackend.DirectoryOperation
+	query := fmt.Sprintf(`
+		SELECT %s FROM %s j
+		WHERE j.status = 'pending' AND j.next_attempt_at <= now()
+			AND (j.locked_until IS NULL OR j.locked_until < now())
+			AND NOT EXISTS (
+				SELECT 1 FROM %s p
+				WHERE p.status = 'pending' AND p.id < j.id AND p.object_keys && j.object_keys)
+		ORDER BY j.id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`, directoryOperationColumns, directoryJournalTable, directoryJournalTable)
+	err = tx.QueryRow(query).Scan(&op.ID, &op.Operation, &op.Payload, &op.Status, &op.Attempts, &op.NextAttemptAt,
+		&op.LastError, &op.Result, &op.Secret, &op.CreatedAt, &op.AppliedAt)
+	if err != nil {
+		return op, err
+	}
+
+	query = fmt.Sprintf("UPDATE %s SET locked_until = now() + make_interval(secs => $2) WHERE id = $1", directoryJournalTable)
+	if _, err := tx.Exec(query, op.ID, lease.Seconds()); err != nil {
+		return op, err
+	}
+
+	return op, tx.Commit()
+}
+
+// LastResult возвращает результат последней применённой до operationId операции,
+// payload которой содержит match
+func (r *DirectoryJournalPostgres) LastResult(operation string, match []byte, operationId int64) (string, error) {
+	var result sql.NullString
+	query := fmt.Sprintf(`
+		SELECT result FROM %s
+		WHERE operation = $1 AND status = 'done' AND payload @> $2::jsonb AND id < $3
+		ORDER BY id DESC
+		LIMIT 1`, directoryJournalTable)
+	err := r.db.QueryRow(query, operation, string(match), operationId).Scan(&result)
+	return result.String, err
+}
+
+// MarkDone стирает пароль операции: после применения он больше не нужен
+func (r *DirectoryJournalPostgres) MarkDone(operationId int64, result string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET status = 'done', attempts = attempts + 1, applied_at = now(), last_error = NULL,
+			result = NULLIF($2, ''), secret = NULL, locked_until = NULL
+		WHERE id = $1`, directoryJournalTable)
+	res, err := r.db.Exec(query, operationId, result)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+func (r *DirectoryJournalPostgres) Reschedule(operationId int64, nextAttemptAt time.Time, lastError string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET attempts = attempts + 1, next_attempt_at = $2, last_error = $3, locked_until = NULL
+		WHERE id = $1`, directoryJournalTable)
+	res, err := r.db.Exec(query, operationId, nextAttemptAt, lastError)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// Release возвращает захваченную операцию в очередь, не расходуя попытку
+func (r *DirectoryJournalPostgres) Release(operationId int64) error {
+	query := fmt.Sprintf("UPDATE %s SET locked_until = NULL WHERE id = $1", directoryJournalTable)
+	res, err := r.db.Exec(query, operationId)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+func (r *DirectoryJournalPostgres) MarkFailed(operationId int64, lastError string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET status = 'failed', attempts = attempts + 1, last_error = $2, locked_until = NULL
+		WHERE id = $1`, directoryJournalTable)
+	res, err := r.db.Exec(query, operationId, lastError)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// Retry возвращает неудавшуюся операцию в очередь с новым счётчиком попыток.
+// sql.ErrNoRows - операции нет или она не в состоянии failed
+func (r *DirectoryJournalPostgres) Retry(operationId int64) (classosbackend.DirectoryOperation, error) {
+	var op classosbackend.DirectoryOperation
+	query := fmt.Sprintf(`
+		UPDATE %s SET status = 'pending', attempts = 0, next_attempt_at = now(), locked_until = NULL
+		WHERE id = $1 AND status = 'failed'
+		RETURNING %s`, directoryJournalTable, directoryOperationColumns)
+	err := r.db.Get(&op, query, operationId)
+	return op, err
+}
+
+func (r *DirectoryJournalPostgres) GetById(operationId int64) (classosbackend.DirectoryOperation, error) {
+	var op classosbackend.DirectoryOperation
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = $1", directoryOperationColumns, directoryJournalTable)
+	err := r.db.Get(&op, query, operationId)
+	return op, err
+}
@@ -4,8 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	classosbackend "github.com/rinat0880/classOS_backend"
 )
 
@@ -76,18 +78,143 @@ func (r *GroupPostgres) Create(checkerId int, group classosbackend.Group) (int,
 
 func (r *GroupPostgres) GetAll(checkerId int) ([]classosbackend.Group, error) {
 	var groups []classosbackend.Group
-	query := fmt.Sprintf("SELECT id, name FROM %s", groupsTable)
+	query := fmt.Sprintf("SELECT id, name FROM %s WHERE archived_at IS NULL", groupsTable)
 	err := r.db.Select(&groups, query)
 	return groups, err
 }
 
 func (r *GroupPostgres) GetById(checkerId, groupId int) (classosbackend.Group, error) {
 	var group classosbackend.Group
-	query := fmt.Sprintf("SELECT id, name FROM %s WHERE id = $1", groupsTable)
+	query := fmt.Sprintf("SELECT id, name, archived_at, archived_from FROM %s WHERE id = $1", groupsTable)
 	err := r.db.Get(&group, query, groupId)
 	return group, err
 }
 
+// GetByName возвращает неархивированную группу с указанным именем; при совпадении имён - созданную первой
+func (r *GroupPostgres) GetByName(name string) (classosbackend.Group, error) {
+	var group classosbackend.Group
+	query := fmt.Sprintf("SELECT id, name FROM %s WHERE name = $1 AND archived_at IS NULL ORDER BY id LIMIT 1", groupsTable)
+	err := r.db.Get(&group, query, name)
+	return group, err
+}
+
+// GetScope возвращает группы, доступные пользователю: все - для admin и ролей с правом groups.all,
+// иначе закреплённые за ним группы
+func (r *GroupPostgres) GetScope(userId int) (classosbackend.GroupScope, error) {
+	var scope classosbackend.GroupScope
+	query := fmt.Sprintf(`
+		SELECT u.role AS role, (u.role = $2 OR EXISTS (
+			SELECT 1 FROM %[1]s rp
+			JOIN %[2]s r ON r.id = rp.role_id
+			WHERE r.name = u.role AND rp.permission = $3
+		)) AS all_groups, (u.role = $2 OR EXISTS (
+			SELECT 1 FROM %[1]s rp
+			JOIN %[2]s r ON r.id = rp.role_id
+			WHERE r.name = u.role AND rp.permission = $4
+		)) AS manages_roles
+		FROM %[3]s u WHERE u.id = $1`, rolePermissionsTable, rolesTable, usersTable)
+	err := r.db.QueryRow(query, userId, classosbackend.RoleAdmin, classosbackend.PermissionGroupsAll, classosbackend.PermissionRolesManage).
+		Scan(&scope.Role, &scope.All, &scope.ManagesRoles)
+	if err != nil {
+		return scope, err
+	}
+
+	if scope.All {
+		return scope, nil
+	}
+
+	scope.GroupIDs = make([]int, 0)
+	query = fmt.Sprintf("SELECT group_id FROM %s WHERE teacher_id = $1 ORDER BY group_id", teacherGroupsTable)
+	if err := r.db.Select(&scope.GroupIDs, query, userId); err != nil {
+		return scope, err
+	}
+
+	return scope, nil
+}
+
+func (r *GroupPostgres) GetTeacherGroups(teacherId int) ([]classosbackend.Group, error) {
+	groups := make([]classosbackend.Group, 0)
+	query := fmt.Sprintf(`
+		SELECT g.id, g.name FROM %s g
+		JOIN %s tg ON tg.group_id = g.id
+		WHERE tg.teacher_id = $1 AND g.archived_at IS NULL
+		ORDER BY g.id`, groupsTable, teacherGroupsTable)
+	err := r.db.Select(&groups, query, teacherId)
+	return groups, err
+}
+
+// GetArchived возвращает архивированные группы, начиная с архивированных последними
+func (r *GroupPostgres) GetArchived() ([]classosbackend.Group, error) {
+	groups := make([]classosbackend.Group, 0)
+	query := fmt.Sprintf(`
+		SELECT id, name, archived_at, archived_from FROM %s
+		WHERE archived_at IS NOT NULL
+		ORDER BY archived_at DESC, id`, groupsTable)
+	err := r.db.Select(&groups, query)
+	return groups, err
+}
+
+// GetArchivedBefore возвращает группы, архивированные раньше before
+func (r *GroupPostgres) GetArchivedBefore(before time.Time) ([]classosbackend.Group, error) {
+	groups := make([]classosbackend.Group, 0)
+	query := fmt.Sprintf(`
+		SELECT id, name, archived_at, archived_from FROM %s
+		WHERE archived_at < $1
+		ORDER BY archived_at, id`, groupsTable)
+	err := r.db.Select(&groups, query, before)
+	return groups, err
+}
+
+func (r *GroupPostgres) ArchiveWithTx(tx *sql.Tx, groupId int, archivedAt time.Time, archivedFrom string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET archived_at = $1, archived_from = NULLIF($2, '')
+		WHERE id = $3 AND archived_at IS NULL`, groupsTable)
+	res, err := tx.Exec(query, archivedAt, archivedFrom, groupId)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+func (r *GroupPostgres) RestoreWithTx(tx *sql.Tx, groupId int) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET archived_at = NULL, archived_from = NULL
+		WHERE id = $1 AND archived_at IS NOT NULL`, groupsTable)
+	res, err := tx.Exec(query, groupId)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// SetTeacherGroups заменяет список групп учителя целиком
+func (r *GroupPostgres) SetTeacherGroups(teacherId int, groupIds []int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE teacher_id = $1", teacherGroupsTable)
+	if _, err := tx.Exec(query, teacherId); err != nil {
+		return err
+	}
+
+	if len(groupIds) > 0 {
+		query = fmt.Sprintf(`
+			INSERT INTO %s (teacher_id, group_id)
+			SELECT $1, unnest($2::int[])
+			ON CONFLICT DO NOTHING`, teacherGroupsTable)
+		if _, err := tx.Exec(query, teacherId, pq.Array(groupIds)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (r *GroupPostgres) Delete(checkerId, groupId int) error {
 	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", groupsTable)
 	_, err := r.db.Exec(query, groupId)
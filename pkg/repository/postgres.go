@@ -10,7 +10,16 @@ const (
 	usersTable            = "users"
 	groupsTable           = "groups"
 	users_listsTable      = "users_lists"
+	whitelistTable        = "whitelist"
+	schedulesTable        = "whitelist_schedules"
 	whitelist_globalTable = "whitelist_global"
+	accessRequestsTable   = "access_requests"
+	settingsTable         = "settings"
+	refreshTokensTable    = "refresh_tokens"
+	teacherGroupsTable    = "teacher_groups"
+	rolesTable            = "roles"
+	rolePermissionsTable  = "role_permissions"
+	directoryJournalTable = "directory_journal"
 )
 
 type Config struct {
@@ -2,21 +2,45 @@ package repository
 
 import (
 	"database/sql"
+	"time"
+
 	"github.com/jmoiron/sqlx"
 	classosbackend "github.com/rinat0880/classOS_backend"
 )
 
 type Authorization interface {
 	CreateUser(user classosbackend.User) (int, error)
-	GetUser(username, password string) (classosbackend.User, error)
+	GetUser(username string) (classosbackend.User, error)
+	UpdatePasswordHash(userId int, passwordHash string) error
+
+	GetTokenState(userId int) (classosbackend.User, error)
+	CreateRefreshToken(token classosbackend.RefreshToken) error
+	GetRefreshToken(tokenHash string) (classosbackend.RefreshToken, error)
+	RotateRefreshToken(oldId int64, token classosbackend.RefreshToken) error
+	RevokeRefreshTokenFamily(family string) error
+	RevokeUserTokens(userId int) error
+	// Активные входы: цепочки с неотозванным и неистёкшим последним токеном текущей версии
+	GetSessions(userId int) ([]classosbackend.Session, error)
 }
 
 type Group interface {
 	Create(checkerId int, group classosbackend.Group) (int, error)
 	GetAll(checkerId int) ([]classosbackend.Group, error)
 	GetById(checkerId, groupId int) (classosbackend.Group, error)
+	GetByName(name string) (classosbackend.Group, error)
 	Delete(checkerId, groupId int) error
 	Update(checkerId, groupId int, input classosbackend.UpdateGroupInput) error
+
+	// Группы, закреплённые за учителями
+	GetScope(userId int) (classosbackend.GroupScope, error)
+	GetTeacherGroups(teacherId int) ([]classosbackend.Group, error)
+	SetTeacherGroups(teacherId int, groupIds []int) error
+
+	// Архив: обычные списки и GetByName архивированные группы не возвращают
+	GetArchived() ([]classosbackend.Group, error)
+	GetArchivedBefore(before time.Time) ([]classosbackend.Group, error)
+	ArchiveWithTx(tx *sql.Tx, groupId int, archivedAt time.Time, archivedFrom string) error
+	RestoreWithTx(tx *sql.Tx, groupId int) error
 	
 	// Методы для транзакций
 	BeginTransaction() (*sql.Tx, error)
@@ -29,8 +53,20 @@ type User interface {
 	Create(groupId int, user classosbackend.User) (int, error)
 	GetAll(checkerId int) ([]classosbackend.User, error)
 	GetById(checkerId, userId int) (classosbackend.User, error)
+	GetByUsername(username string) (classosbackend.User, error)
+	GetByGroup(groupId int) ([]classosbackend.User, error)
+	// ExistingUsernames сравнивает логины без учёта регистра, как это делает AD
+	ExistingUsernames(usernames []string) (map[string]bool, error)
 	Delete(checkerId, userId int) error
 	Update(checkerId, userId int, input classosbackend.UpdateUserInput) error
+
+	// Архив: GetAll и GetByGroup архивированных пользователей не возвращают, GetById - возвращает
+	GetArchived() ([]classosbackend.User, error)
+	GetArchivedBefore(before time.Time) ([]classosbackend.User, error)
+	GetArchivedWithGroup(groupId int) ([]classosbackend.User, error)
+	CountArchivedInGroup(groupId int) (int, error)
+	ArchiveWithTx(tx *sql.Tx, userId int, archivedAt time.Time, archivedFrom string) error
+	RestoreWithTx(tx *sql.Tx, userId int) error
 	
 	// Методы для транзакций
 	BeginTransaction() (*sql.Tx, error)
@@ -39,16 +75,104 @@ type User interface {
 	DeleteWithTx(tx *sql.Tx, checkerId, userId int) error
 }
 
+type Whitelist interface {
+	// Пустой entrySet возвращает записи всех наборов группы
+	GetAll(checkerId, groupId int, entrySet string) ([]classosbackend.WhitelistEntry, error)
+	Add(checkerId, groupId int, entrySet, action string, values []string) ([]classosbackend.WhitelistEntry, error)
+	Delete(checkerId, groupId int, entryId int64) error
+	DeleteValues(checkerId, groupId int, entrySet string, values []string) (int64, error)
+	Replace(checkerId, groupId int, entrySet, action string, values []string) ([]classosbackend.WhitelistEntry, error)
+
+	// Глобальный whitelist, общий для всех групп
+	GetGlobal() ([]classosbackend.GlobalWhitelistEntry, error)
+	AddGlobal(action string, values []string) ([]classosbackend.GlobalWhitelistEntry, error)
+	DeleteGlobal(entryId int64) error
+	DeleteGlobalValues(values []string) (int64, error)
+	ReplaceGlobal(action string, values []string) ([]classosbackend.GlobalWhitelistEntry, error)
+}
+
+type Schedule interface {
+	GetAll(groupId int) ([]classosbackend.ScheduleRule, error)
+	Create(groupId int, rule classosbackend.ScheduleRule) (int64, error)
+	Update(groupId int, ruleId int64, rule classosbackend.ScheduleRule) error
+	Delete(groupId int, ruleId int64) error
+}
+
+type AccessRequest interface {
+	Create(request classosbackend.AccessRequest) (int64, error)
+	GetById(requestId int64) (classosbackend.AccessRequest, error)
+	// nil groupIds и пустой status отключают соответствующий фильтр
+	GetAll(groupIds []int, status string) ([]classosbackend.AccessRequest, error)
+	GetByUser(userId int) ([]classosbackend.AccessRequest, error)
+	// Нулевой at - текущее время БД
+	GetGrants(userId int, at time.Time) ([]classosbackend.AccessRequest, error)
+
+	// Решения применяются только к запросам в статусе pending, иначе sql.ErrNoRows
+	ApproveOnce(requestId int64, decidedBy int, duration time.Duration, comment string) error
+	ApprovePermanent(requestId int64, decidedBy int, entrySet, value, comment string) error
+	Reject(requestId int64, decidedBy int, comment string) error
+}
+
+type Role interface {
+	GetAll() ([]classosbackend.Role, error)
+	GetByName(name string) (classosbackend.Role, error)
+	GetPermissions(name string) ([]string, error)
+	Create(role classosbackend.Role) (int, error)
+	Update(name string, input classosbackend.UpdateRoleInput) error
+	Delete(name string) error
+}
+
+type Settings interface {
+	GetAll() ([]classosbackend.Settings, error)
+	Update(values map[string]string, reset []string) error
+}
+
+// DirectoryJournal - очередь операций каталога (outbox). secret - зашифрованный пароль операции,
+// objectKeys - объекты каталога, в пределах которых операции применяются по порядку
+type DirectoryJournal interface {
+	Add(operation string, objectKeys []string, payload, secret []byte) (int64, error)
+	GetById(operationId int64) (classosbackend.DirectoryOperation, error)
+	GetByStatus(status string, limit int) ([]classosbackend.DirectoryOperation, error)
+	CountByStatus(status string) (int, error)
+	Retry(operationId int64) (classosbackend.DirectoryOperation, error)
+
+	// Обработка очереди: захваченная операция завершается MarkDone, Reschedule, MarkFailed или Release
+	ClaimNext(lease time.Duration) (classosbackend.DirectoryOperation, error)
+	LastResult(operation string, match []byte, operationId int64) (string, error)
+	MarkDone(operationId int64, result string) error
+	Reschedule(operationId int64, nextAttemptAt time.Time, lastError string) error
+	MarkFailed(operationId int64, lastError string) error
+	Release(operationId int64) error
+
+	// Методы для транзакций
+	BeginTransaction() (*sql.Tx, error)
+	AddWithTx(tx *sql.Tx, operation string, objectKeys []string, payload, secret []byte) (int64, error)
+	// TryLockWithTx берёт advisory-блокировку key до конца транзакции; false - её держит другая транзакция
+	TryLockWithTx(tx *sql.Tx, key int64) (bool, error)
+}
+
 type Repository struct {
 	Authorization
 	Group
 	User
+	Whitelist
+	Schedule
+	AccessRequest
+	Role
+	Settings
+	DirectoryJournal
 }
 
 func NewRepository(db *sqlx.DB) *Repository {
 	return &Repository{
-		Authorization: NewAuthPostgres(db),
-		Group:         NewGroupPostgres(db),
-		User:          NewUserPostgres(db),
+		Authorization:    NewAuthPostgres(db),
+		Group:            NewGroupPostgres(db),
+		User:             NewUserPostgres(db),
+		Whitelist:        NewWhitelistPostgres(db),
+		Schedule:         NewSchedulePostgres(db),
+		AccessRequest:    NewAccessRequestPostgres(db),
+		Role:             NewRolePostgres(db),
+		Settings:         NewSettingsPostgres(db),
+		DirectoryJournal: NewDirectoryJournalPostgres(db),
 	}
 }
\ No newline at end of file
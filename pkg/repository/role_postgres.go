@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type RolePostgres struct {
+	db *sqlx.DB
+}
+
+func NewRolePostgres(db *sqlx.DB) *RolePostgres {
+	return &RolePostgres{db: db}
+}
+
+// roleRow - роль вместе с правами, собранными в массив одним запросом
+type roleRow struct {
+	classosbackend.Role
+	Permissions pq.StringArray `db:"permissions"`
+}
+
+func (r roleRow) toRole() classosbackend.Role {
+	role := r.Role
+	role.Permissions = []string(r.Permissions)
+	return role
+}
+
+const roleSelectQuery = `
+	SELECT r.id, r.name, r.description, r.builtin, r.created_at,
+		COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}') AS permissions
+	FROM %s r
+	LEFT JOIN %s rp ON rp.role_id = r.id`
+
+func (r *RolePostgres) GetAll() ([]classosbackend.Role, error) {
+	var rows []roleRow
+	query := fmt.Sprintf(roleSelectQuery+" GROUP BY r.id ORDER BY r.id", rolesTable, rolePermissionsTable)
+	if err := r.db.Select(&rows, query); err != nil {
+		return nil, err
+	}
+
+	roles := make([]classosbackend.Role, 0, len(rows))
+	for _, row := range rows {
+		roles = append(roles, row.toRole())
+	}
+
+	return roles, nil
+}
+
+func (r *RolePostgres) GetByName(name string) (classosbackend.Role, error) {
+	var row roleRow
+	query := fmt.Sprintf(roleSelectQuery+" WHERE r.name = $1 GROUP BY r.id", rolesTable, rolePermissionsTable)
+	if err := r.db.Get(&row, query, name); err != nil {
+		return classosbackend.Role{}, err
+	}
+
+	return row.toRole(), nil
+}
+
+// GetPermissions возвращает права роли; для неизвестной роли - пустой список
+func (r *RolePostgres) GetPermissions(name string) ([]string, error) {
+	permissions := make([]string, 0)
+	query := fmt.Sprintf(`
+		SELECT rp.permission FROM %s rp
+		JOIN %s r ON r.id = rp.role_id
+		WHERE r.name = $1
+		ORDER BY rp.permission`, rolePermissionsTable, rolesTable)
+	err := r.db.Select(&permissions, query, name)
+	return permissions, err
+}
+
+func (r *RolePostgres) Create(role classosbackend.Role) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := fmt.Sprintf("INSERT INTO %s (name, description) VALUES ($1, $2) RETURNING id", rolesTable)
+	if err := tx.QueryRow(query, role.Name, role.Description).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	if err := insertRolePermissions(tx, id, role.Permissions); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// Update меняет описание и, если передан список прав, заменяет права роли целиком
+func (r *RolePostgres) Update(name string, input classosbackend.UpdateRoleInput) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := fmt.Sprintf("SELECT id FROM %s WHERE name = $1 FOR UPDATE", rolesTable)
+	if err := tx.Get(&id, query, name); err != nil {
+		return err
+	}
+
+	if input.Description != nil {
+		query = fmt.Sprintf("UPDATE %s SET description = $1 WHERE id = $2", rolesTable)
+		if _, err := tx.Exec(query, *input.Description, id); err != nil {
+			return err
+		}
+	}
+
+	if input.Permissions != nil {
+		query = fmt.Sprintf("DELETE FROM %s WHERE role_id = $1", rolePermissionsTable)
+		if _, err := tx.Exec(query, id); err != nil {
+			return err
+		}
+
+		if err := insertRolePermissions(tx, id, *input.Permissions); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete удаляет роль; роль, назначенную пользователям, удалить не даёт внешний ключ users.role
+func (r *RolePostgres) Delete(name string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE name = $1", rolesTable)
+	res, err := r.db.Exec(query, name)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+func insertRolePermissions(tx *sqlx.Tx, roleId int, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (role_id, permission)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING`, rolePermissionsTable)
+	_, err := tx.Exec(query, roleId, pq.Array(permissions))
+	return err
+}
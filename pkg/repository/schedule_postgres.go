@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type SchedulePostgres struct {
+	db *sqlx.DB
+}
+
+func NewSchedulePostgres(db *sqlx.DB) *SchedulePostgres {
+	return &SchedulePostgres{db: db}
+}
+
+func (r *SchedulePostgres) GetAll(groupId int) ([]classosbackend.ScheduleRule, error) {
+	rules := make([]classosbackend.ScheduleRule, 0)
+	query := fmt.Sprintf(`
+		SELECT id, group_id, weekday, to_char(start_time, 'HH24:MI') AS start_time,
+			   to_char(end_time, 'HH24:MI') AS end_time, timezone, entry_set, created_at
+		FROM %s
+		WHERE group_id = $1
+		ORDER BY weekday, start_time`, schedulesTable)
+	err := r.db.Select(&rules, query, groupId)
+	return rules, err
+}
+
+func (r *SchedulePostgres) Create(groupId int, rule classosbackend.ScheduleRule) (int64, error) {
+	var id int64
+	query := fmt.Sprintf(`
+		INSERT INTO %s (group_id, weekday, start_time, end_time, timezone, entry_set)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`, schedulesTable)
+	row := r.db.QueryRow(query, groupId, rule.Weekday, rule.StartTime, rule.EndTime, rule.Timezone, rule.EntrySet)
+	if err := row.Scan(&id); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *SchedulePostgres) Update(groupId int, ruleId int64, rule classosbackend.ScheduleRule) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET weekday = $1, start_time = $2, end_time = $3, timezone = $4, entry_set = $5
+		WHERE id = $6 AND group_id = $7`, schedulesTable)
+	res, err := r.db.Exec(query, rule.Weekday, rule.StartTime, rule.EndTime, rule.Timezone, rule.EntrySet, ruleId, groupId)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+func (r *SchedulePostgres) Delete(groupId int, ruleId int64) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1 AND group_id = $2", schedulesTable)
+	res, err := r.db.Exec(query, ruleId, groupId)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// checkRowsAffected возвращает sql.ErrNoRows, если запрос не затронул ни одной строки
+func checkRowsAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type SettingsPostgres struct {
+	db *sqlx.DB
+}
+
+func NewSettingsPostgres(db *sqlx.DB) *SettingsPostgres {
+	return &SettingsPostgres{db: db}
+}
+
+func (r *SettingsPostgres) GetAll() ([]classosbackend.Settings, error) {
+	settings := make([]classosbackend.Settings, 0)
+	query := fmt.Sprintf("SELECT id, key, value, updated_at FROM %s ORDER BY key", settingsTable)
+	err := r.db.Select(&settings, query)
+	return settings, err
+}
+
+// Update применяет изменения атомарно: значения сохраняются, ключи из reset удаляются
+func (r *SettingsPostgres) Update(values map[string]string, reset []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsertQuery := fmt.Sprintf(`
+		INSERT INTO %s (key, value) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = now()`, settingsTable)
+	for key, value := range values {
+		if _, err := tx.Exec(upsertQuery, key, value); err != nil {
+			return err
+		}
+	}
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE key = $1", settingsTable)
+	for _, key := range reset {
+		if _, err := tx.Exec(deleteQuery, key); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
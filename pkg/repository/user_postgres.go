@@ -4,8 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 	
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	classosbackend "github.com/rinat0880/classOS_backend"
 )
 
@@ -50,6 +52,12 @@ func (r *UserPostgres) UpdateWithTx(tx *sql.Tx, checkerId, userId int, input cla
 		argId++
 	}
 
+	if input.Username != nil {
+		userSetValues = append(userSetValues, fmt.Sprintf("username=$%d", argId))
+		userArgs = append(userArgs, *input.Username)
+		argId++
+	}
+
 	if input.Password != nil {
 		userSetValues = append(userSetValues, fmt.Sprintf("password_hash=$%d", argId))
 		userArgs = append(userArgs, *input.Password)
@@ -62,6 +70,23 @@ func (r *UserPostgres) UpdateWithTx(tx *sql.Tx, checkerId, userId int, input cla
 		argId++
 	}
 
+	if input.MustChangePassword != nil {
+		userSetValues = append(userSetValues, fmt.Sprintf("must_change_password=$%d", argId))
+		userArgs = append(userArgs, *input.MustChangePassword)
+		argId++
+	}
+
+	if input.Enabled != nil {
+		userSetValues = append(userSetValues, fmt.Sprintf("enabled=$%d", argId))
+		userArgs = append(userArgs, *input.Enabled)
+		argId++
+	}
+
+	// Смена пароля или роли и отключение пользователя отзывают все выданные ему токены
+	if input.Password != nil || input.Role != nil || (input.Enabled != nil && !*input.Enabled) {
+		userSetValues = append(userSetValues, "token_version = token_version + 1")
+	}
+
 	if len(userSetValues) > 0 {
 		setQuery := strings.Join(userSetValues, ", ")
 		query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d", usersTable, setQuery, argId)
@@ -131,13 +156,13 @@ func (r *UserPostgres) Create(groupId int, user classosbackend.User) (int, error
 func (r *UserPostgres) GetAll(checkerId int) ([]classosbackend.User, error) {
 	var users []classosbackend.User
 	query := fmt.Sprintf(`
-		SELECT u.id, u.name, u.username, u.role, 
+		SELECT u.id, u.name, u.username, u.role, u.enabled, 
 			   COALESCE(ul.group_id, 0) as group_id, 
 			   COALESCE(g.name, '') as group_name 
 		FROM %s u 
 		LEFT JOIN %s ul ON u.id = ul.user_id 
 		LEFT JOIN %s g ON ul.group_id = g.id 
-		WHERE u.id != 1`, 
+		WHERE u.id != 1 AND u.archived_at IS NULL`, 
 		usersTable, users_listsTable, groupsTable)
 	
 	err := r.db.Select(&users, query)
@@ -147,7 +172,8 @@ func (r *UserPostgres) GetAll(checkerId int) ([]classosbackend.User, error) {
 func (r *UserPostgres) GetById(checkerId, userId int) (classosbackend.User, error) {
 	var user classosbackend.User
 	query := fmt.Sprintf(`
-		SELECT u.id, u.name, u.username, u.role, ul.group_id, g.name as group_name 
+		SELECT u.id, u.name, u.username, u.role, u.enabled, u.archived_at, u.archived_from,
+			   ul.group_id, g.name as group_name 
 		FROM %s u 
 		LEFT JOIN %s ul ON u.id = ul.user_id 
 		LEFT JOIN %s g ON ul.group_id = g.id 
@@ -157,6 +183,140 @@ func (r *UserPostgres) GetById(checkerId, userId int) (classosbackend.User, erro
 	return user, err
 }
 
+func (r *UserPostgres) GetByUsername(username string) (classosbackend.User, error) {
+	var user classosbackend.User
+	query := fmt.Sprintf(`
+		SELECT u.id, u.name, u.username, u.role, u.enabled, u.archived_at, u.archived_from,
+			   ul.group_id, g.name as group_name 
+		FROM %s u 
+		LEFT JOIN %s ul ON u.id = ul.user_id 
+		LEFT JOIN %s g ON ul.group_id = g.id 
+		WHERE u.username = $1`, usersTable, users_listsTable, groupsTable)
+
+	err := r.db.Get(&user, query, username)
+	return user, err
+}
+
+// GetByGroup возвращает неархивированных участников группы, отсортированных по имени
+func (r *UserPostgres) GetByGroup(groupId int) ([]classosbackend.User, error) {
+	var users []classosbackend.User
+	query := fmt.Sprintf(`
+		SELECT u.id, u.name, u.username, u.role, u.enabled, ul.group_id, g.name as group_name
+		FROM %s u
+		JOIN %s ul ON u.id = ul.user_id
+		JOIN %s g ON ul.group_id = g.id
+		WHERE ul.group_id = $1 AND u.archived_at IS NULL
+		ORDER BY u.name, u.username`, usersTable, users_listsTable, groupsTable)
+
+	err := r.db.Select(&users, query, groupId)
+	return users, err
+}
+
+// GetArchived возвращает архивированных пользователей, начиная с архивированных последними
+func (r *UserPostgres) GetArchived() ([]classosbackend.User, error) {
+	users := make([]classosbackend.User, 0)
+	query := fmt.Sprintf(`
+		SELECT u.id, u.name, u.username, u.role, u.enabled, u.archived_at, u.archived_from,
+			   ul.group_id, g.name as group_name
+		FROM %s u
+		LEFT JOIN %s ul ON u.id = ul.user_id
+		LEFT JOIN %s g ON ul.group_id = g.id
+		WHERE u.archived_at IS NOT NULL
+		ORDER BY u.archived_at DESC, u.id`, usersTable, users_listsTable, groupsTable)
+
+	err := r.db.Select(&users, query)
+	return users, err
+}
+
+// GetArchivedBefore возвращает пользователей, архивированных раньше before
+func (r *UserPostgres) GetArchivedBefore(before time.Time) ([]classosbackend.User, error) {
+	users := make([]classosbackend.User, 0)
+	query := fmt.Sprintf(`
+		SELECT id, name, username, role, enabled, archived_at, archived_from
+		FROM %s
+		WHERE archived_at < $1
+		ORDER BY archived_at, id`, usersTable)
+
+	err := r.db.Select(&users, query, before)
+	return users, err
+}
+
+// CountArchivedInGroup считает архивированных участников группы, когда бы их ни архивировали
+func (r *UserPostgres) CountArchivedInGroup(groupId int) (int, error) {
+	var count int
+	query := fmt.Sprintf(`
+		SELECT count(*) FROM %s u
+		JOIN %s ul ON u.id = ul.user_id
+		WHERE ul.group_id = $1 AND u.archived_at IS NOT NULL`, usersTable, users_listsTable)
+
+	err := r.db.Get(&count, query, groupId)
+	return count, err
+}
+
+// GetArchivedWithGroup возвращает участников группы, архивированных вместе с ней: у них
+// то же время архивации, что и у группы
+func (r *UserPostgres) GetArchivedWithGroup(groupId int) ([]classosbackend.User, error) {
+	users := make([]classosbackend.User, 0)
+	query := fmt.Sprintf(`
+		SELECT u.id, u.name, u.username, u.role, u.enabled, u.archived_at, u.archived_from,
+			   ul.group_id, g.name as group_name
+		FROM %s u
+		JOIN %s ul ON u.id = ul.user_id
+		JOIN %s g ON ul.group_id = g.id
+		WHERE ul.group_id = $1 AND u.archived_at = g.archived_at
+		ORDER BY u.id`, usersTable, users_listsTable, groupsTable)
+
+	err := r.db.Select(&users, query, groupId)
+	return users, err
+}
+
+// ArchiveWithTx скрывает пользователя и отзывает его токены; членство в группе сохраняется
+// для восстановления. Пустой archivedFrom - учётной записи нет в AD
+func (r *UserPostgres) ArchiveWithTx(tx *sql.Tx, userId int, archivedAt time.Time, archivedFrom string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET archived_at = $1, archived_from = NULLIF($2, ''), token_version = token_version + 1
+		WHERE id = $3 AND archived_at IS NULL`, usersTable)
+	res, err := tx.Exec(query, archivedAt, archivedFrom, userId)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+func (r *UserPostgres) RestoreWithTx(tx *sql.Tx, userId int) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET archived_at = NULL, archived_from = NULL
+		WHERE id = $1 AND archived_at IS NOT NULL`, usersTable)
+	res, err := tx.Exec(query, userId)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// ExistingUsernames возвращает, какие из логинов уже заняты (ключи в нижнем регистре)
+func (r *UserPostgres) ExistingUsernames(usernames []string) (map[string]bool, error) {
+	lowered := make([]string, len(usernames))
+	for i, username := range usernames {
+		lowered[i] = strings.ToLower(username)
+	}
+
+	var taken []string
+	query := fmt.Sprintf(`SELECT lower(username) FROM %s WHERE lower(username) = ANY($1)`, usersTable)
+	if err := r.db.Select(&taken, query, pq.Array(lowered)); err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(taken))
+	for _, username := range taken {
+		found[username] = true
+	}
+
+	return found, nil
+}
+
 func (r *UserPostgres) Delete(checkerId, userId int) error {
 	query := fmt.Sprintf(`Delete FROM %s WHERE id = $1`, usersTable)
 	_, err := r.db.Exec(query, userId)
@@ -180,6 +340,12 @@ func (r *UserPostgres) Update(checkerId, userId int, input classosbackend.Update
 		argId++
 	}
 
+	if input.Username != nil {
+		userSetValues = append(userSetValues, fmt.Sprintf("username=$%d", argId))
+		userArgs = append(userArgs, *input.Username)
+		argId++
+	}
+
 	if input.Password != nil {
 		userSetValues = append(userSetValues, fmt.Sprintf("password_hash=$%d", argId))
 		userArgs = append(userArgs, *input.Password)
@@ -192,6 +358,23 @@ func (r *UserPostgres) Update(checkerId, userId int, input classosbackend.Update
 		argId++
 	}
 
+	if input.MustChangePassword != nil {
+		userSetValues = append(userSetValues, fmt.Sprintf("must_change_password=$%d", argId))
+		userArgs = append(userArgs, *input.MustChangePassword)
+		argId++
+	}
+
+	if input.Enabled != nil {
+		userSetValues = append(userSetValues, fmt.Sprintf("enabled=$%d", argId))
+		userArgs = append(userArgs, *input.Enabled)
+		argId++
+	}
+
+	// Смена пароля или роли и отключение пользователя отзывают все выданные ему токены
+	if input.Password != nil || input.Role != nil || (input.Enabled != nil && !*input.Enabled) {
+		userSetValues = append(userSetValues, "token_version = token_version + 1")
+	}
+
 	if len(userSetValues) > 0 {
 		setQuery := strings.Join(userSetValues, ", ")
 		query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d", usersTable, setQuery, argId)
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type WhitelistPostgres struct {
+	db *sqlx.DB
+}
+
+func NewWhitelistPostgres(db *sqlx.DB) *WhitelistPostgres {
+	return &WhitelistPostgres{db: db}
+}
+
+func (r *WhitelistPostgres) GetAll(checkerId, groupId int, entrySet string) ([]classosbackend.WhitelistEntry, error) {
+	entries := make([]classosbackend.WhitelistEntry, 0)
+	query := fmt.Sprintf(`
+		SELECT id, group_id, resource, entry_set, action, created_at FROM %s
+		WHERE group_id = $1 AND ($2 = '' OR entry_set = $2)
+		ORDER BY entry_set, resource`, whitelistTable)
+	err := r.db.Select(&entries, query, groupId, entrySet)
+	return entries, err
+}
+
+func (r *WhitelistPostgres) Add(checkerId, groupId int, entrySet, action string, values []string) ([]classosbackend.WhitelistEntry, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := insertWhitelistValues(tx, groupId, entrySet, action, values); err != nil {
+		return nil, err
+	}
+
+	entries := make([]classosbackend.WhitelistEntry, 0, len(values))
+	query := fmt.Sprintf(`
+		SELECT id, group_id, resource, entry_set, action, created_at FROM %s
+		WHERE group_id = $1 AND entry_set = $2 AND resource = ANY($3)
+		ORDER BY resource`, whitelistTable)
+	if err := tx.Select(&entries, query, groupId, entrySet, pq.Array(values)); err != nil {
+		return nil, err
+	}
+
+	return entries, tx.Commit()
+}
+
+func (r *WhitelistPostgres) Delete(checkerId, groupId int, entryId int64) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1 AND group_id = $2", whitelistTable)
+	res, err := r.db.Exec(query, entryId, groupId)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+func (r *WhitelistPostgres) DeleteValues(checkerId, groupId int, entrySet string, values []string) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE group_id = $1 AND entry_set = $2 AND resource = ANY($3)", whitelistTable)
+	res, err := r.db.Exec(query, groupId, entrySet, pq.Array(values))
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (r *WhitelistPostgres) Replace(checkerId, groupId int, entrySet, action string, values []string) ([]classosbackend.WhitelistEntry, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Оставляем совпадающие записи, чтобы не терять их id и created_at
+	deleteQuery := fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE group_id = $1 AND entry_set = $2 AND action = $3 AND NOT (resource = ANY($4))`, whitelistTable)
+	if _, err := tx.Exec(deleteQuery, groupId, entrySet, action, pq.Array(values)); err != nil {
+		return nil, err
+	}
+
+	if err := insertWhitelistValues(tx, groupId, entrySet, action, values); err != nil {
+		return nil, err
+	}
+
+	entries := make([]classosbackend.WhitelistEntry, 0, len(values))
+	query := fmt.Sprintf(`
+		SELECT id, group_id, resource, entry_set, action, created_at FROM %s
+		WHERE group_id = $1 AND entry_set = $2 AND action = $3
+		ORDER BY resource`, whitelistTable)
+	if err := tx.Select(&entries, query, groupId, entrySet, action); err != nil {
+		return nil, err
+	}
+
+	return entries, tx.Commit()
+}
+
+// insertWhitelistValues добавляет записи; у уже существующих значений меняется только action
+func insertWhitelistValues(tx *sqlx.Tx, groupId int, entrySet, action string, values []string) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (group_id, entry_set, action, resource)
+		SELECT $1, $2, $3, unnest($4::text[])
+		ON CONFLICT (group_id, entry_set, resource) DO UPDATE SET action = EXCLUDED.action`, whitelistTable)
+
+	_, err := tx.Exec(query, groupId, entrySet, action, pq.Array(values))
+	return err
+}
+
+func (r *WhitelistPostgres) GetGlobal() ([]classosbackend.GlobalWhitelistEntry, error) {
+	entries := make([]classosbackend.GlobalWhitelistEntry, 0)
+	query := fmt.Sprintf("SELECT id, resource, action, created_at FROM %s ORDER BY resource", whitelist_globalTable)
+	err := r.db.Select(&entries, query)
+	return entries, err
+}
+
+func (r *WhitelistPostgres) AddGlobal(action string, values []string) ([]classosbackend.GlobalWhitelistEntry, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := insertGlobalWhitelistValues(tx, action, values); err != nil {
+		return nil, err
+	}
+
+	entries := make([]classosbackend.GlobalWhitelistEntry, 0, len(values))
+	query := fmt.Sprintf("SELECT id, resource, action, created_at FROM %s WHERE resource = ANY($1) ORDER BY resource", whitelist_globalTable)
+	if err := tx.Select(&entries, query, pq.Array(values)); err != nil {
+		return nil, err
+	}
+
+	return entries, tx.Commit()
+}
+
+func (r *WhitelistPostgres) DeleteGlobal(entryId int64) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", whitelist_globalTable)
+	res, err := r.db.Exec(query, entryId)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+func (r *WhitelistPostgres) DeleteGlobalValues(values []string) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE resource = ANY($1)", whitelist_globalTable)
+	res, err := r.db.Exec(query, pq.Array(values))
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (r *WhitelistPostgres) ReplaceGlobal(action string, values []string) ([]classosbackend.GlobalWhitelistEntry, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE action = $1 AND NOT (resource = ANY($2))", whitelist_globalTable)
+	if _, err := tx.Exec(deleteQuery, action, pq.Array(values)); err != nil {
+		return nil, err
+	}
+
+	if err := insertGlobalWhitelistValues(tx, action, values); err != nil {
+		return nil, err
+	}
+
+	entries := make([]classosbackend.GlobalWhitelistEntry, 0, len(values))
+	query := fmt.Sprintf("SELECT id, resource, action, created_at FROM %s WHERE action = $1 ORDER BY resource", whitelist_globalTable)
+	if err := tx.Select(&entries, query, action); err != nil {
+		return nil, err
+	}
+
+	return entries, tx.Commit()
+}
+
+func insertGlobalWhitelistValues(tx *sqlx.Tx, action string, values []string) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (action, resource)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (resource) DO UPDATE SET action = EXCLUDED.action`, whitelist_globalTable)
+
+	_, err := tx.Exec(query, action, pq.Array(values))
+	return err
+}
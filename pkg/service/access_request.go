@@ -0,0 +1,164 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+var (
+	ErrAccessRequestNotFound = errors.New("access request not found")
+	ErrAccessRequestDecided  = errors.New("access request is already decided")
+)
+
+// AccessRequestService ведёт запросы учеников на доступ к заблокированным ресурсам
+type AccessRequestService struct {
+	repo      repository.AccessRequest
+	userRepo  repository.User
+	groupRepo repository.Group
+	policy    PolicyInvalidator
+	settings  SettingsReader
+}
+
+func NewAccessRequestService(repo repository.AccessRequest, userRepo repository.User, groupRepo repository.Group,
+	policy PolicyInvalidator, settings SettingsReader) *AccessRequestService {
+	return &AccessRequestService{repo: repo, userRepo: userRepo, groupRepo: groupRepo, policy: policy, settings: settings}
+}
+
+// Create регистрирует запрос от имени пользователя для его текущей группы
+func (s *AccessRequestService) Create(userId int, input classosbackend.AccessRequestInput) (classosbackend.AccessRequest, error) {
+	if err := input.Validate(); err != nil {
+		return classosbackend.AccessRequest{}, err
+	}
+
+	value, err := classosbackend.NormalizeWhitelistValue(input.URL)
+	if err != nil {
+		return classosbackend.AccessRequest{}, err
+	}
+
+	user, err := s.userRepo.GetById(0, userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.AccessRequest{}, ErrUserNotFound
+		}
+		return classosbackend.AccessRequest{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user.GroupID == nil {
+		return classosbackend.AccessRequest{}, fmt.Errorf("%w: user is not assigned to any group", classosbackend.ErrInvalidAccessRequest)
+	}
+
+	id, err := s.repo.Create(classosbackend.AccessRequest{
+		UserID:        userId,
+		GroupID:       *user.GroupID,
+		URL:           strings.TrimSpace(input.URL),
+		Value:         value,
+		Justification: strings.TrimSpace(input.Justification),
+	})
+	if err != nil {
+		return classosbackend.AccessRequest{}, err
+	}
+
+	return s.repo.GetById(id)
+}
+
+func (s *AccessRequestService) GetByUser(userId int) ([]classosbackend.AccessRequest, error) {
+	return s.repo.GetByUser(userId)
+}
+
+// GetAll возвращает запросы группы; groupId 0 - запросы всех доступных checkerId групп
+func (s *AccessRequestService) GetAll(checkerId, groupId int, status string) ([]classosbackend.AccessRequest, error) {
+	switch status {
+	case "", classosbackend.AccessRequestPending, classosbackend.AccessRequestApprovedOnce,
+		classosbackend.AccessRequestApproved, classosbackend.AccessRequestRejected:
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", classosbackend.ErrInvalidAccessRequest, status)
+	}
+
+	if groupId != 0 {
+		if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+			return nil, err
+		}
+		return s.repo.GetAll([]int{groupId}, status)
+	}
+
+	// Учитель без фильтра по группе видит запросы всех своих групп
+	scope, err := resolveScope(s.groupRepo, checkerId)
+	if err != nil {
+		return nil, err
+	}
+
+	if scope.All {
+		return s.repo.GetAll(nil, status)
+	}
+
+	return s.repo.GetAll(scope.GroupIDs, status)
+}
+
+// Decide применяет решение к ожидающему запросу. Разовое разрешение действует только для автора
+// запроса и истекает само: policyEvaluator не учитывает его после ExpiresAt
+func (s *AccessRequestService) Decide(checkerId int, requestId int64, input classosbackend.AccessDecisionInput) (classosbackend.AccessRequest, error) {
+	if err := input.Validate(); err != nil {
+		return classosbackend.AccessRequest{}, err
+	}
+
+	request, err := s.repo.GetById(requestId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.AccessRequest{}, ErrAccessRequestNotFound
+		}
+		return classosbackend.AccessRequest{}, err
+	}
+
+	if err := checkGroup(s.groupRepo, checkerId, request.GroupID); err != nil {
+		return classosbackend.AccessRequest{}, err
+	}
+
+	if request.Status != classosbackend.AccessRequestPending {
+		return classosbackend.AccessRequest{}, ErrAccessRequestDecided
+	}
+
+	comment := strings.TrimSpace(input.Comment)
+	switch input.Decision {
+	case classosbackend.AccessDecisionOnce:
+		fallback := time.Duration(s.settings.Int(classosbackend.SettingAccessGrantDuration)) * time.Minute
+		err = s.repo.ApproveOnce(requestId, checkerId, input.Duration(fallback), comment)
+	case classosbackend.AccessDecisionPermanent:
+		err = s.approvePermanent(checkerId, request, input, comment)
+	case classosbackend.AccessDecisionReject:
+		err = s.repo.Reject(requestId, checkerId, comment)
+	}
+	if err != nil {
+		// Запрос успели рассмотреть параллельно
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.AccessRequest{}, ErrAccessRequestDecided
+		}
+		return classosbackend.AccessRequest{}, err
+	}
+
+	return s.repo.GetById(requestId)
+}
+
+func (s *AccessRequestService) approvePermanent(checkerId int, request classosbackend.AccessRequest, input classosbackend.AccessDecisionInput, comment string) error {
+	value := request.Value
+	if input.Value != "" {
+		normalized, err := classosbackend.NormalizeWhitelistValue(input.Value)
+		if err != nil {
+			return err
+		}
+		value = normalized
+	}
+
+	entrySet, err := classosbackend.WhitelistInput{EntrySet: input.EntrySet}.Set()
+	if err != nil {
+		return err
+	}
+
+	defer s.policy.Invalidate(request.GroupID)
+	return s.repo.ApprovePermanent(request.ID, checkerId, entrySet, value, comment)
+}
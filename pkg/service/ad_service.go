@@ -2,12 +2,15 @@ package service
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"unicode/utf16"
 
 	"github.com/go-ldap/ldap/v3"
+	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/sirupsen/logrus"
 )
 
@@ -19,8 +22,21 @@ type ADUser struct {
 	Enabled           bool   `json:"enabled"`
 	DistinguishedName string `json:"distinguished_name"`
 	Password          string `json:"password"`
+	// Groups - CN групп из memberOf
+	Groups []string `json:"groups,omitempty"`
+	// MustChangePassword - пароль верный, но AD требует сменить его до входа
+	MustChangePassword bool `json:"must_change_password,omitempty"`
 }
 
+var (
+	ErrADUnavailable  = errors.New("active directory is unavailable")
+	ErrADUserNotFound  = errors.New("user not found in active directory")
+	ErrADGroupNotFound = errors.New("group not found in active directory")
+	// ErrADOUNotFound - OU из настроек нет в каталоге: пустой список в этом случае выглядел бы
+	// как каталог, из которого удалили всех
+	ErrADOUNotFound = errors.New("organizational unit not found in active directory")
+)
+
 type ADGroup struct {
 	Name              string `json:"name"`
 	Description       string `json:"description"`
@@ -35,9 +51,11 @@ type ADService struct {
 	bindPass string
 	useTLS   bool
 	enabled  bool
+	settings SettingsReader
 }
 
-func NewADService() *ADService {
+// NewADService читает параметры подключения из окружения, а OU и UPN-суффикс - из настроек
+func NewADService(settings SettingsReader) *ADService {
 	// Проверяем, включен ли AD
 	enabled := os.Getenv("AD_HOST") != "" &&
 		os.Getenv("AD_BIND_USER") != "" &&
@@ -58,6 +76,7 @@ func NewADService() *ADService {
 		bindPass: os.Getenv("AD_BIND_PASS"),
 		useTLS:   useTLS,
 		enabled:  enabled,
+		settings: settings,
 	}
 
 	logrus.WithFields(logrus.Fields{
@@ -72,21 +91,9 @@ func NewADService() *ADService {
 }
 
 func (ads *ADService) connect() (*ldap.Conn, error) {
-	if !ads.enabled {
-		return nil, fmt.Errorf("AD service is disabled")
-	}
-
-	var conn *ldap.Conn
-	var err error
-
-	address := fmt.Sprintf("%s:%s", ads.host, ads.port)
-
-	conn, err = ldap.DialTLS("tcp", address, &tls.Config{
-		InsecureSkipVerify: false,
-	})
-
+	conn, err := ads.dial()
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to AD: %w", err)
+		return nil, err
 	}
 
 	if err := conn.Bind(ads.bindUser, ads.bindPass); err != nil {
@@ -143,9 +150,7 @@ func (ads *ADService) CreateGroup(group ADGroup) error {
 	}
 	defer conn.Close()
 
-	fmt.Print("user: ", ads.bindUser, "|  pswrd: ", ads.bindPass, "|  baseDN: ", ads.baseDN)
-
-	groupDN := fmt.Sprintf("CN=%s, OU=classos_groups, %s", group.Name, ads.baseDN)
+	groupDN := fmt.Sprintf("CN=%s, OU=%s, %s", group.Name, ads.settings.String(classosbackend.SettingADGroupsOU), ads.baseDN)
 
 	logrus.WithFields(logrus.Fields{
 		"groupDN": groupDN,
@@ -178,9 +183,7 @@ func (ads *ADService) CreateUser(user ADUser, password string, groupname string)
 	}
 	defer conn.Close()
 
-	fmt.Print("user: ", ads.bindUser, "|  pswrd: ", ads.bindPass, "|  baseDN: ", ads.baseDN)
-
-	userDN := fmt.Sprintf("CN=%s, OU=classos_users, %s", user.DisplayName, ads.baseDN)
+	userDN := fmt.Sprintf("CN=%s, OU=%s, %s", user.DisplayName, ads.settings.String(classosbackend.SettingADDefaultOU), ads.baseDN)
 
 	logrus.WithFields(logrus.Fields{
 		"userDN": userDN,
@@ -203,7 +206,7 @@ func (ads *ADService) CreateUser(user ADUser, password string, groupname string)
 	addRequest.Attribute("displayName", []string{user.DisplayName})
 	addRequest.Attribute("sAMAccountName", []string{user.SamAccountName})
 	addRequest.Attribute("userPrincipalName", []string{
-		fmt.Sprintf("%s@school.local", user.SamAccountName),
+		fmt.Sprintf("%s@%s", user.SamAccountName, ads.settings.String(classosbackend.SettingADUPNSuffix)),
 	})
 	addRequest.Attribute("userAccountControl", []string{"514"})
 
@@ -218,13 +221,6 @@ func (ads *ADService) CreateUser(user ADUser, password string, groupname string)
 		}
 	}
 
-	// modReq := ldap.NewModifyRequest(userDN, []ldap.Control{})
-    // modReq.Replace("pwdLastSet", []string{"0"})
-    // if err := conn.Modify(modReq); err != nil {
-    //     ads.deleteUserByDN(conn, userDN)
-    //     return fmt.Errorf("failed to force password reset: %w", err)
-    // }
-
 	if user.Enabled {
 		if err := ads.enableUser(conn, userDN); err != nil {
 			ads.deleteUserByDN(conn, userDN)
@@ -255,6 +251,18 @@ func (ads *ADService) setUserPassword(conn *ldap.Conn, userDN, password string)
 	return nil
 }
 
+// requirePasswordChange выставляет pwdLastSet=0: при следующем входе AD потребует сменить пароль
+func (ads *ADService) requirePasswordChange(conn *ldap.Conn, userDN string) error {
+	modifyRequest := ldap.NewModifyRequest(userDN, nil)
+	modifyRequest.Replace("pwdLastSet", []string{"0"})
+
+	if err := conn.Modify(modifyRequest); err != nil {
+		return fmt.Errorf("failed to force password change: %w", err)
+	}
+
+	return nil
+}
+
 func (ads *ADService) enableUser(conn *ldap.Conn, userDN string) error {
 	modifyRequest := ldap.NewModifyRequest(userDN, nil)
 	modifyRequest.Replace("userAccountControl", []string{"66048"}) 
@@ -280,7 +288,7 @@ func (ads *ADService) encodePasswordForAD(password string) []byte {
 	return passwordBytes
 }
 
-func (ads *ADService) UpdateUser(username string, updates ADUser, groupname string) error {
+func (ads *ADService) UpdateUser(username string, updates ADUser) error {
     if !ads.enabled {
         return fmt.Errorf("AD service is disabled")
     }
@@ -302,6 +310,14 @@ func (ads *ADService) UpdateUser(username string, updates ADUser, groupname stri
         modifyReq.Replace("displayName", []string{updates.DisplayName})
     }
 
+	// CN учётной записи - отображаемое имя, поэтому смена логина не меняет DN
+	if updates.SamAccountName != "" && updates.SamAccountName != username {
+		modifyReq.Replace("sAMAccountName", []string{updates.SamAccountName})
+		modifyReq.Replace("userPrincipalName", []string{
+			fmt.Sprintf("%s@%s", updates.SamAccountName, ads.settings.String(classosbackend.SettingADUPNSuffix)),
+		})
+	}
+
     if len(modifyReq.Changes) > 0 {
         if err := conn.Modify(modifyReq); err != nil {
             return fmt.Errorf("failed to modify user attributes: %w", err)
@@ -314,12 +330,6 @@ func (ads *ADService) UpdateUser(username string, updates ADUser, groupname stri
         }
     }
 
-	if groupname != "" {
-		if err := ads.MoveUserToAnotherGroup(username, groupname); err != nil {
-			return fmt.Errorf("failed to move to another group: %w", err)
-		}
-	}
-
     logrus.WithField("userDN", userDN).Info("AD user updated successfully")
     return nil
 }
@@ -377,6 +387,212 @@ func (ads *ADService) ChangeUserPassword(username, newPassword string) error {
 	return nil
 }
 
+// ResetPassword задаёт пароль администратором и при mustChange требует сменить его при следующем входе
+func (ads *ADService) ResetPassword(username, password string, mustChange bool) error {
+	conn, err := ads.connect()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	userDN, err := ads.findUserDN(conn, username)
+	if err != nil {
+		return err
+	}
+
+	if err := ads.setUserPassword(conn, userDN, password); err != nil {
+		return err
+	}
+
+	if mustChange {
+		if err := ads.requirePasswordChange(conn, userDN); err != nil {
+			return err
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{"userDN": userDN, "must_change": mustChange}).Info("AD user password reset")
+	return nil
+}
+
+// dial открывает соединение с AD без bind
+func (ads *ADService) dial() (*ldap.Conn, error) {
+	if !ads.enabled {
+		return nil, fmt.Errorf("AD service is disabled")
+	}
+
+	address := fmt.Sprintf("%s:%s", ads.host, ads.port)
+
+	conn, err := ldap.DialTLS("tcp", address, &tls.Config{
+		InsecureSkipVerify: false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to AD: %w", err)
+	}
+
+	return conn, nil
+}
+
+// Authenticate проверяет пароль bind-ом от имени пользователя и возвращает его атрибуты из AD.
+// Ошибки ErrADUnavailable и ErrADUserNotFound означают, что AD не может принять решение
+func (ads *ADService) Authenticate(username, password string) (ADUser, error) {
+	if !ads.enabled {
+		return ADUser{}, fmt.Errorf("%w: AD service is disabled", ErrADUnavailable)
+	}
+
+	// Bind с пустым паролем в LDAP считается анонимным и проходит успешно
+	if password == "" {
+		return ADUser{}, ErrInvalidCredentials
+	}
+
+	conn, err := ads.connect()
+	if err != nil {
+		return ADUser{}, fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	searchRequest := ldap.NewSearchRequest(
+		ads.baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2, 0, false,
+		fmt.Sprintf("(&(objectClass=user)(!(objectClass=computer))(sAMAccountName=%s))", ldap.EscapeFilter(username)),
+		[]string{"sAMAccountName", "displayName", "mail", "userPrincipalName", "userAccountControl", "memberOf"},
+		nil,
+	)
+
+	searchResult, err := conn.Search(searchRequest)
+	if err != nil {
+		return ADUser{}, fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+
+	if len(searchResult.Entries) != 1 {
+		return ADUser{}, ErrADUserNotFound
+	}
+	entry := searchResult.Entries[0]
+
+	userConn, err := ads.dial()
+	if err != nil {
+		return ADUser{}, fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer userConn.Close()
+
+	mustChange := false
+	if err := userConn.Bind(entry.DN, password); err != nil {
+		switch {
+		case passwordChangeRequired(err):
+			mustChange = true
+		case accountDisabled(err):
+			return ADUser{}, ErrUserDisabled
+		case ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials):
+			return ADUser{}, ErrInvalidCredentials
+		default:
+			return ADUser{}, fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+		}
+	}
+
+	groups := make([]string, 0)
+	for _, groupDN := range entry.GetAttributeValues("memberOf") {
+		groups = append(groups, extractCN(groupDN))
+	}
+
+	return ADUser{
+		SamAccountName:     entry.GetAttributeValue("sAMAccountName"),
+		DisplayName:        entry.GetAttributeValue("displayName"),
+		EmailAddress:       entry.GetAttributeValue("mail"),
+		UserPrincipalName:  entry.GetAttributeValue("userPrincipalName"),
+		DistinguishedName:  entry.DN,
+		Enabled:            ads.isUserEnabled(entry.GetAttributeValue("userAccountControl")),
+		Groups:             groups,
+		MustChangePassword: mustChange,
+	}, nil
+}
+
+// passwordChangeRequired распознаёт отказ bind-а, который AD возвращает только для верного пароля:
+// data 773 - пароль нужно сменить (pwdLastSet=0), data 532 - срок действия пароля истёк
+func passwordChangeRequired(err error) bool {
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return false
+	}
+
+	return strings.Contains(err.Error(), "data 773") || strings.Contains(err.Error(), "data 532")
+}
+
+// accountDisabled распознаёт отказ bind-а для отключённой учётной записи (data 533)
+func accountDisabled(err error) bool {
+	return ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) && strings.Contains(err.Error(), "data 533")
+}
+
+// ExistingUsers возвращает, какие из sAMAccountName уже заняты в AD (ключи в нижнем регистре)
+func (ads *ADService) ExistingUsers(usernames []string) (map[string]bool, error) {
+	return ads.existing("user", "sAMAccountName", usernames)
+}
+
+// ExistingGroups возвращает, какие из групп есть в AD (ключи в нижнем регистре)
+func (ads *ADService) ExistingGroups(names []string) (map[string]bool, error) {
+	return ads.existing("group", "cn", names)
+}
+
+// existing ищет объекты пачками по значению атрибута через одно соединение
+func (ads *ADService) existing(objectClass, attribute string, values []string) (map[string]bool, error) {
+	if !ads.enabled {
+		return nil, fmt.Errorf("%w: AD service is disabled", ErrADUnavailable)
+	}
+
+	conn, err := ads.connect()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	const batchSize = 100
+
+	found := make(map[string]bool, len(values))
+	for start := 0; start < len(values); start += batchSize {
+		end := start + batchSize
+		if end > len(values) {
+			end = len(values)
+		}
+
+		var filter strings.Builder
+		for _, value := range values[start:end] {
+			fmt.Fprintf(&filter, "(%s=%s)", attribute, ldap.EscapeFilter(value))
+		}
+
+		searchRequest := ldap.NewSearchRequest(
+			ads.baseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			0, 0, false,
+			fmt.Sprintf("(&(objectClass=%s)(|%s))", objectClass, filter.String()),
+			[]string{attribute},
+			nil,
+		)
+
+		searchResult, err := conn.Search(searchRequest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+		}
+
+		for _, entry := range searchResult.Entries {
+			found[strings.ToLower(entry.GetAttributeValue(attribute))] = true
+		}
+	}
+
+	return found, nil
+}
+
+// isADUnavailable отличает недоступность AD от ошибки в данных конкретного объекта
+// ошибки LDAP приходят обёрнутыми, поэтому код результата достаётся через errors.As
+func isADUnavailable(err error) bool {
+	if errors.Is(err, ErrADUnavailable) {
+		return true
+	}
+
+	var ldapErr *ldap.Error
+	return errors.As(err, &ldapErr) &&
+		ldap.IsErrorAnyOf(ldapErr, ldap.ErrorNetwork, ldap.LDAPResultBusy, ldap.LDAPResultUnavailable)
+}
+
 // Находит DN пользователя по sAMAccountName
 func (ads *ADService) findUserDN(conn *ldap.Conn, username string) (string, error) {
 	searchRequest := ldap.NewSearchRequest(
@@ -395,12 +611,30 @@ func (ads *ADService) findUserDN(conn *ldap.Conn, username string) (string, erro
 	}
 
 	if len(searchResult.Entries) == 0 {
-		return "", fmt.Errorf("user %s not found", username)
+		return "", fmt.Errorf("%w: %s", ErrADUserNotFound, username)
 	}
 
 	return searchResult.Entries[0].DN, nil
 }
 
+// UserExists проверяет, занят ли sAMAccountName в AD
+func (ads *ADService) UserExists(username string) (bool, error) {
+	conn, err := ads.connect()
+	if err != nil {
+		return false, fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	if _, err := ads.findUserDN(conn, username); err != nil {
+		if errors.Is(err, ErrADUserNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+
+	return true, nil
+}
+
 // Создает группу в AD
 // func (ads *ADService) CreateGroup(group ADGroup) error {
 // 	if !ads.enabled {
@@ -510,7 +744,7 @@ func (ads *ADService) findGroupDN(conn *ldap.Conn, groupName string) (string, er
 	}
 
 	if len(searchResult.Entries) == 0 {
-		return "", fmt.Errorf("group %s not found", groupName)
+		return "", fmt.Errorf("%w: %s", ErrADGroupNotFound, groupName)
 	}
 
 	return searchResult.Entries[0].DN, nil
@@ -552,6 +786,38 @@ func (ads *ADService) AddUserToGroup(username, groupName string) error {
 	return nil
 }
 
+// RemoveUserFromGroup убирает пользователя из группы; если он не состоял в ней, ничего не делает
+func (ads *ADService) RemoveUserFromGroup(username, groupName string) error {
+	conn, err := ads.connect()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	userDN, err := ads.findUserDN(conn, username)
+	if err != nil {
+		return err
+	}
+
+	groupDN, err := ads.findGroupDN(conn, groupName)
+	if err != nil {
+		return err
+	}
+
+	modifyRequest := ldap.NewModifyRequest(groupDN, nil)
+	modifyRequest.Delete("member", []string{userDN})
+	if err := conn.Modify(modifyRequest); err != nil {
+		// AD отвечает на удаление отсутствующего участника кодом unwillingToPerform
+		if ldap.IsErrorAnyOf(err, ldap.LDAPResultNoSuchAttribute, ldap.LDAPResultUnwillingToPerform) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove user from group in AD: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{"userDN": userDN, "groupDN": groupDN}).Info("User removed from AD group")
+	return nil
+}
+
 func (ads *ADService) MoveUserToAnotherGroup(username, groupName string) error {
 	if !ads.enabled {
 		return fmt.Errorf("AD service is disabled")
@@ -591,7 +857,7 @@ func (ads *ADService) MoveUserToAnotherGroup(username, groupName string) error {
 		"groupDN": groupDN,
 	}).Info("User removed from AD group successfully")
 
-	if err := ads.AddUserToGroup(username, groupname); err != nil {
+	if err := ads.AddUserToGroup(username, groupName); err != nil {
 		return fmt.Errorf("failed user to add to a group: %w", err)
 	}
 
@@ -682,22 +948,359 @@ func (ads *ADService) GetAllUsers() ([]ADUser, error) {
 	return users, nil
 }
 
-func (ads *ADService) isUserEnabled(userAccountControl string) bool {
-	// userAccountControl: 512 = enabled, 514 = disabled
-	return userAccountControl == "512"
+// adPageSize - размер страницы поиска: AD по умолчанию отдаёт не больше 1000 записей за запрос
+const adPageSize = 500
+
+// ListUsers возвращает учётные записи из OU пользователей classOS. Groups содержит только
+// группы из OU групп classOS
+func (ads *ADService) ListUsers() ([]ADUser, error) {
+	if !ads.enabled {
+		return nil, fmt.Errorf("%w: AD service is disabled", ErrADUnavailable)
+	}
+
+	conn, err := ads.connect()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	entries, err := ads.searchOU(conn, ads.settings.String(classosbackend.SettingADDefaultOU),
+		"(&(objectCategory=person)(objectClass=user))",
+		[]string{"sAMAccountName", "displayName", "userPrincipalName", "userAccountControl", "memberOf"})
+	if err != nil {
+		return nil, err
+	}
+
+	groupsOU, err := ldap.ParseDN(ads.ouDN(ads.settings.String(classosbackend.SettingADGroupsOU)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid groups OU: %w", err)
+	}
+
+	users := make([]ADUser, 0, len(entries))
+	for _, entry := range entries {
+		user := ADUser{
+			SamAccountName:    entry.GetAttributeValue("sAMAccountName"),
+			DisplayName:       entry.GetAttributeValue("displayName"),
+			UserPrincipalName: entry.GetAttributeValue("userPrincipalName"),
+			DistinguishedName: entry.DN,
+			Enabled:           ads.isUserEnabled(entry.GetAttributeValue("userAccountControl")),
+			Groups:            make([]string, 0),
+		}
+
+		for _, groupDN := range entry.GetAttributeValues("memberOf") {
+			dn, err := ldap.ParseDN(groupDN)
+			if err != nil || len(dn.RDNs) == 0 || !groupsOU.AncestorOfFold(dn) {
+				continue
+			}
+			user.Groups = append(user.Groups, dn.RDNs[0].Attributes[0].Value)
+		}
+
+		users = append(users, user)
+	}
+
+	return users, nil
 }
 
-func (ads *ADService) SyncAllUsersFromAD() error {
+// ListGroups возвращает группы из OU групп classOS
+func (ads *ADService) ListGroups() ([]ADGroup, error) {
 	if !ads.enabled {
-		return fmt.Errorf("AD service is disabled")
+		return nil, fmt.Errorf("%w: AD service is disabled", ErrADUnavailable)
+	}
+
+	conn, err := ads.connect()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	entries, err := ads.searchOU(conn, ads.settings.String(classosbackend.SettingADGroupsOU), "(objectClass=group)",
+		[]string{"cn", "description"})
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]ADGroup, 0, len(entries))
+	for _, entry := range entries {
+		groups = append(groups, ADGroup{
+			Name:              entry.GetAttributeValue("cn"),
+			Description:       entry.GetAttributeValue("description"),
+			DistinguishedName: entry.DN,
+		})
+	}
+
+	return groups, nil
+}
+
+// searchOU ищет объекты в OU постранично. Отсутствующая OU - ошибка ErrADOUNotFound, а не
+// пустой результат: её отличают от OU без объектов
+func (ads *ADService) searchOU(conn *ldap.Conn, ou, filter string, attributes []string) ([]*ldap.Entry, error) {
+	searchRequest := ldap.NewSearchRequest(
+		ads.ouDN(ou),
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		attributes,
+		nil,
+	)
+
+	searchResult, err := conn.SearchWithPaging(searchRequest, adPageSize)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, fmt.Errorf("%w: %s", ErrADOUNotFound, ou)
+		}
+		return nil, fmt.Errorf("%w: failed to search OU %s: %s", ErrADUnavailable, ou, err.Error())
+	}
+
+	return searchResult.Entries, nil
+}
+
+func (ads *ADService) ouDN(name string) string {
+	return fmt.Sprintf("OU=%s,%s", ldap.EscapeDN(name), ads.baseDN)
+}
+
+// uacAccountDisable - бит ACCOUNTDISABLE в userAccountControl; остальные биты (например,
+// DONT_EXPIRE_PASSWORD в 66048) на включённость не влияют
+const uacAccountDisable = 0x2
+
+func (ads *ADService) isUserEnabled(userAccountControl string) bool {
+	uac, err := strconv.Atoi(userAccountControl)
+	if err != nil {
+		return false
+	}
+
+	return uac&uacAccountDisable == 0
+}
+
+// SetUserEnabled меняет только бит ACCOUNTDISABLE, сохраняя остальные флаги учётной записи
+func (ads *ADService) SetUserEnabled(username string, enabled bool) error {
+	conn, err := ads.connect()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	searchRequest := ldap.NewSearchRequest(
+		ads.baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		1, 0, false,
+		fmt.Sprintf("(&(objectClass=user)(sAMAccountName=%s))", ldap.EscapeFilter(username)),
+		[]string{"userAccountControl"},
+		nil,
+	)
+
+	searchResult, err := conn.Search(searchRequest)
+	if err != nil {
+		return fmt.Errorf("failed to search user in AD: %w", err)
+	}
+	if len(searchResult.Entries) == 0 {
+		return fmt.Errorf("%w: %s", ErrADUserNotFound, username)
+	}
+	entry := searchResult.Entries[0]
+
+	uac, err := strconv.Atoi(entry.GetAttributeValue("userAccountControl"))
+	if err != nil {
+		return fmt.Errorf("invalid userAccountControl of %s: %w", username, err)
+	}
+
+	if enabled {
+		uac &^= uacAccountDisable
+	} else {
+		uac |= uacAccountDisable
+	}
+
+	modifyRequest := ldap.NewModifyRequest(entry.DN, nil)
+	modifyRequest.Replace("userAccountControl", []string{strconv.Itoa(uac)})
+	if err := conn.Modify(modifyRequest); err != nil {
+		return fmt.Errorf("failed to update userAccountControl: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{"userDN": entry.DN, "enabled": enabled}).Info("AD user account state changed")
+	return nil
+}
+
+// ArchiveUser переносит учётную запись в OU архива и отключает её. В архиве запись получает
+// имя CN=<логин>, чтобы не конфликтовать с однофамильцами из других OU. Возвращает прежний DN
+func (ads *ADService) ArchiveUser(username string) (string, error) {
+	conn, err := ads.connect()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	userDN, err := ads.findUserDN(conn, username)
+	if err != nil {
+		return "", err
 	}
 
-	users, err := ads.GetAllUsers()
+	archivedDN, err := ads.moveToArchive(conn, userDN, "CN="+ldap.EscapeDN(username))
 	if err != nil {
+		return "", err
+	}
+
+	if err := ads.SetUserEnabled(username, false); err != nil {
+		if err := ads.moveDN(conn, archivedDN, userDN); err != nil {
+			logrus.WithError(err).WithField("userDN", userDN).Error("failed to move user back from archive")
+		}
+		return "", err
+	}
+
+	logrus.WithFields(logrus.Fields{"userDN": userDN, "archivedDN": archivedDN}).Info("AD user archived")
+	return userDN, nil
+}
+
+// RestoreUser возвращает учётную запись на прежнее место и включает её, если enabled.
+// Повторный вызов безопасен: запись, уже стоящая на месте, не переносится. Пустой originalDN
+// значит, что в архив AD запись не переносилась (например, в режиме DB-only): её достаточно включить
+func (ads *ADService) RestoreUser(username, originalDN string, enabled bool) error {
+	if originalDN == "" {
+		if !enabled {
+			return nil
+		}
+		if err := ads.SetUserEnabled(username, true); err != nil && !errors.Is(err, ErrADUserNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	conn, err := ads.connect()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	userDN, err := ads.findUserDN(conn, username)
+	if err != nil {
+		return err
+	}
+
+	if err := ads.moveDN(conn, userDN, originalDN); err != nil {
 		return err
 	}
 
-	logrus.WithField("count", len(users)).Info("Synced users from AD")
-	// Здесь может быть логика синхронизации с БД
+	if enabled {
+		if err := ads.SetUserEnabled(username, true); err != nil {
+			return err
+		}
+	}
+
+	logrus.WithField("userDN", originalDN).Info("AD user restored from archive")
 	return nil
 }
+
+// ArchiveGroup переносит группу в OU архива с тем же CN и возвращает её прежний DN
+func (ads *ADService) ArchiveGroup(groupName string) (string, error) {
+	conn, err := ads.connect()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	groupDN, err := ads.findGroupDN(conn, groupName)
+	if err != nil {
+		return "", err
+	}
+
+	rdn, _ := splitDN(groupDN)
+	archivedDN, err := ads.moveToArchive(conn, groupDN, rdn)
+	if err != nil {
+		return "", err
+	}
+
+	logrus.WithFields(logrus.Fields{"groupDN": groupDN, "archivedDN": archivedDN}).Info("AD group archived")
+	return groupDN, nil
+}
+
+// RestoreGroup возвращает группу на прежнее место. Пустой originalDN - группа не переносилась
+func (ads *ADService) RestoreGroup(groupName, originalDN string) error {
+	if originalDN == "" {
+		return nil
+	}
+
+	conn, err := ads.connect()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrADUnavailable, err.Error())
+	}
+	defer conn.Close()
+
+	groupDN, err := ads.findGroupDN(conn, groupName)
+	if err != nil {
+		return err
+	}
+
+	if err := ads.moveDN(conn, groupDN, originalDN); err != nil {
+		return err
+	}
+
+	logrus.WithField("groupDN", originalDN).Info("AD group restored from archive")
+	return nil
+}
+
+// moveToArchive переносит объект в OU архива под именем rdn и возвращает его новый DN
+func (ads *ADService) moveToArchive(conn *ldap.Conn, dn, rdn string) (string, error) {
+	archiveDN, err := ads.ensureOU(conn, ads.settings.String(classosbackend.SettingADArchiveOU))
+	if err != nil {
+		return "", err
+	}
+
+	archivedDN := rdn + "," + archiveDN
+	if err := ads.moveDN(conn, dn, archivedDN); err != nil {
+		return "", err
+	}
+
+	return archivedDN, nil
+}
+
+// moveDN переименовывает и переносит объект так, чтобы его DN стал newDN
+func (ads *ADService) moveDN(conn *ldap.Conn, dn, newDN string) error {
+	if strings.EqualFold(normalizeDN(dn), normalizeDN(newDN)) {
+		return nil
+	}
+
+	rdn, parent := splitDN(newDN)
+	modifyRequest := ldap.NewModifyDNRequest(dn, rdn, true, parent)
+	if err := conn.ModifyDN(modifyRequest); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", dn, newDN, err)
+	}
+
+	return nil
+}
+
+// ensureOU создаёт OU под базовым DN, если её ещё нет, и возвращает её DN
+func (ads *ADService) ensureOU(conn *ldap.Conn, name string) (string, error) {
+	ouDN := ads.ouDN(name)
+
+	addRequest := ldap.NewAddRequest(ouDN, nil)
+	addRequest.Attribute("objectClass", []string{"top", "organizationalUnit"})
+	addRequest.Attribute("ou", []string{name})
+	if err := conn.Add(addRequest); err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultEntryAlreadyExists) {
+		return "", fmt.Errorf("failed to create OU %s: %w", name, err)
+	}
+
+	return ouDN, nil
+}
+
+// splitDN отделяет первый RDN от DN родителя с учётом экранированных запятых
+func splitDN(dn string) (string, string) {
+	for i := 0; i < len(dn); i++ {
+		switch dn[i] {
+		case '\\':
+			i++
+		case ',':
+			return strings.TrimSpace(dn[:i]), strings.TrimSpace(dn[i+1:])
+		}
+	}
+
+	return strings.TrimSpace(dn), ""
+}
+
+// normalizeDN убирает пробелы вокруг запятых: DN вида "CN=a, OU=b" и "CN=a,OU=b" совпадают
+func normalizeDN(dn string) string {
+	rdn, parent := splitDN(dn)
+	if parent == "" {
+		return rdn
+	}
+
+	return rdn + "," + normalizeDN(parent)
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrArchived       = errors.New("object is archived")
+	ErrNotArchived    = errors.New("object is not archived")
+	ErrArchiveExpired = errors.New("retention period of the archived object has expired")
+	ErrArchiveSelf    = errors.New("cannot archive your own account")
+	ErrArchiveAdmin   = errors.New("cannot archive the built-in administrator")
+)
+
+// ArchivePurgeInterval - как часто фоновая очистка удаляет архив с истёкшим сроком хранения
+const ArchivePurgeInterval = time.Hour
+
+// superAdminUsername - встроенная учётная запись администратора, её нельзя архивировать
+const superAdminUsername = "admin01"
+
+// ArchiveService заменяет удаление пользователей и групп архивом: объекты скрываются из списков
+// и до истечения archive.retention восстанавливаются, а очередь DirectoryOutbox отключает их и
+// переносит в OU архива AD. Окончательно их удаляет Purge
+type ArchiveService struct {
+	userRepo  repository.User
+	groupRepo repository.Group
+	outbox    *DirectoryOutbox
+	tokens    TokenInvalidator
+	settings  SettingsReader
+}
+
+func NewArchiveService(userRepo repository.User, groupRepo repository.Group, outbox *DirectoryOutbox, tokens TokenInvalidator,
+	settings SettingsReader) *ArchiveService {
+	return &ArchiveService{userRepo: userRepo, groupRepo: groupRepo, outbox: outbox, tokens: tokens, settings: settings}
+}
+
+func (s *ArchiveService) GetUsers(checkerId int) ([]classosbackend.User, error) {
+	users, err := s.userRepo.GetArchived()
+	if err != nil {
+		return nil, err
+	}
+
+	return filterUsers(s.groupRepo, checkerId, users)
+}
+
+func (s *ArchiveService) GetGroups(checkerId int) ([]classosbackend.Group, error) {
+	groups, err := s.groupRepo.GetArchived()
+	if err != nil {
+		return nil, err
+	}
+
+	return filterGroups(s.groupRepo, checkerId, groups)
+}
+
+// ArchiveUser сразу отзывает токены пользователя, а его учётную запись в AD отключает очередь
+func (s *ArchiveService) ArchiveUser(checkerId, userId int) error {
+	if checkerId == userId {
+		return ErrArchiveSelf
+	}
+
+	user, err := checkActiveUser(s.userRepo, s.groupRepo, checkerId, userId)
+	if err != nil {
+		return err
+	}
+
+	if user.Username == superAdminUsername {
+		return ErrArchiveAdmin
+	}
+
+	tx, err := s.userRepo.BeginTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	defer s.tokens.InvalidateTokens(user.ID)
+
+	if err := s.archiveUserWithTx(tx, user, time.Now()); err != nil {
+		return err
+	}
+
+	return s.commit(tx)
+}
+
+// RestoreUser возвращает пользователя из архива. Пользователь архивированной группы
+// восстанавливается только вместе с ней
+func (s *ArchiveService) RestoreUser(checkerId, userId int) error {
+	user, err := checkModifiableUser(s.userRepo, s.groupRepo, checkerId, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkRestorable(user.ArchivedAt); err != nil {
+		return err
+	}
+
+	if user.GroupID != nil {
+		group, err := s.groupRepo.GetById(0, *user.GroupID)
+		if err != nil {
+			return fmt.Errorf("failed to get group: %w", err)
+		}
+		if group.ArchivedAt != nil {
+			return fmt.Errorf("%w: group %s, restore the group first", ErrArchived, group.Name)
+		}
+	}
+
+	tx, err := s.userRepo.BeginTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.restoreUserWithTx(tx, user); err != nil {
+		return err
+	}
+
+	return s.commit(tx)
+}
+
+// ArchiveGroup архивирует группу вместе с её учениками, присваивая им одно время архивации:
+// по нему RestoreGroup находит учеников, которых нужно вернуть. Учителя и администраторы,
+// состоящие в группе, остаются активными
+func (s *ArchiveService) ArchiveGroup(checkerId, groupId int) error {
+	if err := requireAllGroups(s.groupRepo, checkerId); err != nil {
+		return err
+	}
+
+	group, err := checkActiveGroup(s.groupRepo, checkerId, groupId)
+	if err != nil {
+		return err
+	}
+
+	members, err := s.userRepo.GetByGroup(groupId)
+	if err != nil {
+		return fmt.Errorf("failed to get group users: %w", err)
+	}
+
+	tx, err := s.groupRepo.BeginTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	archivedAt := time.Now()
+	for _, member := range members {
+		if member.Role != classosbackend.RoleClient || member.ID == checkerId {
+			continue
+		}
+		defer s.tokens.InvalidateTokens(member.ID)
+		if err := s.archiveUserWithTx(tx, member, archivedAt); err != nil {
+			return fmt.Errorf("user %s: %w", member.Username, err)
+		}
+	}
+
+	if err := s.groupRepo.ArchiveWithTx(tx, groupId, archivedAt, ""); err != nil {
+		return fmt.Errorf("failed to archive group in DB: %w", err)
+	}
+
+	err = s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpArchiveGroup, classosbackend.DirectoryOperationPayload{
+		Group: group.Name,
+	}, "")
+	if err != nil {
+		return err
+	}
+
+	return s.commit(tx)
+}
+
+// RestoreGroup возвращает группу и учеников, архивированных вместе с ней
+func (s *ArchiveService) RestoreGroup(checkerId, groupId int) error {
+	if err := requireAllGroups(s.groupRepo, checkerId); err != nil {
+		return err
+	}
+
+	group, err := s.groupRepo.GetById(checkerId, groupId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrGroupNotFound
+		}
+		return fmt.Errorf("failed to get group: %w", err)
+	}
+
+	if err := s.checkRestorable(group.ArchivedAt); err != nil {
+		return err
+	}
+
+	members, err := s.userRepo.GetArchivedWithGroup(groupId)
+	if err != nil {
+		return fmt.Errorf("failed to get group users: %w", err)
+	}
+
+	tx, err := s.groupRepo.BeginTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Группа восстанавливается в AD раньше учеников: они возвращаются в её состав
+	if err := s.groupRepo.RestoreWithTx(tx, groupId); err != nil {
+		return fmt.Errorf("failed to restore group in DB: %w", err)
+	}
+
+	err = s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpRestoreGroup, classosbackend.DirectoryOperationPayload{
+		Group:      group.Name,
+		OriginalDN: archivedFrom(group.ArchivedFrom),
+	}, "")
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if err := s.restoreUserWithTx(tx, member); err != nil {
+			return fmt.Errorf("user %s: %w", member.Username, err)
+		}
+	}
+
+	return s.commit(tx)
+}
+
+// Purge окончательно удаляет пользователей и группы, чей срок хранения в архиве истёк.
+// Каждый объект удаляется из БД в одной транзакции с постановкой его удаления из AD в очередь,
+// поэтому очистка не зависит от доступности AD. Группа удаляется только после всех своих
+// архивированных участников: пока они ждут очистки, их восстанавливают вместе с группой
+func (s *ArchiveService) Purge() error {
+	before := time.Now().Add(-s.settings.Duration(classosbackend.SettingArchiveRetention))
+
+	users, err := s.userRepo.GetArchivedBefore(before)
+	if err != nil {
+		return fmt.Errorf("failed to get expired users: %w", err)
+	}
+
+	purgedUsers := 0
+	for _, user := range users {
+		err := s.purge(func(tx *sql.Tx) error {
+			if err := s.userRepo.DeleteWithTx(tx, 0, user.ID); err != nil {
+				return fmt.Errorf("failed to delete user from DB: %w", err)
+			}
+			return s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpDeleteUser, classosbackend.DirectoryOperationPayload{
+				Username: user.Username,
+			}, "")
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("username", user.Username).Error("archive purge: failed to delete user")
+			continue
+		}
+		purgedUsers++
+	}
+
+	groups, err := s.groupRepo.GetArchivedBefore(before)
+	if err != nil {
+		return fmt.Errorf("failed to get expired groups: %w", err)
+	}
+
+	purgedGroups := 0
+	for _, group := range groups {
+		members, err := s.userRepo.CountArchivedInGroup(int(group.ID))
+		if err != nil {
+			logrus.WithError(err).WithField("group", group.Name).Error("archive purge: failed to count archived members")
+			continue
+		}
+		if members > 0 {
+			logrus.WithFields(logrus.Fields{"group": group.Name, "members": members}).
+				Warn("archive purge: group kept until its archived members are purged")
+			continue
+		}
+
+		err = s.purge(func(tx *sql.Tx) error {
+			if err := s.groupRepo.DeleteWithTx(tx, 0, int(group.ID)); err != nil {
+				return fmt.Errorf("failed to delete group from DB: %w", err)
+			}
+			return s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpDeleteGroup, classosbackend.DirectoryOperationPayload{
+				Group: group.Name,
+			}, "")
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("group", group.Name).Error("archive purge: failed to delete group")
+			continue
+		}
+		purgedGroups++
+	}
+
+	if purgedUsers > 0 || purgedGroups > 0 {
+		s.outbox.Notify()
+		logrus.WithFields(logrus.Fields{"users": purgedUsers, "groups": purgedGroups}).Info("archive purge completed")
+	}
+
+	return nil
+}
+
+func (s *ArchiveService) purge(delete func(tx *sql.Tx) error) error {
+	tx, err := s.userRepo.BeginTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := delete(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Run запускает Purge сразу и затем каждые interval, пока не отменён ctx
+func (s *ArchiveService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Purge(); err != nil {
+			logrus.WithError(err).Warn("archive purge skipped")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archiveUserWithTx архивирует пользователя в БД и ставит его архивацию в AD в очередь.
+// Прежний DN запоминает сама очередь, поэтому archived_from новых записей пуст
+func (s *ArchiveService) archiveUserWithTx(tx *sql.Tx, user classosbackend.User, archivedAt time.Time) error {
+	if err := s.userRepo.ArchiveWithTx(tx, user.ID, archivedAt, ""); err != nil {
+		return fmt.Errorf("failed to archive user in DB: %w", err)
+	}
+
+	return s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpArchiveUser, classosbackend.DirectoryOperationPayload{
+		Username: user.Username,
+	}, "")
+}
+
+func (s *ArchiveService) restoreUserWithTx(tx *sql.Tx, user classosbackend.User) error {
+	if err := s.userRepo.RestoreWithTx(tx, user.ID); err != nil {
+		return fmt.Errorf("failed to restore user in DB: %w", err)
+	}
+
+	return s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpRestoreUser, classosbackend.DirectoryOperationPayload{
+		Username:   user.Username,
+		OriginalDN: archivedFrom(user.ArchivedFrom),
+		Enabled:    &user.Enabled,
+	}, "")
+}
+
+func (s *ArchiveService) commit(tx *sql.Tx) error {
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.outbox.Notify()
+
+	return nil
+}
+
+// checkRestorable пропускает только архивированные объекты, срок хранения которых не истёк
+func (s *ArchiveService) checkRestorable(archivedAt *time.Time) error {
+	if archivedAt == nil {
+		return ErrNotArchived
+	}
+
+	if time.Since(*archivedAt) > s.settings.Duration(classosbackend.SettingArchiveRetention) {
+		return ErrArchiveExpired
+	}
+
+	return nil
+}
+
+// archivedFrom возвращает прежний DN объекта, записанный до появления очереди, или пустую строку
+func archivedFrom(dn *string) string {
+	if dn == nil {
+		return ""
+	}
+
+	return *dn
+}
@@ -1,68 +1,310 @@
 package service
 
 import (
-	"crypto/sha1"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
 )
 
-const tokenTTL = 12 * time.Hour
-
-var ErrInvalidCredentials = errors.New("incorrect login or password")
+var (
+	ErrInvalidCredentials  = errors.New("incorrect login or password")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	// ErrPasswordChangeRequired - пароль верный, но токены выдаются только после его смены
+	ErrPasswordChangeRequired = errors.New("password change required")
+	ErrUserDisabled           = errors.New("user account is disabled")
+)
 
 type tokenClaims struct {
 	jwt.StandardClaims
-	CheckerId int    `json:"checker_id"`
-	Role      string `json:"role"`
+	CheckerId    int      `json:"checker_id"`
+	Role         string   `json:"role"`
+	TokenVersion int      `json:"ver"`
+	Permissions  []string `json:"perms"`
+	SessionId    string   `json:"sid"`
+}
+
+// tokenStateTTL - сколько ParseToken доверяет закешированной версии токенов пользователя.
+// Сервисы этого процесса сбрасывают кеш через TokenInvalidator, а отзыв токенов в другом
+// процессе с тем же API доходит до его запросов с этой задержкой
+const tokenStateTTL = 10 * time.Second
+
+// TokenInvalidator получает уведомления о росте token_version пользователя, чтобы ParseToken
+// сразу перестал принимать его старые токены. Вызывать после коммита транзакции
+type TokenInvalidator interface {
+	InvalidateTokens(userId int)
+}
+
+type tokenState struct {
+	version   int
+	checkedAt time.Time
 }
 
 type AuthService struct {
-	repo repository.Authorization
+	repo      repository.Authorization
+	roleRepo  repository.Role
+	settings  SettingsReader
+	providers []CredentialProvider
+
+	statesMu   sync.Mutex
+	states     map[int]tokenState
+	generation uint64
 }
 
 func getSigningKey() string {
 	return os.Getenv("AUTH_signingKey")
 }
 
+// getSalt нужен только для проверки хешей старого формата, новые хеши используют соль на пользователя
 func getSalt() string {
 	return os.Getenv("AUTH_salt")
 }
 
-func NewAuthService(repo repository.Authorization) *AuthService {
-	return &AuthService{repo: repo}
+// NewAuthService без провайдеров проверяет пароли только по БД
+func NewAuthService(repo repository.Authorization, roleRepo repository.Role, settings SettingsReader, providers ...CredentialProvider) *AuthService {
+	if len(providers) == 0 {
+		providers = []CredentialProvider{&localProvider{repo: repo}}
+	}
+	return &AuthService{repo: repo, roleRepo: roleRepo, settings: settings, providers: providers, states: make(map[int]tokenState)}
+}
+
+func (s *AuthService) GenerateToken(username, password string) (classosbackend.TokenPair, error) {
+	user, err := s.authenticate(username, password)
+	if err != nil {
+		return classosbackend.TokenPair{}, err
+	}
+
+	if user.MustChangePassword {
+		return classosbackend.TokenPair{}, ErrPasswordChangeRequired
+	}
+
+	return s.startSession(user)
+}
+
+// startSession выдаёт пару токенов, начинающую новую цепочку refresh-токенов
+func (s *AuthService) startSession(user classosbackend.User) (classosbackend.TokenPair, error) {
+	pair, refresh, err := s.issueTokens(user, "")
+	if err != nil {
+		return classosbackend.TokenPair{}, err
+	}
+
+	if err := s.repo.CreateRefreshToken(refresh); err != nil {
+		return classosbackend.TokenPair{}, fmt.Errorf("auth.GenerateToken: %w", err)
+	}
+
+	return pair, nil
+}
+
+// GetSessions возвращает незавершённые входы пользователя; currentSession отмечает текущий
+func (s *AuthService) GetSessions(userId int, currentSession string) ([]classosbackend.Session, error) {
+	sessions, err := s.repo.GetSessions(userId)
+	if err != nil {
+		return nil, fmt.Errorf("auth.GetSessions: %w", err)
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSession
+	}
+
+	return sessions, nil
+}
+
+// Refresh обменивает refresh-токен на новую пару. Каждый refresh-токен одноразовый:
+// повторное предъявление уже использованного токена означает его утечку,
+// поэтому отзывается вся цепочка, включая токен, выданный взамен
+func (s *AuthService) Refresh(refreshToken string) (classosbackend.TokenPair, error) {
+	stored, err := s.repo.GetRefreshToken(hashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return classosbackend.TokenPair{}, fmt.Errorf("auth.Refresh: %w", err)
+	}
+
+	if stored.RevokedAt != nil {
+		if err := s.repo.RevokeRefreshTokenFamily(stored.Family); err != nil {
+			return classosbackend.TokenPair{}, fmt.Errorf("auth.Refresh: %w", err)
+		}
+		logrus.WithField("user_id", stored.UserID).Warn("revoked refresh token reused, token family revoked")
+		return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	user, err := s.repo.GetTokenState(stored.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return classosbackend.TokenPair{}, fmt.Errorf("auth.Refresh: %w", err)
+	}
+
+	if user.TokenVersion != stored.TokenVersion {
+		return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	pair, next, err := s.issueTokens(user, stored.Family)
+	if err != nil {
+		return classosbackend.TokenPair{}, err
+	}
+
+	if err := s.repo.RotateRefreshToken(stored.ID, next); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return classosbackend.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return classosbackend.TokenPair{}, fmt.Errorf("auth.Refresh: %w", err)
+	}
+
+	return pair, nil
 }
 
-func (s *AuthService) GenerateToken(username, password string) (string, error) {
-	user, err := s.repo.GetUser(username, s.GeneratePasswordHash(password))
+// Logout отзывает цепочку refresh-токена, а с everywhere - все токены пользователя,
+// включая ещё не истёкшие access-токены
+func (s *AuthService) Logout(refreshToken string, everywhere bool) error {
+	stored, err := s.repo.GetRefreshToken(hashRefreshToken(refreshToken))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", ErrInvalidCredentials
+			return ErrInvalidRefreshToken
 		}
-		return "", fmt.Errorf("auth.GenerateToken: %w", err)
+		return fmt.Errorf("auth.Logout: %w", err)
+	}
+
+	if everywhere {
+		defer s.InvalidateTokens(stored.UserID)
+		return s.repo.RevokeUserTokens(stored.UserID)
 	}
 
+	return s.repo.RevokeRefreshTokenFamily(stored.Family)
+}
+
+// issueTokens подписывает access-токен и готовит запись нового refresh-токена.
+// Пустой family начинает новую цепочку. Права роли попадают в access-токен, поэтому
+// изменение роли доходит до пользователя при следующем обновлении токена
+func (s *AuthService) issueTokens(user classosbackend.User, family string) (classosbackend.TokenPair, classosbackend.RefreshToken, error) {
+	signingKey := getSigningKey()
+	if signingKey == "" {
+		return classosbackend.TokenPair{}, classosbackend.RefreshToken{}, fmt.Errorf("AUTH_signingKey environment variable is not set")
+	}
+
+	permissions, err := s.permissions(user.Role)
+	if err != nil {
+		return classosbackend.TokenPair{}, classosbackend.RefreshToken{}, fmt.Errorf("failed to get role permissions: %w", err)
+	}
+
+	if family == "" {
+		family = randomToken()
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.settings.Duration(classosbackend.SettingAuthTokenTTL))
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &tokenClaims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(tokenTTL).Unix(),
-			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  now.Unix(),
 		},
-		CheckerId: user.ID,
-		Role:      user.Role,
+		CheckerId:    user.ID,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		Permissions:  permissions,
+		SessionId:    family,
 	})
 
-	signingKey := getSigningKey()
-	if signingKey == "" {
-		return "", fmt.Errorf("AUTH_signingKey environment variable is not set")
+	accessToken, err := token.SignedString([]byte(signingKey))
+	if err != nil {
+		return classosbackend.TokenPair{}, classosbackend.RefreshToken{}, err
+	}
+
+	refreshToken := randomToken()
+
+	refresh := classosbackend.RefreshToken{
+		UserID:       user.ID,
+		TokenHash:    hashRefreshToken(refreshToken),
+		Family:       family,
+		TokenVersion: user.TokenVersion,
+		ExpiresAt:    now.Add(s.settings.Duration(classosbackend.SettingAuthRefreshTokenTTL)),
+	}
+
+	return classosbackend.TokenPair{
+		AccessToken:      accessToken,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refresh.ExpiresAt,
+	}, refresh, nil
+}
+
+func (s *AuthService) permissions(role string) ([]string, error) {
+	if role == classosbackend.RoleAdmin {
+		return classosbackend.AllPermissions(), nil
+	}
+
+	return s.roleRepo.GetPermissions(role)
+}
+
+func randomToken() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticate опрашивает провайдеров по порядку. Недоступный AD или неизвестный ему пользователь
+// передают проверку следующему провайдеру, неверный пароль останавливает цепочку
+func (s *AuthService) authenticate(username, password string) (classosbackend.User, error) {
+	var lastErr error
+	for _, provider := range s.providers {
+		user, err := provider.Authenticate(username, password)
+		if err == nil {
+			// adProvider переносит в БД пароль, сменённый в домене, и этим отзывает старые токены
+			s.InvalidateTokens(user.ID)
+			if !user.Enabled || user.ArchivedAt != nil {
+				return classosbackend.User{}, ErrUserDisabled
+			}
+			return user, nil
+		}
+
+		if !errors.Is(err, ErrADUnavailable) && !errors.Is(err, ErrADUserNotFound) && !errors.Is(err, errProviderSkipped) {
+			return classosbackend.User{}, err
+		}
+
+		logrus.WithError(err).WithField("username", username).Debug("credential provider skipped")
+		lastErr = err
 	}
 
-	return token.SignedString([]byte(signingKey))
+	if lastErr == nil || errors.Is(lastErr, ErrADUserNotFound) || errors.Is(lastErr, errProviderSkipped) {
+		return classosbackend.User{}, ErrInvalidCredentials
+	}
+
+	return classosbackend.User{}, lastErr
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash = hashPassword("classos-dummy-password")
+	})
+	return dummyHash
 }
 
 func (s *AuthService) CreateUser(user classosbackend.User) (int, error) {
@@ -70,10 +312,10 @@ func (s *AuthService) CreateUser(user classosbackend.User) (int, error) {
 	return s.repo.CreateUser(user)
 }
 
-func (s *AuthService) ParseToken(accessToken string) (int, string, error) {
+func (s *AuthService) ParseToken(accessToken string) (classosbackend.Identity, error) {
 	signingKey := getSigningKey()
 	if signingKey == "" {
-		return 0, "", fmt.Errorf("AUTH_signingKey env var is not set")
+		return classosbackend.Identity{}, fmt.Errorf("AUTH_signingKey env var is not set")
 	}
 
 	token, err := jwt.ParseWithClaims(accessToken, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
@@ -83,21 +325,71 @@ func (s *AuthService) ParseToken(accessToken string) (int, string, error) {
 		return []byte(signingKey), nil
 	})
 	if err != nil {
-		return 0, "", err
+		return classosbackend.Identity{}, err
 	}
 
 	claims, ok := token.Claims.(*tokenClaims)
 	if !ok {
-		return 0, "", errors.New("token claims are not type of *tokenClaims")
+		return classosbackend.Identity{}, errors.New("token claims are not type of *tokenClaims")
 	}
 
-	return claims.CheckerId, claims.Role, nil
+	// Токен отзывается сменой пароля или роли (растёт token_version) и удалением пользователя
+	version, err := s.tokenVersion(claims.CheckerId, claims.TokenVersion)
+	if err != nil {
+		return classosbackend.Identity{}, err
+	}
+
+	if version != claims.TokenVersion {
+		return classosbackend.Identity{}, ErrTokenRevoked
+	}
+
+	return classosbackend.Identity{
+		UserID:      claims.CheckerId,
+		Role:        claims.Role,
+		Permissions: claims.Permissions,
+		SessionID:   claims.SessionId,
+	}, nil
+}
+
+// tokenVersion возвращает актуальную версию токенов пользователя. Закешированной версии
+// верим не дольше tokenStateTTL и только если она совпадает с версией токена: токен,
+// выданный после смены пароля, сразу проверяется по БД
+func (s *AuthService) tokenVersion(userId, claimed int) (int, error) {
+	s.statesMu.Lock()
+	state, ok := s.states[userId]
+	generation := s.generation
+	s.statesMu.Unlock()
+	if ok && state.version == claimed && time.Since(state.checkedAt) < tokenStateTTL {
+		return state.version, nil
+	}
+
+	user, err := s.repo.GetTokenState(userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.InvalidateTokens(userId)
+			return 0, ErrTokenRevoked
+		}
+		return 0, fmt.Errorf("auth.ParseToken: %w", err)
+	}
+
+	// Не кешируем версию, если токены успели отозвать, пока мы её читали
+	s.statesMu.Lock()
+	if s.generation == generation {
+		s.states[userId] = tokenState{version: user.TokenVersion, checkedAt: time.Now()}
+	}
+	s.statesMu.Unlock()
+
+	return user.TokenVersion, nil
+}
+
+// InvalidateTokens сбрасывает закешированную версию токенов пользователя после её роста в БД
+func (s *AuthService) InvalidateTokens(userId int) {
+	s.statesMu.Lock()
+	delete(s.states, userId)
+	s.generation++
+	s.statesMu.Unlock()
 }
 
 func (s *AuthService) GeneratePasswordHash(password string) string {
-	hash := sha1.New()
-	hash.Write([]byte(password))
-	salt := getSalt()
-	result := fmt.Sprintf("%x", hash.Sum([]byte(salt)))
-	return result
+	return hashPassword(password)
 }
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	AuthProviderLocal   = "local"
+	AuthProviderAD      = "ad"
+	AuthProviderADFirst = "ad_first"
+)
+
+// errProviderSkipped - провайдер не проверяет этого пользователя и передаёт его следующему
+var errProviderSkipped = errors.New("credential provider does not handle this user")
+
+// CredentialProvider проверяет логин и пароль и возвращает пользователя из БД
+// с ролью и версией токенов. ErrInvalidCredentials - окончательный отказ,
+// ErrADUnavailable и ErrADUserNotFound передают решение следующему провайдеру цепочки
+type CredentialProvider interface {
+	Authenticate(username, password string) (classosbackend.User, error)
+}
+
+// NewCredentialProviders собирает цепочку провайдеров для режима из конфига (auth.provider):
+// local - только БД, ad - только AD (кроме встроенного администратора), ad_first - AD, а если он недоступен или не знает пользователя, БД
+func NewCredentialProviders(mode string, repos *repository.Repository, directory Directory) ([]CredentialProvider, error) {
+	local := &localProvider{repo: repos.Authorization}
+	ad := &adProvider{ad: directory, authRepo: repos.Authorization, userRepo: repos.User, groupRepo: repos.Group}
+
+	switch mode {
+	case "", AuthProviderLocal:
+		return []CredentialProvider{local}, nil
+	case AuthProviderAD:
+		return []CredentialProvider{&superAdminProvider{local: local}, ad}, nil
+	case AuthProviderADFirst:
+		return []CredentialProvider{ad, local}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth provider %q: expected %q, %q or %q", mode, AuthProviderLocal, AuthProviderAD, AuthProviderADFirst)
+	}
+}
+
+// localProvider проверяет пароль по хешу в БД и переводит хеши старого формата на argon2id
+type localProvider struct {
+	repo repository.Authorization
+}
+
+func (p *localProvider) Authenticate(username, password string) (classosbackend.User, error) {
+	user, err := p.repo.GetUser(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Проверяем пароль и для несуществующего пользователя, чтобы время ответа его не выдавало
+			verifyPassword(dummyPasswordHash(), password)
+			return user, ErrInvalidCredentials
+		}
+		return user, fmt.Errorf("auth.GenerateToken: %w", err)
+	}
+
+	ok, needsRehash, err := verifyPassword(user.Password, password)
+	if err != nil {
+		return user, fmt.Errorf("auth.GenerateToken: user %d: %w", user.ID, err)
+	}
+	if !ok {
+		return user, ErrInvalidCredentials
+	}
+
+	if needsRehash {
+		if err := p.repo.UpdatePasswordHash(user.ID, hashPassword(password)); err != nil {
+			logrus.WithError(err).WithField("user_id", user.ID).Warn("failed to upgrade password hash")
+		}
+	}
+
+	return user, nil
+}
+
+// superAdminProvider проверяет по БД только встроенного администратора: в режиме ad он должен
+// иметь возможность войти, даже если AD недоступен или настроен неверно
+type superAdminProvider struct {
+	local *localProvider
+}
+
+func (p *superAdminProvider) Authenticate(username, password string) (classosbackend.User, error) {
+	if username != superAdminUsername {
+		return classosbackend.User{}, errProviderSkipped
+	}
+
+	return p.local.Authenticate(username, password)
+}
+
+// adProvider проверяет пароль bind-ом в AD и после успешного входа создаёт или обновляет
+// пользователя в БД по атрибутам из AD. Локальный хеш тоже обновляется, чтобы режим
+// ad_first мог пустить пользователя с тем же паролем, пока AD недоступен
+type adProvider struct {
+	ad        Directory
+	authRepo  repository.Authorization
+	userRepo  repository.User
+	groupRepo repository.Group
+}
+
+func (p *adProvider) Authenticate(username, password string) (classosbackend.User, error) {
+	adUser, err := p.ad.Authenticate(username, password)
+	if err != nil {
+		return classosbackend.User{}, err
+	}
+
+	if err := p.syncUser(adUser, password); err != nil {
+		return classosbackend.User{}, fmt.Errorf("failed to sync AD user %s: %w", adUser.SamAccountName, err)
+	}
+
+	return p.authRepo.GetUser(adUser.SamAccountName)
+}
+
+func (p *adProvider) syncUser(adUser ADUser, password string) error {
+	name := adUser.DisplayName
+	if name == "" {
+		name = adUser.SamAccountName
+	}
+
+	existing, err := p.userRepo.GetByUsername(adUser.SamAccountName)
+	if errors.Is(err, sql.ErrNoRows) {
+		userId, err := p.authRepo.CreateUser(classosbackend.User{
+			Name:     name,
+			Username: adUser.SamAccountName,
+			Password: hashPassword(password),
+		})
+		if err != nil {
+			return err
+		}
+
+		logrus.WithField("username", adUser.SamAccountName).Info("created user from AD on first sign-in")
+		existing = classosbackend.User{ID: userId, Name: name}
+	} else if err != nil {
+		return err
+	}
+
+	var input classosbackend.UpdateUserInput
+	if existing.Name != name {
+		input.Name = &name
+	}
+
+	stored, err := p.authRepo.GetUser(adUser.SamAccountName)
+	if err != nil {
+		return err
+	}
+	if ok, _, _ := verifyPassword(stored.Password, password); !ok {
+		// Пароль сменили в домене: обновление хеша заодно отзывает старые токены
+		hash := hashPassword(password)
+		input.Password = &hash
+	}
+
+	// Требование сменить пароль задаёт AD, в БД хранится его копия
+	if stored.MustChangePassword != adUser.MustChangePassword {
+		input.MustChangePassword = &adUser.MustChangePassword
+	}
+
+	if groupId, ok := p.matchGroup(adUser.Groups); ok && (existing.GroupID == nil || *existing.GroupID != groupId) {
+		input.GroupID = &groupId
+	}
+
+	if input.Name == nil && input.Password == nil && input.GroupID == nil && input.MustChangePassword == nil {
+		return nil
+	}
+
+	return p.userRepo.Update(0, existing.ID, input)
+}
+
+// matchGroup находит группу classOS с тем же именем, что у одной из AD-групп пользователя
+func (p *adProvider) matchGroup(adGroups []string) (int, bool) {
+	for _, name := range adGroups {
+		group, err := p.groupRepo.GetByName(name)
+		if err == nil {
+			return int(group.ID), true
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			logrus.WithError(err).WithField("group", name).Warn("failed to look up group for AD user")
+		}
+	}
+
+	return 0, false
+}
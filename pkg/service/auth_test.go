@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// testAccessToken подписывает access-токен с текущей версией токенов пользователя
+func testAccessToken(t *testing.T, f *directoryFixture, userId int) string {
+	t.Helper()
+
+	user := f.store.users[userId]
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &tokenClaims{
+		CheckerId:    userId,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+	}).SignedString([]byte(getSigningKey()))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+
+	return token
+}
+
+func TestParseTokenRevokedWithoutDelay(t *testing.T) {
+	t.Setenv("AUTH_signingKey", "test-signing-key")
+
+	password, disabled := "NewSecret123", false
+	tests := map[string]func(f *directoryFixture, userId int) error{
+		"password change": func(f *directoryFixture, userId int) error {
+			return f.users.Update(f.admin, userId, classosbackend.UpdateUserInput{Password: &password})
+		},
+		"disable": func(f *directoryFixture, userId int) error {
+			return f.users.SetEnabled(f.admin, userId, disabled)
+		},
+		"archive": func(f *directoryFixture, userId int) error {
+			return f.archive.ArchiveUser(f.admin, userId)
+		},
+		"password reset": func(f *directoryFixture, userId int) error {
+			passwords := NewPasswordResetService(testUserRepo{store: f.store}, testGroupRepo{store: f.store}, f.outbox, f.auth)
+			_, err := passwords.Reset(f.admin, classosbackend.PasswordResetInput{UserIDs: []int{userId}})
+			return err
+		},
+	}
+
+	for name, revoke := range tests {
+		f := newDirectoryFixture(t)
+		groupId := f.createGroup(t, "7A")
+		userId := f.createUser(t, groupId, "ivanov")
+		f.flush(t)
+
+		token := testAccessToken(t, f, userId)
+		// Первая проверка кеширует версию токенов
+		if _, err := f.auth.ParseToken(token); err != nil {
+			t.Fatalf("%s: parse before revoke: %v", name, err)
+		}
+
+		if err := revoke(f, userId); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if _, err := f.auth.ParseToken(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("%s: got %v, want ErrTokenRevoked before tokenStateTTL passes", name, err)
+		}
+	}
+}
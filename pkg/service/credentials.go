@@ -0,0 +1,245 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+var (
+	ErrNoFreeUsername = errors.New("no free username for the template")
+	ErrUsernameTaken  = errors.New("username is already taken")
+)
+
+// maxUsernameAttempts ограничивает перебор номеров {n} для одного имени
+const maxUsernameAttempts = 100
+
+// usernameBatchAttempts - сколько вариантов каждого имени проверяется за один запрос
+const usernameBatchAttempts = 5
+
+// Буквы и цифры, которые не путаются на печати: без l/I/1, O/0
+const (
+	passwordConsonants = "bcdfghjkmnprstvz"
+	passwordVowels     = "aeiu"
+	passwordDigits     = "23456789"
+)
+
+// CredentialGenerator подбирает логины по шаблону из настроек и генерирует начальные пароли
+type CredentialGenerator struct {
+	userRepo  repository.User
+	directory Directory
+	settings  SettingsReader
+}
+
+func NewCredentialGenerator(userRepo repository.User, directory Directory, settings SettingsReader) *CredentialGenerator {
+	return &CredentialGenerator{userRepo: userRepo, directory: directory, settings: settings}
+}
+
+// Fill дополняет пустые логин и пароль пользователя и возвращает сгенерированный пароль
+func (g *CredentialGenerator) Fill(user *classosbackend.User) (string, error) {
+	if user.Username == "" {
+		username, err := g.Username(user.Name, nil, true)
+		if err != nil {
+			return "", err
+		}
+		user.Username = username
+	}
+
+	if user.Password != "" {
+		return "", nil
+	}
+
+	password, err := GeneratePassword(user.Username)
+	if err != nil {
+		return "", err
+	}
+	user.Password = password
+
+	return password, nil
+}
+
+// Username возвращает первый свободный логин по шаблону. reserved - логины в нижнем регистре,
+// уже занятые в текущей операции (например, другими строками импорта). Без checkAD занятость
+// проверяется только по БД
+func (g *CredentialGenerator) Username(name string, reserved map[string]bool, checkAD bool) (string, error) {
+	usernames, errs := g.Usernames([]string{name}, reserved, checkAD)
+	return usernames[0], errs[0]
+}
+
+// Usernames подбирает логины сразу для нескольких имён и добавляет их в reserved. Занятость
+// проверяется одним запросом к БД и AD на раунд: сначала по первым usernameBatchAttempts вариантам
+// каждого имени, следующие варианты запрашиваются только для имён, которым свободного не нашлось
+func (g *CredentialGenerator) Usernames(names []string, reserved map[string]bool, checkAD bool) ([]string, []error) {
+	if reserved == nil {
+		reserved = make(map[string]bool)
+	}
+	nameOrder := g.settings.String(classosbackend.SettingUsersNameOrder)
+	template := g.settings.String(classosbackend.SettingUsernameTemplate)
+
+	usernames := make([]string, len(names))
+	errs := make([]error, len(names))
+	candidates := make([][]string, len(names))
+	pending := make([]int, 0, len(names))
+	for i, name := range names {
+		first, last := classosbackend.SplitFullName(name, nameOrder)
+		candidates[i], errs[i] = usernameCandidates(template, first, last)
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("%w: cannot build a username from name %q", ErrNoFreeUsername, name)
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	for offset := 0; offset < maxUsernameAttempts && len(pending) > 0; offset += usernameBatchAttempts {
+		batch := make([]string, 0)
+		seen := make(map[string]bool)
+		for _, i := range pending {
+			for _, candidate := range usernameWindow(candidates[i], offset) {
+				key := strings.ToLower(candidate)
+				if !reserved[key] && !seen[key] {
+					seen[key] = true
+					batch = append(batch, candidate)
+				}
+			}
+		}
+
+		taken, err := g.takenUsernames(batch, checkAD)
+		if err != nil {
+			for _, i := range pending {
+				errs[i] = err
+			}
+			return usernames, errs
+		}
+
+		next := pending[:0]
+		for _, i := range pending {
+			for _, candidate := range usernameWindow(candidates[i], offset) {
+				key := strings.ToLower(candidate)
+				if !reserved[key] && !taken[key] {
+					usernames[i] = candidate
+					reserved[key] = true
+					break
+				}
+			}
+			if usernames[i] == "" {
+				next = append(next, i)
+			}
+		}
+		pending = next
+	}
+
+	for _, i := range pending {
+		errs[i] = fmt.Errorf("%w: %q", ErrNoFreeUsername, names[i])
+	}
+
+	return usernames, errs
+}
+
+// takenUsernames объединяет занятые логины из БД и, если нужно, из AD
+func (g *CredentialGenerator) takenUsernames(usernames []string, checkAD bool) (map[string]bool, error) {
+	if len(usernames) == 0 {
+		return map[string]bool{}, nil
+	}
+
+	taken, err := g.userRepo.ExistingUsernames(usernames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check usernames: %w", err)
+	}
+
+	if checkAD {
+		inAD, err := g.directory.ExistingUsers(usernames)
+		if err != nil {
+			return nil, err
+		}
+		for username := range inAD {
+			taken[username] = true
+		}
+	}
+
+	return taken, nil
+}
+
+// usernameCandidates перечисляет различающиеся варианты логина по шаблону в порядке перебора
+func usernameCandidates(template, first, last string) ([]string, error) {
+	candidates := make([]string, 0, maxUsernameAttempts)
+	previous := ""
+	for n := 0; n < maxUsernameAttempts; n++ {
+		candidate := classosbackend.RenderUsername(template, first, last, n)
+		if candidate == previous {
+			continue
+		}
+		previous = candidate
+
+		if err := classosbackend.ValidateUsername(candidate); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates, nil
+}
+
+func usernameWindow(candidates []string, offset int) []string {
+	if offset >= len(candidates) {
+		return nil
+	}
+
+	end := offset + usernameBatchAttempts
+	if end > len(candidates) {
+		end = len(candidates)
+	}
+	return candidates[offset:end]
+}
+
+// GeneratePassword возвращает пароль вида Bafu-Keti-47: его легко продиктовать, а заглавные,
+// строчные буквы, цифры и дефис закрывают все категории сложности AD. Пароль не содержит логин
+func GeneratePassword(username string) (string, error) {
+	for {
+		var b strings.Builder
+		for word := 0; word < 2; word++ {
+			for syllable := 0; syllable < 2; syllable++ {
+				consonant, err := randomChar(passwordConsonants)
+				if err != nil {
+					return "", err
+				}
+				vowel, err := randomChar(passwordVowels)
+				if err != nil {
+					return "", err
+				}
+
+				if syllable == 0 {
+					consonant = strings.ToUpper(consonant)
+				}
+				b.WriteString(consonant + vowel)
+			}
+			b.WriteString("-")
+		}
+
+		for i := 0; i < 2; i++ {
+			digit, err := randomChar(passwordDigits)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(digit)
+		}
+
+		password := b.String()
+		if len(username) < 3 || !strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+			return password, nil
+		}
+	}
+}
+
+func randomChar(alphabet string) (string, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	return string(alphabet[i.Int64()]), nil
+}
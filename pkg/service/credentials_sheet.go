@@ -0,0 +1,226 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jung-kurt/gofpdf"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+var ErrNoStudents = errors.New("group has no students")
+
+// DefaultSheetFont - шрифт с кириллицей из пакета font-dejavu образа alpine
+const DefaultSheetFont = "/usr/share/fonts/dejavu/DejaVuSans.ttf"
+
+// Разметка листа A4 в миллиметрах: две колонки по пять карточек, линии отреза пунктиром
+const (
+	sheetMargin = 10.0
+	slipWidth   = 95.0
+	slipHeight  = 55.0
+	slipColumns = 2
+	slipRows    = 5
+	slipPadding = 5.0
+	slipQRSize  = 28.0
+	sheetFont   = "DejaVu"
+	minNameSize = 8.0
+)
+
+// credentialSlip - карточка одного ученика. Пустой Password печатается как поле для записи от руки
+type credentialSlip struct {
+	Name     string
+	Username string
+	Password string
+	Note     string
+}
+
+// CredentialsSheetService печатает карточки с логинами учеников группы и при необходимости
+// задаёт им новые пароли. Новые пароли попадают только в PDF: в БД хранится их хеш
+type CredentialsSheetService struct {
+	userRepo  repository.User
+	groupRepo repository.Group
+	outbox    *DirectoryOutbox
+	tokens    TokenInvalidator
+	settings  SettingsReader
+	fontPath  string
+}
+
+func NewCredentialsSheetService(userRepo repository.User, groupRepo repository.Group, outbox *DirectoryOutbox,
+	tokens TokenInvalidator, settings SettingsReader, fontPath string) *CredentialsSheetService {
+	if fontPath == "" {
+		fontPath = DefaultSheetFont
+	}
+
+	return &CredentialsSheetService{userRepo: userRepo, groupRepo: groupRepo, outbox: outbox, tokens: tokens, settings: settings, fontPath: fontPath}
+}
+
+func (s *CredentialsSheetService) Generate(checkerId, groupId int, input classosbackend.CredentialsSheetInput) (classosbackend.CredentialsSheet, error) {
+	if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+		return classosbackend.CredentialsSheet{}, err
+	}
+
+	group, err := s.groupRepo.GetById(0, groupId)
+	if err != nil {
+		return classosbackend.CredentialsSheet{}, fmt.Errorf("failed to get group: %w", err)
+	}
+
+	users, err := s.userRepo.GetByGroup(groupId)
+	if err != nil {
+		return classosbackend.CredentialsSheet{}, fmt.Errorf("failed to get group users: %w", err)
+	}
+
+	slips := make([]credentialSlip, 0, len(users))
+	students := make([]classosbackend.User, 0, len(users))
+	for _, user := range users {
+		if user.Role == classosbackend.RoleClient {
+			students = append(students, user)
+			slips = append(slips, credentialSlip{Name: user.Name, Username: user.Username})
+		}
+	}
+	if len(students) == 0 {
+		return classosbackend.CredentialsSheet{}, ErrNoStudents
+	}
+
+	sheet := classosbackend.CredentialsSheet{
+		Filename: fmt.Sprintf("credentials-group-%d.pdf", groupId),
+		Students: len(students),
+	}
+
+	if input.ResetPasswords {
+		for i, student := range students {
+			password, err := resetUserPassword(s.outbox, s.userRepo, s.tokens, student, input.MustChangePassword)
+			if err != nil {
+				logrus.WithError(err).WithField("username", student.Username).Error("credentials sheet: failed to reset password")
+				slips[i].Note = "Password was not reset, ask your teacher"
+				sheet.ResetFailed++
+				continue
+			}
+			slips[i].Password = password
+		}
+	}
+
+	sheet.Body, err = s.render(group.Name, slips)
+	if err != nil {
+		return classosbackend.CredentialsSheet{}, err
+	}
+
+	return sheet, nil
+}
+
+func (s *CredentialsSheetService) render(groupName string, slips []credentialSlip) ([]byte, error) {
+	// Стандартные шрифты PDF не содержат кириллицы, поэтому TTF встраивается в документ
+	font, err := os.ReadFile(s.fontPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load font: %w", err)
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Credentials: "+groupName, true)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddUTF8FontFromBytes(sheetFont, "", font)
+	if err := pdf.Error(); err != nil {
+		return nil, fmt.Errorf("failed to load font %s: %w", s.fontPath, err)
+	}
+
+	loginURL := s.settings.String(classosbackend.SettingUsersLoginURL)
+	if loginURL != "" {
+		png, err := qrcode.Encode(loginURL, qrcode.Medium, 256)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode login URL as QR code: %w", err)
+		}
+		pdf.RegisterImageOptionsReader("login-qr", gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+	}
+
+	perPage := slipColumns * slipRows
+	for i, slip := range slips {
+		if i%perPage == 0 {
+			pdf.AddPage()
+		}
+
+		x := sheetMargin + float64(i%slipColumns)*slipWidth
+		y := sheetMargin + float64(i%perPage/slipColumns)*slipHeight
+		s.renderSlip(pdf, x, y, groupName, loginURL, slip)
+	}
+
+	var body bytes.Buffer
+	if err := pdf.Output(&body); err != nil {
+		return nil, fmt.Errorf("failed to render credentials sheet: %w", err)
+	}
+
+	return body.Bytes(), nil
+}
+
+func (s *CredentialsSheetService) renderSlip(pdf *gofpdf.Fpdf, x, y float64, groupName, loginURL string, slip credentialSlip) {
+	pdf.SetDrawColor(160, 160, 160)
+	pdf.SetDashPattern([]float64{2, 2}, 0)
+	pdf.Rect(x, y, slipWidth, slipHeight, "D")
+	pdf.SetDashPattern([]float64{}, 0)
+
+	textWidth := slipWidth - 2*slipPadding
+	if loginURL != "" {
+		textWidth -= slipQRSize + slipPadding
+
+		qrX := x + slipWidth - slipPadding - slipQRSize
+		qrY := y + slipPadding
+		pdf.ImageOptions("login-qr", qrX, qrY, slipQRSize, slipQRSize, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+		pdf.SetFont(sheetFont, "", 6)
+		pdf.SetTextColor(90, 90, 90)
+		pdf.SetXY(qrX-2, qrY+slipQRSize+1)
+		pdf.MultiCell(slipQRSize+4, 3, loginURL, "", "C", false)
+	}
+
+	left := x + slipPadding
+	pdf.SetTextColor(90, 90, 90)
+	pdf.SetFont(sheetFont, "", 9)
+	pdf.SetXY(left, y+slipPadding)
+	pdf.CellFormat(textWidth, 5, fitText(pdf, groupName, textWidth), "", 0, "L", false, 0, "")
+
+	pdf.SetTextColor(0, 0, 0)
+	nameSize := 13.0
+	pdf.SetFont(sheetFont, "", nameSize)
+	for nameSize > minNameSize && pdf.GetStringWidth(slip.Name) > textWidth {
+		nameSize--
+		pdf.SetFont(sheetFont, "", nameSize)
+	}
+	pdf.SetXY(left, y+slipPadding+7)
+	pdf.CellFormat(textWidth, 7, fitText(pdf, slip.Name, textWidth), "", 0, "L", false, 0, "")
+
+	pdf.SetFont(sheetFont, "", 11)
+	pdf.SetXY(left, y+slipPadding+19)
+	pdf.CellFormat(textWidth, 6, fitText(pdf, "Username: "+slip.Username, textWidth), "", 0, "L", false, 0, "")
+
+	password := slip.Password
+	if password == "" {
+		password = "____________"
+	}
+	pdf.SetXY(left, y+slipPadding+27)
+	pdf.CellFormat(textWidth, 6, "Password: "+password, "", 0, "L", false, 0, "")
+
+	if slip.Note != "" {
+		pdf.SetFont(sheetFont, "", 7)
+		pdf.SetTextColor(180, 0, 0)
+		pdf.SetXY(left, y+slipPadding+35)
+		pdf.MultiCell(textWidth, 3.5, slip.Note, "", "L", false)
+		pdf.SetTextColor(0, 0, 0)
+	}
+}
+
+// fitText обрезает строку с многоточием, если она не помещается в ширину width
+func fitText(pdf *gofpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+
+	runes := []rune(text)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+
+	return string(runes) + "…"
+}
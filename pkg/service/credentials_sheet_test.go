@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// sheetTestFont ищет шрифт DejaVu по путям alpine и debian
+func sheetTestFont(t *testing.T) string {
+	t.Helper()
+
+	for _, path := range []string{DefaultSheetFont, "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	t.Skip("DejaVuSans.ttf is not installed")
+	return ""
+}
+
+func newCredentialsSheetService(t *testing.T, f *directoryFixture, loginURL string) *CredentialsSheetService {
+	t.Helper()
+
+	settings := NewSettingsService(&testSettingsRepo{values: map[string]string{classosbackend.SettingUsersLoginURL: loginURL}})
+	return NewCredentialsSheetService(testUserRepo{store: f.store}, testGroupRepo{store: f.store}, f.outbox, f.auth, settings, sheetTestFont(t))
+}
+
+func TestCredentialsSheetWithoutReset(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	studentId := f.createUser(t, groupId, "ivanov")
+	f.createUser(t, groupId, "petrov")
+	f.store.addUser(t, "teacher", classosbackend.RoleTeacher, groupId)
+	f.flush(t)
+	hash := f.store.users[studentId].Password
+	queued := len(f.journal.ops)
+
+	sheets := newCredentialsSheetService(t, f, "https://classos.school.local/login")
+	sheet, err := sheets.Generate(f.admin, groupId, classosbackend.CredentialsSheetInput{})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	if !bytes.HasPrefix(sheet.Body, []byte("%PDF-")) {
+		t.Fatal("body is not a PDF")
+	}
+	if sheet.Students != 2 || sheet.ResetFailed != 0 {
+		t.Fatalf("got %d students and %d failed resets, want only the 2 students", sheet.Students, sheet.ResetFailed)
+	}
+	if len(f.journal.ops) != queued || f.store.users[studentId].Password != hash {
+		t.Fatal("passwords changed without reset_passwords")
+	}
+}
+
+func TestCredentialsSheetResetsPasswords(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	studentId := f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+	version := f.store.users[studentId].TokenVersion
+
+	sheets := newCredentialsSheetService(t, f, "")
+	sheet, err := sheets.Generate(f.admin, groupId, classosbackend.CredentialsSheetInput{ResetPasswords: true, MustChangePassword: true})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if sheet.Students != 1 || sheet.ResetFailed != 0 {
+		t.Fatalf("got %+v", sheet)
+	}
+	f.flush(t)
+
+	if _, err := f.directory.Authenticate("ivanov", "Secret123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("old password: got %v, want ErrInvalidCredentials", err)
+	}
+	user := f.store.users[studentId]
+	if !user.MustChangePassword || user.TokenVersion == version {
+		t.Fatalf("DB user is %+v, want must_change_password and a new token version", user)
+	}
+}
+
+func TestCredentialsSheetChecks(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	other := f.createGroup(t, "7B")
+	f.createUser(t, other, "petrov")
+	teacher := f.store.addUser(t, "teacher", classosbackend.RoleTeacher, 0)
+	f.store.teacherGroups[teacher] = []int{groupId}
+
+	sheets := newCredentialsSheetService(t, f, "")
+	if _, err := sheets.Generate(f.admin, groupId, classosbackend.CredentialsSheetInput{}); !errors.Is(err, ErrNoStudents) {
+		t.Fatalf("empty group: got %v, want ErrNoStudents", err)
+	}
+	if _, err := sheets.Generate(teacher, other, classosbackend.CredentialsSheetInput{ResetPasswords: true}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("teacher of another group: got %v, want ErrForbidden", err)
+	}
+
+	sheets.fontPath = "/nonexistent/font.ttf"
+	if _, err := sheets.Generate(f.admin, other, classosbackend.CredentialsSheetInput{}); err == nil {
+		t.Fatal("missing font: got no error")
+	}
+}
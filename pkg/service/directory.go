@@ -0,0 +1,95 @@
+package service
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DirectoryAD     = "ad"
+	DirectoryMemory = "memory"
+)
+
+// Режимы работы с каталогом (directory.mode): online - изменения сразу применяются в каталоге,
+// db_only - только в БД с записью в журнал, auto - db_only, если каталог недоступен при запуске
+const (
+	DirectoryModeOnline = "online"
+	DirectoryModeDBOnly = "db_only"
+	DirectoryModeAuto   = "auto"
+)
+
+// Directory - каталог учётных записей, в котором сервисы повторяют изменения пользователей и групп.
+// Ошибки ErrADUnavailable, ErrADUserNotFound и ErrADGroupNotFound значат то же, что и для AD
+type Directory interface {
+	TestConnection() error
+	Authenticate(username, password string) (ADUser, error)
+
+	CreateUser(user ADUser, password string, groupname string) error
+	UpdateUser(username string, updates ADUser) error
+	DeleteUser(username string) error
+	ChangeUserPassword(username, newPassword string) error
+	ResetPassword(username, password string, mustChange bool) error
+	SetUserEnabled(username string, enabled bool) error
+	UserExists(username string) (bool, error)
+	// ExistingUsers и ExistingGroups возвращают найденные имена в нижнем регистре
+	ExistingUsers(usernames []string) (map[string]bool, error)
+	// ListUsers и ListGroups читают OU пользователей и групп classOS; Groups пользователей
+	// содержит только группы из OU групп
+	ListUsers() ([]ADUser, error)
+	ListGroups() ([]ADGroup, error)
+
+	CreateGroup(group ADGroup) error
+	UpdateGroup(groupName string, updates ADGroup) error
+	DeleteGroup(groupName string) error
+	ExistingGroups(names []string) (map[string]bool, error)
+	AddUserToGroup(username, groupName string) error
+	RemoveUserFromGroup(username, groupName string) error
+	MoveUserToAnotherGroup(username, groupName string) error
+
+	// Архив: объекты переносятся в OU архива, методы возвращают их прежний DN
+	ArchiveUser(username string) (string, error)
+	RestoreUser(username, originalDN string, enabled bool) error
+	ArchiveGroup(groupName string) (string, error)
+	RestoreGroup(groupName, originalDN string) error
+}
+
+// NewDirectory создаёт каталог по значению directory.backend из конфига: ad - Active Directory
+// с параметрами из окружения, memory - каталог в памяти для тестов и стендов без домена
+func NewDirectory(backend string, settings SettingsReader) (Directory, error) {
+	switch backend {
+	case "", DirectoryAD:
+		return NewADService(settings), nil
+	case DirectoryMemory:
+		return NewMemoryDirectory(settings, os.Getenv("AD_BASE_DN")), nil
+	default:
+		return nil, fmt.Errorf("unknown directory backend %q: expected %q or %q", backend, DirectoryAD, DirectoryMemory)
+	}
+}
+
+// ResolveDirectoryMode возвращает фактический режим: auto превращается в online или db_only
+// по результату проверки соединения
+func ResolveDirectoryMode(mode string, directory Directory) (string, error) {
+	switch mode {
+	case DirectoryModeOnline, DirectoryModeDBOnly:
+		return mode, nil
+	case "", DirectoryModeAuto:
+		if err := directory.TestConnection(); err != nil {
+			logrus.WithError(err).Warn("directory is unreachable, switching to DB-only mode")
+			return DirectoryModeDBOnly, nil
+		}
+		return DirectoryModeOnline, nil
+	default:
+		return "", fmt.Errorf("unknown directory mode %q: expected %q, %q or %q", mode, DirectoryModeOnline, DirectoryModeDBOnly, DirectoryModeAuto)
+	}
+}
+
+// DirectoryForMode возвращает каталог, который сервисы читают: в режиме db_only он пуст
+func DirectoryForMode(mode string, directory Directory) Directory {
+	if mode == DirectoryModeDBOnly {
+		return NewOfflineDirectory()
+	}
+
+	return directory
+}
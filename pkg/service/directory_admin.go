@@ -0,0 +1,94 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+var (
+	ErrDirectoryOperationNotFound  = errors.New("directory operation not found")
+	ErrDirectoryOperationNotFailed = errors.New("only failed directory operations can be retried")
+	ErrInvalidOperationStatus      = errors.New("status must be pending, failed or done")
+)
+
+// MaxJournalPage ограничивает число операций журнала в одном ответе
+const MaxJournalPage = 1000
+
+// DirectoryAdminService показывает состояние каталога и очередь его операций
+type DirectoryAdminService struct {
+	backend string
+	mode    string
+	// directory - настроенный каталог, а не очередь: статус проверяет, доступен ли он сейчас
+	directory Directory
+	journal   repository.DirectoryJournal
+	outbox    *DirectoryOutbox
+}
+
+func NewDirectoryAdminService(backend, mode string, directory Directory, journal repository.DirectoryJournal,
+	outbox *DirectoryOutbox) *DirectoryAdminService {
+	if backend == "" {
+		backend = DirectoryAD
+	}
+
+	return &DirectoryAdminService{backend: backend, mode: mode, directory: directory, journal: journal, outbox: outbox}
+}
+
+func (s *DirectoryAdminService) Status() (classosbackend.DirectoryStatus, error) {
+	status := classosbackend.DirectoryStatus{Backend: s.backend, Mode: s.mode, Connected: true}
+
+	if err := s.directory.TestConnection(); err != nil {
+		status.Connected = false
+		status.Message = err.Error()
+	}
+
+	var err error
+	if status.PendingOperations, err = s.journal.CountByStatus(classosbackend.DirectoryOpPending); err != nil {
+		return status, err
+	}
+	if status.FailedOperations, err = s.journal.CountByStatus(classosbackend.DirectoryOpFailed); err != nil {
+		return status, err
+	}
+
+	return status, nil
+}
+
+// GetJournal возвращает операции в состоянии status от старых к новым
+func (s *DirectoryAdminService) GetJournal(status string, limit int) ([]classosbackend.DirectoryOperation, error) {
+	switch status {
+	case classosbackend.DirectoryOpPending, classosbackend.DirectoryOpFailed, classosbackend.DirectoryOpDone:
+	default:
+		return nil, ErrInvalidOperationStatus
+	}
+
+	if limit <= 0 || limit > MaxJournalPage {
+		limit = MaxJournalPage
+	}
+
+	return s.journal.GetByStatus(status, limit)
+}
+
+// Retry возвращает неудавшуюся операцию в очередь. Она применится в порядке записи,
+// то есть раньше операций, записанных после неё
+func (s *DirectoryAdminService) Retry(operationId int64) (classosbackend.DirectoryOperation, error) {
+	op, err := s.journal.Retry(operationId)
+	if err == nil {
+		s.outbox.Notify()
+		return op, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return op, fmt.Errorf("failed to retry operation: %w", err)
+	}
+
+	if _, err := s.journal.GetById(operationId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return op, ErrDirectoryOperationNotFound
+		}
+		return op, fmt.Errorf("failed to get operation: %w", err)
+	}
+
+	return op, ErrDirectoryOperationNotFailed
+}
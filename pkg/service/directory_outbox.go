@@ -0,0 +1,380 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// errOperationInvalid - операцию нельзя применить ни с какой попытки, она сразу становится failed
+var errOperationInvalid = errors.New("invalid directory operation")
+
+// DirectoryOutboxInterval - как часто обработчик проверяет очередь, если его не разбудили раньше
+const DirectoryOutboxInterval = 10 * time.Second
+
+// Повторы операции: задержка удваивается от directoryRetryBase до directoryRetryMax,
+// после directoryMaxAttempts неудачных попыток операция становится failed.
+// directoryLease - на сколько обработчик захватывает операцию, пока обращается к каталогу
+const (
+	directoryMaxAttempts = 8
+	directoryRetryBase   = 5 * time.Second
+	directoryRetryMax    = 10 * time.Minute
+	directoryLease       = 5 * time.Minute
+)
+
+// DirectoryOutbox - очередь операций каталога. Сервисы записывают операцию в той же транзакции,
+// что и изменение в БД, поэтому изменение без операции (и наоборот) не сохранится. Run применяет
+// операции по порядку записи в пределах затронутых ими пользователей и групп: ожидающая повтора
+// операция задерживает только более поздние операции с теми же объектами, иначе, например,
+// добавление в группу обогнало бы её создание. Пароли хранятся зашифрованными ключом приложения
+// и стираются после применения операции
+type DirectoryOutbox struct {
+	journal repository.DirectoryJournal
+	aead    cipher.AEAD
+	wake    chan struct{}
+
+	// Пауза после неудачной проверки соединения. Поля меняет только Run
+	unreachable int
+	pausedUntil time.Time
+}
+
+// NewDirectoryOutbox шифрует пароли ключом, производным от ключа подписи токенов
+func NewDirectoryOutbox(journal repository.DirectoryJournal) *DirectoryOutbox {
+	key := sha256.Sum256([]byte("classos-directory-outbox:" + getSigningKey()))
+	// AES-256 с ключом из sha256 создаётся без ошибок
+	block, _ := aes.NewCipher(key[:])
+	aead, _ := cipher.NewGCM(block)
+
+	return &DirectoryOutbox{journal: journal, aead: aead, wake: make(chan struct{}, 1)}
+}
+
+// EnqueueWithTx записывает операцию в транзакции сервиса. После коммита нужно вызвать Notify
+func (o *DirectoryOutbox) EnqueueWithTx(tx *sql.Tx, operation string, payload classosbackend.DirectoryOperationPayload, password string) error {
+	data, secret, err := o.encode(payload, password)
+	if err != nil {
+		return err
+	}
+
+	if _, err := o.journal.AddWithTx(tx, operation, directoryObjectKeys(operation, payload), data, secret); err != nil {
+		return fmt.Errorf("failed to enqueue directory operation %s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// Add записывает операцию вне транзакции и будит обработчик
+func (o *DirectoryOutbox) Add(operation string, payload classosbackend.DirectoryOperationPayload, password string) (int64, error) {
+	data, secret, err := o.encode(payload, password)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := o.journal.Add(operation, directoryObjectKeys(operation, payload), data, secret)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue directory operation %s: %w", operation, err)
+	}
+
+	o.Notify()
+	return id, nil
+}
+
+// Notify будит обработчик, не дожидаясь очередной проверки очереди
+func (o *DirectoryOutbox) Notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run применяет операции к directory сразу и затем каждые interval или по Notify, пока не отменён ctx
+func (o *DirectoryOutbox) Run(ctx context.Context, directory Directory, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		o.process(directory)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// process применяет готовые операции, пока они не закончатся. Операции, чей повтор ещё не
+// наступил, пропускаются. Соединение проверяется один раз, перед первой операцией
+func (o *DirectoryOutbox) process(directory Directory) {
+	if time.Now().Before(o.pausedUntil) {
+		return
+	}
+
+	connected := false
+	for {
+		applied, err := o.processNext(directory, &connected)
+		if err != nil {
+			logrus.WithError(err).Error("directory outbox: failed to process operation")
+			return
+		}
+		if !applied {
+			return
+		}
+	}
+}
+
+// processNext захватывает операцию в короткой транзакции, применяет её к каталогу вне транзакции
+// и записывает результат. false - готовых операций нет или каталог недоступен
+func (o *DirectoryOutbox) processNext(directory Directory, connected *bool) (bool, error) {
+	op, err := o.journal.ClaimNext(directoryLease)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to claim pending operation: %w", err)
+	}
+
+	if !*connected {
+		if err := directory.TestConnection(); err != nil {
+			// Недоступный каталог - не ошибка операции: попытки не расходуются, очередь ждёт целиком
+			o.pausedUntil = time.Now().Add(retryDelay(o.unreachable))
+			o.unreachable++
+			logrus.WithError(err).WithField("paused_until", o.pausedUntil).Warn("directory outbox: directory is unreachable, operations are postponed")
+			if err := o.journal.Release(op.ID); err != nil {
+				return false, fmt.Errorf("failed to release operation %d: %w", op.ID, err)
+			}
+			return false, nil
+		}
+		o.unreachable = 0
+		*connected = true
+	}
+
+	log := logrus.WithFields(logrus.Fields{"id": op.ID, "operation": op.Operation, "attempt": op.Attempts + 1})
+
+	result, err := o.apply(directory, op)
+	switch {
+	case err == nil:
+		if err := o.journal.MarkDone(op.ID, result); err != nil {
+			return false, fmt.Errorf("failed to complete operation %d: %w", op.ID, err)
+		}
+		log.Info("directory outbox: operation applied")
+	case errors.Is(err, errOperationInvalid) || op.Attempts+1 >= directoryMaxAttempts:
+		if err := o.journal.MarkFailed(op.ID, err.Error()); err != nil {
+			return false, fmt.Errorf("failed to fail operation %d: %w", op.ID, err)
+		}
+		log.WithError(err).Error("directory outbox: operation failed, retry it via the admin API")
+	default:
+		// Более поздние операции с теми же объектами ждут этой, остальные продолжают применяться
+		next := time.Now().Add(retryDelay(op.Attempts))
+		if err := o.journal.Reschedule(op.ID, next, err.Error()); err != nil {
+			return false, fmt.Errorf("failed to reschedule operation %d: %w", op.ID, err)
+		}
+		log.WithError(err).WithField("next_attempt_at", next).Warn("directory outbox: operation will be retried")
+	}
+
+	return true, nil
+}
+
+// apply выполняет операцию так, чтобы её повтор после сбоя между каталогом и БД ничего не
+// сломал: уже созданные объекты не создаются заново, отсутствие удаляемых объектов не ошибка
+func (o *DirectoryOutbox) apply(directory Directory, op classosbackend.DirectoryOperation) (string, error) {
+	var payload classosbackend.DirectoryOperationPayload
+	if err := json.Unmarshal(op.Payload, &payload); err != nil {
+		return "", fmt.Errorf("%w: %s", errOperationInvalid, err.Error())
+	}
+
+	password, err := o.decrypt(op.Secret)
+	if err != nil {
+		return "", err
+	}
+	if payload.PasswordSet && password == "" {
+		return "", fmt.Errorf("%w: password is not stored", errOperationInvalid)
+	}
+
+	enabled := payload.Enabled != nil && *payload.Enabled
+
+	switch op.Operation {
+	case classosbackend.DirectoryOpCreateUser:
+		exists, err := directory.UserExists(payload.Username)
+		if err != nil || exists {
+			return "", err
+		}
+		user := ADUser{SamAccountName: payload.Username, DisplayName: payload.DisplayName, Enabled: payload.Enabled == nil || enabled}
+		return "", directory.CreateUser(user, password, payload.Group)
+	case classosbackend.DirectoryOpUpdateUser:
+		updates := ADUser{SamAccountName: payload.NewName, DisplayName: payload.DisplayName}
+		err := directory.UpdateUser(payload.Username, updates)
+		if errors.Is(err, ErrADUserNotFound) && payload.NewName != "" {
+			// Логин уже переименован прошлой попыткой
+			err = directory.UpdateUser(payload.NewName, updates)
+		}
+		return "", err
+	case classosbackend.DirectoryOpDeleteUser:
+		return "", ignoreNotFound(directory.DeleteUser(payload.Username))
+	case classosbackend.DirectoryOpChangePassword:
+		return "", directory.ChangeUserPassword(payload.Username, password)
+	case classosbackend.DirectoryOpResetPassword:
+		return "", directory.ResetPassword(payload.Username, password, payload.MustChange != nil && *payload.MustChange)
+	case classosbackend.DirectoryOpSetUserEnabled:
+		return "", directory.SetUserEnabled(payload.Username, enabled)
+	case classosbackend.DirectoryOpCreateGroup:
+		existing, err := directory.ExistingGroups([]string{payload.Group})
+		if err != nil || existing[strings.ToLower(payload.Group)] {
+			return "", err
+		}
+		return "", directory.CreateGroup(ADGroup{Name: payload.Group, Description: "Created by ClassOS"})
+	case classosbackend.DirectoryOpUpdateGroup:
+		err := directory.UpdateGroup(payload.Group, ADGroup{Name: payload.NewName})
+		if errors.Is(err, ErrADGroupNotFound) {
+			// Группа уже переименована прошлой попыткой
+			existing, existErr := directory.ExistingGroups([]string{payload.NewName})
+			if existErr == nil && existing[strings.ToLower(payload.NewName)] {
+				return "", nil
+			}
+		}
+		return "", err
+	case classosbackend.DirectoryOpDeleteGroup:
+		return "", ignoreNotFound(directory.DeleteGroup(payload.Group))
+	case classosbackend.DirectoryOpAddUserToGroup:
+		return "", directory.AddUserToGroup(payload.Username, payload.Group)
+	case classosbackend.DirectoryOpRemoveUserFromGroup:
+		return "", directory.RemoveUserFromGroup(payload.Username, payload.Group)
+	case classosbackend.DirectoryOpMoveUserToGroup:
+		return "", directory.MoveUserToAnotherGroup(payload.Username, payload.Group)
+	case classosbackend.DirectoryOpArchiveUser:
+		from, err := directory.ArchiveUser(payload.Username)
+		return from, ignoreNotFound(err)
+	case classosbackend.DirectoryOpRestoreUser:
+		originalDN, err := o.originalDN(op, classosbackend.DirectoryOpArchiveUser, map[string]string{"username": payload.Username}, payload.OriginalDN)
+		if err != nil {
+			return "", err
+		}
+		return "", directory.RestoreUser(payload.Username, originalDN, enabled)
+	case classosbackend.DirectoryOpArchiveGroup:
+		from, err := directory.ArchiveGroup(payload.Group)
+		return from, ignoreNotFound(err)
+	case classosbackend.DirectoryOpRestoreGroup:
+		originalDN, err := o.originalDN(op, classosbackend.DirectoryOpArchiveGroup, map[string]string{"group": payload.Group}, payload.OriginalDN)
+		if err != nil {
+			return "", err
+		}
+		return "", directory.RestoreGroup(payload.Group, originalDN)
+	default:
+		return "", fmt.Errorf("%w: unknown operation %q", errOperationInvalid, op.Operation)
+	}
+}
+
+// originalDN возвращает прежний DN восстанавливаемого объекта: из payload, если он был известен
+// при записи операции, иначе из результата последней архивации этого объекта
+func (o *DirectoryOutbox) originalDN(op classosbackend.DirectoryOperation, archiveOperation string,
+	match map[string]string, originalDN string) (string, error) {
+	if originalDN != "" {
+		return originalDN, nil
+	}
+
+	data, err := json.Marshal(match)
+	if err != nil {
+		return "", err
+	}
+
+	originalDN, err = o.journal.LastResult(archiveOperation, data, op.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to find archived DN: %w", err)
+	}
+
+	return originalDN, nil
+}
+
+// directoryObjectKeys перечисляет пользователей и группы, которых касается операция: операции
+// с общими объектами применяются по порядку записи. Переименование затрагивает и новое имя
+func directoryObjectKeys(operation string, payload classosbackend.DirectoryOperationPayload) []string {
+	keys := make([]string, 0, 3)
+	if payload.Username != "" {
+		keys = append(keys, "user:"+strings.ToLower(payload.Username))
+	}
+	if payload.Group != "" {
+		keys = append(keys, "group:"+strings.ToLower(payload.Group))
+	}
+	if payload.NewName != "" {
+		if operation == classosbackend.DirectoryOpUpdateGroup {
+			keys = append(keys, "group:"+strings.ToLower(payload.NewName))
+		} else {
+			keys = append(keys, "user:"+strings.ToLower(payload.NewName))
+		}
+	}
+
+	return keys
+}
+
+func (o *DirectoryOutbox) encode(payload classosbackend.DirectoryOperationPayload, password string) ([]byte, []byte, error) {
+	payload.PasswordSet = password != ""
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode directory operation: %w", err)
+	}
+
+	if password == "" {
+		return data, nil, nil
+	}
+
+	nonce := make([]byte, o.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt password: %w", err)
+	}
+
+	return data, o.aead.Seal(nonce, nonce, []byte(password), nil), nil
+}
+
+func (o *DirectoryOutbox) decrypt(secret []byte) (string, error) {
+	if len(secret) == 0 {
+		return "", nil
+	}
+
+	nonceSize := o.aead.NonceSize()
+	if len(secret) < nonceSize {
+		return "", fmt.Errorf("%w: malformed password", errOperationInvalid)
+	}
+
+	password, err := o.aead.Open(nil, secret[:nonceSize], secret[nonceSize:], nil)
+	if err != nil {
+		// Ключ приложения сменился после записи операции
+		return "", fmt.Errorf("%w: failed to decrypt password", errOperationInvalid)
+	}
+
+	return string(password), nil
+}
+
+// retryDelay - задержка перед попыткой после attempts неудачных
+func retryDelay(attempts int) time.Duration {
+	delay := directoryRetryBase
+	for i := 0; i < attempts && delay < directoryRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > directoryRetryMax {
+		delay = directoryRetryMax
+	}
+
+	return delay
+}
+
+// ignoreNotFound считает удаление или архивацию отсутствующего в каталоге объекта выполненными
+func ignoreNotFound(err error) error {
+	if errors.Is(err, ErrADUserNotFound) || errors.Is(err, ErrADGroupNotFound) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+// DriftService только читает БД и каталог: отчёт о расхождениях ничего не меняет и не
+// зависит от очереди каталога
+type DriftService struct {
+	userRepo  repository.User
+	groupRepo repository.Group
+	directory Directory
+}
+
+func NewDriftService(userRepo repository.User, groupRepo repository.Group, directory Directory) *DriftService {
+	return &DriftService{
+		userRepo:  userRepo,
+		groupRepo: groupRepo,
+		directory: directory,
+	}
+}
+
+// Drift сравнивает пользователей БД с учётными записями в OU пользователей classOS. Учётные записи
+// AD читаются постраничным поиском, поэтому отчёт строится и для нескольких тысяч пользователей
+func (s *DriftService) Drift() (classosbackend.DriftReport, error) {
+	state, err := loadSyncState(s.userRepo, s.groupRepo, s.directory)
+	if err != nil {
+		return classosbackend.DriftReport{}, err
+	}
+
+	report := classosbackend.DriftReport{
+		GeneratedAt: time.Now(),
+		DBUsers:     len(state.dbUsers),
+		ADUsers:     len(state.adUsers),
+		Entries:     make([]classosbackend.DriftEntry, 0),
+	}
+
+	add := func(entry classosbackend.DriftEntry) {
+		report.Entries = append(report.Entries, entry)
+		report.Summary.Total++
+
+		switch entry.Kind {
+		case classosbackend.DriftMissingInAD:
+			report.Summary.MissingInAD++
+		case classosbackend.DriftMissingInDB:
+			report.Summary.MissingInDB++
+		case classosbackend.DriftDisplayName:
+			report.Summary.DisplayName++
+		case classosbackend.DriftMembership:
+			report.Summary.Membership++
+		case classosbackend.DriftEnabled:
+			report.Summary.Enabled++
+		}
+	}
+
+	for _, key := range sortedKeys(state.dbUsers) {
+		user := state.dbUsers[key]
+		adUser, ok := state.adUsers[key]
+		if !ok {
+			entry := classosbackend.DriftEntry{Kind: classosbackend.DriftMissingInAD, Username: user.Username}
+			if state.adElsewhere[key] {
+				entry.Details = "account exists in AD outside the users OU"
+			}
+			add(entry)
+			continue
+		}
+
+		if user.Name != adUser.DisplayName {
+			add(classosbackend.DriftEntry{
+				Kind:     classosbackend.DriftDisplayName,
+				Username: user.Username,
+				DB:       user.Name,
+				AD:       adUser.DisplayName,
+			})
+		}
+
+		dbGroup := groupName(user)
+		inDBGroup := dbGroup == "" && len(adUser.Groups) == 0 ||
+			len(adUser.Groups) == 1 && strings.EqualFold(adUser.Groups[0], dbGroup)
+		if !inDBGroup {
+			add(classosbackend.DriftEntry{
+				Kind:     classosbackend.DriftMembership,
+				Username: user.Username,
+				DB:       dbGroup,
+				AD:       strings.Join(adUser.Groups, ", "),
+			})
+		}
+
+		if user.Enabled != adUser.Enabled {
+			add(classosbackend.DriftEntry{
+				Kind:     classosbackend.DriftEnabled,
+				Username: user.Username,
+				DB:       strconv.FormatBool(user.Enabled),
+				AD:       strconv.FormatBool(adUser.Enabled),
+			})
+		}
+	}
+
+	for _, key := range sortedKeys(state.adUsers) {
+		if _, ok := state.dbUsers[key]; ok || key == superAdminUsername {
+			continue
+		}
+
+		entry := classosbackend.DriftEntry{Kind: classosbackend.DriftMissingInDB, Username: state.adUsers[key].SamAccountName}
+		if state.archivedUsers[key] {
+			entry.Details = "user is archived in DB"
+		}
+		add(entry)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+func TestDriftReport(t *testing.T) {
+	f := newDirectoryFixture(t)
+	from := f.createGroup(t, "7A")
+	f.createGroup(t, "7B")
+	f.createUser(t, from, "renamed")
+	f.createUser(t, from, "moved")
+	f.createUser(t, from, "disabled")
+	f.createUser(t, from, "deleted")
+	f.createUser(t, from, "archived")
+	f.createUser(t, from, "synced")
+	f.flush(t)
+
+	if err := f.directory.UpdateUser("renamed", ADUser{DisplayName: "Renamed In AD"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.directory.MoveUserToAnotherGroup("moved", "7B"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.directory.SetUserEnabled("disabled", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.directory.DeleteUser("deleted"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.directory.CreateUser(ADUser{SamAccountName: "stranger", DisplayName: "Stranger", Enabled: true}, "Secret123", "7A"); err != nil {
+		t.Fatal(err)
+	}
+	// Архивирован в БД, а учётная запись в AD ещё не перенесена
+	for id, user := range f.store.users {
+		if user.Username == "archived" {
+			archivedAt := time.Now()
+			user.ArchivedAt = &archivedAt
+			f.store.users[id] = user
+		}
+	}
+	queued := len(f.journal.ops)
+
+	report, err := NewDriftService(testUserRepo{store: f.store}, testGroupRepo{store: f.store}, f.directory).Drift()
+	if err != nil {
+		t.Fatalf("drift: %v", err)
+	}
+
+	want := map[string]classosbackend.DriftEntry{
+		"renamed":  {Kind: classosbackend.DriftDisplayName, Username: "renamed", DB: "Student renamed", AD: "Renamed In AD"},
+		"moved":    {Kind: classosbackend.DriftMembership, Username: "moved", DB: "7A", AD: "7B"},
+		"disabled": {Kind: classosbackend.DriftEnabled, Username: "disabled", DB: "true", AD: "false"},
+		"deleted":  {Kind: classosbackend.DriftMissingInAD, Username: "deleted"},
+		"stranger": {Kind: classosbackend.DriftMissingInDB, Username: "stranger"},
+		"archived": {Kind: classosbackend.DriftMissingInDB, Username: "archived", Details: "user is archived in DB"},
+	}
+	if len(report.Entries) != len(want) {
+		t.Fatalf("got %d entries %+v, want %d", len(report.Entries), report.Entries, len(want))
+	}
+	for _, entry := range report.Entries {
+		if entry != want[entry.Username] {
+			t.Errorf("got %+v, want %+v", entry, want[entry.Username])
+		}
+	}
+
+	summary := classosbackend.DriftSummary{MissingInAD: 1, MissingInDB: 2, DisplayName: 1, Membership: 1, Enabled: 1, Total: 6}
+	if report.Summary != summary {
+		t.Fatalf("got summary %+v, want %+v", report.Summary, summary)
+	}
+	if report.DBUsers != 5 || report.ADUsers != 6 {
+		t.Fatalf("got %d DB and %d AD users, want 5 and 6", report.DBUsers, report.ADUsers)
+	}
+
+	// Отчёт только читает: ничего не ставится в очередь и не исправляется в AD
+	if len(f.journal.ops) != queued {
+		t.Fatal("drift queued directory operations")
+	}
+	if user, _ := f.adUser(t, "renamed"); user.DisplayName != "Renamed In AD" {
+		t.Fatal("drift changed AD")
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// policyPrecedence задаёт порядок проверки слоёв политики, от высшего приоритета к низшему:
+//
+//  0. действующие разовые разрешения пользователя (только при проверке URL, см. evaluateWithGrants)
+//  1. deny-записи группы
+//  2. allow-записи группы
+//  3. глобальные deny-записи
+//  4. глобальные allow-записи
+//  5. всё остальное запрещено
+//
+// Первый слой, в котором нашлось совпадение, определяет результат, поэтому блокировка
+// канала youtube.com/channel/X в группе действует, даже если группе разрешён *.youtube.com,
+// а группа может разрешить то, что запрещено глобально.
+// Порядок общий для проверки URL и всех экспортёров конфигов.
+var policyPrecedence = []struct {
+	source string
+	action string
+}{
+	{classosbackend.WhitelistSourceGroup, classosbackend.WhitelistActionDeny},
+	{classosbackend.WhitelistSourceGroup, classosbackend.WhitelistActionAllow},
+	{classosbackend.WhitelistSourceGlobal, classosbackend.WhitelistActionDeny},
+	{classosbackend.WhitelistSourceGlobal, classosbackend.WhitelistActionAllow},
+}
+
+type policyLayer struct {
+	source  string
+	action  string
+	entries []classosbackend.ResolvedWhitelistEntry
+	matcher *policyMatcher
+}
+
+func (l policyLayer) name() string {
+	return l.source + "_" + l.action
+}
+
+// policyEvaluator - итоговая политика группы, разложенная по слоям в порядке приоритета
+type policyEvaluator struct {
+	layers []policyLayer
+}
+
+func newPolicyEvaluator(entries []classosbackend.ResolvedWhitelistEntry) *policyEvaluator {
+	evaluator := &policyEvaluator{layers: make([]policyLayer, 0, len(policyPrecedence))}
+
+	for _, level := range policyPrecedence {
+		layer := policyLayer{source: level.source, action: level.action}
+		for _, entry := range entries {
+			if entry.Source == level.source && entry.Action == level.action {
+				layer.entries = append(layer.entries, entry)
+			}
+		}
+		layer.matcher = compileMatcher(layer.entries)
+		evaluator.layers = append(evaluator.layers, layer)
+	}
+
+	return evaluator
+}
+
+// evaluate возвращает решение для хоста и пути, запись, которая его определила, и причину
+func (e *policyEvaluator) evaluate(host, path string) (bool, *classosbackend.ResolvedWhitelistEntry, string) {
+	for _, layer := range e.layers {
+		matched := layer.matcher.match(host, path)
+		if matched == nil {
+			continue
+		}
+
+		allowed := layer.action == classosbackend.WhitelistActionAllow
+		verb := "allowed"
+		if !allowed {
+			verb = "denied"
+		}
+
+		return allowed, matched, fmt.Sprintf("%s by %s %s entry %q", verb, layer.source, layer.action, matched.Value)
+	}
+
+	return false, nil, "no whitelist entry matches the url"
+}
+
+// evaluateWithGrants проверяет разовые разрешения пользователя раньше слоёв группы:
+// учитель одобрил конкретный запрос, поэтому оно сильнее любых записей whitelist.
+// Истёкшие разрешения отбрасываются здесь, так что срок соблюдается без фоновой очистки.
+// Нулевой at значит, что grants уже отобраны по текущему времени БД
+func (e *policyEvaluator) evaluateWithGrants(grants []classosbackend.AccessRequest, at time.Time, host, path string) (bool, *classosbackend.ResolvedWhitelistEntry, string) {
+	entries := make([]classosbackend.ResolvedWhitelistEntry, 0, len(grants))
+	expires := make(map[int64]time.Time, len(grants))
+	for _, grant := range grants {
+		if grant.ExpiresAt == nil || !at.IsZero() && !grant.ActiveAt(at) {
+			continue
+		}
+
+		entries = append(entries, classosbackend.ResolvedWhitelistEntry{
+			ID:     grant.ID,
+			Value:  grant.Value,
+			Source: classosbackend.WhitelistSourceGrant,
+			Action: classosbackend.WhitelistActionAllow,
+		})
+		expires[grant.ID] = *grant.ExpiresAt
+	}
+
+	if matched := compileMatcher(entries).match(host, path); matched != nil {
+		return true, matched, fmt.Sprintf("allowed by access request %d until %s", matched.ID, expires[matched.ID].Format(time.RFC3339))
+	}
+
+	return e.evaluate(host, path)
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+func TestMatcherSpecificity(t *testing.T) {
+	entries := []classosbackend.ResolvedWhitelistEntry{
+		{ID: 1, Value: "*.example.com"},
+		{ID: 2, Value: "*.docs.example.com"},
+		{ID: 3, Value: "www.example.com"},
+		{ID: 4, Value: "www.example.com/docs"},
+		{ID: 5, Value: "www.example.com/docs/api"},
+		{ID: 6, Value: "10.0.0.0/8"},
+		{ID: 7, Value: "10.1.0.0/16"},
+		{ID: 8, Value: "static.example.com/img"},
+	}
+	matcher := compileMatcher(entries)
+
+	tests := []struct {
+		host, path string
+		want       int64
+	}{
+		{"www.example.com", "/", 3},
+		{"www.example.com", "/docs", 4},
+		{"www.example.com", "/docs/intro", 4},
+		{"www.example.com", "/docs/api/v1", 5},
+		// Путь сравнивается по границе сегмента
+		{"www.example.com", "/docsx", 3},
+		{"mail.example.com", "/", 1},
+		{"v1.docs.example.com", "/", 2},
+		// *.docs.example.com не совпадает с самим docs.example.com
+		{"docs.example.com", "/", 1},
+		{"example.com", "/", 0},
+		{"badexample.com", "/", 0},
+		// Точная запись с путём не совпала, но wildcard совпадает с любым путём
+		{"static.example.com", "/css", 1},
+		{"static.example.com", "/img/logo.png", 8},
+		{"10.2.3.4", "/", 6},
+		{"10.1.2.3", "/", 7},
+		{"::ffff:10.1.2.3", "/", 7},
+		{"11.0.0.1", "/", 0},
+	}
+
+	for _, tt := range tests {
+		var got int64
+		if entry := matcher.match(tt.host, tt.path); entry != nil {
+			got = entry.ID
+		}
+		if got != tt.want {
+			t.Errorf("match(%s, %s) = entry %d, want %d", tt.host, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluatorPrecedence(t *testing.T) {
+	evaluator := newPolicyEvaluator(testPolicy(t,
+		"global allow *.youtube.com",
+		"global deny ads.youtube.com",
+		"group deny www.youtube.com/channel/X",
+		"group allow ads.youtube.com/kids",
+		"global deny *.games.com",
+		"group allow chess.games.com",
+		"group allow *.wiki.org",
+		"global deny en.wiki.org",
+	).Data)
+
+	tests := []struct {
+		host, path string
+		want       bool
+		by         int64
+	}{
+		{"www.youtube.com", "/watch", true, 1},
+		// Группа запрещает канал, хотя весь *.youtube.com разрешён глобально
+		{"www.youtube.com", "/channel/X", false, 3},
+		{"ads.youtube.com", "/", false, 2},
+		// Группа может разрешить то, что запрещено глобально
+		{"ads.youtube.com", "/kids/show", true, 4},
+		{"chess.games.com", "/", true, 6},
+		{"poker.games.com", "/", false, 5},
+		{"en.wiki.org", "/", true, 7},
+		{"youtube.com", "/", false, 0},
+		{"unknown.org", "/", false, 0},
+	}
+
+	for _, tt := range tests {
+		allowed, entry, reason := evaluator.evaluate(tt.host, tt.path)
+		var by int64
+		if entry != nil {
+			by = entry.ID
+		}
+		if allowed != tt.want || by != tt.by {
+			t.Errorf("%s%s: got %v by entry %d (%s), want %v by entry %d", tt.host, tt.path, allowed, by, reason, tt.want, tt.by)
+		}
+	}
+}
+
+func TestEvaluateWithGrants(t *testing.T) {
+	evaluator := newPolicyEvaluator(testPolicy(t, "group deny *.games.com").Data)
+
+	now := time.Now()
+	decided, active, expired := now.Add(-time.Hour), now.Add(time.Hour), now.Add(-time.Minute)
+	grants := []classosbackend.AccessRequest{
+		{ID: 10, Value: "chess.games.com", Status: classosbackend.AccessRequestApprovedOnce, DecidedAt: &decided, ExpiresAt: &active},
+		{ID: 11, Value: "poker.games.com", Status: classosbackend.AccessRequestApprovedOnce, DecidedAt: &decided, ExpiresAt: &expired},
+	}
+
+	// Одобренный запрос сильнее deny-записи группы
+	if allowed, entry, _ := evaluator.evaluateWithGrants(grants, now, "chess.games.com", "/"); !allowed || entry.ID != 10 {
+		t.Fatalf("active grant: got %v by %+v", allowed, entry)
+	}
+	if allowed, _, _ := evaluator.evaluateWithGrants(grants, now, "poker.games.com", "/"); allowed {
+		t.Fatal("expired grant still allows")
+	}
+	// Нулевой at: grants уже отобраны по времени БД
+	if allowed, _, _ := evaluator.evaluateWithGrants(grants[:1], time.Time{}, "chess.games.com", "/"); !allowed {
+		t.Fatal("preselected grant is ignored")
+	}
+}
+
+func TestParseCheckURL(t *testing.T) {
+	tests := []struct {
+		raw, host, path string
+	}{
+		{"https://WWW.Example.com./Docs/API?q=1", "www.example.com", "/Docs/API"},
+		{"example.com/docs", "example.com", "/docs"},
+		{"http://10.1.2.3:8080", "10.1.2.3", ""},
+		{"  http://[::1]/x  ", "::1", "/x"},
+	}
+
+	for _, tt := range tests {
+		host, path, err := parseCheckURL(tt.raw)
+		if err != nil || host != tt.host || path != tt.path {
+			t.Errorf("parseCheckURL(%q) = %q, %q, %v; want %q, %q", tt.raw, host, path, err, tt.host, tt.path)
+		}
+	}
+
+	if _, _, err := parseCheckURL("http:///path"); !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("empty host: got %v, want ErrInvalidURL", err)
+	}
+}
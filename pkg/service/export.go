@@ -0,0 +1,352 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+var ErrUnsupportedExportFormat = errors.New("unsupported export format")
+
+// DefaultDNSUpstream - DNS-сервер для разрешённых доменов в конфиге dnsmasq, если dns_upstream
+// не задан в конфиге
+const DefaultDNSUpstream = "1.1.1.1"
+
+const blockedPACProxy = "PROXY 127.0.0.1:9"
+
+type exportHeader struct {
+	groupId      int
+	entrySet     string
+	unrestricted bool
+}
+
+func (h exportHeader) String() string {
+	return fmt.Sprintf("classOS whitelist for group %d, entry set %q", h.groupId, h.entrySet)
+}
+
+// exportRules - записи одного слоя политики, разложенные по типам для генераторов конфигов
+type exportRules struct {
+	hosts     []string
+	wildcards []string
+	urls      []string
+	prefixes  []netip.Prefix
+	ips       []string
+}
+
+func classifyEntries(entries []classosbackend.ResolvedWhitelistEntry) exportRules {
+	var rules exportRules
+	for _, entry := range entries {
+		if prefix, err := netip.ParsePrefix(entry.Value); err == nil {
+			rules.prefixes = append(rules.prefixes, prefix)
+			continue
+		}
+
+		host, path := splitEntryValue(entry.Value)
+		switch {
+		case path != "":
+			rules.urls = append(rules.urls, entry.Value)
+		case strings.HasPrefix(host, "*."):
+			rules.wildcards = append(rules.wildcards, strings.TrimPrefix(host, "*."))
+		case net.ParseIP(host) != nil:
+			rules.ips = append(rules.ips, host)
+		default:
+			rules.hosts = append(rules.hosts, host)
+		}
+	}
+
+	return rules
+}
+
+// renderPolicyExport рендерит политику из preview. Все форматы обходят слои policyEvaluator
+// в порядке policyPrecedence, поэтому приоритеты совпадают с проверкой URL.
+// ETag зависит только от содержимого, поэтому смена активного набора по расписанию тоже меняет ETag
+func renderPolicyExport(format string, preview classosbackend.PolicyPreview, dnsUpstream string) (classosbackend.PolicyExport, error) {
+	var body []byte
+	var contentType string
+	var err error
+
+	evaluator := newPolicyEvaluator(preview.Data)
+	header := exportHeader{groupId: preview.GroupID, entrySet: preview.EntrySet, unrestricted: preview.Unrestricted}
+	switch format {
+	case classosbackend.ExportFormatSquid:
+		body, contentType = renderSquid(header, evaluator), "text/plain; charset=utf-8"
+	case classosbackend.ExportFormatDnsmasq:
+		body, contentType = renderDnsmasq(header, evaluator, dnsUpstream), "text/plain; charset=utf-8"
+	case classosbackend.ExportFormatPAC:
+		body, contentType = renderPAC(header, evaluator), "application/x-ns-proxy-autoconfig"
+	case classosbackend.ExportFormatHosts:
+		body, contentType = renderHosts(header, evaluator), "text/plain; charset=utf-8"
+	case classosbackend.ExportFormatJSON:
+		body, err = json.Marshal(map[string]interface{}{
+			"group_id":     preview.GroupID,
+			"entry_set":    preview.EntrySet,
+			"unrestricted": preview.Unrestricted,
+			"entries":      preview.Data,
+		})
+		contentType = "application/json; charset=utf-8"
+	default:
+		return classosbackend.PolicyExport{}, fmt.Errorf("%w: %q", ErrUnsupportedExportFormat, format)
+	}
+	if err != nil {
+		return classosbackend.PolicyExport{}, err
+	}
+
+	sum := sha256.Sum256(body)
+	return classosbackend.PolicyExport{
+		ContentType: contentType,
+		ETag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+		Body:        body,
+	}, nil
+}
+
+// renderSquid генерирует acl для подключения через include в squid.conf.
+// Squid применяет http_access по порядку, это и есть порядок слоёв политики
+func renderSquid(header exportHeader, evaluator *policyEvaluator) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "# %s\n", header)
+	if header.unrestricted {
+		b.WriteString("http_access allow all\n")
+		return b.Bytes()
+	}
+
+	for _, layer := range evaluator.layers {
+		rules := classifyEntries(layer.entries)
+		name := fmt.Sprintf("classos_group_%d_%s", header.groupId, layer.name())
+
+		var acls []string
+		if len(rules.hosts) > 0 {
+			fmt.Fprintf(&b, "acl %s_hosts dstdomain %s\n", name, strings.Join(rules.hosts, " "))
+			acls = append(acls, name+"_hosts")
+		}
+
+		if len(rules.wildcards) > 0 {
+			// dstdomain .example.com совпадает и с самим доменом, поэтому для *.example.com используем regex
+			patterns := make([]string, 0, len(rules.wildcards))
+			for _, domain := range rules.wildcards {
+				patterns = append(patterns, `\.`+regexp.QuoteMeta(domain)+`$`)
+			}
+			fmt.Fprintf(&b, "acl %s_wildcards dstdom_regex -i %s\n", name, strings.Join(patterns, " "))
+			acls = append(acls, name+"_wildcards")
+		}
+
+		if len(rules.urls) > 0 {
+			patterns := make([]string, 0, len(rules.urls))
+			for _, value := range rules.urls {
+				patterns = append(patterns, urlPattern(value))
+			}
+			fmt.Fprintf(&b, "acl %s_urls url_regex -i %s\n", name, strings.Join(patterns, " "))
+			acls = append(acls, name+"_urls")
+		}
+
+		if len(rules.ips) > 0 || len(rules.prefixes) > 0 {
+			nets := append([]string{}, rules.ips...)
+			for _, prefix := range rules.prefixes {
+				nets = append(nets, prefix.String())
+			}
+			fmt.Fprintf(&b, "acl %s_nets dst %s\n", name, strings.Join(nets, " "))
+			acls = append(acls, name+"_nets")
+		}
+
+		for _, acl := range acls {
+			fmt.Fprintf(&b, "http_access %s %s\n", layer.action, acl)
+		}
+	}
+	b.WriteString("http_access deny all\n")
+
+	return b.Bytes()
+}
+
+// urlPattern - регулярное выражение для записи с путём, путь сравнивается по границе сегмента
+func urlPattern(value string) string {
+	host, path := splitEntryValue(value)
+	return `^https?://` + squidHostPattern(host) + `(:[0-9]+)?` + regexp.QuoteMeta(path) + `([/?#]|$)`
+}
+
+func squidHostPattern(host string) string {
+	if domain, ok := strings.CutPrefix(host, "*."); ok {
+		return `[^/:]+\.` + regexp.QuoteMeta(domain)
+	}
+
+	return regexp.QuoteMeta(host)
+}
+
+// renderDnsmasq пропускает разрешённые имена к upstream, запрещённые и всё остальное резолвит в 0.0.0.0.
+// Решение для каждого имени из записей берётся у policyEvaluator: строка /d/ - решение для самого d,
+// /*.d/ - для его поддоменов, если оно другое. dnsmasq выбирает самое длинное совпадение, а шаблон
+// /*.d/ (dnsmasq 2.86+) совпадает только с поддоменами. DNS не видит пути, поэтому имя открыто, если
+// политика разрешает его хотя бы по одному пути. IP-записи и deny-записи с путём попадают в конфиг комментариями
+func renderDnsmasq(header exportHeader, evaluator *policyEvaluator, upstream string) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "# %s\n", header)
+	if header.unrestricted {
+		b.WriteString("# unrestricted: all names are resolved upstream\n")
+		return b.Bytes()
+	}
+
+	var domains, skipped []string
+	seen := make(map[string]bool)
+	paths := []string{""}
+	for _, layer := range evaluator.layers {
+		allow := layer.action == classosbackend.WhitelistActionAllow
+		for _, entry := range layer.entries {
+			host, path := splitEntryValue(entry.Value)
+			if _, err := netip.ParsePrefix(entry.Value); err == nil || net.ParseIP(host) != nil || path != "" && !allow {
+				skipped = append(skipped, layer.action+" "+entry.Value)
+				continue
+			}
+			if path != "" {
+				paths = append(paths, path)
+			}
+
+			domain := strings.TrimPrefix(host, "*.")
+			if !seen[domain] {
+				seen[domain] = true
+				domains = append(domains, domain)
+			}
+		}
+	}
+
+	// Имя открыто, если политика разрешает хотя бы один путь: решающая allow-запись
+	// разрешает и свой собственный путь, поэтому достаточно проверить пути allow-записей
+	resolvable := func(host string) bool {
+		for _, path := range paths {
+			if allowed, _, _ := evaluator.evaluate(host, path); allowed {
+				return true
+			}
+		}
+		return false
+	}
+	writeRule := func(pattern string, allowed bool) {
+		if allowed {
+			fmt.Fprintf(&b, "server=/%s/%s\n", pattern, upstream)
+		} else {
+			fmt.Fprintf(&b, "address=/%s/0.0.0.0\n", pattern)
+		}
+	}
+
+	for _, domain := range domains {
+		// evaluate для "*.d" проверяет только wildcard-записи, то есть произвольный поддомен d
+		self, subdomains := resolvable(domain), resolvable("*."+domain)
+		writeRule(domain, self)
+		if subdomains != self {
+			writeRule("*."+domain, subdomains)
+		}
+	}
+
+	for _, entry := range skipped {
+		fmt.Fprintf(&b, "# not applicable to DNS: %s\n", entry)
+	}
+
+	b.WriteString("address=/#/0.0.0.0\n")
+
+	return b.Bytes()
+}
+
+// renderPAC генерирует proxy auto-config: разрешённое идёт напрямую, запрещённое в несуществующий прокси.
+// Браузеры передают в PAC только хост для https, поэтому allow-записи с путём в этом случае
+// проверяются по хосту, а deny-записи с путём срабатывают только на полный URL
+func renderPAC(header exportHeader, evaluator *policyEvaluator) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "// %s\n", header)
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	if header.unrestricted {
+		b.WriteString("\treturn \"DIRECT\";\n}\n")
+		return b.Bytes()
+	}
+
+	b.WriteString("\thost = host.toLowerCase();\n")
+	b.WriteString("\tvar stripped = /^[a-z]+:\\/\\/[^\\/]*\\/?$/.test(url);\n")
+
+	for _, layer := range evaluator.layers {
+		result := jsString(blockedPACProxy)
+		if layer.action == classosbackend.WhitelistActionAllow {
+			result = jsString("DIRECT")
+		}
+
+		for _, entry := range layer.entries {
+			if condition := pacCondition(entry.Value, layer.action); condition != "" {
+				fmt.Fprintf(&b, "\tif (%s) return %s;\n", condition, result)
+			}
+		}
+	}
+
+	fmt.Fprintf(&b, "\treturn %s;\n", jsString(blockedPACProxy))
+	b.WriteString("}\n")
+
+	return b.Bytes()
+}
+
+func pacCondition(value, action string) string {
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		if !prefix.Addr().Is4() {
+			return ""
+		}
+		mask := net.CIDRMask(prefix.Bits(), 32)
+		return fmt.Sprintf("isInNet(host, %s, %s)", jsString(prefix.Addr().String()), jsString(net.IP(mask).String()))
+	}
+
+	host, path := splitEntryValue(value)
+	hostCheck := fmt.Sprintf("host == %s", jsString(host))
+	if domain, ok := strings.CutPrefix(host, "*."); ok {
+		hostCheck = fmt.Sprintf("dnsDomainIs(host, %s)", jsString("."+domain))
+	}
+
+	if path == "" {
+		return hostCheck
+	}
+
+	pathCheck := fmt.Sprintf("new RegExp(%s, \"i\").test(url)", jsString(urlPattern(value)))
+	if action == classosbackend.WhitelistActionAllow {
+		pathCheck = "(stripped || " + pathCheck + ")"
+	}
+
+	return hostCheck + " && " + pathCheck
+}
+
+// renderHosts - формат hosts умеет только блокировать конкретные имена.
+// Запрещённое имя выводится, только если политика действительно его блокирует, остальное справочно
+func renderHosts(header exportHeader, evaluator *policyEvaluator) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "# %s\n", header)
+	if header.unrestricted {
+		b.WriteString("# unrestricted: nothing is blocked\n")
+		return b.Bytes()
+	}
+
+	b.WriteString("# hosts files can only block exact names; other entries are listed for reference\n")
+	for _, layer := range evaluator.layers {
+		for _, entry := range layer.entries {
+			host, path := splitEntryValue(entry.Value)
+			blockable := layer.action == classosbackend.WhitelistActionDeny && path == "" &&
+				!strings.HasPrefix(host, "*.") && net.ParseIP(host) == nil
+			if !blockable {
+				fmt.Fprintf(&b, "# %s %s\n", layer.action, entry.Value)
+				continue
+			}
+
+			if allowed, _, _ := evaluator.evaluate(host, ""); !allowed {
+				fmt.Fprintf(&b, "0.0.0.0 %s\n", host)
+			}
+		}
+	}
+
+	return b.Bytes()
+}
+
+func jsString(value string) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
@@ -0,0 +1,432 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+	"testing"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// testPolicy собирает политику из строк вида "group deny *.example.com"
+func testPolicy(t *testing.T, lines ...string) classosbackend.PolicyPreview {
+	t.Helper()
+
+	preview := classosbackend.PolicyPreview{GroupID: 7, EntrySet: "default"}
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			t.Fatalf("bad policy line %q", line)
+		}
+		preview.Data = append(preview.Data, classosbackend.ResolvedWhitelistEntry{
+			ID:     int64(i + 1),
+			Source: fields[0],
+			Action: fields[1],
+			Value:  fields[2],
+		})
+	}
+
+	return preview
+}
+
+func renderFormat(t *testing.T, format string, preview classosbackend.PolicyPreview) string {
+	t.Helper()
+
+	export, err := renderPolicyExport(format, preview, DefaultDNSUpstream)
+	if err != nil {
+		t.Fatalf("render %s: %v", format, err)
+	}
+
+	return string(export.Body)
+}
+
+// squidAllows применяет http_access из конфига squid к URL так же, как squid: первое совпадение решает
+func squidAllows(t *testing.T, config, host, path string) bool {
+	t.Helper()
+
+	url := "http://" + host + path
+	acls := make(map[string]func() bool)
+	for _, line := range strings.Split(config, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "acl":
+			name, kind, values := fields[1], fields[2], fields[3:]
+			switch kind {
+			case "dstdomain":
+				acls[name] = func() bool {
+					for _, value := range values {
+						if strings.EqualFold(host, value) {
+							return true
+						}
+					}
+					return false
+				}
+			case "dstdom_regex", "url_regex":
+				subject := host
+				if kind == "url_regex" {
+					subject = url
+				}
+				acls[name] = func() bool {
+					for _, value := range values[1:] {
+						if regexp.MustCompile("(?i)" + value).MatchString(subject) {
+							return true
+						}
+					}
+					return false
+				}
+			case "dst":
+				acls[name] = func() bool {
+					addr, err := netip.ParseAddr(host)
+					if err != nil {
+						return false
+					}
+					for _, value := range values {
+						if prefix, err := netip.ParsePrefix(value); err == nil && prefix.Contains(addr) {
+							return true
+						}
+						if value == host {
+							return true
+						}
+					}
+					return false
+				}
+			default:
+				t.Fatalf("unknown squid acl type in %q", line)
+			}
+		case "http_access":
+			if fields[2] == "all" {
+				return fields[1] == "allow"
+			}
+			acl, ok := acls[fields[2]]
+			if !ok {
+				t.Fatalf("http_access uses undefined acl %s", fields[2])
+			}
+			if acl() {
+				return fields[1] == "allow"
+			}
+		}
+	}
+
+	t.Fatal("squid config has no final http_access")
+	return false
+}
+
+// dnsmasqResolves выбирает самый длинный шаблон server/address, подходящий под имя:
+// /d/ совпадает с d и его поддоменами, /*.d/ - только с поддоменами
+func dnsmasqResolves(t *testing.T, config, host string) bool {
+	t.Helper()
+
+	rule := regexp.MustCompile(`^(server|address)=/([^/]+)/`)
+	best, allowed := -1, false
+	for _, line := range strings.Split(config, "\n") {
+		m := rule.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		pattern, length := m[2], 0
+		switch {
+		case pattern == "#":
+		case strings.HasPrefix(pattern, "*."):
+			if !strings.HasSuffix(host, pattern[1:]) {
+				continue
+			}
+			length = len(pattern) - 1
+		default:
+			if host != pattern && !strings.HasSuffix(host, "."+pattern) {
+				continue
+			}
+			length = len(pattern)
+		}
+
+		if length > best {
+			best, allowed = length, m[1] == "server"
+		}
+	}
+
+	if best < 0 {
+		t.Fatal("dnsmasq config has no default rule")
+	}
+
+	return allowed
+}
+
+// pacAllows выполняет условия, которые генерирует pacCondition, по порядку
+func pacAllows(t *testing.T, config, host, path string) bool {
+	t.Helper()
+
+	url := "http://" + host + path
+	stripped := regexp.MustCompile(`^[a-z]+://[^/]*/?$`).MatchString(url)
+	str := `("(?:[^"\\]|\\.)*")`
+	hostEq := regexp.MustCompile(`^host == ` + str)
+	domainIs := regexp.MustCompile(`^dnsDomainIs\(host, ` + str + `\)`)
+	inNet := regexp.MustCompile(`^isInNet\(host, ` + str + `, ` + str + `\)`)
+	urlTest := regexp.MustCompile(`^ && (\(stripped \|\| )?new RegExp\(` + str + `, "i"\)\.test\(url\)\)?$`)
+	decode := func(value string) string {
+		var s string
+		if err := json.Unmarshal([]byte(value), &s); err != nil {
+			t.Fatalf("decode %s: %v", value, err)
+		}
+		return s
+	}
+
+	ifLine := regexp.MustCompile(`^\tif \((.*)\) return (".*");$`)
+	for _, line := range strings.Split(config, "\n") {
+		if strings.HasPrefix(line, "\treturn ") {
+			return decode(strings.TrimSuffix(strings.TrimPrefix(line, "\treturn "), ";")) == "DIRECT"
+		}
+		m := ifLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		condition, matched := m[1], false
+		if c := hostEq.FindStringSubmatch(condition); c != nil {
+			matched = host == decode(c[1])
+			condition = condition[len(c[0]):]
+		} else if c := domainIs.FindStringSubmatch(condition); c != nil {
+			matched = strings.HasSuffix(host, decode(c[1]))
+			condition = condition[len(c[0]):]
+		} else if c := inNet.FindStringSubmatch(condition); c != nil {
+			ip, mask := net.ParseIP(host), net.IPMask(net.ParseIP(decode(c[2])).To4())
+			matched = ip != nil && ip.Mask(mask).Equal(net.ParseIP(decode(c[1])).Mask(mask))
+			condition = condition[len(c[0]):]
+		} else {
+			t.Fatalf("unknown PAC condition %q", condition)
+		}
+
+		if condition != "" {
+			c := urlTest.FindStringSubmatch(condition)
+			if c == nil {
+				t.Fatalf("unknown PAC condition %q", m[1])
+			}
+			urlMatched := regexp.MustCompile("(?i)" + decode(c[2])).MatchString(url)
+			matched = matched && (c[1] != "" && stripped || urlMatched)
+		}
+
+		if matched {
+			return decode(m[2]) == "DIRECT"
+		}
+	}
+
+	t.Fatal("PAC has no final return")
+	return false
+}
+
+func hostsBlocks(config, host string) bool {
+	for _, line := range strings.Split(config, "\n") {
+		if line == "0.0.0.0 "+host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TestExportersAgreeWithEvaluator проверяет, что каждый формат экспорта даёт то же решение,
+// что и проверка URL. DNS не видит путей, поэтому для dnsmasq сравнивается решение без пути,
+// если в случае не задано иное
+func TestExportersAgreeWithEvaluator(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy []string
+		probes []string
+		// dns - ожидаемый ответ dnsmasq там, где он отличается от решения для хоста без пути
+		dns map[string]bool
+	}{
+		{
+			name:   "group deny wildcard, group allow apex",
+			policy: []string{"group deny *.example.com", "group allow example.com"},
+			probes: []string{"example.com", "www.example.com", "a.b.example.com"},
+		},
+		{
+			name:   "group allow wildcard beats global deny",
+			policy: []string{"group allow *.school.org", "global deny ads.school.org"},
+			probes: []string{"school.org", "www.school.org", "ads.school.org", "x.ads.school.org"},
+		},
+		{
+			name:   "wildcard allow does not open the apex",
+			policy: []string{"global allow *.wiki.org"},
+			probes: []string{"wiki.org", "en.wiki.org", "wiki.org.evil.com"},
+		},
+		{
+			name:   "exact allow does not open subdomains",
+			policy: []string{"global allow example.com"},
+			probes: []string{"example.com", "www.example.com", "notexample.com"},
+		},
+		{
+			name:   "exact deny inside a wildcard allow",
+			policy: []string{"global allow *.edu.ru", "global deny cheat.edu.ru"},
+			probes: []string{"edu.ru", "cheat.edu.ru", "a.cheat.edu.ru", "school.edu.ru"},
+		},
+		{
+			name:   "nested wildcards",
+			policy: []string{"global allow *.example.org", "global deny *.ads.example.org"},
+			probes: []string{"example.org", "ads.example.org", "x.ads.example.org", "www.example.org"},
+		},
+		{
+			name:   "group deny path inside a group allow wildcard",
+			policy: []string{"group allow *.youtube.com", "group deny www.youtube.com/channel/X"},
+			probes: []string{"www.youtube.com/channel/X", "www.youtube.com/channel/X/videos", "www.youtube.com/watch", "m.youtube.com"},
+		},
+		{
+			name:   "allow path opens the host in DNS",
+			policy: []string{"global allow docs.site.com/guide", "global allow *.site.com/public"},
+			probes: []string{"docs.site.com/guide", "docs.site.com/guide/intro", "docs.site.com/other", "www.site.com/public", "www.site.com"},
+			dns:    map[string]bool{"docs.site.com": true, "www.site.com": true},
+		},
+		{
+			name:   "networks",
+			policy: []string{"global allow 10.0.0.0/8", "group deny 10.1.0.0/16"},
+			probes: []string{"10.2.3.4", "10.1.2.3", "192.168.0.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preview := testPolicy(t, tt.policy...)
+			evaluator := newPolicyEvaluator(preview.Data)
+			squid := renderFormat(t, classosbackend.ExportFormatSquid, preview)
+			dnsmasq := renderFormat(t, classosbackend.ExportFormatDnsmasq, preview)
+			pac := renderFormat(t, classosbackend.ExportFormatPAC, preview)
+			hosts := renderFormat(t, classosbackend.ExportFormatHosts, preview)
+
+			for _, probe := range tt.probes {
+				host, path := splitEntryValue(probe)
+				if path == "" {
+					// Полный URL: PAC для https видит только хост, это проверяется отдельно
+					path = "/index.html"
+				}
+				want, _, reason := evaluator.evaluate(host, path)
+
+				if got := squidAllows(t, squid, host, path); got != want {
+					t.Errorf("squid %s%s: got %v, evaluator %v (%s)", host, path, got, want, reason)
+				}
+				if got := pacAllows(t, pac, host, path); got != want {
+					t.Errorf("pac %s%s: got %v, evaluator %v (%s)", host, path, got, want, reason)
+				}
+
+				if net.ParseIP(host) != nil {
+					continue
+				}
+
+				wantDNS, ok := tt.dns[host]
+				if !ok {
+					wantDNS, _, _ = evaluator.evaluate(host, "")
+				}
+				if got := dnsmasqResolves(t, dnsmasq, host); got != wantDNS {
+					t.Errorf("dnsmasq %s: got %v, want %v\n%s", host, got, wantDNS, dnsmasq)
+				}
+
+				if allowed, _, _ := evaluator.evaluate(host, ""); allowed && hostsBlocks(hosts, host) {
+					t.Errorf("hosts blocks %s, but the evaluator allows it", host)
+				}
+			}
+		})
+	}
+}
+
+func TestExportETag(t *testing.T) {
+	preview := testPolicy(t, "global allow example.com")
+
+	for _, format := range []string{
+		classosbackend.ExportFormatSquid, classosbackend.ExportFormatDnsmasq, classosbackend.ExportFormatPAC,
+		classosbackend.ExportFormatHosts, classosbackend.ExportFormatJSON,
+	} {
+		first, err := renderPolicyExport(format, preview, DefaultDNSUpstream)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		again, _ := renderPolicyExport(format, preview, DefaultDNSUpstream)
+		if first.ETag != again.ETag {
+			t.Errorf("%s: ETag changed between identical renders", format)
+		}
+
+		// Смена активного набора по расписанию меняет содержимое, а с ним и ETag
+		switched := preview
+		switched.EntrySet = "exams"
+		if other, _ := renderPolicyExport(format, switched, DefaultDNSUpstream); other.ETag == first.ETag {
+			t.Errorf("%s: ETag did not change with the entry set", format)
+		}
+	}
+
+	if _, err := renderPolicyExport("iptables", preview, DefaultDNSUpstream); !errors.Is(err, ErrUnsupportedExportFormat) {
+		t.Fatalf("got %v, want ErrUnsupportedExportFormat", err)
+	}
+}
+
+func TestExportUnrestricted(t *testing.T) {
+	preview := testPolicy(t, "global deny example.com")
+	preview.Unrestricted = true
+
+	squid := renderFormat(t, classosbackend.ExportFormatSquid, preview)
+	if !squidAllows(t, squid, "example.com", "/") {
+		t.Errorf("squid blocks in unrestricted mode:\n%s", squid)
+	}
+	if dnsmasq := renderFormat(t, classosbackend.ExportFormatDnsmasq, preview); strings.Contains(dnsmasq, "address=") {
+		t.Errorf("dnsmasq blocks in unrestricted mode:\n%s", dnsmasq)
+	}
+	if pac := renderFormat(t, classosbackend.ExportFormatPAC, preview); !pacAllows(t, pac, "example.com", "/") {
+		t.Errorf("PAC blocks in unrestricted mode:\n%s", pac)
+	}
+	if hosts := renderFormat(t, classosbackend.ExportFormatHosts, preview); hostsBlocks(hosts, "example.com") {
+		t.Errorf("hosts blocks in unrestricted mode:\n%s", hosts)
+	}
+}
+
+func TestExportFormatSpecifics(t *testing.T) {
+	preview := testPolicy(t,
+		"group allow *.wiki.org",
+		"group deny www.youtube.com/channel/X",
+		"global deny games.com",
+		"global deny *.games.com",
+		"global allow 10.0.0.0/8",
+		"global allow www.youtube.com/edu",
+	)
+
+	// https: браузер передаёт в PAC только хост, поэтому allow-запись с путём открывает хост,
+	// а deny-запись с путём не срабатывает
+	pac := renderFormat(t, classosbackend.ExportFormatPAC, preview)
+	if !pacAllows(t, pac, "www.youtube.com", "") {
+		t.Errorf("PAC blocks the host of an allowed path for a stripped URL:\n%s", pac)
+	}
+
+	hosts := renderFormat(t, classosbackend.ExportFormatHosts, preview)
+	if !hostsBlocks(hosts, "games.com") {
+		t.Errorf("hosts does not block games.com:\n%s", hosts)
+	}
+	for _, line := range []string{"# deny *.games.com", "# allow 10.0.0.0/8", "# deny www.youtube.com/channel/X"} {
+		if !strings.Contains(hosts, line+"\n") {
+			t.Errorf("hosts does not list %q for reference:\n%s", line, hosts)
+		}
+	}
+
+	dnsmasq := renderFormat(t, classosbackend.ExportFormatDnsmasq, preview)
+	for _, line := range []string{"# not applicable to DNS: allow 10.0.0.0/8", "# not applicable to DNS: deny www.youtube.com/channel/X"} {
+		if !strings.Contains(dnsmasq, line+"\n") {
+			t.Errorf("dnsmasq does not note %q:\n%s", line, dnsmasq)
+		}
+	}
+	if !strings.HasSuffix(dnsmasq, "address=/#/0.0.0.0\n") || !strings.Contains(dnsmasq, "server=/www.youtube.com/"+DefaultDNSUpstream+"\n") {
+		t.Errorf("unexpected dnsmasq config:\n%s", dnsmasq)
+	}
+
+	var decoded struct {
+		GroupID int                                     `json:"group_id"`
+		Entries []classosbackend.ResolvedWhitelistEntry `json:"entries"`
+	}
+	if err := json.Unmarshal([]byte(renderFormat(t, classosbackend.ExportFormatJSON, preview)), &decoded); err != nil {
+		t.Fatalf("decode JSON export: %v", err)
+	}
+	if decoded.GroupID != preview.GroupID || len(decoded.Entries) != len(preview.Data) {
+		t.Fatalf("got %+v, want the preview entries", decoded)
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// directoryFixture - сервисы поверх репозиториев в памяти и MemoryDirectory. Операции каталога
+// применяет flush, как это делает обработчик очереди
+type directoryFixture struct {
+	store     *testStore
+	journal   *testJournal
+	directory *MemoryDirectory
+	outbox    *DirectoryOutbox
+	auth      *AuthService
+	users     *IntegratedUserService
+	groups    *IntegratedGroupService
+	archive   *ArchiveService
+	sync      *SyncService
+
+	admin int
+}
+
+func newDirectoryFixture(t *testing.T) *directoryFixture {
+	store := newTestStore(t)
+	settings := NewSettingsService(nil)
+	userRepo := testUserRepo{store: store}
+	groupRepo := testGroupRepo{store: store}
+
+	f := &directoryFixture{
+		store:     store,
+		journal:   newTestJournal(store),
+		directory: NewMemoryDirectory(settings, ""),
+	}
+	f.outbox = NewDirectoryOutbox(f.journal)
+	f.auth = NewAuthService(testAuthRepo{store: store}, nil, settings)
+	f.archive = NewArchiveService(userRepo, groupRepo, f.outbox, f.auth, settings)
+	generator := NewCredentialGenerator(userRepo, f.directory, settings)
+	f.users = NewIntegratedUserService(userRepo, groupRepo, f.auth, f.directory, f.outbox, generator, f.archive)
+	f.groups = NewIntegratedGroupService(groupRepo, f.outbox, f.archive)
+	f.sync = NewSyncService(userRepo, groupRepo, f.journal, f.directory, f.outbox, f.archive, f.auth)
+	f.admin = store.addUser(t, superAdminUsername, classosbackend.RoleAdmin, 0)
+
+	return f
+}
+
+// flush применяет очередь и проверяет, что все операции применены
+func (f *directoryFixture) flush(t *testing.T) {
+	t.Helper()
+
+	f.outbox.process(f.directory)
+
+	ops, _ := f.journal.GetByStatus("", len(f.journal.ops))
+	for _, op := range ops {
+		if op.Status != classosbackend.DirectoryOpDone {
+			lastError := ""
+			if op.LastError != nil {
+				lastError = *op.LastError
+			}
+			t.Fatalf("operation %d %s is %s: %s", op.ID, op.Operation, op.Status, lastError)
+		}
+	}
+}
+
+func (f *directoryFixture) createGroup(t *testing.T, name string) int {
+	t.Helper()
+
+	groupId, err := f.groups.Create(f.admin, classosbackend.Group{Name: name})
+	if err != nil {
+		t.Fatalf("create group %s: %v", name, err)
+	}
+
+	return groupId
+}
+
+func (f *directoryFixture) createUser(t *testing.T, groupId int, username string) int {
+	t.Helper()
+
+	input := classosbackend.CreateUserInput{Name: "Student " + username, Username: username, Password: "Secret123"}
+	created, err := f.users.Create(f.admin, groupId, input.User())
+	if err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+
+	return created.ID
+}
+
+// adUser ищет учётную запись в OU пользователей
+func (f *directoryFixture) adUser(t *testing.T, username string) (ADUser, bool) {
+	t.Helper()
+
+	users, err := f.directory.ListUsers()
+	if err != nil {
+		t.Fatalf("list AD users: %v", err)
+	}
+
+	for _, user := range users {
+		if strings.EqualFold(user.SamAccountName, username) {
+			return user, true
+		}
+	}
+
+	return ADUser{}, false
+}
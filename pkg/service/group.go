@@ -14,18 +14,31 @@ func NewGroupService(repo repository.Group) *GroupService {
 }
 
 func (s *GroupService) Create(checkerId int, group classosbackend.Group) (int, error) {
+	if err := requireAllGroups(s.repo, checkerId); err != nil {
+		return 0, err
+	}
 	return s.repo.Create(checkerId, group)
 }
 
 func (s *GroupService) GetAll(checkerId int) ([]classosbackend.Group, error) {
-	return s.repo.GetAll(checkerId)
+	groups, err := s.repo.GetAll(checkerId)
+	if err != nil {
+		return nil, err
+	}
+	return filterGroups(s.repo, checkerId, groups)
 }
 
 func (s *GroupService) GetById(checkerId, groupId int) (classosbackend.Group, error) {
+	if err := checkGroup(s.repo, checkerId, groupId); err != nil {
+		return classosbackend.Group{}, err
+	}
 	return s.repo.GetById(checkerId, groupId)
 }
 
 func (s *GroupService) Delete(checkerId, groupId int) error {
+	if err := requireAllGroups(s.repo, checkerId); err != nil {
+		return err
+	}
 	return s.repo.Delete(checkerId, groupId) 
 }
 
@@ -33,5 +46,8 @@ func (s *GroupService) Update(checkerId, groupId int, input classosbackend.Updat
 	if err := input.Validate(); err != nil {
 		return err
 	}
+	if err := requireAllGroups(s.repo, checkerId); err != nil {
+		return err
+	}
 	return s.repo.Update(checkerId, groupId, input)
 }
\ No newline at end of file
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+const (
+	// xlsxMaxPartSize ограничивает распакованный размер одного XML-файла книги: сжатый
+	// файл небольшого размера может распаковаться в гигабайты
+	xlsxMaxPartSize = 32 << 20
+	// xlsxMaxColumns ограничивает номер столбца, чтобы ссылка вроде "XFD1" не раздувала строку
+	xlsxMaxColumns = 64
+)
+
+var errXLSXTooLarge = fmt.Errorf("workbook part is larger than %d bytes", xlsxMaxPartSize)
+
+// tableRecord - строка таблицы вместе с её номером в исходном файле
+type tableRecord struct {
+	line   int
+	fields []string
+}
+
+// readTable читает CSV или первый лист XLSX; XLSX распознаётся по сигнатуре zip-архива
+func readTable(data []byte) ([]tableRecord, error) {
+	var records []tableRecord
+	var err error
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		records, err = readXLSX(data)
+	} else {
+		records, err = readCSV(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", classosbackend.ErrInvalidImport, err.Error())
+	}
+
+	return records, nil
+}
+
+// readCSV принимает разделители ",", ";" и табуляцию: Excel в русской локали сохраняет CSV через ";"
+func readCSV(data []byte) ([]tableRecord, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = ','
+	for _, delimiter := range []rune{';', '\t'} {
+		if bytes.Count(firstLine, []byte(string(delimiter))) > bytes.Count(firstLine, []byte(string(reader.Comma))) {
+			reader.Comma = delimiter
+		}
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records := make([]tableRecord, 0)
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		records = append(records, tableRecord{line: line, fields: fields})
+	}
+
+	return records, nil
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		ID string `xml:"id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText - строка с форматированием: текст может быть разбит на несколько фрагментов
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX читает значения первого листа книги. Формулы не вычисляются: берётся сохранённый результат
+func readXLSX(data []byte) ([]tableRecord, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var shared xlsxSharedStrings
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXML(file, &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	sheetFile, ok := files[firstSheetPath(files)]
+	if !ok {
+		return nil, errors.New("workbook has no worksheets")
+	}
+
+	var sheet xlsxSheet
+	if err := decodeZipXML(sheetFile, &sheet); err != nil {
+		return nil, err
+	}
+
+	// Строка заголовка не считается
+	if len(sheet.Rows) > classosbackend.MaxImportRows+1 {
+		return nil, fmt.Errorf("at most %d rows per import", classosbackend.MaxImportRows)
+	}
+
+	records := make([]tableRecord, 0, len(sheet.Rows))
+	for i, row := range sheet.Rows {
+		line := row.R
+		if line == 0 {
+			line = i + 1
+		}
+
+		fields := make([]string, 0)
+		for j, cell := range row.Cells {
+			column := xlsxColumn(cell.Ref)
+			if column < 0 {
+				column = j
+			}
+			if column >= xlsxMaxColumns {
+				return nil, fmt.Errorf("cell %s is beyond column %d", cell.Ref, xlsxMaxColumns)
+			}
+			for len(fields) <= column {
+				fields = append(fields, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(shared.Items) {
+					return nil, fmt.Errorf("cell %s refers to a missing shared string", cell.Ref)
+				}
+				fields[column] = shared.Items[index].String()
+			case "inlineStr":
+				fields[column] = cell.Inline.String()
+			default:
+				fields[column] = cell.Value
+			}
+		}
+
+		records = append(records, tableRecord{line: line, fields: fields})
+	}
+
+	return records, nil
+}
+
+// firstSheetPath находит файл первого листа по workbook.xml и его связям
+func firstSheetPath(files map[string]*zip.File) string {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	var workbook xlsxWorkbook
+	var rels xlsxRelationships
+	workbookFile, ok := files["xl/workbook.xml"]
+	relsFile, relsOk := files["xl/_rels/workbook.xml.rels"]
+	if !ok || !relsOk || decodeZipXML(workbookFile, &workbook) != nil || decodeZipXML(relsFile, &rels) != nil ||
+		len(workbook.Sheets) == 0 {
+		return fallback
+	}
+
+	for _, rel := range rels.Items {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/")
+		}
+		return path.Join("xl", rel.Target)
+	}
+
+	return fallback
+}
+
+// decodeZipXML разбирает XML-файл архива, не распаковывая больше xlsxMaxPartSize байт.
+// Размер из заголовка zip проверяется заранее, но ему нельзя доверять, поэтому чтение тоже ограничено
+func decodeZipXML(file *zip.File, v interface{}) error {
+	if file.UncompressedSize64 > xlsxMaxPartSize {
+		return errXLSXTooLarge
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := xml.NewDecoder(&limitedReader{r: reader, n: xlsxMaxPartSize}).Decode(v); err != nil {
+		if errors.Is(err, errXLSXTooLarge) {
+			return errXLSXTooLarge
+		}
+		return err
+	}
+
+	return nil
+}
+
+// limitedReader, в отличие от io.LimitReader, сообщает о превышении лимита ошибкой, а не концом файла
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, errXLSXTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// xlsxColumn переводит ссылку на ячейку (например, "AB12") в номер столбца с нуля; -1 - ссылки нет
+func xlsxColumn(ref string) int {
+	column := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A') + 1
+	}
+
+	return column - 1
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// testXLSX собирает книгу из одного листа; parts дополняют или заменяют файлы архива
+func testXLSX(t *testing.T, sheet string, parts map[string]string) []byte {
+	t.Helper()
+
+	files := map[string]string{
+		"xl/workbook.xml": `<workbook><sheets><sheet name="Users" sheetId="1" r:id="rId1"` +
+			` xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/users.xml"/></Relationships>`,
+		"xl/worksheets/users.xml":    `<worksheet><sheetData>` + sheet + `</sheetData></worksheet>`,
+	}
+	for name, content := range parts {
+		files[name] = content
+	}
+
+	var b bytes.Buffer
+	archive := zip.NewWriter(&b)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	return b.Bytes()
+}
+
+func TestReadCSVDelimiters(t *testing.T) {
+	for name, data := range map[string]string{
+		"comma":     "name,group\nIvanov Ivan,7A\n",
+		"semicolon": "\xef\xbb\xbfФИО;Класс\nIvanov Ivan;7A\n",
+		"tab":       "Full Name\tGroup\nIvanov Ivan\t7A\n",
+	} {
+		records, err := readTable([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		rows, err := parseImportRows(records)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(rows) != 1 || rows[0].Name != "Ivanov Ivan" || rows[0].Group != "7A" || rows[0].Row != 2 {
+			t.Fatalf("%s: got %+v", name, rows[0].ImportRow)
+		}
+	}
+}
+
+func TestParseImportRowsLimits(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("name,group\n")
+	for i := 0; i <= classosbackend.MaxImportRows; i++ {
+		fmt.Fprintf(&b, "Student %d,7A\n", i)
+	}
+
+	records, err := readTable([]byte(b.String()))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if _, err := parseImportRows(records); !errors.Is(err, classosbackend.ErrInvalidImport) {
+		t.Fatalf("%d rows: got %v, want ErrInvalidImport", classosbackend.MaxImportRows+1, err)
+	}
+
+	records, _ = readTable([]byte("name,login\nIvanov Ivan,iivanov\n"))
+	if _, err := parseImportRows(records); !errors.Is(err, classosbackend.ErrInvalidImport) {
+		t.Fatalf("missing group column: got %v, want ErrInvalidImport", err)
+	}
+
+	records, _ = readTable([]byte("name,group\n,\n"))
+	if _, err := parseImportRows(records); !errors.Is(err, classosbackend.ErrInvalidImport) {
+		t.Fatalf("no data rows: got %v, want ErrInvalidImport", err)
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	data := testXLSX(t, `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="inlineStr"><is><t>Group</t></is></c></row>`+
+		`<row r="3"><c r="A3" t="s"><v>1</v></c><c r="C3"><v>7</v></c></row>`,
+		map[string]string{
+			"xl/sharedStrings.xml": `<sst><si><t>Name</t></si><si><r><t>Ivanov </t></r><r><t>Ivan</t></r></si></sst>`,
+		})
+
+	records, err := readTable(data)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	rows, err := parseImportRows(records)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Name != "Ivanov Ivan" || rows[0].Group != "7" || rows[0].Row != 3 {
+		t.Fatalf("got %+v", rows[0].ImportRow)
+	}
+}
+
+func TestReadXLSXLimits(t *testing.T) {
+	var rows strings.Builder
+	for i := 1; i <= classosbackend.MaxImportRows+2; i++ {
+		fmt.Fprintf(&rows, `<row r="%d"><c r="A%d" t="inlineStr"><is><t>x</t></is></c></row>`, i, i)
+	}
+
+	tests := map[string]struct {
+		data []byte
+		want string
+	}{
+		"too many rows":         {testXLSX(t, rows.String(), nil), "rows per import"},
+		"column beyond limit":   {testXLSX(t, `<row r="1"><c r="XFD1"><v>1</v></c></row>`, nil), "beyond column"},
+		"missing shared string": {testXLSX(t, `<row r="1"><c r="A1" t="s"><v>5</v></c></row>`, nil), "missing shared string"},
+		"oversized part": {testXLSX(t, "", map[string]string{
+			"xl/sharedStrings.xml": "<sst>" + strings.Repeat(" ", xlsxMaxPartSize) + "</sst>",
+		}), "larger than"},
+	}
+
+	for name, tt := range tests {
+		_, err := readTable(tt.data)
+		if !errors.Is(err, classosbackend.ErrInvalidImport) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want ErrInvalidImport with %q", name, err, tt.want)
+		}
+	}
+}
@@ -7,54 +7,67 @@ import (
 	"github.com/rinat0880/classOS_backend/pkg/repository"
 )
 
+// IntegratedGroupService меняет группы в БД и ставит соответствующие операции каталога
+// в очередь DirectoryOutbox в той же транзакции
 type IntegratedGroupService struct {
-	repo      repository.Group
-	adService *ADService
+	repo    repository.Group
+	outbox  *DirectoryOutbox
+	archive *ArchiveService
 }
 
-func NewIntegratedGroupService(repo repository.Group, adService *ADService) *IntegratedGroupService {
+func NewIntegratedGroupService(repo repository.Group, outbox *DirectoryOutbox, archive *ArchiveService) *IntegratedGroupService {
 	return &IntegratedGroupService{
-		repo:      repo,
-		adService: adService,
+		repo:    repo,
+		outbox:  outbox,
+		archive: archive,
 	}
 }
 
 func (s *IntegratedGroupService) Create(checkerId int, group classosbackend.Group) (int, error) {
+	if err := requireAllGroups(s.repo, checkerId); err != nil {
+		return 0, err
+	}
+
 	tx, err := s.repo.BeginTransaction()
 	if err != nil {
 		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	adGroup := ADGroup{
-		Name:        group.Name,
-		Description: "Created by ClassOS",
-	}
-
-	err = s.adService.CreateGroup(adGroup)
+	groupId, err := s.repo.CreateWithTx(tx, checkerId, group)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create group in AD: %w", err)
+		return 0, fmt.Errorf("failed to create group in DB: %w", err)
 	}
 
-	groupId, err := s.repo.CreateWithTx(tx, checkerId, group)
+	err = s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpCreateGroup, classosbackend.DirectoryOperationPayload{
+		Group: group.Name,
+	}, "")
 	if err != nil {
-		s.adService.DeleteGroup(group.Name)
-		return 0, fmt.Errorf("failed to create group in DB: %w", err)
+		return 0, err
 	}
 
 	if err := tx.Commit(); err != nil {
-		s.adService.DeleteGroup(group.Name)
 		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	s.outbox.Notify()
 
 	return groupId, nil
 }
 
 func (s *IntegratedGroupService) GetAll(checkerId int) ([]classosbackend.Group, error) {
-	return s.repo.GetAll(checkerId)
+	groups, err := s.repo.GetAll(checkerId)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterGroups(s.repo, checkerId, groups)
 }
 
 func (s *IntegratedGroupService) GetById(checkerId, groupId int) (classosbackend.Group, error) {
+	if err := checkGroup(s.repo, checkerId, groupId); err != nil {
+		return classosbackend.Group{}, err
+	}
+
 	return s.repo.GetById(checkerId, groupId)
 }
 
@@ -63,9 +76,13 @@ func (s *IntegratedGroupService) Update(checkerId, groupId int, input classosbac
 		return err
 	}
 
-	currentGroup, err := s.repo.GetById(checkerId, groupId)
+	if err := requireAllGroups(s.repo, checkerId); err != nil {
+		return err
+	}
+
+	currentGroup, err := checkActiveGroup(s.repo, checkerId, groupId)
 	if err != nil {
-		return fmt.Errorf("group not found: %w", err)
+		return err
 	}
 
 	tx, err := s.repo.BeginTransaction()
@@ -74,54 +91,30 @@ func (s *IntegratedGroupService) Update(checkerId, groupId int, input classosbac
 	}
 	defer tx.Rollback()
 
-	if input.Name != nil {
-		adUpdates := ADGroup{
-			Name: *input.Name,
-		}
-
-		err = s.adService.UpdateGroup(currentGroup.Name, adUpdates)
-		if err != nil {
-			return fmt.Errorf("failed to update group in AD: %w", err)
-		}
-	}
-
 	err = s.repo.UpdateWithTx(tx, checkerId, groupId, input)
 	if err != nil {
 		return fmt.Errorf("failed to update group in DB: %w", err)
 	}
 
+	if input.Name != nil {
+		err = s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpUpdateGroup, classosbackend.DirectoryOperationPayload{
+			Group:   currentGroup.Name,
+			NewName: *input.Name,
+		}, "")
+		if err != nil {
+			return err
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	s.outbox.Notify()
 
 	return nil
 }
 
+// Delete переносит группу вместе с её учениками в архив
 func (s *IntegratedGroupService) Delete(checkerId, groupId int) error {
-	group, err := s.repo.GetById(checkerId, groupId)
-	if err != nil {
-		return fmt.Errorf("group not found: %w", err)
-	}
-
-	tx, err := s.repo.BeginTransaction()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	err = s.adService.DeleteGroup(group.Name)
-	if err != nil {
-		return fmt.Errorf("failed to delete group from AD: %w", err)
-	}
-
-	err = s.repo.DeleteWithTx(tx, checkerId, groupId)
-	if err != nil {
-		return fmt.Errorf("failed to delete group from DB: %w", err)
-	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	return nil
+	return s.archive.ArchiveGroup(checkerId, groupId)
 }
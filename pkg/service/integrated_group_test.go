@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+func adGroupNames(t *testing.T, directory *MemoryDirectory) map[string]bool {
+	t.Helper()
+
+	groups, err := directory.ListGroups()
+	if err != nil {
+		t.Fatalf("list AD groups: %v", err)
+	}
+
+	names := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		names[group.Name] = true
+	}
+
+	return names
+}
+
+func TestGroupCreateAndRename(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	userId := f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	if names := adGroupNames(t, f.directory); !names["7A"] {
+		t.Fatalf("got AD groups %v, want 7A", names)
+	}
+
+	name := "8A"
+	if err := f.groups.Update(f.admin, groupId, classosbackend.UpdateGroupInput{Name: &name}); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	f.flush(t)
+
+	if names := adGroupNames(t, f.directory); names["7A"] || !names["8A"] {
+		t.Fatalf("got AD groups %v, want only 8A", names)
+	}
+	if user, _ := f.adUser(t, "ivanov"); len(user.Groups) != 1 || user.Groups[0] != "8A" {
+		t.Fatalf("got member of %v, want [8A]", user.Groups)
+	}
+	if group, _ := f.groups.GetById(f.admin, groupId); group.Name != "8A" {
+		t.Fatalf("DB group is %s, want 8A", group.Name)
+	}
+	if f.store.users[userId].ArchivedAt != nil {
+		t.Fatal("rename archived the member")
+	}
+}
+
+func TestGroupArchiveAndRestore(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	f.createGroup(t, "7B")
+	userId := f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	if err := f.groups.Delete(f.admin, groupId); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	f.flush(t)
+
+	if names := adGroupNames(t, f.directory); names["7A"] || !names["7B"] {
+		t.Fatalf("got AD groups %v, want only 7B", names)
+	}
+	if _, ok := f.adUser(t, "ivanov"); ok {
+		t.Fatal("member of the archived group is still in the users OU")
+	}
+	if f.store.groups[groupId].ArchivedAt == nil || f.store.users[userId].ArchivedAt == nil {
+		t.Fatal("group and its member are not archived in DB")
+	}
+
+	if err := f.archive.RestoreGroup(f.admin, groupId); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	f.flush(t)
+
+	if names := adGroupNames(t, f.directory); !names["7A"] {
+		t.Fatalf("got AD groups %v, want 7A", names)
+	}
+	if user, ok := f.adUser(t, "ivanov"); !ok || len(user.Groups) != 1 || user.Groups[0] != "7A" {
+		t.Fatalf("got %+v, want restored member of 7A", user)
+	}
+}
+
+func TestGroupCreateRequiresAllGroups(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	teacher := f.store.addUser(t, "teacher", classosbackend.RoleTeacher, 0)
+	f.store.teacherGroups[teacher] = []int{groupId}
+
+	if _, err := f.groups.Create(teacher, classosbackend.Group{Name: "7B"}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v, want ErrForbidden", err)
+	}
+	if len(f.journal.ops) != 1 {
+		t.Fatalf("got %d queued operations, want only the first group", len(f.journal.ops))
+	}
+}
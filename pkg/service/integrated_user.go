@@ -3,77 +3,106 @@ package service
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/rinat0880/classOS_backend/pkg/repository"
-	"github.com/sirupsen/logrus"
 )
 
+// IntegratedUserService меняет пользователей в БД и ставит соответствующие операции каталога
+// в очередь DirectoryOutbox в той же транзакции
 type IntegratedUserService struct {
 	repo        repository.User
 	groupRepo   repository.Group
 	authService *AuthService
-	adService   *ADService
+	directory   Directory
+	outbox      *DirectoryOutbox
+	generator   *CredentialGenerator
+	archive     *ArchiveService
 }
 
-var groupname string
-
-func NewIntegratedUserService(repo repository.User, groupRepo repository.Group, authService *AuthService, adService *ADService) *IntegratedUserService {
+func NewIntegratedUserService(repo repository.User, groupRepo repository.Group, authService *AuthService, directory Directory,
+	outbox *DirectoryOutbox, generator *CredentialGenerator, archive *ArchiveService) *IntegratedUserService {
 	return &IntegratedUserService{
 		repo:        repo,
 		groupRepo:   groupRepo,
 		authService: authService,
-		adService:   adService,
+		directory:   directory,
+		outbox:      outbox,
+		generator:   generator,
+		archive:     archive,
 	}
 }
 
-func (s *IntegratedUserService) Create(checkerId, groupId int, user classosbackend.User) (int, error) {
-	_, err := s.groupRepo.GetById(checkerId, groupId)
+func (s *IntegratedUserService) Create(checkerId, groupId int, user classosbackend.User) (classosbackend.CreatedUser, error) {
+	group, err := checkNewUser(s.groupRepo, checkerId, groupId, &user)
 	if err != nil {
-		return 0, err
+		return classosbackend.CreatedUser{}, err
 	}
+	user.GroupName = &group.Name
 
-	tx, err := s.repo.BeginTransaction()
+	generatedPassword, err := s.generator.Fill(&user)
 	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		return classosbackend.CreatedUser{}, err
 	}
-	defer tx.Rollback()
 
-	adUser := s.convertUserToADUser(user)
+	userId, err := s.create(groupId, user)
+	if err != nil {
+		return classosbackend.CreatedUser{}, err
+	}
 
-	if user.GroupName != nil {
-		groupname = *user.GroupName
-		logrus.WithField("groupname", groupname).Info("obtained successfullay groupname")
-	} else{
+	return classosbackend.CreatedUser{ID: userId, Username: user.Username, Password: generatedPassword}, nil
+}
+
+func (s *IntegratedUserService) create(groupId int, user classosbackend.User) (int, error) {
+	if user.GroupName == nil {
 		return 0, fmt.Errorf("failed to obtain groupname for AD")
 	}
 
-	err = s.adService.CreateUser(adUser, user.Password, groupname)
+	tx, err := s.repo.BeginTransaction()
 	if err != nil {
-		return 0, fmt.Errorf("failed to create user in AD: %w", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
+
+	adUser := s.convertUserToADUser(user)
+	password := user.Password
 
 	user.Password = s.authService.GeneratePasswordHash(user.Password)
 	userId, err := s.repo.CreateWithTx(tx, groupId, user)
 	if err != nil {
-		s.adService.DeleteUser(user.Username)
 		return 0, fmt.Errorf("failed to create user in DB: %w", err)
 	}
 
+	err = s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpCreateUser, classosbackend.DirectoryOperationPayload{
+		Username:    adUser.SamAccountName,
+		DisplayName: adUser.DisplayName,
+		Group:       *user.GroupName,
+		Enabled:     &adUser.Enabled,
+	}, password)
+	if err != nil {
+		return 0, err
+	}
+
 	if err := tx.Commit(); err != nil {
-		s.adService.DeleteUser(user.Username)
 		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	s.outbox.Notify()
 
 	return userId, nil
 }
 
 func (s *IntegratedUserService) GetAll(checkerId int) ([]classosbackend.User, error) {
-	return s.repo.GetAll(checkerId)
+	users, err := s.repo.GetAll(checkerId)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterUsers(s.groupRepo, checkerId, users)
 }
 
 func (s *IntegratedUserService) GetById(checkerId, userId int) (classosbackend.User, error) {
-	return s.repo.GetById(checkerId, userId)
+	return checkUser(s.repo, s.groupRepo, checkerId, userId)
 }
 
 func (s *IntegratedUserService) Update(checkerId, userId int, input classosbackend.UpdateUserInput) error {
@@ -81,9 +110,32 @@ func (s *IntegratedUserService) Update(checkerId, userId int, input classosbacke
 		return err
 	}
 
-	currentUser, err := s.repo.GetById(checkerId, userId)
+	currentUser, err := checkActiveUser(s.repo, s.groupRepo, checkerId, userId)
 	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		return err
+	}
+
+	if err := checkUserChanges(s.groupRepo, checkerId, currentUser, input); err != nil {
+		return err
+	}
+
+	// Операции после переименования обращаются к учётной записи AD по новому логину
+	username := currentUser.Username
+	if input.Username != nil && *input.Username != currentUser.Username {
+		if err := s.checkUsernameFree(currentUser.Username, *input.Username); err != nil {
+			return err
+		}
+		username = *input.Username
+	}
+
+	// Перевод в другую группу переносит и членство в группе AD
+	var moveTo string
+	if input.GroupID != nil && (currentUser.GroupID == nil || *input.GroupID != *currentUser.GroupID) {
+		group, err := checkActiveGroup(s.groupRepo, checkerId, *input.GroupID)
+		if err != nil {
+			return err
+		}
+		moveTo = group.Name
 	}
 
 	tx, err := s.repo.BeginTransaction()
@@ -93,37 +145,42 @@ func (s *IntegratedUserService) Update(checkerId, userId int, input classosbacke
 	defer tx.Rollback()
 
 	if input.Name != nil || input.Username != nil {
-		adUpdates := ADUser{}
+		// Группа в AD меняется только переводом по group_id ниже
+		payload := classosbackend.DirectoryOperationPayload{Username: currentUser.Username}
 		if input.Name != nil {
-			adUpdates.DisplayName = *input.Name
+			payload.DisplayName = *input.Name
 		}
 		if input.Username != nil {
-			adUpdates.SamAccountName = *input.Username
-		}
-
-		if input.GroupName != nil {
-			groupname = *input.GroupName
-			logrus.WithField("groupname", groupname).Info("obtained successfullay groupname")
-		} else{
-			return fmt.Errorf("failed to obtain groupname for AD")
+			payload.NewName = *input.Username
 		}
 
-		err = s.adService.UpdateUser(currentUser.Username, adUpdates, groupname)
-		if err != nil {
-			return fmt.Errorf("failed to update user in AD: %w", err)
+		if err := s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpUpdateUser, payload, ""); err != nil {
+			return err
 		}
 	}
 
 	if input.Password != nil {
-		err = s.adService.ChangeUserPassword(currentUser.Username, *input.Password)
+		err = s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpChangePassword, classosbackend.DirectoryOperationPayload{
+			Username: username,
+		}, *input.Password)
 		if err != nil {
-			return fmt.Errorf("failed to change password in AD: %w", err)
+			return err
 		}
 
 		hashedPassword := s.authService.GeneratePasswordHash(*input.Password)
 		input.Password = &hashedPassword
 	}
 
+	if moveTo != "" {
+		err = s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpMoveUserToGroup, classosbackend.DirectoryOperationPayload{
+			Username: username,
+			Group:    moveTo,
+		}, "")
+		if err != nil {
+			return err
+		}
+	}
+
 	err = s.repo.UpdateWithTx(tx, checkerId, userId, input)
 	if err != nil {
 		return fmt.Errorf("failed to update user in DB: %w", err)
@@ -132,18 +189,19 @@ func (s *IntegratedUserService) Update(checkerId, userId int, input classosbacke
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	s.outbox.Notify()
+	// Смена пароля или роли отзывает токены пользователя
+	s.authService.InvalidateTokens(userId)
 
 	return nil
 }
 
-func (s *IntegratedUserService) Delete(checkerId, userId int) error {
-	user, err := s.repo.GetById(checkerId, userId)
+// SetEnabled в БД действует сразу, а в AD - когда очередь применит операцию: до этого
+// отключённый пользователь ещё может входить в компьютеры домена
+func (s *IntegratedUserService) SetEnabled(checkerId, userId int, enabled bool) error {
+	user, err := checkEnabledChange(s.repo, s.groupRepo, checkerId, userId, enabled)
 	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
-	}
-
-	if user.Username == "admin01" {
-		return fmt.Errorf("cannot delete super admin")
+		return err
 	}
 
 	tx, err := s.repo.BeginTransaction()
@@ -152,29 +210,56 @@ func (s *IntegratedUserService) Delete(checkerId, userId int) error {
 	}
 	defer tx.Rollback()
 
-	err = s.adService.DeleteUser(user.Username)
-	if err != nil {
-		return fmt.Errorf("failed to delete user from AD: %w", err)
+	if err := s.repo.UpdateWithTx(tx, checkerId, userId, classosbackend.UpdateUserInput{Enabled: &enabled}); err != nil {
+		return fmt.Errorf("failed to change user state in DB: %w", err)
 	}
 
-	err = s.repo.DeleteWithTx(tx, checkerId, userId)
+	err = s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpSetUserEnabled, classosbackend.DirectoryOperationPayload{
+		Username: user.Username,
+		Enabled:  &enabled,
+	}, "")
 	if err != nil {
-		return fmt.Errorf("failed to delete user from DB: %w", err)
+		return err
 	}
 
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	s.outbox.Notify()
+	s.authService.InvalidateTokens(userId)
 
 	return nil
 }
 
-func (s *IntegratedUserService) SyncAllFromAD() error {
-	return s.adService.SyncAllUsersFromAD()
+// checkUsernameFree проверяет, что новый логин не занят в БД и в AD. Смена только регистра
+// не проверяется: AD сравнивает логины без учёта регистра
+func (s *IntegratedUserService) checkUsernameFree(current, username string) error {
+	if strings.EqualFold(current, username) {
+		return nil
+	}
+
+	taken, err := s.repo.ExistingUsernames([]string{username})
+	if err != nil {
+		return fmt.Errorf("failed to check username: %w", err)
+	}
+	if taken[strings.ToLower(username)] {
+		return fmt.Errorf("%w: %s", ErrUsernameTaken, username)
+	}
+
+	taken, err = s.directory.ExistingUsers([]string{username})
+	if err != nil {
+		return err
+	}
+	if taken[strings.ToLower(username)] {
+		return fmt.Errorf("%w: %s in AD", ErrUsernameTaken, username)
+	}
+
+	return nil
 }
 
-func (s *IntegratedUserService) ValidateADConnection() error {
-	return s.adService.TestConnection()
+// Delete переносит пользователя в архив; окончательно его удаляет очистка архива
+func (s *IntegratedUserService) Delete(checkerId, userId int) error {
+	return s.archive.ArchiveUser(checkerId, userId)
 }
 
 func (s *IntegratedUserService) convertUserToADUser(user classosbackend.User) ADUser {
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"testing"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+func TestUserCreate(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	user, ok := f.adUser(t, "ivanov")
+	if !ok {
+		t.Fatal("user is not created in AD")
+	}
+	if user.DisplayName != "Student ivanov" || !user.Enabled {
+		t.Fatalf("got %+v", user)
+	}
+	if len(user.Groups) != 1 || user.Groups[0] != "7A" {
+		t.Fatalf("got groups %v, want [7A]", user.Groups)
+	}
+	if _, err := f.directory.Authenticate("ivanov", "Secret123"); err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+}
+
+func TestUserCreateGeneratesCredentials(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+
+	// Группа в AD берётся из group_id, клиент её не передаёт
+	input := classosbackend.CreateUserInput{Name: "Ivanov Ivan"}
+	created, err := f.users.Create(f.admin, groupId, input.User())
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if created.Username == "" || created.Password == "" {
+		t.Fatalf("got %+v, want generated credentials", created)
+	}
+	f.flush(t)
+
+	user, ok := f.adUser(t, created.Username)
+	if !ok || len(user.Groups) != 1 || user.Groups[0] != "7A" {
+		t.Fatalf("got %+v, want member of 7A", user)
+	}
+	if _, err := f.directory.Authenticate(created.Username, created.Password); err != nil {
+		t.Fatalf("authenticate with generated password: %v", err)
+	}
+}
+
+func TestUserUpdate(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	userId := f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	name, username := "Ivan Ivanov", "iivanov"
+	err := f.users.Update(f.admin, userId, classosbackend.UpdateUserInput{Name: &name, Username: &username})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	password := "NewSecret123"
+	if err := f.users.Update(f.admin, userId, classosbackend.UpdateUserInput{Password: &password}); err != nil {
+		t.Fatalf("change password: %v", err)
+	}
+	f.flush(t)
+
+	if _, ok := f.adUser(t, "ivanov"); ok {
+		t.Fatal("old username is still in AD")
+	}
+	user, ok := f.adUser(t, "iivanov")
+	if !ok || user.DisplayName != name {
+		t.Fatalf("got %+v, want renamed user", user)
+	}
+	if _, err := f.directory.Authenticate("iivanov", password); err != nil {
+		t.Fatalf("authenticate with new password: %v", err)
+	}
+	if dbUser := f.store.users[userId]; dbUser.Username != username || dbUser.Name != name {
+		t.Fatalf("DB user is %+v", dbUser)
+	}
+}
+
+func TestUserRenameKeepsGroup(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	f.createGroup(t, "7B")
+	userId := f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	name := "Ivan Ivanov"
+	if err := f.users.Update(f.admin, userId, classosbackend.UpdateUserInput{Name: &name}); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	f.flush(t)
+
+	user, _ := f.adUser(t, "ivanov")
+	if user.DisplayName != name {
+		t.Fatalf("display name is %q, want %q", user.DisplayName, name)
+	}
+	if len(user.Groups) != 1 || user.Groups[0] != "7A" {
+		t.Fatalf("got AD groups %v, want [7A]", user.Groups)
+	}
+}
+
+func TestUserSetEnabled(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	userId := f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	if err := f.users.SetEnabled(f.admin, userId, false); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	f.flush(t)
+
+	if user, _ := f.adUser(t, "ivanov"); user.Enabled {
+		t.Fatal("user is still enabled in AD")
+	}
+	if f.store.users[userId].Enabled {
+		t.Fatal("user is still enabled in DB")
+	}
+}
+
+func TestUserMoveToGroup(t *testing.T) {
+	f := newDirectoryFixture(t)
+	from := f.createGroup(t, "7A")
+	to := f.createGroup(t, "7B")
+	userId := f.createUser(t, from, "ivanov")
+	f.flush(t)
+
+	if err := f.users.Update(f.admin, userId, classosbackend.UpdateUserInput{GroupID: &to}); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	f.flush(t)
+
+	user, _ := f.adUser(t, "ivanov")
+	if len(user.Groups) != 1 || user.Groups[0] != "7B" {
+		t.Fatalf("got AD groups %v, want [7B]", user.Groups)
+	}
+	if groupId := f.store.users[userId].GroupID; groupId == nil || *groupId != to {
+		t.Fatalf("DB group is %v, want %d", groupId, to)
+	}
+}
+
+func TestUserArchiveAndRestore(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	userId := f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	if err := f.users.Delete(f.admin, userId); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	f.flush(t)
+
+	if _, ok := f.adUser(t, "ivanov"); ok {
+		t.Fatal("archived user is still in the users OU")
+	}
+	if exists, _ := f.directory.UserExists("ivanov"); !exists {
+		t.Fatal("archived user is deleted from AD")
+	}
+	if f.store.users[userId].ArchivedAt == nil {
+		t.Fatal("user is not archived in DB")
+	}
+
+	if err := f.archive.RestoreUser(f.admin, userId); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	f.flush(t)
+
+	user, ok := f.adUser(t, "ivanov")
+	if !ok || !user.Enabled {
+		t.Fatalf("got %+v, want restored enabled user", user)
+	}
+	if len(user.Groups) != 1 || user.Groups[0] != "7A" {
+		t.Fatalf("got AD groups %v, want [7A]", user.Groups)
+	}
+}
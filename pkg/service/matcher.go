@@ -0,0 +1,130 @@
+package service
+
+import (
+	"net/netip"
+	"strings"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+type matchRule struct {
+	entry classosbackend.ResolvedWhitelistEntry
+	path  string
+}
+
+type prefixRule struct {
+	entry  classosbackend.ResolvedWhitelistEntry
+	prefix netip.Prefix
+}
+
+// policyMatcher - скомпилированный набор записей для быстрой проверки URL.
+// exact и wildcard индексируются по хосту, поэтому проверка не зависит от размера списка
+type policyMatcher struct {
+	exact    map[string][]matchRule
+	wildcard map[string][]matchRule
+	prefixes []prefixRule
+}
+
+func compileMatcher(entries []classosbackend.ResolvedWhitelistEntry) *policyMatcher {
+	m := &policyMatcher{
+		exact:    make(map[string][]matchRule),
+		wildcard: make(map[string][]matchRule),
+	}
+
+	for _, entry := range entries {
+		if prefix, err := netip.ParsePrefix(entry.Value); err == nil {
+			m.prefixes = append(m.prefixes, prefixRule{entry: entry, prefix: prefix})
+			continue
+		}
+
+		host, path := splitEntryValue(entry.Value)
+		if domain, ok := strings.CutPrefix(host, "*."); ok {
+			m.wildcard[domain] = append(m.wildcard[domain], matchRule{entry: entry, path: path})
+			continue
+		}
+
+		m.exact[host] = append(m.exact[host], matchRule{entry: entry, path: path})
+	}
+
+	return m
+}
+
+// match возвращает наиболее специфичную запись: точный хост важнее wildcard,
+// более длинный путь важнее короткого, ближайший родительский домен важнее дальнего
+func (m *policyMatcher) match(host, path string) *classosbackend.ResolvedWhitelistEntry {
+	if best := bestPathMatch(m.exact[host], path); best != nil {
+		return best
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addr = addr.Unmap()
+		var best *prefixRule
+		for i := range m.prefixes {
+			rule := &m.prefixes[i]
+			if rule.prefix.Contains(addr) && (best == nil || rule.prefix.Bits() > best.prefix.Bits()) {
+				best = rule
+			}
+		}
+		if best != nil {
+			entry := best.entry
+			return &entry
+		}
+
+		return nil
+	}
+
+	// *.example.com совпадает с любым поддоменом, но не с самим example.com
+	for domain := host; ; {
+		idx := strings.IndexByte(domain, '.')
+		if idx < 0 {
+			break
+		}
+		domain = domain[idx+1:]
+
+		if best := bestPathMatch(m.wildcard[domain], path); best != nil {
+			return best
+		}
+	}
+
+	return nil
+}
+
+func bestPathMatch(rules []matchRule, path string) *classosbackend.ResolvedWhitelistEntry {
+	var best *matchRule
+	for i := range rules {
+		rule := &rules[i]
+		if !pathHasPrefix(path, rule.path) {
+			continue
+		}
+		if best == nil || len(rule.path) > len(best.path) {
+			best = rule
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	entry := best.entry
+	return &entry
+}
+
+// pathHasPrefix сравнивает пути по границе сегментов: /docs совпадает с /docs/a, но не с /docsx
+func pathHasPrefix(path, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	return len(path) == len(prefix) || path[len(prefix)] == '/'
+}
+
+func splitEntryValue(value string) (string, string) {
+	if idx := strings.IndexByte(value, '/'); idx >= 0 {
+		return value[:idx], value[idx:]
+	}
+
+	return value, ""
+}
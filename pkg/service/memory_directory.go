@@ -0,0 +1,650 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-ldap/ldap/v3"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMemoryBaseDN - базовый DN каталога в памяти, если AD_BASE_DN не задан
+const defaultMemoryBaseDN = "DC=classos,DC=local"
+
+type memoryUser struct {
+	dn          string
+	username    string
+	displayName string
+	upn         string
+	password    string
+	enabled     bool
+	mustChange  bool
+}
+
+type memoryGroup struct {
+	dn          string
+	name        string
+	description string
+	// members - логины участников в нижнем регистре; DN участника вычисляется при чтении,
+	// поэтому перенос пользователя, как и в AD, не ломает членство
+	members map[string]bool
+}
+
+// MemoryDirectory - потокобезопасный каталог в памяти с моделью AD: объекты адресуются DN,
+// пользователи и группы создаются в OU из настроек, архив переносит их в OU архива.
+// OU создаются при первом обращении. Позволяет запускать сервисы без контроллера домена
+type MemoryDirectory struct {
+	mu       sync.RWMutex
+	baseDN   string
+	settings SettingsReader
+	// ключи - логины и имена групп в нижнем регистре: AD сравнивает их без учёта регистра
+	users  map[string]*memoryUser
+	groups map[string]*memoryGroup
+	ous    map[string]bool
+}
+
+func NewMemoryDirectory(settings SettingsReader, baseDN string) *MemoryDirectory {
+	if baseDN == "" {
+		baseDN = defaultMemoryBaseDN
+	}
+
+	return &MemoryDirectory{
+		baseDN:   baseDN,
+		settings: settings,
+		users:    make(map[string]*memoryUser),
+		groups:   make(map[string]*memoryGroup),
+		ous:      make(map[string]bool),
+	}
+}
+
+func (d *MemoryDirectory) TestConnection() error {
+	return nil
+}
+
+func (d *MemoryDirectory) Authenticate(username, password string) (ADUser, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if password == "" {
+		return ADUser{}, ErrInvalidCredentials
+	}
+
+	user, ok := d.users[strings.ToLower(username)]
+	if !ok {
+		return ADUser{}, ErrADUserNotFound
+	}
+
+	if user.password != password {
+		return ADUser{}, ErrInvalidCredentials
+	}
+
+	if !user.enabled {
+		return ADUser{}, ErrUserDisabled
+	}
+
+	adUser := d.toADUser(user)
+	adUser.MustChangePassword = user.mustChange
+	return adUser, nil
+}
+
+func (d *MemoryDirectory) CreateUser(user ADUser, password string, groupname string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := strings.ToLower(user.SamAccountName)
+	if _, ok := d.users[key]; ok {
+		return fmt.Errorf("failed to create user in AD: %s already exists", user.SamAccountName)
+	}
+
+	userDN := d.childDN(user.DisplayName, d.settings.String(classosbackend.SettingADDefaultOU))
+	if d.dnTaken(userDN) {
+		return fmt.Errorf("failed to create user in AD: %s already exists", userDN)
+	}
+
+	group, err := d.findGroup(groupname)
+	if err != nil {
+		return fmt.Errorf("failed user to add to a group: %w", err)
+	}
+
+	d.users[key] = &memoryUser{
+		dn:          userDN,
+		username:    user.SamAccountName,
+		displayName: user.DisplayName,
+		upn:         fmt.Sprintf("%s@%s", user.SamAccountName, d.settings.String(classosbackend.SettingADUPNSuffix)),
+		password:    password,
+		enabled:     user.Enabled,
+	}
+	group.members[key] = true
+
+	logrus.WithField("userDN", userDN).Debug("memory directory: user created")
+	return nil
+}
+
+func (d *MemoryDirectory) UpdateUser(username string, updates ADUser) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user, err := d.findUser(username)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	if updates.DisplayName != "" {
+		user.displayName = updates.DisplayName
+	}
+
+	if updates.SamAccountName != "" && updates.SamAccountName != user.username {
+		if err := d.renameUser(user, updates.SamAccountName); err != nil {
+			return err
+		}
+	}
+
+	if updates.Password != "" {
+		user.password = updates.Password
+	}
+
+	return nil
+}
+
+// renameUser меняет логин и UPN; членство в группах хранится по логину и переносится вместе с ним
+func (d *MemoryDirectory) renameUser(user *memoryUser, username string) error {
+	oldKey, newKey := strings.ToLower(user.username), strings.ToLower(username)
+	if newKey != oldKey {
+		if _, ok := d.users[newKey]; ok {
+			return fmt.Errorf("failed to modify user attributes: %s already exists", username)
+		}
+
+		delete(d.users, oldKey)
+		d.users[newKey] = user
+		for _, group := range d.groups {
+			if group.members[oldKey] {
+				delete(group.members, oldKey)
+				group.members[newKey] = true
+			}
+		}
+	}
+
+	user.username = username
+	user.upn = fmt.Sprintf("%s@%s", username, d.settings.String(classosbackend.SettingADUPNSuffix))
+	return nil
+}
+
+func (d *MemoryDirectory) DeleteUser(username string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user, err := d.findUser(username)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	key := strings.ToLower(user.username)
+	for _, group := range d.groups {
+		delete(group.members, key)
+	}
+	delete(d.users, key)
+
+	return nil
+}
+
+// ChangeUserPassword, как и смена unicodePwd администратором в AD, снимает требование сменить пароль
+func (d *MemoryDirectory) ChangeUserPassword(username, newPassword string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user, err := d.findUser(username)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	user.password = newPassword
+	user.mustChange = false
+	return nil
+}
+
+func (d *MemoryDirectory) ResetPassword(username, password string, mustChange bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user, err := d.findUser(username)
+	if err != nil {
+		return err
+	}
+
+	user.password = password
+	user.mustChange = mustChange
+	return nil
+}
+
+func (d *MemoryDirectory) SetUserEnabled(username string, enabled bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user, err := d.findUser(username)
+	if err != nil {
+		return err
+	}
+
+	user.enabled = enabled
+	return nil
+}
+
+func (d *MemoryDirectory) UserExists(username string) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, ok := d.users[strings.ToLower(username)]
+	return ok, nil
+}
+
+func (d *MemoryDirectory) ExistingUsers(usernames []string) (map[string]bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	found := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		if _, ok := d.users[strings.ToLower(username)]; ok {
+			found[strings.ToLower(username)] = true
+		}
+	}
+
+	return found, nil
+}
+
+// ListUsers возвращает пользователей из OU пользователей, отсортированных по логину
+func (d *MemoryDirectory) ListUsers() ([]ADUser, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	usersOU := d.settings.String(classosbackend.SettingADDefaultOU)
+	groupsOU := d.settings.String(classosbackend.SettingADGroupsOU)
+	if err := d.checkOU(usersOU); err != nil {
+		return nil, err
+	}
+
+	users := make([]ADUser, 0, len(d.users))
+	for _, user := range d.users {
+		if !d.inOU(user.dn, usersOU) {
+			continue
+		}
+
+		adUser := d.toADUser(user)
+		groups := make([]string, 0, len(adUser.Groups))
+		for _, name := range adUser.Groups {
+			if d.inOU(d.groups[strings.ToLower(name)].dn, groupsOU) {
+				groups = append(groups, name)
+			}
+		}
+		adUser.Groups = groups
+		users = append(users, adUser)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return strings.ToLower(users[i].SamAccountName) < strings.ToLower(users[j].SamAccountName)
+	})
+
+	return users, nil
+}
+
+// ListGroups возвращает группы из OU групп, отсортированные по имени
+func (d *MemoryDirectory) ListGroups() ([]ADGroup, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	groupsOU := d.settings.String(classosbackend.SettingADGroupsOU)
+	if err := d.checkOU(groupsOU); err != nil {
+		return nil, err
+	}
+
+	groups := make([]ADGroup, 0, len(d.groups))
+	for _, group := range d.groups {
+		if d.inOU(group.dn, groupsOU) {
+			groups = append(groups, ADGroup{Name: group.name, Description: group.description, DistinguishedName: group.dn})
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return strings.ToLower(groups[i].Name) < strings.ToLower(groups[j].Name)
+	})
+
+	return groups, nil
+}
+
+func (d *MemoryDirectory) CreateGroup(group ADGroup) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := strings.ToLower(group.Name)
+	if _, ok := d.groups[key]; ok {
+		return fmt.Errorf("failed to create group in AD: %s already exists", group.Name)
+	}
+
+	groupDN := d.childDN(group.Name, d.settings.String(classosbackend.SettingADGroupsOU))
+	if d.dnTaken(groupDN) {
+		return fmt.Errorf("failed to create group in AD: %s already exists", groupDN)
+	}
+
+	d.groups[key] = &memoryGroup{
+		dn:          groupDN,
+		name:        group.Name,
+		description: group.Description,
+		members:     make(map[string]bool),
+	}
+
+	return nil
+}
+
+// UpdateGroup переименовывает группу, меняя её CN в том же OU
+func (d *MemoryDirectory) UpdateGroup(groupName string, updates ADGroup) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	group, err := d.findGroup(groupName)
+	if err != nil {
+		return fmt.Errorf("group not found: %w", err)
+	}
+
+	if updates.Name == "" || strings.EqualFold(updates.Name, group.name) {
+		return nil
+	}
+
+	newKey := strings.ToLower(updates.Name)
+	if _, ok := d.groups[newKey]; ok {
+		return fmt.Errorf("failed to update group in AD: %s already exists", updates.Name)
+	}
+
+	_, parent := splitDN(group.dn)
+	newDN := "CN=" + ldap.EscapeDN(updates.Name) + "," + parent
+	if d.dnTaken(newDN) {
+		return fmt.Errorf("failed to update group in AD: %s already exists", newDN)
+	}
+
+	delete(d.groups, strings.ToLower(group.name))
+	group.name = updates.Name
+	group.dn = newDN
+	d.groups[newKey] = group
+
+	return nil
+}
+
+func (d *MemoryDirectory) DeleteGroup(groupName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	group, err := d.findGroup(groupName)
+	if err != nil {
+		return fmt.Errorf("group not found: %w", err)
+	}
+
+	delete(d.groups, strings.ToLower(group.name))
+	return nil
+}
+
+func (d *MemoryDirectory) ExistingGroups(names []string) (map[string]bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	found := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := d.groups[strings.ToLower(name)]; ok {
+			found[strings.ToLower(name)] = true
+		}
+	}
+
+	return found, nil
+}
+
+func (d *MemoryDirectory) AddUserToGroup(username, groupName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user, err := d.findUser(username)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	group, err := d.findGroup(groupName)
+	if err != nil {
+		return fmt.Errorf("group not found: %w", err)
+	}
+
+	group.members[strings.ToLower(user.username)] = true
+	return nil
+}
+
+func (d *MemoryDirectory) RemoveUserFromGroup(username, groupName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user, err := d.findUser(username)
+	if err != nil {
+		return err
+	}
+
+	group, err := d.findGroup(groupName)
+	if err != nil {
+		return err
+	}
+
+	delete(group.members, strings.ToLower(user.username))
+	return nil
+}
+
+func (d *MemoryDirectory) MoveUserToAnotherGroup(username, groupName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user, err := d.findUser(username)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	return d.moveToGroup(user, groupName)
+}
+
+func (d *MemoryDirectory) ArchiveUser(username string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user, err := d.findUser(username)
+	if err != nil {
+		return "", err
+	}
+
+	archivedDN := d.childDN(user.username, d.settings.String(classosbackend.SettingADArchiveOU))
+	if err := d.move(user.dn, archivedDN); err != nil {
+		return "", err
+	}
+
+	originalDN := user.dn
+	user.dn = archivedDN
+	user.enabled = false
+	return originalDN, nil
+}
+
+func (d *MemoryDirectory) RestoreUser(username, originalDN string, enabled bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user, err := d.findUser(username)
+	if originalDN == "" {
+		// Запись не переносилась в архив, как и в ADService её достаточно включить
+		if err == nil && enabled {
+			user.enabled = true
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := d.move(user.dn, originalDN); err != nil {
+		return err
+	}
+
+	user.dn = originalDN
+	if enabled {
+		user.enabled = true
+	}
+	return nil
+}
+
+func (d *MemoryDirectory) ArchiveGroup(groupName string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	group, err := d.findGroup(groupName)
+	if err != nil {
+		return "", err
+	}
+
+	archivedDN := d.childDN(group.name, d.settings.String(classosbackend.SettingADArchiveOU))
+	if err := d.move(group.dn, archivedDN); err != nil {
+		return "", err
+	}
+
+	originalDN := group.dn
+	group.dn = archivedDN
+	return originalDN, nil
+}
+
+func (d *MemoryDirectory) RestoreGroup(groupName, originalDN string) error {
+	if originalDN == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	group, err := d.findGroup(groupName)
+	if err != nil {
+		return err
+	}
+
+	if err := d.move(group.dn, originalDN); err != nil {
+		return err
+	}
+
+	group.dn = originalDN
+	return nil
+}
+
+// Методы ниже вызываются под уже взятой блокировкой
+
+func (d *MemoryDirectory) findUser(username string) (*memoryUser, error) {
+	user, ok := d.users[strings.ToLower(username)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrADUserNotFound, username)
+	}
+
+	return user, nil
+}
+
+func (d *MemoryDirectory) findGroup(groupName string) (*memoryGroup, error) {
+	group, ok := d.groups[strings.ToLower(groupName)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrADGroupNotFound, groupName)
+	}
+
+	return group, nil
+}
+
+// moveToGroup оставляет пользователя участником только группы groupName
+func (d *MemoryDirectory) moveToGroup(user *memoryUser, groupName string) error {
+	group, err := d.findGroup(groupName)
+	if err != nil {
+		return fmt.Errorf("group not found: %w", err)
+	}
+
+	key := strings.ToLower(user.username)
+	for _, other := range d.groups {
+		delete(other.members, key)
+	}
+	group.members[key] = true
+
+	return nil
+}
+
+// childDN строит DN объекта с именем name в OU под базовым DN и создаёт OU, если её нет
+func (d *MemoryDirectory) childDN(name, ou string) string {
+	ouDN := d.ouDN(ou)
+	d.ous[strings.ToLower(ouDN)] = true
+
+	return fmt.Sprintf("CN=%s,%s", ldap.EscapeDN(name), ouDN)
+}
+
+// checkOU, как и поиск в AD, считает отсутствующую OU ошибкой
+func (d *MemoryDirectory) checkOU(ou string) error {
+	if !d.ous[strings.ToLower(d.ouDN(ou))] {
+		return fmt.Errorf("%w: %s", ErrADOUNotFound, ou)
+	}
+
+	return nil
+}
+
+func (d *MemoryDirectory) ouDN(ou string) string {
+	return fmt.Sprintf("OU=%s,%s", ldap.EscapeDN(ou), d.baseDN)
+}
+
+// inOU проверяет, что объект лежит непосредственно в OU
+func (d *MemoryDirectory) inOU(dn, ou string) bool {
+	_, parent := splitDN(dn)
+	return strings.EqualFold(normalizeDN(parent), d.ouDN(ou))
+}
+
+// move проверяет, что объект можно перенести на newDN: OU назначения существует и DN свободен
+func (d *MemoryDirectory) move(dn, newDN string) error {
+	if strings.EqualFold(normalizeDN(dn), normalizeDN(newDN)) {
+		return nil
+	}
+
+	_, parent := splitDN(newDN)
+	if !d.ous[strings.ToLower(normalizeDN(parent))] {
+		return fmt.Errorf("failed to move %s to %s: no such object %s", dn, newDN, parent)
+	}
+
+	if d.dnTaken(newDN) {
+		return fmt.Errorf("failed to move %s to %s: entry already exists", dn, newDN)
+	}
+
+	return nil
+}
+
+func (d *MemoryDirectory) dnTaken(dn string) bool {
+	dn = normalizeDN(dn)
+	for _, user := range d.users {
+		if strings.EqualFold(normalizeDN(user.dn), dn) {
+			return true
+		}
+	}
+	for _, group := range d.groups {
+		if strings.EqualFold(normalizeDN(group.dn), dn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *MemoryDirectory) toADUser(user *memoryUser) ADUser {
+	groups := make([]string, 0)
+	key := strings.ToLower(user.username)
+	for _, group := range d.groups {
+		if group.members[key] {
+			groups = append(groups, group.name)
+		}
+	}
+	sort.Strings(groups)
+
+	return ADUser{
+		SamAccountName:    user.username,
+		DisplayName:       user.displayName,
+		UserPrincipalName: user.upn,
+		DistinguishedName: user.dn,
+		Enabled:           user.enabled,
+		Groups:            groups,
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+)
+
+// OfflineDirectory - каталог режима DB-only. Сервисы ставят изменения каталога в очередь
+// DirectoryOutbox в своей транзакции, поэтому запись напрямую в каталог отклоняется: запись
+// в очередь вне транзакции могла бы разойтись с БД. Чтение видит пустой каталог, поэтому
+// занятость логинов и имён групп проверяется только по БД
+type OfflineDirectory struct{}
+
+func NewOfflineDirectory() *OfflineDirectory {
+	return &OfflineDirectory{}
+}
+
+// errOfflineWrite возвращают методы записи: в режиме DB-only каталог меняет только очередь
+var errOfflineWrite = fmt.Errorf("%w: DB-only mode, directory changes are applied by the outbox", ErrADUnavailable)
+
+// TestConnection всегда успешна: операции в режиме DB-only не требуют соединения
+func (d *OfflineDirectory) TestConnection() error {
+	return nil
+}
+
+func (d *OfflineDirectory) Authenticate(username, password string) (ADUser, error) {
+	return ADUser{}, fmt.Errorf("%w: DB-only mode", ErrADUnavailable)
+}
+
+func (d *OfflineDirectory) CreateUser(user ADUser, password string, groupname string) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) UpdateUser(username string, updates ADUser) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) DeleteUser(username string) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) ChangeUserPassword(username, newPassword string) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) ResetPassword(username, password string, mustChange bool) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) SetUserEnabled(username string, enabled bool) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) UserExists(username string) (bool, error) {
+	return false, nil
+}
+
+func (d *OfflineDirectory) ExistingUsers(usernames []string) (map[string]bool, error) {
+	return make(map[string]bool), nil
+}
+
+func (d *OfflineDirectory) ListUsers() ([]ADUser, error) {
+	return nil, fmt.Errorf("%w: DB-only mode", ErrADUnavailable)
+}
+
+func (d *OfflineDirectory) ListGroups() ([]ADGroup, error) {
+	return nil, fmt.Errorf("%w: DB-only mode", ErrADUnavailable)
+}
+
+func (d *OfflineDirectory) CreateGroup(group ADGroup) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) UpdateGroup(groupName string, updates ADGroup) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) DeleteGroup(groupName string) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) ExistingGroups(names []string) (map[string]bool, error) {
+	return make(map[string]bool), nil
+}
+
+func (d *OfflineDirectory) AddUserToGroup(username, groupName string) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) RemoveUserFromGroup(username, groupName string) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) MoveUserToAnotherGroup(username, groupName string) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) ArchiveUser(username string) (string, error) {
+	return "", errOfflineWrite
+}
+
+func (d *OfflineDirectory) RestoreUser(username, originalDN string, enabled bool) error {
+	return errOfflineWrite
+}
+
+func (d *OfflineDirectory) ArchiveGroup(groupName string) (string, error) {
+	return "", errOfflineWrite
+}
+
+func (d *OfflineDirectory) RestoreGroup(groupName, originalDN string) error {
+	return errOfflineWrite
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Параметры argon2id для новых хешей. При их изменении старые хеши продолжают проверяться
+// по параметрам из самой строки и пересчитываются при следующем входе
+const (
+	argon2Memory  = 64 * 1024
+	argon2Time    = 3
+	argon2Threads = 2
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+var errMalformedPasswordHash = errors.New("malformed password hash")
+
+// hashPassword возвращает самоописывающий хеш в формате PHC:
+// $argon2id$v=19$m=65536,t=3,p=2$<соль base64>$<хеш base64>
+func hashPassword(password string) string {
+	salt := make([]byte, argon2SaltLen)
+	rand.Read(salt)
+
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// verifyPassword проверяет пароль по сохранённому хешу. needsRehash сообщает, что хеш
+// устаревшего формата (SHA1 с общей солью) или с другими параметрами и его стоит пересчитать
+func verifyPassword(encoded, password string) (ok bool, needsRehash bool, err error) {
+	if !strings.HasPrefix(encoded, "$") {
+		return verifyLegacyPassword(encoded, password), true, nil
+	}
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false, errMalformedPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, errMalformedPasswordHash
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, false, errMalformedPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, errMalformedPasswordHash
+	}
+
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(expected) == 0 {
+		return false, false, errMalformedPasswordHash
+	}
+
+	key := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(expected)))
+	if subtle.ConstantTimeCompare(key, expected) != 1 {
+		return false, false, nil
+	}
+
+	needsRehash = memory != argon2Memory || iterations != argon2Time || threads != argon2Threads ||
+		len(salt) != argon2SaltLen || len(expected) != argon2KeyLen
+
+	return true, needsRehash, nil
+}
+
+// verifyLegacyPassword проверяет хеш прежнего формата: hex(AUTH_salt || sha1(password))
+func verifyLegacyPassword(encoded, password string) bool {
+	hash := sha1.New()
+	hash.Write([]byte(password))
+	legacy := fmt.Sprintf("%x", hash.Sum([]byte(getSalt())))
+
+	return subtle.ConstantTimeCompare([]byte(legacy), []byte(encoded)) == 1
+}
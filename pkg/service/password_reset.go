@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// PasswordResetService задаёт новые пароли сразу нескольким пользователям
+type PasswordResetService struct {
+	userRepo  repository.User
+	groupRepo repository.Group
+	outbox    *DirectoryOutbox
+	tokens    TokenInvalidator
+}
+
+func NewPasswordResetService(userRepo repository.User, groupRepo repository.Group, outbox *DirectoryOutbox, tokens TokenInvalidator) *PasswordResetService {
+	return &PasswordResetService{userRepo: userRepo, groupRepo: groupRepo, outbox: outbox, tokens: tokens}
+}
+
+// Reset сначала проверяет доступ ко всем пользователям, затем меняет пароли по одному.
+// Ошибка для одного пользователя не останавливает остальных и попадает в отчёт
+func (s *PasswordResetService) Reset(checkerId int, input classosbackend.PasswordResetInput) (classosbackend.PasswordResetReport, error) {
+	if err := input.Validate(); err != nil {
+		return classosbackend.PasswordResetReport{}, err
+	}
+
+	users, err := s.collectUsers(checkerId, input)
+	if err != nil {
+		return classosbackend.PasswordResetReport{}, err
+	}
+
+	report := classosbackend.PasswordResetReport{
+		MustChangePassword: input.MustChangePassword,
+		Total:              len(users),
+		Results:            make([]classosbackend.PasswordResetResult, 0, len(users)),
+	}
+
+	for _, user := range users {
+		result := classosbackend.PasswordResetResult{UserID: user.ID, Name: user.Name, Username: user.Username}
+
+		password, err := resetUserPassword(s.outbox, s.userRepo, s.tokens, user, input.MustChangePassword)
+		if err != nil {
+			logrus.WithError(err).WithField("username", user.Username).Error("failed to reset password")
+			result.Status = classosbackend.PasswordResetFailed
+			result.Error = err.Error()
+			report.Failed++
+		} else {
+			result.Status = classosbackend.PasswordResetDone
+			result.Password = password
+			report.Succeeded++
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	return report, nil
+}
+
+// collectUsers для группы берёт её учеников, для списка - проверяет каждого пользователя
+func (s *PasswordResetService) collectUsers(checkerId int, input classosbackend.PasswordResetInput) ([]classosbackend.User, error) {
+	if input.GroupID != nil {
+		if err := checkGroup(s.groupRepo, checkerId, *input.GroupID); err != nil {
+			return nil, err
+		}
+
+		members, err := s.userRepo.GetByGroup(*input.GroupID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get group users: %w", err)
+		}
+
+		students := make([]classosbackend.User, 0, len(members))
+		for _, member := range members {
+			if member.Role == classosbackend.RoleClient {
+				students = append(students, member)
+			}
+		}
+		if len(students) == 0 {
+			return nil, ErrNoStudents
+		}
+
+		return students, nil
+	}
+
+	users := make([]classosbackend.User, 0, len(input.UserIDs))
+	seen := make(map[int]bool, len(input.UserIDs))
+	for _, userId := range input.UserIDs {
+		if seen[userId] {
+			continue
+		}
+		seen[userId] = true
+
+		user, err := checkActiveUser(s.userRepo, s.groupRepo, checkerId, userId)
+		if err != nil {
+			return nil, fmt.Errorf("user %d: %w", userId, err)
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// resetUserPassword генерирует пароль, сохраняет его хеш в БД и в той же транзакции ставит сброс
+// пароля в AD в очередь. Флаг смены пароля в БД повторяет pwdLastSet=0 в AD, старые токены
+// пользователя перестают действовать сразу после коммита
+func resetUserPassword(outbox *DirectoryOutbox, userRepo repository.User, tokens TokenInvalidator, user classosbackend.User, mustChange bool) (string, error) {
+	password, err := GeneratePassword(user.Username)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := userRepo.BeginTransaction()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	hash := hashPassword(password)
+	input := classosbackend.UpdateUserInput{Password: &hash, MustChangePassword: &mustChange}
+	if err := userRepo.UpdateWithTx(tx, 0, user.ID, input); err != nil {
+		return "", fmt.Errorf("failed to update password in DB: %w", err)
+	}
+
+	err = outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpResetPassword, classosbackend.DirectoryOperationPayload{
+		Username:   user.Username,
+		MustChange: &mustChange,
+	}, password)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	outbox.Notify()
+	tokens.InvalidateTokens(user.ID)
+
+	return password, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+func TestPasswordResetGroup(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	ivanov := f.createUser(t, groupId, "ivanov")
+	f.createUser(t, groupId, "petrov")
+	teacher := f.store.addUser(t, "teacher", classosbackend.RoleTeacher, groupId)
+	f.flush(t)
+	teacherHash := f.store.users[teacher].Password
+
+	passwords := NewPasswordResetService(testUserRepo{store: f.store}, testGroupRepo{store: f.store}, f.outbox, f.auth)
+	report, err := passwords.Reset(f.admin, classosbackend.PasswordResetInput{GroupID: &groupId, MustChangePassword: true})
+	if err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if report.Total != 2 || report.Succeeded != 2 || report.Failed != 0 || !report.MustChangePassword {
+		t.Fatalf("got report %+v, want 2 students reset", report)
+	}
+	f.flush(t)
+
+	for _, result := range report.Results {
+		if result.Status != classosbackend.PasswordResetDone || result.Password == "" {
+			t.Fatalf("got result %+v", result)
+		}
+
+		adUser, err := f.directory.Authenticate(result.Username, result.Password)
+		if err != nil {
+			t.Fatalf("%s: authenticate with the new password: %v", result.Username, err)
+		}
+		if !adUser.MustChangePassword {
+			t.Errorf("%s: AD does not require a password change", result.Username)
+		}
+
+		dbUser := f.store.users[result.UserID]
+		if ok, _, _ := verifyPassword(dbUser.Password, result.Password); !ok || !dbUser.MustChangePassword {
+			t.Errorf("%s: DB user is not updated", result.Username)
+		}
+	}
+
+	if f.store.users[ivanov].TokenVersion == 0 {
+		t.Error("reset did not revoke the student's tokens")
+	}
+	if f.store.users[teacher].Password != teacherHash {
+		t.Error("group reset changed the teacher's password")
+	}
+}
+
+func TestPasswordResetUsers(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	other := f.createGroup(t, "7B")
+	ivanov := f.createUser(t, groupId, "ivanov")
+	petrov := f.createUser(t, other, "petrov")
+	teacher := f.store.addUser(t, "teacher", classosbackend.RoleTeacher, 0)
+	f.store.teacherGroups[teacher] = []int{groupId}
+	f.flush(t)
+	queued := len(f.journal.ops)
+
+	passwords := NewPasswordResetService(testUserRepo{store: f.store}, testGroupRepo{store: f.store}, f.outbox, f.auth)
+
+	// Доступ проверяется до первого сброса: чужой ученик в списке отменяет весь запрос
+	_, err := passwords.Reset(teacher, classosbackend.PasswordResetInput{UserIDs: []int{ivanov, petrov}})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v, want ErrForbidden", err)
+	}
+	if len(f.journal.ops) != queued {
+		t.Fatal("passwords are reset before the access check failed")
+	}
+
+	report, err := passwords.Reset(teacher, classosbackend.PasswordResetInput{UserIDs: []int{ivanov, ivanov}})
+	if err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if report.Total != 1 || report.Succeeded != 1 {
+		t.Fatalf("got report %+v, want one reset for a repeated id", report)
+	}
+	f.flush(t)
+
+	adUser, err := f.directory.Authenticate("ivanov", report.Results[0].Password)
+	if err != nil || adUser.MustChangePassword {
+		t.Fatalf("got %+v, %v; want the new password without a forced change", adUser, err)
+	}
+}
+
+func TestPasswordResetInputValidate(t *testing.T) {
+	groupId := 1
+	tooMany := make([]int, classosbackend.MaxPasswordResetUsers+1)
+	for _, input := range []classosbackend.PasswordResetInput{
+		{},
+		{UserIDs: []int{1}, GroupID: &groupId},
+		{UserIDs: tooMany},
+	} {
+		if err := input.Validate(); err == nil {
+			t.Errorf("%+v: got no error", input)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"golang.org/x/crypto/argon2"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash := hashPassword("Secret123")
+	if !strings.HasPrefix(hash, fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$", argon2.Version, argon2Memory, argon2Time, argon2Threads)) {
+		t.Fatalf("unexpected hash format %s", hash)
+	}
+	if hashPassword("Secret123") == hash {
+		t.Fatal("two hashes of the same password share a salt")
+	}
+
+	ok, needsRehash, err := verifyPassword(hash, "Secret123")
+	if err != nil || !ok || needsRehash {
+		t.Fatalf("correct password: got ok=%v rehash=%v err=%v", ok, needsRehash, err)
+	}
+	if ok, _, err := verifyPassword(hash, "secret123"); err != nil || ok {
+		t.Fatalf("wrong password: got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestVerifyPasswordNeedsRehash(t *testing.T) {
+	t.Setenv("AUTH_salt", "legacy-salt")
+
+	sum := sha1.New()
+	sum.Write([]byte("Secret123"))
+	legacy := fmt.Sprintf("%x", sum.Sum([]byte("legacy-salt")))
+
+	ok, needsRehash, err := verifyPassword(legacy, "Secret123")
+	if err != nil || !ok || !needsRehash {
+		t.Fatalf("legacy hash: got ok=%v rehash=%v err=%v", ok, needsRehash, err)
+	}
+	if ok, _, _ := verifyPassword(legacy, "Wrong123"); ok {
+		t.Fatal("legacy hash accepts a wrong password")
+	}
+
+	// Хеш со старыми параметрами проверяется по параметрам из строки
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("Secret123"), salt, 1, 8*1024, 1, argon2KeyLen)
+	weak := fmt.Sprintf("$argon2id$v=%d$m=%d,t=1,p=1$%s$%s", argon2.Version, 8*1024,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	ok, needsRehash, err = verifyPassword(weak, "Secret123")
+	if err != nil || !ok || !needsRehash {
+		t.Fatalf("weaker parameters: got ok=%v rehash=%v err=%v", ok, needsRehash, err)
+	}
+
+	for _, malformed := range []string{"$argon2i$v=19$m=1,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=1,t=1,p=1$c2FsdA", "$argon2id$v=19$x$c2FsdA$a2V5"} {
+		if _, _, err := verifyPassword(malformed, "Secret123"); !errors.Is(err, errMalformedPasswordHash) {
+			t.Errorf("%s: got %v, want errMalformedPasswordHash", malformed, err)
+		}
+	}
+}
+
+func TestLocalProviderUpgradesLegacyHash(t *testing.T) {
+	t.Setenv("AUTH_salt", "legacy-salt")
+
+	store := newTestStore(t)
+	userId := store.addUser(t, "ivanov", classosbackend.RoleClient, 0)
+	sum := sha1.New()
+	sum.Write([]byte("Secret123"))
+	user := store.users[userId]
+	user.Password = fmt.Sprintf("%x", sum.Sum([]byte("legacy-salt")))
+	store.users[userId] = user
+
+	provider := &localProvider{repo: testAuthRepo{store: store}}
+	if _, err := provider.Authenticate("ivanov", "Wrong123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password: got %v, want ErrInvalidCredentials", err)
+	}
+	if store.users[userId].Password != user.Password {
+		t.Fatal("hash is rewritten after a failed login")
+	}
+
+	if _, err := provider.Authenticate("ivanov", "Secret123"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	upgraded := store.users[userId].Password
+	if !strings.HasPrefix(upgraded, "$argon2id$") {
+		t.Fatalf("hash is not upgraded: %s", upgraded)
+	}
+
+	// Следующий вход проверяется уже по argon2id и хеш не пересчитывается
+	if _, err := provider.Authenticate("ivanov", "Secret123"); err != nil {
+		t.Fatalf("login with upgraded hash: %v", err)
+	}
+	if store.users[userId].Password != upgraded {
+		t.Fatal("current hash is rehashed again")
+	}
+
+	if _, err := provider.Authenticate("nobody", "Secret123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("unknown user: got %v, want ErrInvalidCredentials", err)
+	}
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrInvalidURL   = errors.New("invalid url")
+)
+
+type evaluatorKey struct {
+	groupId  int
+	entrySet string
+}
+
+// PolicyService отвечает на вопрос "разрешён ли URL пользователю".
+// Расписания и скомпилированные политики кешируются по группам и сбрасываются при изменении whitelist
+type PolicyService struct {
+	whitelistRepo repository.Whitelist
+	scheduleRepo  repository.Schedule
+	userRepo      repository.User
+	groupRepo     repository.Group
+	grantRepo     repository.AccessRequest
+	dnsUpstream   string
+
+	mu         sync.RWMutex
+	schedules  map[int][]scheduleWindow
+	evaluators map[evaluatorKey]*policyEvaluator
+	generation uint64
+}
+
+func NewPolicyService(whitelistRepo repository.Whitelist, scheduleRepo repository.Schedule, userRepo repository.User,
+	groupRepo repository.Group, grantRepo repository.AccessRequest, dnsUpstream string) *PolicyService {
+	if dnsUpstream == "" {
+		dnsUpstream = DefaultDNSUpstream
+	}
+
+	return &PolicyService{
+		whitelistRepo: whitelistRepo,
+		scheduleRepo:  scheduleRepo,
+		userRepo:      userRepo,
+		groupRepo:     groupRepo,
+		grantRepo:     grantRepo,
+		dnsUpstream:   dnsUpstream,
+		schedules:     make(map[int][]scheduleWindow),
+		evaluators:    make(map[evaluatorKey]*policyEvaluator),
+	}
+}
+
+// Check проверяет доступ пользователя к URL. Без права policy.read вызывающий может
+// проверить только себя; если пользователь не указан, проверяется сам вызывающий
+func (s *PolicyService) Check(identity classosbackend.Identity, input classosbackend.PolicyCheckInput) (classosbackend.PolicyDecision, error) {
+	host, path, err := parseCheckURL(input.URL)
+	if err != nil {
+		return classosbackend.PolicyDecision{}, err
+	}
+
+	if !identity.Can(classosbackend.PermissionPolicyRead) {
+		if input.Username != "" || input.UserID != 0 && input.UserID != identity.UserID {
+			return classosbackend.PolicyDecision{}, ErrForbidden
+		}
+		input.UserID = identity.UserID
+	}
+	if input.UserID == 0 && input.Username == "" {
+		input.UserID = identity.UserID
+	}
+
+	user, err := s.findUser(input)
+	if err != nil {
+		return classosbackend.PolicyDecision{}, err
+	}
+
+	decision := classosbackend.PolicyDecision{
+		UserID: user.ID,
+		Host:   host,
+		Path:   path,
+	}
+
+	// Пользователь без группы проверяется только по глобальному whitelist
+	var groupId int
+	if user.GroupID != nil {
+		groupId = *user.GroupID
+	}
+	decision.GroupID = groupId
+
+	// Без явного момента расписание проверяется по часам приложения, а сроки разовых
+	// разрешений - по часам БД, от которых они отсчитаны
+	at := input.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	_, entrySet, err := s.activeSet(groupId, at)
+	if err != nil {
+		return classosbackend.PolicyDecision{}, err
+	}
+	decision.EntrySet = entrySet
+
+	if entrySet == classosbackend.EntrySetOpen {
+		decision.Allowed = true
+		decision.Reason = "group schedule allows unrestricted access"
+		return decision, nil
+	}
+
+	evaluator, err := s.evaluator(groupId, entrySet)
+	if err != nil {
+		return classosbackend.PolicyDecision{}, err
+	}
+
+	// Разовые разрешения не кешируются: их мало, а срок действия должен соблюдаться точно
+	grants, err := s.grantRepo.GetGrants(user.ID, input.At)
+	if err != nil {
+		return classosbackend.PolicyDecision{}, fmt.Errorf("failed to get access grants: %w", err)
+	}
+
+	decision.Allowed, decision.Matched, decision.Reason = evaluator.evaluateWithGrants(grants, input.At, host, path)
+	return decision, nil
+}
+
+// Preview показывает, какая политика действует для группы в момент at
+func (s *PolicyService) Preview(checkerId, groupId int, at time.Time) (classosbackend.PolicyPreview, error) {
+	if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+		return classosbackend.PolicyPreview{}, err
+	}
+
+	rule, entrySet, err := s.activeSet(groupId, at)
+	if err != nil {
+		return classosbackend.PolicyPreview{}, err
+	}
+
+	preview := classosbackend.PolicyPreview{
+		GroupID:      groupId,
+		At:           at,
+		EntrySet:     entrySet,
+		Unrestricted: entrySet == classosbackend.EntrySetOpen,
+		Schedule:     rule,
+		Data:         []classosbackend.ResolvedWhitelistEntry{},
+	}
+
+	if !preview.Unrestricted {
+		preview.Data, err = resolveWhitelist(s.whitelistRepo, groupId, entrySet)
+		if err != nil {
+			return classosbackend.PolicyPreview{}, err
+		}
+	}
+
+	return preview, nil
+}
+
+// Export рендерит политику группы, действующую в момент at, в формате прокси или DNS-фильтра
+func (s *PolicyService) Export(checkerId, groupId int, format string, at time.Time) (classosbackend.PolicyExport, error) {
+	preview, err := s.Preview(checkerId, groupId, at)
+	if err != nil {
+		return classosbackend.PolicyExport{}, err
+	}
+
+	return renderPolicyExport(format, preview, s.dnsUpstream)
+}
+
+// Invalidate сбрасывает кеш группы после изменения её whitelist или расписания
+func (s *PolicyService) Invalidate(groupId int) {
+	s.mu.Lock()
+	delete(s.schedules, groupId)
+	for key := range s.evaluators {
+		if key.groupId == groupId {
+			delete(s.evaluators, key)
+		}
+	}
+	s.generation++
+	s.mu.Unlock()
+}
+
+// InvalidateAll сбрасывает кеш всех групп, например после изменения глобального whitelist
+func (s *PolicyService) InvalidateAll() {
+	s.mu.Lock()
+	s.schedules = make(map[int][]scheduleWindow)
+	s.evaluators = make(map[evaluatorKey]*policyEvaluator)
+	s.generation++
+	s.mu.Unlock()
+}
+
+func (s *PolicyService) activeSet(groupId int, at time.Time) (*classosbackend.ScheduleRule, string, error) {
+	s.mu.RLock()
+	windows, ok := s.schedules[groupId]
+	generation := s.generation
+	s.mu.RUnlock()
+
+	if !ok {
+		rules, err := s.scheduleRepo.GetAll(groupId)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get schedules: %w", err)
+		}
+
+		windows, err = compileSchedules(rules)
+		if err != nil {
+			return nil, "", err
+		}
+
+		s.mu.Lock()
+		if s.generation == generation {
+			s.schedules[groupId] = windows
+		}
+		s.mu.Unlock()
+	}
+
+	rule, entrySet := activeEntrySet(windows, at)
+	return rule, entrySet, nil
+}
+
+func (s *PolicyService) evaluator(groupId int, entrySet string) (*policyEvaluator, error) {
+	key := evaluatorKey{groupId: groupId, entrySet: entrySet}
+
+	s.mu.RLock()
+	evaluator, ok := s.evaluators[key]
+	generation := s.generation
+	s.mu.RUnlock()
+	if ok {
+		return evaluator, nil
+	}
+
+	entries, err := resolveWhitelist(s.whitelistRepo, groupId, entrySet)
+	if err != nil {
+		return nil, err
+	}
+	evaluator = newPolicyEvaluator(entries)
+
+	// Не кешируем результат, если whitelist успели изменить, пока мы его читали
+	s.mu.Lock()
+	if s.generation == generation {
+		s.evaluators[key] = evaluator
+	}
+	s.mu.Unlock()
+
+	return evaluator, nil
+}
+
+func (s *PolicyService) findUser(input classosbackend.PolicyCheckInput) (classosbackend.User, error) {
+	var user classosbackend.User
+	var err error
+
+	if input.UserID != 0 {
+		user, err = s.userRepo.GetById(0, input.UserID)
+	} else {
+		user, err = s.userRepo.GetByUsername(input.Username)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrUserNotFound
+	}
+
+	return user, err
+}
+
+// parseCheckURL выделяет хост и путь так же, как они хранятся в whitelist
+func parseCheckURL(rawURL string) (string, string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidURL, err.Error())
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "", "", fmt.Errorf("%w: host is empty", ErrInvalidURL)
+	}
+
+	return host, u.EscapedPath(), nil
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+var (
+	ErrWrongCurrentPassword = errors.New("current password is incorrect")
+	ErrNoGroup              = errors.New("user is not assigned to any group")
+)
+
+// ProfileService - раздел /api/me: пользователь работает только со своей учётной записью,
+// поэтому методы принимают его собственный id, а не checkerId
+type ProfileService struct {
+	auth      *AuthService
+	authRepo  repository.Authorization
+	userRepo  repository.User
+	grantRepo repository.AccessRequest
+	policy    Policy
+	outbox    *DirectoryOutbox
+}
+
+func NewProfileService(auth *AuthService, authRepo repository.Authorization, userRepo repository.User,
+	grantRepo repository.AccessRequest, policy Policy, outbox *DirectoryOutbox) *ProfileService {
+	return &ProfileService{auth: auth, authRepo: authRepo, userRepo: userRepo, grantRepo: grantRepo, policy: policy, outbox: outbox}
+}
+
+func (s *ProfileService) Get(identity classosbackend.Identity) (classosbackend.Profile, error) {
+	user, err := s.getUser(identity.UserID)
+	if err != nil {
+		return classosbackend.Profile{}, err
+	}
+
+	return classosbackend.Profile{
+		ID:          user.ID,
+		Name:        user.Name,
+		Username:    user.Username,
+		Role:        user.Role,
+		GroupID:     user.GroupID,
+		GroupName:   user.GroupName,
+		Permissions: identity.Permissions,
+	}, nil
+}
+
+// ChangePassword меняет пароль в БД и ставит его смену в AD в очередь. Смена пароля отзывает все входы пользователя,
+// поэтому для текущего клиента сразу выдаётся новая пара токенов
+func (s *ProfileService) ChangePassword(userId int, input classosbackend.ChangeOwnPasswordInput) (classosbackend.TokenPair, error) {
+	if err := input.Validate(); err != nil {
+		return classosbackend.TokenPair{}, err
+	}
+
+	user, err := s.getUser(userId)
+	if err != nil {
+		return classosbackend.TokenPair{}, err
+	}
+
+	tokens, err := s.changePassword(user.Username, input.CurrentPassword, input.NewPassword)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return classosbackend.TokenPair{}, ErrWrongCurrentPassword
+	}
+
+	return tokens, err
+}
+
+// ChangeRequiredPassword меняет пароль без токена: так входят пользователи,
+// которым вход вернул password_change_required
+func (s *ProfileService) ChangeRequiredPassword(input classosbackend.RequiredPasswordChangeInput) (classosbackend.TokenPair, error) {
+	if err := input.Validate(); err != nil {
+		return classosbackend.TokenPair{}, err
+	}
+
+	return s.changePassword(input.Username, input.CurrentPassword, input.NewPassword)
+}
+
+// changePassword проверяет текущий пароль, меняет его в БД, снимает требование смены пароля
+// и в той же транзакции ставит смену пароля в AD в очередь
+func (s *ProfileService) changePassword(username, currentPassword, newPassword string) (classosbackend.TokenPair, error) {
+	user, err := s.auth.authenticate(username, currentPassword)
+	if err != nil {
+		return classosbackend.TokenPair{}, err
+	}
+
+	tx, err := s.userRepo.BeginTransaction()
+	if err != nil {
+		return classosbackend.TokenPair{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	hash := hashPassword(newPassword)
+	mustChange := false
+	if err := s.userRepo.UpdateWithTx(tx, 0, user.ID, classosbackend.UpdateUserInput{Password: &hash, MustChangePassword: &mustChange}); err != nil {
+		return classosbackend.TokenPair{}, fmt.Errorf("failed to update password in DB: %w", err)
+	}
+
+	// Пароль, заданный через учётную запись службы, сбрасывает и pwdLastSet=0
+	err = s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpChangePassword, classosbackend.DirectoryOperationPayload{
+		Username: user.Username,
+	}, newPassword)
+	if err != nil {
+		return classosbackend.TokenPair{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return classosbackend.TokenPair{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.outbox.Notify()
+	s.auth.InvalidateTokens(user.ID)
+
+	state, err := s.authRepo.GetTokenState(user.ID)
+	if err != nil {
+		return classosbackend.TokenPair{}, fmt.Errorf("failed to get token state: %w", err)
+	}
+
+	return s.auth.startSession(state)
+}
+
+// GetWhitelist возвращает политику группы пользователя в момент at и его разовые разрешения.
+// Нулевой at - текущий момент, разрешения при этом отбираются по времени БД
+func (s *ProfileService) GetWhitelist(userId int, at time.Time) (classosbackend.MyWhitelist, error) {
+	user, err := s.getUser(userId)
+	if err != nil {
+		return classosbackend.MyWhitelist{}, err
+	}
+
+	if user.GroupID == nil {
+		return classosbackend.MyWhitelist{}, ErrNoGroup
+	}
+
+	previewAt := at
+	if previewAt.IsZero() {
+		previewAt = time.Now()
+	}
+
+	preview, err := s.policy.Preview(0, *user.GroupID, previewAt)
+	if err != nil {
+		return classosbackend.MyWhitelist{}, err
+	}
+
+	grants, err := s.grantRepo.GetGrants(userId, at)
+	if err != nil {
+		return classosbackend.MyWhitelist{}, fmt.Errorf("failed to get access grants: %w", err)
+	}
+
+	return classosbackend.MyWhitelist{PolicyPreview: preview, Grants: grants}, nil
+}
+
+func (s *ProfileService) GetSessions(identity classosbackend.Identity) ([]classosbackend.Session, error) {
+	return s.auth.GetSessions(identity.UserID, identity.SessionID)
+}
+
+func (s *ProfileService) getUser(userId int) (classosbackend.User, error) {
+	user, err := s.userRepo.GetById(0, userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, ErrUserNotFound
+		}
+		return user, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
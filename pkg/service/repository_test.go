@@ -0,0 +1,759 @@
+package service
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+// Репозитории в памяти для тестов сервисов. Транзакции настоящие *sql.Tx драйвера без
+// хранилища: методы *WithTx применяют изменения сразу, откат их не отменяет
+
+func init() {
+	sql.Register("classos-test", testDriver{})
+}
+
+type testDriver struct{}
+
+func (testDriver) Open(string) (driver.Conn, error) { return testConn{}, nil }
+
+type testConn struct{}
+
+func (testConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("queries are not supported")
+}
+func (testConn) Close() error              { return nil }
+func (testConn) Begin() (driver.Tx, error) { return testTx{}, nil }
+
+type testTx struct{}
+
+func (testTx) Commit() error   { return nil }
+func (testTx) Rollback() error { return nil }
+
+// testStore - общие данные репозиториев: пользователи, группы, закрепление групп за учителями
+// и права ролей
+type testStore struct {
+	mu            sync.Mutex
+	db            *sql.DB
+	nextId        int
+	users         map[int]classosbackend.User
+	groups        map[int]classosbackend.Group
+	teacherGroups map[int][]int
+	permissions   map[string][]string
+}
+
+func newTestStore(t *testing.T) *testStore {
+	db, err := sql.Open("classos-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &testStore{
+		db:            db,
+		nextId:        1,
+		users:         make(map[int]classosbackend.User),
+		groups:        make(map[int]classosbackend.Group),
+		teacherGroups: make(map[int][]int),
+		permissions:   make(map[string][]string),
+	}
+}
+
+func (s *testStore) id() int {
+	id := s.nextId
+	s.nextId++
+	return id
+}
+
+// user возвращает пользователя с именем группы, как его возвращает JOIN в postgres
+func (s *testStore) user(id int) (classosbackend.User, bool) {
+	user, ok := s.users[id]
+	if !ok {
+		return user, false
+	}
+
+	user.GroupName = nil
+	if user.GroupID != nil {
+		if group, ok := s.groups[*user.GroupID]; ok {
+			name := group.Name
+			user.GroupName = &name
+		}
+	}
+
+	return user, true
+}
+
+func (s *testStore) sortedUsers(match func(classosbackend.User) bool) []classosbackend.User {
+	users := make([]classosbackend.User, 0)
+	for id := range s.users {
+		if user, _ := s.user(id); match(user) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users
+}
+
+func (s *testStore) sortedGroups(match func(classosbackend.Group) bool) []classosbackend.Group {
+	groups := make([]classosbackend.Group, 0)
+	for _, group := range s.groups {
+		if match(group) {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+
+	return groups
+}
+
+type testUserRepo struct {
+	repository.User
+	store *testStore
+}
+
+func (r testUserRepo) BeginTransaction() (*sql.Tx, error) { return r.store.db.Begin() }
+
+func (r testUserRepo) Create(groupId int, user classosbackend.User) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, existing := range r.store.users {
+		if strings.EqualFold(existing.Username, user.Username) {
+			return 0, errors.New("duplicate username")
+		}
+	}
+
+	user.ID = r.store.id()
+	user.Enabled = true
+	if groupId != 0 {
+		user.GroupID = &groupId
+	}
+	r.store.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+func (r testUserRepo) CreateWithTx(_ *sql.Tx, groupId int, user classosbackend.User) (int, error) {
+	return r.Create(groupId, user)
+}
+
+func (r testUserRepo) GetAll(int) ([]classosbackend.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.store.sortedUsers(func(user classosbackend.User) bool {
+		return user.ArchivedAt == nil && user.Username != superAdminUsername
+	}), nil
+}
+
+func (r testUserRepo) GetById(_, userId int) (classosbackend.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.user(userId)
+	if !ok {
+		return user, sql.ErrNoRows
+	}
+
+	return user, nil
+}
+
+func (r testUserRepo) GetByUsername(username string) (classosbackend.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	users := r.store.sortedUsers(func(user classosbackend.User) bool {
+		return user.ArchivedAt == nil && strings.EqualFold(user.Username, username)
+	})
+	if len(users) == 0 {
+		return classosbackend.User{}, sql.ErrNoRows
+	}
+
+	return users[0], nil
+}
+
+func (r testUserRepo) GetByGroup(groupId int) ([]classosbackend.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.store.sortedUsers(func(user classosbackend.User) bool {
+		return user.ArchivedAt == nil && user.GroupID != nil && *user.GroupID == groupId
+	}), nil
+}
+
+func (r testUserRepo) ExistingUsernames(usernames []string) (map[string]bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	existing := make(map[string]bool)
+	for _, username := range usernames {
+		for _, user := range r.store.users {
+			if strings.EqualFold(user.Username, username) {
+				existing[strings.ToLower(username)] = true
+			}
+		}
+	}
+
+	return existing, nil
+}
+
+func (r testUserRepo) Update(_, userId int, input classosbackend.UpdateUserInput) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	if input.Username != nil {
+		user.Username = *input.Username
+	}
+	if input.Password != nil {
+		user.Password = *input.Password
+	}
+	if input.Role != nil {
+		user.Role = *input.Role
+	}
+	if input.GroupID != nil {
+		groupId := *input.GroupID
+		user.GroupID = &groupId
+	}
+	if input.MustChangePassword != nil {
+		user.MustChangePassword = *input.MustChangePassword
+	}
+	if input.Enabled != nil {
+		user.Enabled = *input.Enabled
+	}
+	if input.Password != nil || input.Role != nil || (input.Enabled != nil && !*input.Enabled) {
+		user.TokenVersion++
+	}
+	r.store.users[userId] = user
+
+	return nil
+}
+
+func (r testUserRepo) UpdateWithTx(_ *sql.Tx, checkerId, userId int, input classosbackend.UpdateUserInput) error {
+	return r.Update(checkerId, userId, input)
+}
+
+func (r testUserRepo) Delete(_, userId int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.users, userId)
+	return nil
+}
+
+func (r testUserRepo) GetArchived() ([]classosbackend.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.store.sortedUsers(func(user classosbackend.User) bool { return user.ArchivedAt != nil }), nil
+}
+
+func (r testUserRepo) GetArchivedWithGroup(groupId int) ([]classosbackend.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.store.sortedUsers(func(user classosbackend.User) bool {
+		return user.ArchivedAt != nil && user.GroupID != nil && *user.GroupID == groupId
+	}), nil
+}
+
+func (r testUserRepo) ArchiveWithTx(_ *sql.Tx, userId int, archivedAt time.Time, archivedFrom string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	user.ArchivedAt = &archivedAt
+	user.ArchivedFrom = &archivedFrom
+	user.TokenVersion++
+	r.store.users[userId] = user
+
+	return nil
+}
+
+func (r testUserRepo) RestoreWithTx(_ *sql.Tx, userId int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	user.ArchivedAt = nil
+	user.ArchivedFrom = nil
+	r.store.users[userId] = user
+
+	return nil
+}
+
+type testAuthRepo struct {
+	repository.Authorization
+	store *testStore
+}
+
+func (r testAuthRepo) GetUser(username string) (classosbackend.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, user := range r.store.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+
+	return classosbackend.User{}, sql.ErrNoRows
+}
+
+func (r testAuthRepo) UpdatePasswordHash(userId int, passwordHash string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	user.Password = passwordHash
+	r.store.users[userId] = user
+
+	return nil
+}
+
+func (r testAuthRepo) GetTokenState(userId int) (classosbackend.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userId]
+	if !ok {
+		return classosbackend.User{}, sql.ErrNoRows
+	}
+
+	return user, nil
+}
+
+// testSettingsRepo хранит настройки в памяти; updates считает записи в БД
+type testSettingsRepo struct {
+	values  map[string]string
+	updates int
+}
+
+func (r *testSettingsRepo) GetAll() ([]classosbackend.Settings, error) {
+	settings := make([]classosbackend.Settings, 0, len(r.values))
+	for key, value := range r.values {
+		settings = append(settings, classosbackend.Settings{Key: key, Value: value})
+	}
+
+	return settings, nil
+}
+
+func (r *testSettingsRepo) Update(values map[string]string, reset []string) error {
+	r.updates++
+	for key, value := range values {
+		r.values[key] = value
+	}
+	for _, key := range reset {
+		delete(r.values, key)
+	}
+
+	return nil
+}
+
+type testGroupRepo struct {
+	repository.Group
+	store *testStore
+}
+
+func (r testGroupRepo) BeginTransaction() (*sql.Tx, error) { return r.store.db.Begin() }
+
+func (r testGroupRepo) Create(_ int, group classosbackend.Group) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, existing := range r.store.groups {
+		if strings.EqualFold(existing.Name, group.Name) {
+			return 0, errors.New("duplicate group name")
+		}
+	}
+
+	group.ID = int64(r.store.id())
+	r.store.groups[int(group.ID)] = group
+
+	return int(group.ID), nil
+}
+
+func (r testGroupRepo) CreateWithTx(_ *sql.Tx, checkerId int, group classosbackend.Group) (int, error) {
+	return r.Create(checkerId, group)
+}
+
+func (r testGroupRepo) GetAll(int) ([]classosbackend.Group, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.store.sortedGroups(func(group classosbackend.Group) bool { return group.ArchivedAt == nil }), nil
+}
+
+func (r testGroupRepo) GetById(_, groupId int) (classosbackend.Group, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	group, ok := r.store.groups[groupId]
+	if !ok {
+		return group, sql.ErrNoRows
+	}
+
+	return group, nil
+}
+
+func (r testGroupRepo) GetByName(name string) (classosbackend.Group, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	groups := r.store.sortedGroups(func(group classosbackend.Group) bool {
+		return group.ArchivedAt == nil && strings.EqualFold(group.Name, name)
+	})
+	if len(groups) == 0 {
+		return classosbackend.Group{}, sql.ErrNoRows
+	}
+
+	return groups[0], nil
+}
+
+func (r testGroupRepo) Update(_, groupId int, input classosbackend.UpdateGroupInput) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	group, ok := r.store.groups[groupId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	if input.Name != nil {
+		group.Name = *input.Name
+	}
+	r.store.groups[groupId] = group
+
+	return nil
+}
+
+func (r testGroupRepo) UpdateWithTx(_ *sql.Tx, checkerId, groupId int, input classosbackend.UpdateGroupInput) error {
+	return r.Update(checkerId, groupId, input)
+}
+
+func (r testGroupRepo) GetScope(userId int) (classosbackend.GroupScope, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userId]
+	if !ok {
+		return classosbackend.GroupScope{}, sql.ErrNoRows
+	}
+
+	scope := classosbackend.GroupScope{Role: user.Role}
+	if user.Role == classosbackend.RoleAdmin {
+		scope.All = true
+		scope.ManagesRoles = true
+		return scope, nil
+	}
+
+	for _, permission := range r.store.permissions[user.Role] {
+		scope.All = scope.All || permission == classosbackend.PermissionGroupsAll
+		scope.ManagesRoles = scope.ManagesRoles || permission == classosbackend.PermissionRolesManage
+	}
+	if !scope.All {
+		scope.GroupIDs = append([]int{}, r.store.teacherGroups[userId]...)
+	}
+
+	return scope, nil
+}
+
+func (r testGroupRepo) GetTeacherGroups(teacherId int) ([]classosbackend.Group, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	groups := make([]classosbackend.Group, 0)
+	for _, groupId := range r.store.teacherGroups[teacherId] {
+		if group, ok := r.store.groups[groupId]; ok && group.ArchivedAt == nil {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups, nil
+}
+
+func (r testGroupRepo) SetTeacherGroups(teacherId int, groupIds []int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.teacherGroups[teacherId] = append([]int{}, groupIds...)
+	return nil
+}
+
+func (r testGroupRepo) GetArchived() ([]classosbackend.Group, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.store.sortedGroups(func(group classosbackend.Group) bool { return group.ArchivedAt != nil }), nil
+}
+
+func (r testGroupRepo) ArchiveWithTx(_ *sql.Tx, groupId int, archivedAt time.Time, archivedFrom string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	group, ok := r.store.groups[groupId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	group.ArchivedAt = &archivedAt
+	group.ArchivedFrom = &archivedFrom
+	r.store.groups[groupId] = group
+
+	return nil
+}
+
+func (r testGroupRepo) RestoreWithTx(_ *sql.Tx, groupId int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	group, ok := r.store.groups[groupId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	group.ArchivedAt = nil
+	group.ArchivedFrom = nil
+	r.store.groups[groupId] = group
+
+	return nil
+}
+
+// addUser добавляет пользователя в обход сервисов: так тесты готовят администраторов,
+// учителей и пользователей других ролей
+func (s *testStore) addUser(t *testing.T, username, role string, groupId int) int {
+	t.Helper()
+
+	id, err := testUserRepo{store: s}.Create(groupId, classosbackend.User{Name: username, Username: username, Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func (s *testStore) addGroup(t *testing.T, name string) int {
+	t.Helper()
+
+	id, err := testGroupRepo{store: s}.Create(0, classosbackend.Group{Name: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// testJournal - очередь каталога в памяти с тем же порядком выдачи, что и в postgres: операция
+// не выдаётся, пока есть более ранняя ожидающая операция с общим объектом
+type testJournal struct {
+	repository.DirectoryJournal
+	store *testStore
+
+	mu      sync.Mutex
+	ops     []classosbackend.DirectoryOperation
+	keys    map[int64][]string
+	claimed map[int64]bool
+	locked  bool
+}
+
+func newTestJournal(store *testStore) *testJournal {
+	return &testJournal{store: store, keys: make(map[int64][]string), claimed: make(map[int64]bool)}
+}
+
+func (j *testJournal) BeginTransaction() (*sql.Tx, error) { return j.store.db.Begin() }
+
+// TryLockWithTx отказывает, пока тест держит locked: так проверяется отказ второму Apply
+func (j *testJournal) TryLockWithTx(*sql.Tx, int64) (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return !j.locked, nil
+}
+
+func (j *testJournal) Add(operation string, objectKeys []string, payload, secret []byte) (int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	op := classosbackend.DirectoryOperation{
+		ID:            int64(len(j.ops) + 1),
+		Operation:     operation,
+		Payload:       append([]byte{}, payload...),
+		Status:        classosbackend.DirectoryOpPending,
+		NextAttemptAt: time.Now(),
+		Secret:        secret,
+		CreatedAt:     time.Now(),
+	}
+	j.ops = append(j.ops, op)
+	j.keys[op.ID] = objectKeys
+
+	return op.ID, nil
+}
+
+func (j *testJournal) AddWithTx(_ *sql.Tx, operation string, objectKeys []string, payload, secret []byte) (int64, error) {
+	return j.Add(operation, objectKeys, payload, secret)
+}
+
+func (j *testJournal) GetByStatus(status string, limit int) ([]classosbackend.DirectoryOperation, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ops := make([]classosbackend.DirectoryOperation, 0)
+	for _, op := range j.ops {
+		if (status == "" || op.Status == status) && len(ops) < limit {
+			ops = append(ops, op)
+		}
+	}
+
+	return ops, nil
+}
+
+func (j *testJournal) CountByStatus(status string) (int, error) {
+	ops, err := j.GetByStatus(status, len(j.ops)+1)
+	return len(ops), err
+}
+
+func (j *testJournal) ClaimNext(time.Duration) (classosbackend.DirectoryOperation, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i, op := range j.ops {
+		if op.Status != classosbackend.DirectoryOpPending || j.claimed[op.ID] || op.NextAttemptAt.After(time.Now()) {
+			continue
+		}
+
+		blocked := false
+		for _, earlier := range j.ops[:i] {
+			blocked = blocked || earlier.Status == classosbackend.DirectoryOpPending && sharesKey(j.keys[earlier.ID], j.keys[op.ID])
+		}
+		if !blocked {
+			j.claimed[op.ID] = true
+			return op, nil
+		}
+	}
+
+	return classosbackend.DirectoryOperation{}, sql.ErrNoRows
+}
+
+func sharesKey(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// LastResult сравнивает поля match с payload, как оператор @> для jsonb
+func (j *testJournal) LastResult(operation string, match []byte, operationId int64) (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var want map[string]any
+	if err := json.Unmarshal(match, &want); err != nil {
+		return "", err
+	}
+
+	for i := len(j.ops) - 1; i >= 0; i-- {
+		op := j.ops[i]
+		if op.Operation != operation || op.Status != classosbackend.DirectoryOpDone || op.ID >= operationId || op.Result == nil {
+			continue
+		}
+
+		var payload map[string]any
+		if err := json.Unmarshal(op.Payload, &payload); err != nil {
+			return "", err
+		}
+
+		contains := true
+		for key, value := range want {
+			contains = contains && payload[key] == value
+		}
+		if contains {
+			return *op.Result, nil
+		}
+	}
+
+	return "", sql.ErrNoRows
+}
+
+func (j *testJournal) update(operationId int64, change func(op *classosbackend.DirectoryOperation)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := range j.ops {
+		if j.ops[i].ID == operationId {
+			change(&j.ops[i])
+			delete(j.claimed, operationId)
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (j *testJournal) MarkDone(operationId int64, result string) error {
+	return j.update(operationId, func(op *classosbackend.DirectoryOperation) {
+		now := time.Now()
+		op.Status = classosbackend.DirectoryOpDone
+		op.Attempts++
+		op.AppliedAt = &now
+		op.LastError = nil
+		op.Secret = nil
+		op.Result = nil
+		if result != "" {
+			op.Result = &result
+		}
+	})
+}
+
+func (j *testJournal) Reschedule(operationId int64, nextAttemptAt time.Time, lastError string) error {
+	return j.update(operationId, func(op *classosbackend.DirectoryOperation) {
+		op.Attempts++
+		op.NextAttemptAt = nextAttemptAt
+		op.LastError = &lastError
+	})
+}
+
+func (j *testJournal) MarkFailed(operationId int64, lastError string) error {
+	return j.update(operationId, func(op *classosbackend.DirectoryOperation) {
+		op.Status = classosbackend.DirectoryOpFailed
+		op.Attempts++
+		op.LastError = &lastError
+	})
+}
+
+func (j *testJournal) Release(operationId int64) error {
+	return j.update(operationId, func(*classosbackend.DirectoryOperation) {})
+}
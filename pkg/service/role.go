@@ -0,0 +1,154 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+var (
+	ErrRoleNotFound  = errors.New("role not found")
+	ErrRoleExists    = errors.New("role already exists")
+	ErrRoleProtected = errors.New("built-in role cannot be changed this way")
+	ErrRoleInUse     = errors.New("role is assigned to users")
+)
+
+// pgForeignKeyViolation - код ошибки Postgres при нарушении внешнего ключа
+const pgForeignKeyViolation = "23503"
+
+// RoleService ведёт роли и их права. Пользователи получают новые права роли
+// вместе со следующим access-токеном
+type RoleService struct {
+	repo repository.Role
+}
+
+func NewRoleService(repo repository.Role) *RoleService {
+	return &RoleService{repo: repo}
+}
+
+func (s *RoleService) GetAll() ([]classosbackend.Role, error) {
+	roles, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range roles {
+		roles[i] = withAdminPermissions(roles[i])
+	}
+
+	return roles, nil
+}
+
+func (s *RoleService) GetPermissions() []classosbackend.PermissionDefinition {
+	return classosbackend.PermissionDefinitions()
+}
+
+func (s *RoleService) Create(role classosbackend.Role) (classosbackend.Role, error) {
+	role.Name = strings.TrimSpace(role.Name)
+	role.Description = strings.TrimSpace(role.Description)
+	if err := role.Validate(); err != nil {
+		return classosbackend.Role{}, err
+	}
+
+	permissions, err := classosbackend.NormalizePermissions(role.Permissions)
+	if err != nil {
+		return classosbackend.Role{}, err
+	}
+	role.Permissions = permissions
+
+	if _, err := s.repo.GetByName(role.Name); err == nil {
+		return classosbackend.Role{}, ErrRoleExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return classosbackend.Role{}, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	if _, err := s.repo.Create(role); err != nil {
+		return classosbackend.Role{}, fmt.Errorf("failed to create role: %w", err)
+	}
+
+	return s.repo.GetByName(role.Name)
+}
+
+// Update меняет описание и права роли; права admin фиксированы
+func (s *RoleService) Update(name string, input classosbackend.UpdateRoleInput) (classosbackend.Role, error) {
+	if err := input.Validate(); err != nil {
+		return classosbackend.Role{}, err
+	}
+
+	if _, err := s.getByName(name); err != nil {
+		return classosbackend.Role{}, err
+	}
+
+	if input.Permissions != nil {
+		if name == classosbackend.RoleAdmin {
+			return classosbackend.Role{}, ErrRoleProtected
+		}
+
+		permissions, err := classosbackend.NormalizePermissions(*input.Permissions)
+		if err != nil {
+			return classosbackend.Role{}, err
+		}
+		input.Permissions = &permissions
+	}
+
+	if input.Description != nil {
+		description := strings.TrimSpace(*input.Description)
+		input.Description = &description
+	}
+
+	if err := s.repo.Update(name, input); err != nil {
+		return classosbackend.Role{}, fmt.Errorf("failed to update role: %w", err)
+	}
+
+	return s.getByName(name)
+}
+
+func (s *RoleService) Delete(name string) error {
+	role, err := s.getByName(name)
+	if err != nil {
+		return err
+	}
+
+	if role.Builtin {
+		return ErrRoleProtected
+	}
+
+	if err := s.repo.Delete(name); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pgForeignKeyViolation {
+			return ErrRoleInUse
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRoleNotFound
+		}
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RoleService) getByName(name string) (classosbackend.Role, error) {
+	role, err := s.repo.GetByName(name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return role, ErrRoleNotFound
+		}
+		return role, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	return withAdminPermissions(role), nil
+}
+
+// withAdminPermissions показывает у роли admin полный набор прав, который она получает в токене
+func withAdminPermissions(role classosbackend.Role) classosbackend.Role {
+	if role.Name == classosbackend.RoleAdmin {
+		role.Permissions = classosbackend.AllPermissions()
+	}
+
+	return role
+}
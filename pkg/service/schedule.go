@@ -0,0 +1,139 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+var ErrScheduleNotFound = errors.New("schedule rule not found")
+
+type ScheduleService struct {
+	repo      repository.Schedule
+	groupRepo repository.Group
+	policy    PolicyInvalidator
+}
+
+func NewScheduleService(repo repository.Schedule, groupRepo repository.Group, policy PolicyInvalidator) *ScheduleService {
+	return &ScheduleService{repo: repo, groupRepo: groupRepo, policy: policy}
+}
+
+func (s *ScheduleService) GetAll(checkerId, groupId int) ([]classosbackend.ScheduleRule, error) {
+	if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetAll(groupId)
+}
+
+func (s *ScheduleService) Create(checkerId, groupId int, rule classosbackend.ScheduleRule) (int64, error) {
+	if err := rule.Validate(); err != nil {
+		return 0, err
+	}
+
+	if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+		return 0, err
+	}
+
+	defer s.policy.Invalidate(groupId)
+	return s.repo.Create(groupId, rule)
+}
+
+func (s *ScheduleService) Update(checkerId, groupId int, ruleId int64, rule classosbackend.ScheduleRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+		return err
+	}
+
+	defer s.policy.Invalidate(groupId)
+	err := s.repo.Update(groupId, ruleId, rule)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrScheduleNotFound
+	}
+
+	return err
+}
+
+func (s *ScheduleService) Delete(checkerId, groupId int, ruleId int64) error {
+	if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+		return err
+	}
+
+	defer s.policy.Invalidate(groupId)
+	err := s.repo.Delete(groupId, ruleId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrScheduleNotFound
+	}
+
+	return err
+}
+
+// scheduleWindow - правило расписания с уже разобранными временем и часовым поясом
+type scheduleWindow struct {
+	rule     classosbackend.ScheduleRule
+	location *time.Location
+	start    int
+	end      int
+}
+
+func compileSchedules(rules []classosbackend.ScheduleRule) ([]scheduleWindow, error) {
+	windows := make([]scheduleWindow, 0, len(rules))
+	for _, rule := range rules {
+		location, err := time.LoadLocation(rule.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("schedule rule %d: %w", rule.ID, err)
+		}
+
+		start, err := classosbackend.ParseClock(rule.StartTime)
+		if err != nil {
+			return nil, fmt.Errorf("schedule rule %d: %w", rule.ID, err)
+		}
+
+		end, err := classosbackend.ParseClock(rule.EndTime)
+		if err != nil {
+			return nil, fmt.Errorf("schedule rule %d: %w", rule.ID, err)
+		}
+
+		windows = append(windows, scheduleWindow{rule: rule, location: location, start: start, end: end})
+	}
+
+	return windows, nil
+}
+
+// activeEntrySet выбирает набор записей, действующий в момент at.
+// Если активны несколько правил, побеждает начавшееся позже, при равенстве - более короткое.
+// Без активных правил действует набор по умолчанию
+func activeEntrySet(windows []scheduleWindow, at time.Time) (*classosbackend.ScheduleRule, string) {
+	var best *scheduleWindow
+	for i := range windows {
+		window := &windows[i]
+
+		local := at.In(window.location)
+		if int(local.Weekday()) != window.rule.Weekday {
+			continue
+		}
+
+		minute := local.Hour()*60 + local.Minute()
+		if minute < window.start || minute >= window.end {
+			continue
+		}
+
+		if best == nil || window.start > best.start || window.start == best.start && window.end < best.end {
+			best = window
+		}
+	}
+
+	if best == nil {
+		return nil, classosbackend.EntrySetDefault
+	}
+
+	rule := best.rule
+	return &rule, rule.EntrySet
+}
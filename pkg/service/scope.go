@@ -0,0 +1,234 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+var (
+	ErrForbidden   = errors.New("access to this resource is not allowed")
+	ErrNotTeacher  = errors.New("user is not a teacher")
+	ErrDisableSelf = errors.New("cannot disable your own account")
+)
+
+// resolveScope возвращает группы, которыми может управлять checkerId.
+// checkerId 0 - внутренние вызовы сервисов, им доступно всё
+func resolveScope(groupRepo repository.Group, checkerId int) (classosbackend.GroupScope, error) {
+	if checkerId == 0 {
+		return classosbackend.GroupScope{Role: classosbackend.RoleAdmin, All: true, ManagesRoles: true}, nil
+	}
+
+	scope, err := groupRepo.GetScope(checkerId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return scope, ErrForbidden
+		}
+		return scope, fmt.Errorf("failed to get access scope: %w", err)
+	}
+
+	return scope, nil
+}
+
+// requireAllGroups пропускает только пользователей с доступом ко всем группам: создание
+// и удаление групп и назначение ролей, кроме client, не ограничиваются одной группой
+func requireAllGroups(groupRepo repository.Group, checkerId int) error {
+	scope, err := resolveScope(groupRepo, checkerId)
+	if err != nil {
+		return err
+	}
+
+	if !scope.All {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// checkUser проверяет, что пользователь существует и checkerId может им управлять
+func checkUser(userRepo repository.User, groupRepo repository.Group, checkerId, userId int) (classosbackend.User, error) {
+	_, user, err := scopedUser(userRepo, groupRepo, checkerId, userId)
+	return user, err
+}
+
+// checkModifiableUser - checkUser для изменений, сброса пароля, архивации и удаления:
+// учётную запись администратора меняет только администратор
+func checkModifiableUser(userRepo repository.User, groupRepo repository.Group, checkerId, userId int) (classosbackend.User, error) {
+	scope, user, err := scopedUser(userRepo, groupRepo, checkerId, userId)
+	if err != nil {
+		return user, err
+	}
+
+	if !scope.ModifiesUser(user) {
+		return user, ErrForbidden
+	}
+
+	return user, nil
+}
+
+// checkActiveUser - checkModifiableUser для изменений: архивированного пользователя сначала нужно восстановить
+func checkActiveUser(userRepo repository.User, groupRepo repository.Group, checkerId, userId int) (classosbackend.User, error) {
+	user, err := checkModifiableUser(userRepo, groupRepo, checkerId, userId)
+	if err != nil {
+		return user, err
+	}
+
+	if user.ArchivedAt != nil {
+		return user, fmt.Errorf("%w: user %s", ErrArchived, user.Username)
+	}
+
+	return user, nil
+}
+
+func scopedUser(userRepo repository.User, groupRepo repository.Group, checkerId, userId int) (classosbackend.GroupScope, classosbackend.User, error) {
+	scope, err := resolveScope(groupRepo, checkerId)
+	if err != nil {
+		return scope, classosbackend.User{}, err
+	}
+
+	user, err := userRepo.GetById(checkerId, userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return scope, user, ErrUserNotFound
+		}
+		return scope, user, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if !scope.ManagesUser(user) {
+		return scope, user, ErrForbidden
+	}
+
+	return scope, user, nil
+}
+
+// checkActiveGroup - checkGroup для изменений: в архивированную группу нельзя добавлять пользователей
+func checkActiveGroup(groupRepo repository.Group, checkerId, groupId int) (classosbackend.Group, error) {
+	if err := checkGroup(groupRepo, checkerId, groupId); err != nil {
+		return classosbackend.Group{}, err
+	}
+
+	group, err := groupRepo.GetById(checkerId, groupId)
+	if err != nil {
+		return group, fmt.Errorf("failed to get group: %w", err)
+	}
+
+	if group.ArchivedAt != nil {
+		return group, fmt.Errorf("%w: group %s", ErrArchived, group.Name)
+	}
+
+	return group, nil
+}
+
+// checkUserChanges проверяет изменения пользователя user: роль назначают только администратор
+// и роли с правом roles.manage, роль admin - только администратор, а перевести ученика
+// можно только в доступную группу
+func checkUserChanges(groupRepo repository.Group, checkerId int, user classosbackend.User, input classosbackend.UpdateUserInput) error {
+	scope, err := resolveScope(groupRepo, checkerId)
+	if err != nil {
+		return err
+	}
+
+	if input.Role != nil && *input.Role != user.Role {
+		if err := checkRoleAssignment(scope, *input.Role); err != nil {
+			return err
+		}
+	}
+
+	if input.GroupID != nil && !scope.Allows(*input.GroupID) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// checkNewUser проверяет группу и роль создаваемого пользователя и возвращает его группу;
+// без права на роли создаются только ученики
+func checkNewUser(groupRepo repository.Group, checkerId, groupId int, user *classosbackend.User) (classosbackend.Group, error) {
+	group, err := checkActiveGroup(groupRepo, checkerId, groupId)
+	if err != nil {
+		return classosbackend.Group{}, err
+	}
+
+	if user.Role == "" {
+		user.Role = classosbackend.RoleClient
+	}
+
+	if user.Role == classosbackend.RoleClient {
+		return group, nil
+	}
+
+	scope, err := resolveScope(groupRepo, checkerId)
+	if err != nil {
+		return classosbackend.Group{}, err
+	}
+
+	if err := checkRoleAssignment(scope, user.Role); err != nil {
+		return classosbackend.Group{}, err
+	}
+
+	return group, nil
+}
+
+// checkRoleAssignment - назначение роли, кроме client: нужны доступ ко всем группам и право на роли
+func checkRoleAssignment(scope classosbackend.GroupScope, role string) error {
+	if !scope.All || !scope.ManagesRoles || role == classosbackend.RoleAdmin && scope.Role != classosbackend.RoleAdmin {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// filterUsers оставляет пользователей, которыми может управлять checkerId
+func filterUsers(groupRepo repository.Group, checkerId int, users []classosbackend.User) ([]classosbackend.User, error) {
+	scope, err := resolveScope(groupRepo, checkerId)
+	if err != nil {
+		return nil, err
+	}
+
+	if scope.All {
+		return users, nil
+	}
+
+	visible := make([]classosbackend.User, 0, len(users))
+	for _, user := range users {
+		if scope.ManagesUser(user) {
+			visible = append(visible, user)
+		}
+	}
+
+	return visible, nil
+}
+
+// filterGroups оставляет группы, доступные checkerId
+func filterGroups(groupRepo repository.Group, checkerId int, groups []classosbackend.Group) ([]classosbackend.Group, error) {
+	scope, err := resolveScope(groupRepo, checkerId)
+	if err != nil {
+		return nil, err
+	}
+
+	if scope.All {
+		return groups, nil
+	}
+
+	visible := make([]classosbackend.Group, 0, len(groups))
+	for _, group := range groups {
+		if scope.Allows(int(group.ID)) {
+			visible = append(visible, group)
+		}
+	}
+
+	return visible, nil
+}
+
+// checkEnabledChange проверяет доступ к пользователю при включении или отключении;
+// отключить самого себя нельзя, чтобы не потерять последний вход администратора
+func checkEnabledChange(userRepo repository.User, groupRepo repository.Group, checkerId, userId int, enabled bool) (classosbackend.User, error) {
+	if !enabled && checkerId == userId {
+		return classosbackend.User{}, ErrDisableSelf
+	}
+
+	return checkActiveUser(userRepo, groupRepo, checkerId, userId)
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// scopeFixture - администратор, роль manager с доступом ко всем группам без права на роли
+// и учитель группы 7A
+type scopeFixture struct {
+	store     *testStore
+	users     *IntegratedUserService
+	passwords *PasswordResetService
+	archive   *ArchiveService
+	teachers  *TeacherService
+
+	group   int
+	admin   int
+	other   int
+	manager int
+	teacher int
+	student int
+}
+
+func newScopeFixture(t *testing.T) scopeFixture {
+	store := newTestStore(t)
+	store.permissions["manager"] = []string{
+		classosbackend.PermissionGroupsAll,
+		classosbackend.PermissionUsersWrite,
+		classosbackend.PermissionTeachersManage,
+	}
+
+	f := scopeFixture{store: store}
+	f.group = store.addGroup(t, "7A")
+	f.admin = store.addUser(t, "admin02", classosbackend.RoleAdmin, 0)
+	f.other = store.addUser(t, "admin03", classosbackend.RoleAdmin, 0)
+	f.manager = store.addUser(t, "manager", "manager", 0)
+	f.teacher = store.addUser(t, "teacher", classosbackend.RoleTeacher, 0)
+	f.student = store.addUser(t, "student", classosbackend.RoleClient, f.group)
+	store.teacherGroups[f.teacher] = []int{f.group}
+
+	userRepo := testUserRepo{store: store}
+	groupRepo := testGroupRepo{store: store}
+	outbox := NewDirectoryOutbox(nil)
+	authService := NewAuthService(nil, nil, nil)
+	f.archive = NewArchiveService(userRepo, groupRepo, outbox, authService, nil)
+	f.users = NewIntegratedUserService(userRepo, groupRepo, authService, nil, outbox, nil, f.archive)
+	f.passwords = NewPasswordResetService(userRepo, groupRepo, outbox, authService)
+	f.teachers = NewTeacherService(groupRepo, userRepo)
+
+	return f
+}
+
+func TestUpdateRoleRequiresRolesManage(t *testing.T) {
+	f := newScopeFixture(t)
+
+	for _, role := range []string{classosbackend.RoleAdmin, classosbackend.RoleTeacher} {
+		err := f.users.Update(f.manager, f.student, classosbackend.UpdateUserInput{Role: &role})
+		if !errors.Is(err, ErrForbidden) {
+			t.Errorf("manager sets role %s: got %v, want ErrForbidden", role, err)
+		}
+	}
+
+	if user := f.store.users[f.student]; user.Role != classosbackend.RoleClient {
+		t.Fatalf("role changed to %s", user.Role)
+	}
+
+	role := classosbackend.RoleTeacher
+	if err := f.users.Update(f.admin, f.student, classosbackend.UpdateUserInput{Role: &role}); err != nil {
+		t.Fatalf("admin sets role: %v", err)
+	}
+	if user := f.store.users[f.student]; user.Role != classosbackend.RoleTeacher {
+		t.Fatalf("role is %s, want teacher", user.Role)
+	}
+}
+
+func TestAssignAdminRoleRequiresAdmin(t *testing.T) {
+	f := newScopeFixture(t)
+	f.store.permissions["manager"] = append(f.store.permissions["manager"], classosbackend.PermissionRolesManage)
+
+	role := classosbackend.RoleAdmin
+	err := f.users.Update(f.manager, f.student, classosbackend.UpdateUserInput{Role: &role})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v, want ErrForbidden", err)
+	}
+
+	role = classosbackend.RoleTeacher
+	if err := f.users.Update(f.manager, f.student, classosbackend.UpdateUserInput{Role: &role}); err != nil {
+		t.Fatalf("manager with roles.manage sets role teacher: %v", err)
+	}
+}
+
+func TestCreateUserWithRoleRequiresRolesManage(t *testing.T) {
+	f := newScopeFixture(t)
+
+	user := classosbackend.User{Name: "New Teacher", Username: "newteacher", Password: "Secret123", Role: classosbackend.RoleTeacher}
+	if _, err := checkNewUser(testGroupRepo{store: f.store}, f.manager, f.group, &user); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v, want ErrForbidden", err)
+	}
+}
+
+func TestUpdateAdminRequiresAdmin(t *testing.T) {
+	f := newScopeFixture(t)
+
+	name := "Renamed"
+	err := f.users.Update(f.manager, f.admin, classosbackend.UpdateUserInput{Name: &name})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v, want ErrForbidden", err)
+	}
+}
+
+func TestChangeAdminPasswordRequiresAdmin(t *testing.T) {
+	f := newScopeFixture(t)
+
+	password := "NewSecret123"
+	err := f.users.Update(f.manager, f.admin, classosbackend.UpdateUserInput{Password: &password})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v, want ErrForbidden", err)
+	}
+}
+
+func TestResetAdminPasswordRequiresAdmin(t *testing.T) {
+	f := newScopeFixture(t)
+
+	_, err := f.passwords.Reset(f.manager, classosbackend.PasswordResetInput{UserIDs: []int{f.student, f.admin}})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v, want ErrForbidden", err)
+	}
+}
+
+func TestArchiveAdminRequiresAdmin(t *testing.T) {
+	f := newScopeFixture(t)
+
+	if err := f.archive.ArchiveUser(f.manager, f.admin); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v, want ErrForbidden", err)
+	}
+	if err := f.users.SetEnabled(f.manager, f.admin, false); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("disable: got %v, want ErrForbidden", err)
+	}
+}
+
+func TestAdminCanViewAdmins(t *testing.T) {
+	f := newScopeFixture(t)
+
+	if _, err := f.users.GetById(f.manager, f.admin); err != nil {
+		t.Fatalf("manager views admin: %v", err)
+	}
+	if _, err := checkActiveUser(testUserRepo{store: f.store}, testGroupRepo{store: f.store}, f.admin, f.other); err != nil {
+		t.Fatalf("admin modifies admin: %v", err)
+	}
+}
+
+func TestTeacherSetGroupsChecksCurrentGroups(t *testing.T) {
+	f := newScopeFixture(t)
+	other := f.store.addGroup(t, "8B")
+	f.store.permissions[classosbackend.RoleTeacher] = []string{classosbackend.PermissionTeachersManage}
+
+	// Учитель 8B не управляется учителем 7A, даже если ему назначают только 7A
+	colleague := f.store.addUser(t, "colleague", classosbackend.RoleTeacher, 0)
+	f.store.teacherGroups[colleague] = []int{other}
+
+	_, err := f.teachers.SetGroups(f.teacher, colleague, classosbackend.TeacherGroupsInput{GroupIDs: []int{f.group}})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v, want ErrForbidden", err)
+	}
+	if groups := f.store.teacherGroups[colleague]; len(groups) != 1 || groups[0] != other {
+		t.Fatalf("teacher groups changed to %v", groups)
+	}
+
+	_, err = f.teachers.SetGroups(f.teacher, colleague, classosbackend.TeacherGroupsInput{GroupIDs: []int{}})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("removing groups: got %v, want ErrForbidden", err)
+	}
+}
+
+func TestTeacherSetGroupsChecksNewGroups(t *testing.T) {
+	f := newScopeFixture(t)
+	other := f.store.addGroup(t, "8B")
+
+	newcomer := f.store.addUser(t, "newcomer", classosbackend.RoleTeacher, 0)
+	_, err := f.teachers.SetGroups(f.teacher, newcomer, classosbackend.TeacherGroupsInput{GroupIDs: []int{other}})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v, want ErrForbidden", err)
+	}
+
+	groups, err := f.teachers.SetGroups(f.manager, newcomer, classosbackend.TeacherGroupsInput{GroupIDs: []int{f.group, other}})
+	if err != nil {
+		t.Fatalf("manager sets groups: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(groups))
+	}
+}
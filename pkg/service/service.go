@@ -1,14 +1,17 @@
 package service
 
 import (
+	"time"
+
 	classosbackend "github.com/rinat0880/classOS_backend"
-	"github.com/rinat0880/classOS_backend/pkg/repository"
 )
 
 type Authorization interface {
 	CreateUser(user classosbackend.User) (int, error)
-	GenerateToken(username, password string) (string, error)
-	ParseToken(token string) (int, string, error)
+	GenerateToken(username, password string) (classosbackend.TokenPair, error)
+	Refresh(refreshToken string) (classosbackend.TokenPair, error)
+	Logout(refreshToken string, everywhere bool) error
+	ParseToken(token string) (classosbackend.Identity, error)
 	GeneratePasswordHash(password string) string
 }
 
@@ -21,26 +24,129 @@ type Group interface {
 }
 
 type User interface {
-	Create(checkerId, groupId int, user classosbackend.User) (int, error)
+	Create(checkerId, groupId int, user classosbackend.User) (classosbackend.CreatedUser, error)
 	GetAll(checkerId int) ([]classosbackend.User, error)
 	GetById(checkerId, userId int) (classosbackend.User, error)
 	Delete(checkerId, userId int) error
 	Update(checkerId, userId int, input classosbackend.UpdateUserInput) error
+	SetEnabled(checkerId, userId int, enabled bool) error
+}
+
+type Whitelist interface {
+	GetAll(checkerId, groupId int, entrySet string) ([]classosbackend.WhitelistEntry, error)
+	Add(checkerId, groupId int, input classosbackend.WhitelistInput) ([]classosbackend.WhitelistEntry, error)
+	Delete(checkerId, groupId int, entryId int64) error
+	DeleteValues(checkerId, groupId int, input classosbackend.WhitelistInput) (int64, error)
+	Replace(checkerId, groupId int, input classosbackend.WhitelistInput) ([]classosbackend.WhitelistEntry, error)
+
+	GetGlobal() ([]classosbackend.GlobalWhitelistEntry, error)
+	AddGlobal(input classosbackend.WhitelistInput) ([]classosbackend.GlobalWhitelistEntry, error)
+	DeleteGlobal(entryId int64) error
+	DeleteGlobalValues(input classosbackend.WhitelistInput) (int64, error)
+	ReplaceGlobal(input classosbackend.WhitelistInput) ([]classosbackend.GlobalWhitelistEntry, error)
+}
+
+type Policy interface {
+	Check(identity classosbackend.Identity, input classosbackend.PolicyCheckInput) (classosbackend.PolicyDecision, error)
+	Preview(checkerId, groupId int, at time.Time) (classosbackend.PolicyPreview, error)
+	Export(checkerId, groupId int, format string, at time.Time) (classosbackend.PolicyExport, error)
+}
+
+type Schedule interface {
+	GetAll(checkerId, groupId int) ([]classosbackend.ScheduleRule, error)
+	Create(checkerId, groupId int, rule classosbackend.ScheduleRule) (int64, error)
+	Update(checkerId, groupId int, ruleId int64, rule classosbackend.ScheduleRule) error
+	Delete(checkerId, groupId int, ruleId int64) error
+}
+
+type AccessRequest interface {
+	Create(userId int, input classosbackend.AccessRequestInput) (classosbackend.AccessRequest, error)
+	GetByUser(userId int) ([]classosbackend.AccessRequest, error)
+	GetAll(checkerId, groupId int, status string) ([]classosbackend.AccessRequest, error)
+	Decide(checkerId int, requestId int64, input classosbackend.AccessDecisionInput) (classosbackend.AccessRequest, error)
+}
+
+// Archive - архив пользователей и групп: Delete в User и Group переносит их сюда
+type Archive interface {
+	GetUsers(checkerId int) ([]classosbackend.User, error)
+	GetGroups(checkerId int) ([]classosbackend.Group, error)
+	RestoreUser(checkerId, userId int) error
+	RestoreGroup(checkerId, groupId int) error
+}
+
+type UserImport interface {
+	Import(checkerId int, data []byte, dryRun bool) (classosbackend.ImportReport, error)
+}
+
+type CredentialsSheet interface {
+	Generate(checkerId, groupId int, input classosbackend.CredentialsSheetInput) (classosbackend.CredentialsSheet, error)
+}
+
+type PasswordReset interface {
+	Reset(checkerId int, input classosbackend.PasswordResetInput) (classosbackend.PasswordResetReport, error)
+}
+
+type Teacher interface {
+	GetGroups(checkerId, teacherId int) ([]classosbackend.Group, error)
+	SetGroups(checkerId, teacherId int, input classosbackend.TeacherGroupsInput) ([]classosbackend.Group, error)
+}
+
+type Profile interface {
+	Get(identity classosbackend.Identity) (classosbackend.Profile, error)
+	ChangePassword(userId int, input classosbackend.ChangeOwnPasswordInput) (classosbackend.TokenPair, error)
+	ChangeRequiredPassword(input classosbackend.RequiredPasswordChangeInput) (classosbackend.TokenPair, error)
+	GetWhitelist(userId int, at time.Time) (classosbackend.MyWhitelist, error)
+	GetSessions(identity classosbackend.Identity) ([]classosbackend.Session, error)
+}
+
+type Role interface {
+	GetAll() ([]classosbackend.Role, error)
+	GetPermissions() []classosbackend.PermissionDefinition
+	Create(role classosbackend.Role) (classosbackend.Role, error)
+	Update(name string, input classosbackend.UpdateRoleInput) (classosbackend.Role, error)
+	Delete(name string) error
+}
+
+// DirectoryAdmin - состояние каталога и очередь его операций
+type DirectoryAdmin interface {
+	Status() (classosbackend.DirectoryStatus, error)
+	GetJournal(status string, limit int) ([]classosbackend.DirectoryOperation, error)
+	Retry(operationId int64) (classosbackend.DirectoryOperation, error)
+}
+
+// Sync - сверка БД и каталога: план изменений и его применение в выбранном направлении
+type Sync interface {
+	Plan(direction string) (classosbackend.SyncPlan, error)
+	Apply(input classosbackend.SyncInput) (classosbackend.SyncPlan, error)
+}
+
+// Drift - отчёт о расхождениях пользователей БД и каталога без изменений
+type Drift interface {
+	Drift() (classosbackend.DriftReport, error)
+}
+
+type Settings interface {
+	GetAll() ([]classosbackend.SettingValue, error)
+	Update(input classosbackend.UpdateSettingsInput) ([]classosbackend.SettingValue, error)
 }
 
 type Service struct {
 	Authorization
 	Group
 	User
-}
-
-func NewService(repos *repository.Repository) *Service {
-	adService := NewADService()
-	authService := NewAuthService(repos.Authorization)
-
-	return &Service{
-		Authorization: authService,
-		Group:         NewIntegratedGroupService(repos.Group, adService),
-		User:          NewIntegratedUserService(repos.User, repos.Group, authService, adService),
-	}
+	Archive
+	UserImport
+	CredentialsSheet
+	PasswordReset
+	Whitelist
+	Policy
+	Schedule
+	AccessRequest
+	Teacher
+	Role
+	Profile
+	Settings
+	DirectoryAdmin
+	Sync
+	Drift
 }
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// SettingsReader отдаёт действующие значения настроек из реестра classosbackend.SettingDefinitions.
+// Если значение не задано или не читается, возвращается значение по умолчанию
+type SettingsReader interface {
+	Bool(key string) bool
+	Int(key string) int
+	Duration(key string) time.Duration
+	String(key string) string
+	StringList(key string) []string
+}
+
+// SettingsService хранит настройки в БД и кеширует их в памяти до следующего изменения.
+// Без репозитория (например, в утилитах командной строки) работает только со значениями по умолчанию
+type SettingsService struct {
+	repo repository.Settings
+
+	mu     sync.RWMutex
+	stored map[string]classosbackend.Settings
+}
+
+func NewSettingsService(repo repository.Settings) *SettingsService {
+	return &SettingsService{repo: repo}
+}
+
+func (s *SettingsService) GetAll() ([]classosbackend.SettingValue, error) {
+	stored, err := s.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := classosbackend.SettingDefinitions()
+	values := make([]classosbackend.SettingValue, 0, len(definitions))
+	for _, definition := range definitions {
+		value := classosbackend.SettingValue{
+			Key:         definition.Key,
+			Type:        definition.Type,
+			Value:       definition.Default,
+			Default:     definition.Default,
+			Description: definition.Description,
+			IsDefault:   true,
+		}
+
+		if setting, ok := stored[definition.Key]; ok {
+			updatedAt := setting.UpdatedAt
+			value.Value = setting.Value
+			value.IsDefault = false
+			value.UpdatedAt = &updatedAt
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// Update проверяет все значения до записи, поэтому одна ошибка отменяет весь запрос
+func (s *SettingsService) Update(input classosbackend.UpdateSettingsInput) ([]classosbackend.SettingValue, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(input))
+	var reset []string
+	for key, value := range input {
+		definition, err := classosbackend.LookupSetting(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if value == nil {
+			reset = append(reset, key)
+			continue
+		}
+
+		normalized, err := definition.Normalize(*value)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = normalized
+	}
+
+	if err := s.repo.Update(values, reset); err != nil {
+		return nil, err
+	}
+
+	return s.GetAll()
+}
+
+func (s *SettingsService) Bool(key string) bool {
+	value, _ := s.value(key).(bool)
+	return value
+}
+
+func (s *SettingsService) Int(key string) int {
+	value, _ := s.value(key).(int)
+	return value
+}
+
+func (s *SettingsService) Duration(key string) time.Duration {
+	value, _ := s.value(key).(time.Duration)
+	return value
+}
+
+func (s *SettingsService) String(key string) string {
+	value, _ := s.value(key).(string)
+	return value
+}
+
+func (s *SettingsService) StringList(key string) []string {
+	value, _ := s.value(key).([]string)
+	return value
+}
+
+func (s *SettingsService) value(key string) interface{} {
+	definition, err := classosbackend.LookupSetting(key)
+	if err != nil {
+		logrus.WithError(err).Error("settings: reading unregistered key")
+		return nil
+	}
+
+	raw := definition.Default
+	if setting, ok := s.cached()[key]; ok {
+		raw = setting.Value
+	}
+
+	parsed, err := definition.Parse(raw)
+	if err != nil {
+		logrus.WithError(err).Warn("settings: stored value is invalid, using default")
+		parsed, _ = definition.Parse(definition.Default)
+	}
+
+	return parsed
+}
+
+func (s *SettingsService) cached() map[string]classosbackend.Settings {
+	s.mu.RLock()
+	stored := s.stored
+	s.mu.RUnlock()
+	if stored != nil {
+		return stored
+	}
+
+	stored, err := s.reload()
+	if err != nil {
+		// Не кешируем сбой, чтобы следующее чтение снова попробовало БД
+		logrus.WithError(err).Warn("settings: failed to load, using defaults")
+		return nil
+	}
+
+	return stored
+}
+
+func (s *SettingsService) reload() (map[string]classosbackend.Settings, error) {
+	stored := make(map[string]classosbackend.Settings)
+	if s.repo != nil {
+		settings, err := s.repo.GetAll()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, setting := range settings {
+			stored[setting.Key] = setting
+		}
+	}
+
+	s.mu.Lock()
+	s.stored = stored
+	s.mu.Unlock()
+
+	return stored, nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+func TestSettingDefaultsAreValid(t *testing.T) {
+	for _, definition := range classosbackend.SettingDefinitions() {
+		if _, err := definition.Parse(definition.Default); err != nil {
+			t.Errorf("default of %s: %v", definition.Key, err)
+		}
+	}
+}
+
+func TestSettingsUpdateRejectsInvalidValues(t *testing.T) {
+	tests := map[string]string{
+		classosbackend.SettingAuthTokenTTL:        "30s",
+		classosbackend.SettingAuthRefreshTokenTTL: "forever",
+		classosbackend.SettingADDefaultOU:         "users,DC=evil",
+		classosbackend.SettingADGroupsOU:          " ",
+		classosbackend.SettingADUPNSuffix:         "*.school.local",
+		classosbackend.SettingArchiveRetention:    "1h",
+		classosbackend.SettingAccessGrantDuration: "0",
+		classosbackend.SettingUsernameTemplate:    "{middle}.{last}",
+		classosbackend.SettingUsersNameOrder:      "middle_first",
+		classosbackend.SettingUsersLoginURL:       "javascript:alert(1)",
+	}
+
+	for key, value := range tests {
+		repo := &testSettingsRepo{values: map[string]string{}}
+		settings := NewSettingsService(repo)
+
+		// Одна ошибка отменяет весь запрос: корректное значение рядом тоже не записывается
+		input := classosbackend.UpdateSettingsInput{key: &value}
+		if key != classosbackend.SettingArchiveRetention {
+			valid := "48h"
+			input[classosbackend.SettingArchiveRetention] = &valid
+		}
+		_, err := settings.Update(input)
+		if !errors.Is(err, classosbackend.ErrInvalidSetting) {
+			t.Errorf("%s=%q: got %v, want ErrInvalidSetting", key, value, err)
+		}
+		if repo.updates != 0 {
+			t.Errorf("%s=%q: settings are written despite the error", key, value)
+		}
+	}
+
+	value := "1"
+	settings := NewSettingsService(&testSettingsRepo{values: map[string]string{}})
+	if _, err := settings.Update(classosbackend.UpdateSettingsInput{"ad.password": &value}); !errors.Is(err, classosbackend.ErrUnknownSetting) {
+		t.Fatalf("unknown key: got %v, want ErrUnknownSetting", err)
+	}
+}
+
+func TestSettingsUpdateAndReset(t *testing.T) {
+	repo := &testSettingsRepo{values: map[string]string{}}
+	settings := NewSettingsService(repo)
+
+	if got := settings.Duration(classosbackend.SettingAuthTokenTTL); got != 15*time.Minute {
+		t.Fatalf("default token TTL is %s", got)
+	}
+
+	ttl, suffix := " 30m ", "School.Local"
+	values, err := settings.Update(classosbackend.UpdateSettingsInput{
+		classosbackend.SettingAuthTokenTTL: &ttl,
+		classosbackend.SettingADUPNSuffix:  &suffix,
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if repo.values[classosbackend.SettingAuthTokenTTL] != "30m" {
+		t.Fatalf("stored %q, want normalized 30m", repo.values[classosbackend.SettingAuthTokenTTL])
+	}
+	if got := settings.Duration(classosbackend.SettingAuthTokenTTL); got != 30*time.Minute {
+		t.Fatalf("token TTL after update is %s", got)
+	}
+	for _, value := range values {
+		if value.Key == classosbackend.SettingAuthTokenTTL && value.IsDefault {
+			t.Fatal("updated setting is reported as default")
+		}
+	}
+
+	if _, err := settings.Update(classosbackend.UpdateSettingsInput{classosbackend.SettingAuthTokenTTL: nil}); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if got := settings.Duration(classosbackend.SettingAuthTokenTTL); got != 15*time.Minute {
+		t.Fatalf("token TTL after reset is %s", got)
+	}
+
+	// Испорченное значение в БД не ломает чтение: используется значение по умолчанию
+	repo.values[classosbackend.SettingArchiveRetention] = "never"
+	if _, err := settings.GetAll(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := settings.Duration(classosbackend.SettingArchiveRetention); got != 720*time.Hour {
+		t.Fatalf("retention with a broken stored value is %s", got)
+	}
+}
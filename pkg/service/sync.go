@@ -0,0 +1,820 @@
+package service
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+var (
+	// ErrSyncPending - в очереди каталога есть неприменённые операции: план по текущему
+	// состоянию AD устарел бы ещё до применения
+	ErrSyncPending = errors.New("directory queue has pending operations")
+	// ErrInvalidSyncChange - изменение плана, которое нельзя применить в выбранном направлении
+	ErrInvalidSyncChange = errors.New("invalid sync change")
+	// ErrSyncPlanChanged - состояние БД или AD изменилось после построения плана
+	ErrSyncPlanChanged = errors.New("sync plan has changed, review the new plan")
+	ErrSyncInProgress  = errors.New("another sync is being applied")
+	// ErrSyncConfirmationRequired - план архивирует или пересоздаёт больше syncConfirmLimit объектов
+	ErrSyncConfirmationRequired = errors.New("sync plan requires confirmation")
+)
+
+// errSyncStaff - учётные записи администраторов и учителей синхронизация не архивирует и не
+// пересоздаёт с новым паролем, их расхождения разбираются вручную
+var errSyncStaff = errors.New("staff accounts are never archived or re-created by sync")
+
+// syncConfirmLimit - сколько архиваций и пересозданий учётных записей план может содержать
+// без явного подтверждения
+const syncConfirmLimit = 10
+
+// syncLockKey - ключ advisory-блокировки, которая не даёт применять два плана одновременно
+const syncLockKey int64 = 0x636c6173_73796e63
+
+// SyncService сверяет пользователей, группы и членство в группах между БД и OU classOS в каталоге.
+// Изменения AD ставятся в очередь DirectoryOutbox, изменения БД применяются сразу; удаление с любой
+// стороны - это архивация, а не окончательное удаление
+type SyncService struct {
+	userRepo    repository.User
+	groupRepo   repository.Group
+	journal     repository.DirectoryJournal
+	directory   Directory
+	outbox      *DirectoryOutbox
+	archive     *ArchiveService
+	authService *AuthService
+}
+
+func NewSyncService(userRepo repository.User, groupRepo repository.Group, journal repository.DirectoryJournal, directory Directory,
+	outbox *DirectoryOutbox, archive *ArchiveService, authService *AuthService) *SyncService {
+	return &SyncService{
+		userRepo:    userRepo,
+		groupRepo:   groupRepo,
+		journal:     journal,
+		directory:   directory,
+		outbox:      outbox,
+		archive:     archive,
+		authService: authService,
+	}
+}
+
+// syncState - состояние обеих сторон; ключи карт - имена в нижнем регистре
+type syncState struct {
+	dbUsers        map[string]classosbackend.User
+	dbGroups       map[string]classosbackend.Group
+	archivedUsers  map[string]bool
+	archivedGroups map[string]bool
+	adUsers        map[string]ADUser
+	adGroups       map[string]ADGroup
+	// adElsewhere - логины пользователей БД, чьи учётные записи есть в AD вне OU classOS
+	adElsewhere map[string]bool
+}
+
+// Plan строит план сверки, ничего не меняя. report строит план направления db_to_ad
+func (s *SyncService) Plan(direction string) (classosbackend.SyncPlan, error) {
+	if err := classosbackend.ValidateSyncDirection(direction); err != nil {
+		return classosbackend.SyncPlan{}, err
+	}
+
+	plan, _, err := s.plan(direction)
+	return plan, err
+}
+
+func (s *SyncService) plan(direction string) (classosbackend.SyncPlan, syncState, error) {
+	state, err := loadSyncState(s.userRepo, s.groupRepo, s.directory)
+	if err != nil {
+		return classosbackend.SyncPlan{}, state, err
+	}
+
+	var changes []classosbackend.SyncChange
+	if direction == classosbackend.SyncADToDB {
+		changes = planADToDB(state)
+	} else {
+		changes = planDBToAD(state)
+	}
+
+	plan := classosbackend.SyncPlan{
+		Direction:   direction,
+		GeneratedAt: time.Now(),
+		Changes:     changes,
+	}
+	summarize(&plan)
+
+	plan.ID, err = planID(direction, changes)
+	if err != nil {
+		return classosbackend.SyncPlan{}, state, err
+	}
+	plan.ConfirmationRequired = direction != classosbackend.SyncReport && destructiveChanges(direction, changes) > syncConfirmLimit
+
+	return plan, state, nil
+}
+
+// Apply заново строит план и применяет его, только если он совпадает с планом input.PlanID,
+// который видел администратор. Изменения применяются по порядку; ошибка одного изменения не
+// останавливает остальные. Конфликты пропускаются, report не применяется. Одновременно
+// применяется только один план
+func (s *SyncService) Apply(input classosbackend.SyncInput) (classosbackend.SyncPlan, error) {
+	if err := input.Validate(); err != nil {
+		return classosbackend.SyncPlan{}, err
+	}
+
+	if input.Direction == classosbackend.SyncReport {
+		plan, _, err := s.plan(input.Direction)
+		return plan, err
+	}
+
+	// Блокировка держится до отката транзакции в конце Apply
+	lock, err := s.journal.BeginTransaction()
+	if err != nil {
+		return classosbackend.SyncPlan{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer lock.Rollback()
+
+	locked, err := s.journal.TryLockWithTx(lock, syncLockKey)
+	if err != nil {
+		return classosbackend.SyncPlan{}, fmt.Errorf("failed to lock sync: %w", err)
+	}
+	if !locked {
+		return classosbackend.SyncPlan{}, ErrSyncInProgress
+	}
+
+	pending, err := s.journal.CountByStatus(classosbackend.DirectoryOpPending)
+	if err != nil {
+		return classosbackend.SyncPlan{}, fmt.Errorf("failed to count pending directory operations: %w", err)
+	}
+	if pending > 0 {
+		return classosbackend.SyncPlan{}, fmt.Errorf("%w: %d operations, retry after they are applied", ErrSyncPending, pending)
+	}
+
+	plan, state, err := s.plan(input.Direction)
+	if err != nil {
+		return plan, err
+	}
+	if plan.ID != input.PlanID {
+		return plan, ErrSyncPlanChanged
+	}
+	if plan.ConfirmationRequired && !input.Confirm {
+		return plan, fmt.Errorf("%w: it archives or re-creates more than %d accounts", ErrSyncConfirmationRequired, syncConfirmLimit)
+	}
+
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+		if change.Action == classosbackend.SyncActionConflict {
+			change.Status = classosbackend.SyncStatusSkipped
+			continue
+		}
+
+		if input.Direction == classosbackend.SyncADToDB {
+			err = s.applyToDB(state, change)
+		} else {
+			err = s.applyToAD(change)
+		}
+
+		if err != nil {
+			change.Status = classosbackend.SyncStatusFailed
+			change.Error = err.Error()
+			continue
+		}
+		change.Status = classosbackend.SyncStatusApplied
+	}
+
+	s.outbox.Notify()
+
+	plan.Applied = true
+	summarize(&plan)
+
+	return plan, nil
+}
+
+// loadSyncState читает пользователей и группы БД и OU classOS в каталоге. Отсутствующая OU -
+// ошибка: иначе все объекты БД выглядели бы удалёнными из AD
+func loadSyncState(userRepo repository.User, groupRepo repository.Group, directory Directory) (syncState, error) {
+	state := syncState{
+		dbUsers:        make(map[string]classosbackend.User),
+		dbGroups:       make(map[string]classosbackend.Group),
+		archivedUsers:  make(map[string]bool),
+		archivedGroups: make(map[string]bool),
+		adUsers:        make(map[string]ADUser),
+		adGroups:       make(map[string]ADGroup),
+		adElsewhere:    make(map[string]bool),
+	}
+
+	adUsers, err := directory.ListUsers()
+	if err != nil {
+		return state, err
+	}
+	for _, user := range adUsers {
+		state.adUsers[strings.ToLower(user.SamAccountName)] = user
+	}
+
+	adGroups, err := directory.ListGroups()
+	if err != nil {
+		return state, err
+	}
+	for _, group := range adGroups {
+		state.adGroups[strings.ToLower(group.Name)] = group
+	}
+
+	users, err := userRepo.GetAll(0)
+	if err != nil {
+		return state, fmt.Errorf("failed to get users: %w", err)
+	}
+	for _, user := range users {
+		if user.Username != superAdminUsername {
+			state.dbUsers[strings.ToLower(user.Username)] = user
+		}
+	}
+
+	groups, err := groupRepo.GetAll(0)
+	if err != nil {
+		return state, fmt.Errorf("failed to get groups: %w", err)
+	}
+	for _, group := range groups {
+		state.dbGroups[strings.ToLower(group.Name)] = group
+	}
+
+	archivedUsers, err := userRepo.GetArchived()
+	if err != nil {
+		return state, fmt.Errorf("failed to get archived users: %w", err)
+	}
+	for _, user := range archivedUsers {
+		state.archivedUsers[strings.ToLower(user.Username)] = true
+	}
+
+	archivedGroups, err := groupRepo.GetArchived()
+	if err != nil {
+		return state, fmt.Errorf("failed to get archived groups: %w", err)
+	}
+	for _, group := range archivedGroups {
+		state.archivedGroups[strings.ToLower(group.Name)] = true
+	}
+
+	var missing []string
+	for key, user := range state.dbUsers {
+		if _, ok := state.adUsers[key]; !ok {
+			missing = append(missing, user.Username)
+		}
+	}
+	if len(missing) > 0 {
+		state.adElsewhere, err = directory.ExistingUsers(missing)
+		if err != nil {
+			return state, err
+		}
+	}
+
+	return state, nil
+}
+
+// planDBToAD приводит AD к БД. Изменения упорядочены так, как их должна применить очередь:
+// группы создаются раньше пользователей, а удаляются после них
+func planDBToAD(state syncState) []classosbackend.SyncChange {
+	var groupCreates, userChanges, memberships, groupDeletes []classosbackend.SyncChange
+
+	for _, key := range sortedKeys(state.dbGroups) {
+		if _, ok := state.adGroups[key]; !ok {
+			groupCreates = append(groupCreates, classosbackend.SyncChange{
+				Object: classosbackend.SyncObjectGroup,
+				Action: classosbackend.SyncActionCreate,
+				Name:   state.dbGroups[key].Name,
+			})
+		}
+	}
+
+	for _, key := range sortedKeys(state.adGroups) {
+		if _, ok := state.dbGroups[key]; ok {
+			continue
+		}
+
+		change := classosbackend.SyncChange{
+			Object: classosbackend.SyncObjectGroup,
+			Action: classosbackend.SyncActionDelete,
+			Name:   state.adGroups[key].Name,
+			Reason: "group is moved to the archive OU",
+		}
+		if state.archivedGroups[key] {
+			change.Action = classosbackend.SyncActionConflict
+			change.Reason = "group is archived in DB but is still in the groups OU"
+		}
+		groupDeletes = append(groupDeletes, change)
+	}
+
+	for _, key := range sortedKeys(state.dbUsers) {
+		user := state.dbUsers[key]
+		adUser, ok := state.adUsers[key]
+		if !ok {
+			change := classosbackend.SyncChange{
+				Object: classosbackend.SyncObjectUser,
+				Action: classosbackend.SyncActionCreate,
+				Name:   user.Username,
+				Group:  groupName(user),
+				Reason: "a new password is generated, the user must change it at next login",
+			}
+			switch {
+			case state.adElsewhere[key]:
+				change.Action = classosbackend.SyncActionConflict
+				change.Reason = "account exists in AD outside the users OU"
+			case user.Role != classosbackend.RoleClient:
+				change.Action = classosbackend.SyncActionConflict
+				change.Reason = errSyncStaff.Error()
+			}
+			userChanges = append(userChanges, change)
+			continue
+		}
+
+		if fields := userFieldChanges(user, adUser); len(fields) > 0 {
+			userChanges = append(userChanges, classosbackend.SyncChange{
+				Object: classosbackend.SyncObjectUser,
+				Action: classosbackend.SyncActionUpdate,
+				Name:   user.Username,
+				Fields: fields,
+			})
+		}
+
+		adMember := make(map[string]bool, len(adUser.Groups))
+		for _, name := range adUser.Groups {
+			adMember[strings.ToLower(name)] = true
+		}
+
+		dbGroup := groupName(user)
+		if dbGroup != "" && !adMember[strings.ToLower(dbGroup)] {
+			memberships = append(memberships, classosbackend.SyncChange{
+				Object: classosbackend.SyncObjectMembership,
+				Action: classosbackend.SyncActionCreate,
+				Name:   user.Username,
+				Group:  dbGroup,
+			})
+		}
+
+		for _, name := range adUser.Groups {
+			if !strings.EqualFold(name, dbGroup) {
+				memberships = append(memberships, classosbackend.SyncChange{
+					Object: classosbackend.SyncObjectMembership,
+					Action: classosbackend.SyncActionDelete,
+					Name:   user.Username,
+					Group:  name,
+				})
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(state.adUsers) {
+		if _, ok := state.dbUsers[key]; ok || key == superAdminUsername {
+			continue
+		}
+
+		adUser := state.adUsers[key]
+		change := classosbackend.SyncChange{
+			Object: classosbackend.SyncObjectUser,
+			Action: classosbackend.SyncActionDelete,
+			Name:   adUser.SamAccountName,
+			Reason: "account is disabled and moved to the archive OU",
+		}
+		if state.archivedUsers[key] {
+			change.Action = classosbackend.SyncActionConflict
+			change.Reason = "user is archived in DB but is still in the users OU"
+		}
+		userChanges = append(userChanges, change)
+	}
+
+	changes := append(groupCreates, userChanges...)
+	changes = append(changes, memberships...)
+	return append(changes, groupDeletes...)
+}
+
+// planADToDB приводит БД к AD. В БД пользователь состоит ровно в одной группе, поэтому
+// пользователь AD без групп classOS или с несколькими группами без группы из БД - конфликт
+func planADToDB(state syncState) []classosbackend.SyncChange {
+	var groupCreates, userChanges, groupDeletes []classosbackend.SyncChange
+
+	// groups - группы, которые будут в БД после применения плана
+	groups := make(map[string]bool, len(state.dbGroups))
+	for key := range state.dbGroups {
+		groups[key] = true
+	}
+
+	for _, key := range sortedKeys(state.adGroups) {
+		if _, ok := state.dbGroups[key]; ok {
+			continue
+		}
+
+		change := classosbackend.SyncChange{
+			Object: classosbackend.SyncObjectGroup,
+			Action: classosbackend.SyncActionCreate,
+			Name:   state.adGroups[key].Name,
+		}
+		if state.archivedGroups[key] {
+			change.Action = classosbackend.SyncActionConflict
+			change.Reason = "group is archived in DB, restore it or delete it from AD"
+		} else {
+			groups[key] = true
+		}
+		groupCreates = append(groupCreates, change)
+	}
+
+	for _, key := range sortedKeys(state.dbGroups) {
+		if _, ok := state.adGroups[key]; !ok {
+			groupDeletes = append(groupDeletes, classosbackend.SyncChange{
+				Object: classosbackend.SyncObjectGroup,
+				Action: classosbackend.SyncActionDelete,
+				Name:   state.dbGroups[key].Name,
+				Reason: "group is archived together with its students",
+			})
+		}
+	}
+
+	for _, key := range sortedKeys(state.adUsers) {
+		adUser := state.adUsers[key]
+		if key == superAdminUsername {
+			continue
+		}
+
+		var adGroups []string
+		for _, name := range adUser.Groups {
+			if groups[strings.ToLower(name)] {
+				adGroups = append(adGroups, name)
+			}
+		}
+
+		user, ok := state.dbUsers[key]
+		if !ok {
+			change := classosbackend.SyncChange{
+				Object: classosbackend.SyncObjectUser,
+				Action: classosbackend.SyncActionCreate,
+				Name:   adUser.SamAccountName,
+				Reason: "created as a student, the password stays in AD",
+			}
+			switch {
+			case state.archivedUsers[key]:
+				change.Action = classosbackend.SyncActionConflict
+				change.Reason = "user is archived in DB, restore it or delete it from AD"
+			case len(adGroups) != 1:
+				change.Action = classosbackend.SyncActionConflict
+				change.Reason = fmt.Sprintf("user must be a member of exactly one classOS group, found %d", len(adGroups))
+			default:
+				change.Group = adGroups[0]
+			}
+			userChanges = append(userChanges, change)
+			continue
+		}
+
+		if fields := userFieldChanges(user, adUser); len(fields) > 0 {
+			userChanges = append(userChanges, classosbackend.SyncChange{
+				Object: classosbackend.SyncObjectUser,
+				Action: classosbackend.SyncActionUpdate,
+				Name:   user.Username,
+				Fields: fields,
+			})
+		}
+
+		dbGroup := groupName(user)
+		member := false
+		for _, name := range adGroups {
+			member = member || strings.EqualFold(name, dbGroup)
+		}
+
+		switch {
+		case member:
+		case len(adGroups) == 1:
+			userChanges = append(userChanges, classosbackend.SyncChange{
+				Object: classosbackend.SyncObjectMembership,
+				Action: classosbackend.SyncActionUpdate,
+				Name:   user.Username,
+				Group:  adGroups[0],
+				Fields: []classosbackend.SyncFieldChange{{Field: "group", DB: dbGroup, AD: adGroups[0]}},
+			})
+		default:
+			userChanges = append(userChanges, classosbackend.SyncChange{
+				Object: classosbackend.SyncObjectMembership,
+				Action: classosbackend.SyncActionConflict,
+				Name:   user.Username,
+				Group:  dbGroup,
+				Reason: fmt.Sprintf("user must be a member of exactly one classOS group, found %d", len(adGroups)),
+			})
+		}
+	}
+
+	for _, key := range sortedKeys(state.dbUsers) {
+		if _, ok := state.adUsers[key]; ok {
+			continue
+		}
+
+		user := state.dbUsers[key]
+		change := classosbackend.SyncChange{
+			Object: classosbackend.SyncObjectUser,
+			Action: classosbackend.SyncActionDelete,
+			Name:   user.Username,
+			Reason: "user is archived",
+		}
+		switch {
+		case state.adElsewhere[key]:
+			change.Action = classosbackend.SyncActionConflict
+			change.Reason = "account exists in AD outside the users OU"
+		case user.Role != classosbackend.RoleClient:
+			change.Action = classosbackend.SyncActionConflict
+			change.Reason = errSyncStaff.Error()
+		}
+		userChanges = append(userChanges, change)
+	}
+
+	changes := append(groupCreates, userChanges...)
+	return append(changes, groupDeletes...)
+}
+
+// applyToAD ставит изменение в очередь каталога. Создание пользователя в одной транзакции
+// с очередью меняет пароль в БД на сгенерированный
+func (s *SyncService) applyToAD(change *classosbackend.SyncChange) error {
+	switch change.Object + "/" + change.Action {
+	case classosbackend.SyncObjectGroup + "/" + classosbackend.SyncActionCreate:
+		return s.enqueue(classosbackend.DirectoryOpCreateGroup, classosbackend.DirectoryOperationPayload{Group: change.Name})
+	case classosbackend.SyncObjectGroup + "/" + classosbackend.SyncActionDelete:
+		return s.enqueue(classosbackend.DirectoryOpArchiveGroup, classosbackend.DirectoryOperationPayload{Group: change.Name})
+	case classosbackend.SyncObjectUser + "/" + classosbackend.SyncActionCreate:
+		return s.createADUser(change)
+	case classosbackend.SyncObjectUser + "/" + classosbackend.SyncActionDelete:
+		return s.enqueue(classosbackend.DirectoryOpArchiveUser, classosbackend.DirectoryOperationPayload{Username: change.Name})
+	case classosbackend.SyncObjectUser + "/" + classosbackend.SyncActionUpdate:
+		for _, field := range change.Fields {
+			var err error
+			switch field.Field {
+			case "name":
+				err = s.enqueue(classosbackend.DirectoryOpUpdateUser, classosbackend.DirectoryOperationPayload{
+					Username:    change.Name,
+					DisplayName: field.DB,
+				})
+			case "enabled":
+				enabled := field.DB == "true"
+				err = s.enqueue(classosbackend.DirectoryOpSetUserEnabled, classosbackend.DirectoryOperationPayload{
+					Username: change.Name,
+					Enabled:  &enabled,
+				})
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case classosbackend.SyncObjectMembership + "/" + classosbackend.SyncActionCreate:
+		return s.enqueue(classosbackend.DirectoryOpAddUserToGroup, classosbackend.DirectoryOperationPayload{
+			Username: change.Name,
+			Group:    change.Group,
+		})
+	case classosbackend.SyncObjectMembership + "/" + classosbackend.SyncActionDelete:
+		return s.enqueue(classosbackend.DirectoryOpRemoveUserFromGroup, classosbackend.DirectoryOperationPayload{
+			Username: change.Name,
+			Group:    change.Group,
+		})
+	default:
+		return fmt.Errorf("%w: unsupported change %s %s", ErrInvalidSyncChange, change.Action, change.Object)
+	}
+}
+
+// applyToDB меняет БД; архивация дополнительно ставит в очередь архивацию в AD, которая
+// для отсутствующих там объектов ничего не делает
+func (s *SyncService) applyToDB(state syncState, change *classosbackend.SyncChange) error {
+	switch change.Object + "/" + change.Action {
+	case classosbackend.SyncObjectGroup + "/" + classosbackend.SyncActionCreate:
+		_, err := s.groupRepo.Create(0, classosbackend.Group{Name: change.Name})
+		return err
+	case classosbackend.SyncObjectGroup + "/" + classosbackend.SyncActionDelete:
+		group, err := s.groupRepo.GetByName(change.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get group: %w", err)
+		}
+		return s.archive.ArchiveGroup(0, int(group.ID))
+	case classosbackend.SyncObjectUser + "/" + classosbackend.SyncActionCreate:
+		return s.createDBUser(state.adUsers[strings.ToLower(change.Name)], change.Group)
+	case classosbackend.SyncObjectUser + "/" + classosbackend.SyncActionDelete:
+		user, err := s.userRepo.GetByUsername(change.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if user.Role != classosbackend.RoleClient {
+			return errSyncStaff
+		}
+		return s.archive.ArchiveUser(0, user.ID)
+	case classosbackend.SyncObjectUser + "/" + classosbackend.SyncActionUpdate:
+		user, err := s.userRepo.GetByUsername(change.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		var input classosbackend.UpdateUserInput
+		for _, field := range change.Fields {
+			switch field.Field {
+			case "name":
+				name := field.AD
+				input.Name = &name
+			case "enabled":
+				enabled := field.AD == "true"
+				input.Enabled = &enabled
+			}
+		}
+		// Отключение в AD отзывает токены пользователя
+		defer s.authService.InvalidateTokens(user.ID)
+		return s.userRepo.Update(0, user.ID, input)
+	case classosbackend.SyncObjectMembership + "/" + classosbackend.SyncActionUpdate:
+		user, err := s.userRepo.GetByUsername(change.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		group, err := s.groupRepo.GetByName(change.Group)
+		if err != nil {
+			return fmt.Errorf("failed to get group: %w", err)
+		}
+
+		groupId := int(group.ID)
+		return s.userRepo.Update(0, user.ID, classosbackend.UpdateUserInput{GroupID: &groupId})
+	default:
+		return fmt.Errorf("%w: unsupported change %s %s", ErrInvalidSyncChange, change.Action, change.Object)
+	}
+}
+
+// createADUser генерирует пароль: пароль из БД хранится только в виде хеша и в AD не переносится
+func (s *SyncService) createADUser(change *classosbackend.SyncChange) error {
+	user, err := s.userRepo.GetByUsername(change.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.Role != classosbackend.RoleClient {
+		return errSyncStaff
+	}
+
+	password, err := GeneratePassword(user.Username)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.userRepo.BeginTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	hash := s.authService.GeneratePasswordHash(password)
+	mustChange := true
+	err = s.userRepo.UpdateWithTx(tx, 0, user.ID, classosbackend.UpdateUserInput{Password: &hash, MustChangePassword: &mustChange})
+	if err != nil {
+		return fmt.Errorf("failed to update password in DB: %w", err)
+	}
+
+	err = s.outbox.EnqueueWithTx(tx, classosbackend.DirectoryOpCreateUser, classosbackend.DirectoryOperationPayload{
+		Username:    user.Username,
+		DisplayName: user.Name,
+		Group:       groupName(user),
+		Enabled:     &user.Enabled,
+	}, password)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.authService.InvalidateTokens(user.ID)
+
+	change.Password = password
+	return nil
+}
+
+// createDBUser создаёт ученика со случайным паролем, которым нельзя войти: пароль знает только AD
+func (s *SyncService) createDBUser(adUser ADUser, groupName string) error {
+	group, err := s.groupRepo.GetByName(groupName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrGroupNotFound
+		}
+		return fmt.Errorf("failed to get group: %w", err)
+	}
+
+	password, err := GeneratePassword(adUser.SamAccountName)
+	if err != nil {
+		return err
+	}
+
+	name := adUser.DisplayName
+	if name == "" {
+		name = adUser.SamAccountName
+	}
+
+	userId, err := s.userRepo.Create(int(group.ID), classosbackend.User{
+		Name:     name,
+		Username: adUser.SamAccountName,
+		Password: s.authService.GeneratePasswordHash(password),
+		Role:     classosbackend.RoleClient,
+	})
+	if err != nil || adUser.Enabled {
+		return err
+	}
+
+	return s.userRepo.Update(0, userId, classosbackend.UpdateUserInput{Enabled: &adUser.Enabled})
+}
+
+func (s *SyncService) enqueue(operation string, payload classosbackend.DirectoryOperationPayload) error {
+	_, err := s.outbox.Add(operation, payload, "")
+	return err
+}
+
+// userFieldChanges сравнивает отображаемое имя и включённость учётной записи
+func userFieldChanges(user classosbackend.User, adUser ADUser) []classosbackend.SyncFieldChange {
+	var fields []classosbackend.SyncFieldChange
+	if user.Name != adUser.DisplayName {
+		fields = append(fields, classosbackend.SyncFieldChange{Field: "name", DB: user.Name, AD: adUser.DisplayName})
+	}
+	if user.Enabled != adUser.Enabled {
+		fields = append(fields, classosbackend.SyncFieldChange{
+			Field: "enabled",
+			DB:    strconv.FormatBool(user.Enabled),
+			AD:    strconv.FormatBool(adUser.Enabled),
+		})
+	}
+
+	return fields
+}
+
+func groupName(user classosbackend.User) string {
+	if user.GroupName == nil {
+		return ""
+	}
+
+	return *user.GroupName
+}
+
+func summarize(plan *classosbackend.SyncPlan) {
+	summary := classosbackend.SyncSummary{}
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case classosbackend.SyncActionCreate:
+			summary.Create++
+		case classosbackend.SyncActionUpdate:
+			summary.Update++
+		case classosbackend.SyncActionDelete:
+			summary.Delete++
+		case classosbackend.SyncActionConflict:
+			summary.Conflict++
+		}
+
+		switch change.Status {
+		case classosbackend.SyncStatusApplied:
+			summary.Applied++
+		case classosbackend.SyncStatusFailed:
+			summary.Failed++
+		case classosbackend.SyncStatusSkipped:
+			summary.Skipped++
+		}
+	}
+
+	plan.Summary = summary
+	if plan.Changes == nil {
+		plan.Changes = make([]classosbackend.SyncChange, 0)
+	}
+}
+
+// planID - хеш направления и изменений: одинаковые планы получают одинаковый id, поэтому
+// Apply может проверить, что применяет тот же план, который видел администратор
+func planID(direction string, changes []classosbackend.SyncChange) (string, error) {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode sync plan: %w", err)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(direction))
+	hash.Write([]byte{0})
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil))[:32], nil
+}
+
+// destructiveChanges считает архивации пользователей и групп, а при db_to_ad ещё и
+// пересоздание пользователей в AD с новым паролем
+func destructiveChanges(direction string, changes []classosbackend.SyncChange) int {
+	count := 0
+	for _, change := range changes {
+		switch {
+		case change.Action == classosbackend.SyncActionDelete && change.Object != classosbackend.SyncObjectMembership:
+			count++
+		case change.Action == classosbackend.SyncActionCreate && change.Object == classosbackend.SyncObjectUser &&
+			direction == classosbackend.SyncDBToAD:
+			count++
+		}
+	}
+
+	return count
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
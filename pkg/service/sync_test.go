@@ -0,0 +1,217 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+)
+
+// applySync строит план и применяет его с id этого плана
+func applySync(t *testing.T, f *directoryFixture, direction string) classosbackend.SyncPlan {
+	t.Helper()
+
+	plan, err := f.sync.Plan(direction)
+	if err != nil {
+		t.Fatalf("plan %s: %v", direction, err)
+	}
+
+	applied, err := f.sync.Apply(classosbackend.SyncInput{Direction: direction, PlanID: plan.ID})
+	if err != nil {
+		t.Fatalf("apply %s: %v", direction, err)
+	}
+
+	return applied
+}
+
+func findChange(plan classosbackend.SyncPlan, object, name string) (classosbackend.SyncChange, bool) {
+	for _, change := range plan.Changes {
+		if change.Object == object && change.Name == name {
+			return change, true
+		}
+	}
+
+	return classosbackend.SyncChange{}, false
+}
+
+func TestSyncDBToAD(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	// Ученик есть только в БД, лишняя учётная запись - только в AD
+	f.store.addUser(t, "petrov", classosbackend.RoleClient, groupId)
+	if err := f.directory.CreateUser(ADUser{SamAccountName: "stranger", DisplayName: "Stranger", Enabled: true}, "Secret123", "7A"); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := applySync(t, f, classosbackend.SyncDBToAD)
+	f.flush(t)
+
+	if plan.Summary.Create != 1 || plan.Summary.Delete != 1 || plan.Summary.Failed != 0 {
+		t.Fatalf("got summary %+v", plan.Summary)
+	}
+	created, _ := findChange(plan, classosbackend.SyncObjectUser, "petrov")
+	if created.Status != classosbackend.SyncStatusApplied || created.Password == "" {
+		t.Fatalf("got change %+v", created)
+	}
+
+	if user, ok := f.adUser(t, "petrov"); !ok || len(user.Groups) != 1 || user.Groups[0] != "7A" {
+		t.Fatalf("got %+v, want petrov in 7A", user)
+	}
+	if _, err := f.directory.Authenticate("petrov", created.Password); err != nil {
+		t.Fatalf("authenticate with generated password: %v", err)
+	}
+	if _, ok := f.adUser(t, "stranger"); ok {
+		t.Fatal("account missing in DB is not archived")
+	}
+
+	if plan, _ := f.sync.Plan(classosbackend.SyncDBToAD); len(plan.Changes) != 0 {
+		t.Fatalf("got %d changes after sync, want none", len(plan.Changes))
+	}
+}
+
+func TestSyncADToDB(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	userId := f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	if err := f.directory.CreateUser(ADUser{SamAccountName: "petrov", DisplayName: "Petr Petrov", Enabled: true}, "Secret123", "7A"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.directory.UpdateUser("ivanov", ADUser{DisplayName: "Ivan Ivanov"}); err != nil {
+		t.Fatal(err)
+	}
+	gone := f.store.addUser(t, "sidorov", classosbackend.RoleClient, groupId)
+
+	plan := applySync(t, f, classosbackend.SyncADToDB)
+	f.flush(t)
+
+	if plan.Summary.Failed != 0 || plan.Summary.Applied != 3 {
+		t.Fatalf("got summary %+v", plan.Summary)
+	}
+	user, err := testUserRepo{store: f.store}.GetByUsername("petrov")
+	if err != nil || user.Name != "Petr Petrov" || user.GroupID == nil || *user.GroupID != groupId {
+		t.Fatalf("got %+v, %v; want petrov in 7A", user, err)
+	}
+	if f.store.users[userId].Name != "Ivan Ivanov" {
+		t.Fatalf("display name is %q", f.store.users[userId].Name)
+	}
+	if f.store.users[gone].ArchivedAt == nil {
+		t.Fatal("user missing in AD is not archived")
+	}
+}
+
+func TestSyncNeverArchivesStaff(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	teacher := f.store.addUser(t, "teacher", classosbackend.RoleTeacher, 0)
+
+	for _, direction := range []string{classosbackend.SyncADToDB, classosbackend.SyncDBToAD} {
+		plan := applySync(t, f, direction)
+
+		change, ok := findChange(plan, classosbackend.SyncObjectUser, "teacher")
+		if !ok || change.Action != classosbackend.SyncActionConflict || change.Status != classosbackend.SyncStatusSkipped {
+			t.Fatalf("%s: got %+v, want skipped conflict", direction, change)
+		}
+	}
+	f.flush(t)
+
+	if f.store.users[teacher].ArchivedAt != nil {
+		t.Fatal("teacher is archived")
+	}
+	if exists, _ := f.directory.UserExists("teacher"); exists {
+		t.Fatal("teacher is re-created in AD")
+	}
+}
+
+func TestSyncApplyRequiresCurrentPlan(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	f.store.addUser(t, "petrov", classosbackend.RoleClient, groupId)
+	plan, err := f.sync.Plan(classosbackend.SyncDBToAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.store.addUser(t, "sidorov", classosbackend.RoleClient, groupId)
+	_, err = f.sync.Apply(classosbackend.SyncInput{Direction: classosbackend.SyncDBToAD, PlanID: plan.ID})
+	if !errors.Is(err, ErrSyncPlanChanged) {
+		t.Fatalf("got %v, want ErrSyncPlanChanged", err)
+	}
+	if len(f.journal.ops) != 2 {
+		t.Fatalf("stale plan queued %d operations", len(f.journal.ops)-2)
+	}
+}
+
+func TestSyncApplyIsExclusive(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	plan, err := f.sync.Plan(classosbackend.SyncDBToAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.journal.locked = true
+	_, err = f.sync.Apply(classosbackend.SyncInput{Direction: classosbackend.SyncDBToAD, PlanID: plan.ID})
+	if !errors.Is(err, ErrSyncInProgress) {
+		t.Fatalf("got %v, want ErrSyncInProgress", err)
+	}
+}
+
+func TestSyncMassArchiveRequiresConfirmation(t *testing.T) {
+	f := newDirectoryFixture(t)
+	groupId := f.createGroup(t, "7A")
+	f.createUser(t, groupId, "ivanov")
+	f.flush(t)
+
+	for i := 0; i <= syncConfirmLimit; i++ {
+		f.store.addUser(t, fmt.Sprintf("gone%d", i), classosbackend.RoleClient, groupId)
+	}
+
+	plan, err := f.sync.Plan(classosbackend.SyncADToDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.ConfirmationRequired {
+		t.Fatalf("plan archiving %d users does not require confirmation", plan.Summary.Delete)
+	}
+
+	input := classosbackend.SyncInput{Direction: classosbackend.SyncADToDB, PlanID: plan.ID}
+	if _, err := f.sync.Apply(input); !errors.Is(err, ErrSyncConfirmationRequired) {
+		t.Fatalf("got %v, want ErrSyncConfirmationRequired", err)
+	}
+
+	input.Confirm = true
+	applied, err := f.sync.Apply(input)
+	if err != nil {
+		t.Fatalf("confirmed apply: %v", err)
+	}
+	if applied.Summary.Applied != syncConfirmLimit+1 {
+		t.Fatalf("got summary %+v", applied.Summary)
+	}
+}
+
+func TestSyncMissingOU(t *testing.T) {
+	f := newDirectoryFixture(t)
+	f.store.addUser(t, "ivanov", classosbackend.RoleClient, 0)
+
+	if _, err := f.sync.Plan(classosbackend.SyncADToDB); !errors.Is(err, ErrADOUNotFound) {
+		t.Fatalf("got %v, want ErrADOUNotFound", err)
+	}
+	if _, err := NewDriftService(f.sync.userRepo, f.sync.groupRepo, f.directory).Drift(); !errors.Is(err, ErrADOUNotFound) {
+		t.Fatalf("drift: got %v, want ErrADOUNotFound", err)
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+// TeacherService закрепляет группы за учителями
+type TeacherService struct {
+	groupRepo repository.Group
+	userRepo  repository.User
+}
+
+func NewTeacherService(groupRepo repository.Group, userRepo repository.User) *TeacherService {
+	return &TeacherService{groupRepo: groupRepo, userRepo: userRepo}
+}
+
+// GetGroups возвращает группы учителя; чужие группы видны только пользователям с доступом ко всем группам
+func (s *TeacherService) GetGroups(checkerId, teacherId int) ([]classosbackend.Group, error) {
+	if checkerId != teacherId {
+		if err := requireAllGroups(s.groupRepo, checkerId); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.checkTeacher(teacherId); err != nil {
+		return nil, err
+	}
+
+	return s.groupRepo.GetTeacherGroups(teacherId)
+}
+
+// SetGroups заменяет список групп учителя и возвращает новый список. checkerId без доступа ко всем
+// группам управляет только учителями, все группы которых доступны ему самому, и назначает только
+// доступные ему группы
+func (s *TeacherService) SetGroups(checkerId, teacherId int, input classosbackend.TeacherGroupsInput) ([]classosbackend.Group, error) {
+	if err := s.checkTeacher(teacherId); err != nil {
+		return nil, err
+	}
+
+	scope, err := resolveScope(s.groupRepo, checkerId)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.groupRepo.GetTeacherGroups(teacherId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get teacher groups: %w", err)
+	}
+	for _, group := range current {
+		if !scope.Allows(int(group.ID)) {
+			return nil, ErrForbidden
+		}
+	}
+
+	for _, groupId := range input.GroupIDs {
+		if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.groupRepo.SetTeacherGroups(teacherId, input.GroupIDs); err != nil {
+		return nil, fmt.Errorf("failed to set teacher groups: %w", err)
+	}
+
+	return s.groupRepo.GetTeacherGroups(teacherId)
+}
+
+func (s *TeacherService) checkTeacher(teacherId int) error {
+	user, err := s.userRepo.GetById(0, teacherId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user.Role != classosbackend.RoleTeacher {
+		return ErrNotTeacher
+	}
+
+	return nil
+}
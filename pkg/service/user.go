@@ -1,9 +1,6 @@
 package service
 
 import (
-	"crypto/sha1"
-	"fmt"
-
 	classosbackend "github.com/rinat0880/classOS_backend"
 	"github.com/rinat0880/classOS_backend/pkg/repository"
 )
@@ -11,50 +8,76 @@ import (
 type UserService struct {
 	repo      repository.User
 	groupRepo repository.Group
+	generator *CredentialGenerator
 }
 
-func NewUserService(repo repository.User, groupRepo repository.Group) *UserService {
-	return &UserService{repo: repo, groupRepo: groupRepo}
+func NewUserService(repo repository.User, groupRepo repository.Group, generator *CredentialGenerator) *UserService {
+	return &UserService{repo: repo, groupRepo: groupRepo, generator: generator}
 }
 
-func (s *UserService) Create(checkerId, groupId int, user classosbackend.User) (int, error) {
-	_, err := s.groupRepo.GetById(checkerId, groupId)
-	if err != nil {
-		return 0, err
+func (s *UserService) Create(checkerId, groupId int, user classosbackend.User) (classosbackend.CreatedUser, error) {
+	if _, err := checkNewUser(s.groupRepo, checkerId, groupId, &user); err != nil {
+		return classosbackend.CreatedUser{}, err
 	}
 
-	user.Password = s.generatePasswordHash(user.Password)
+	generatedPassword, err := s.generator.Fill(&user)
+	if err != nil {
+		return classosbackend.CreatedUser{}, err
+	}
 
-	return s.repo.Create(groupId, user)
-}
+	user.Password = hashPassword(user.Password)
 
+	userId, err := s.repo.Create(groupId, user)
+	if err != nil {
+		return classosbackend.CreatedUser{}, err
+	}
 
-func (s *UserService) generatePasswordHash(password string) string {
-	hash := sha1.New()
-	hash.Write([]byte(password))
-	salt := getSalt()
-	return fmt.Sprintf("%x", hash.Sum([]byte(salt)))
+	return classosbackend.CreatedUser{ID: userId, Username: user.Username, Password: generatedPassword}, nil
 }
 
 func (s *UserService) GetAll(checkerId int) ([]classosbackend.User, error) {
-	return s.repo.GetAll(checkerId)
+	users, err := s.repo.GetAll(checkerId)
+	if err != nil {
+		return nil, err
+	}
+	return filterUsers(s.groupRepo, checkerId, users)
 }
 
 func (s *UserService) GetById(checkerId, user_id int) (classosbackend.User, error) {
-	return s.repo.GetById(checkerId, user_id)
+	return checkUser(s.repo, s.groupRepo, checkerId, user_id)
 }
 
 func (s *UserService) Delete(checkerId, user_id int) error {
+	if _, err := checkModifiableUser(s.repo, s.groupRepo, checkerId, user_id); err != nil {
+		return err
+	}
 	return s.repo.Delete(checkerId, user_id)
 }
 
+func (s *UserService) SetEnabled(checkerId, userId int, enabled bool) error {
+	if _, err := checkEnabledChange(s.repo, s.groupRepo, checkerId, userId, enabled); err != nil {
+		return err
+	}
+
+	return s.repo.Update(checkerId, userId, classosbackend.UpdateUserInput{Enabled: &enabled})
+}
+
 func (s *UserService) Update(checkerId, user_id int, input classosbackend.UpdateUserInput) error {
 	if err := input.Validate(); err != nil {
 		return err
 	}
 
+	user, err := checkActiveUser(s.repo, s.groupRepo, checkerId, user_id)
+	if err != nil {
+		return err
+	}
+
+	if err := checkUserChanges(s.groupRepo, checkerId, user, input); err != nil {
+		return err
+	}
+
 	if input.Password != nil {
-        hashedPassword := s.generatePasswordHash(*input.Password)
+        hashedPassword := hashPassword(*input.Password)
         input.Password = &hashedPassword
     }
 	
@@ -0,0 +1,356 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const minImportPasswordLength = 8
+
+// importColumns - допустимые заголовки столбцов файла импорта
+var importColumns = map[string][]string{
+	"name":     {"name", "full name", "full_name", "display name", "фио", "имя"},
+	"username": {"username", "login", "samaccountname", "логин"},
+	"group":    {"group", "class", "группа", "класс"},
+	"password": {"password", "пароль"},
+}
+
+// importRow - строка файла вместе с паролем и найденной группой; в отчёт попадает только ImportRow.
+// generated отмечает строки без логина: его подбирает CredentialGenerator
+type importRow struct {
+	classosbackend.ImportRow
+	password  string
+	group     classosbackend.Group
+	generated bool
+}
+
+func (r *importRow) fail(status, format string, args ...interface{}) {
+	r.Status = status
+	r.Error = fmt.Sprintf(format, args...)
+}
+
+// UserImportService создаёт пользователей из CSV или XLSX тем же путём, что и POST /api/groups/:id/users
+type UserImportService struct {
+	users     User
+	userRepo  repository.User
+	groupRepo repository.Group
+	directory Directory
+	generator *CredentialGenerator
+}
+
+func NewUserImportService(users User, userRepo repository.User, groupRepo repository.Group, directory Directory,
+	generator *CredentialGenerator) *UserImportService {
+	return &UserImportService{users: users, userRepo: userRepo, groupRepo: groupRepo, directory: directory, generator: generator}
+}
+
+// Import проверяет все строки по БД и AD и, если это не dryRun, создаёт прошедшие проверку.
+// Ошибка одной строки не останавливает импорт; если AD становится недоступен,
+// оставшиеся строки пропускаются, чтобы не получить половину пользователей без учётных записей в AD
+func (s *UserImportService) Import(checkerId int, data []byte, dryRun bool) (classosbackend.ImportReport, error) {
+	records, err := readTable(data)
+	if err != nil {
+		return classosbackend.ImportReport{}, err
+	}
+
+	rows, err := parseImportRows(records)
+	if err != nil {
+		return classosbackend.ImportReport{}, err
+	}
+
+	s.validateLocal(rows)
+	s.validateDB(checkerId, rows)
+	adErr := s.validateAD(rows)
+	if adErr != nil {
+		logrus.WithError(adErr).Warn("import: rows were not checked against AD")
+	}
+	s.generateUsernames(rows, adErr == nil)
+
+	report := classosbackend.ImportReport{DryRun: dryRun, ADChecked: adErr == nil}
+
+	if !dryRun {
+		s.create(checkerId, rows, adErr)
+	}
+
+	report.Rows = make([]classosbackend.ImportRow, 0, len(rows))
+	for _, row := range rows {
+		switch row.Status {
+		case classosbackend.ImportRowValid, classosbackend.ImportRowCreated:
+			report.Succeeded++
+		case classosbackend.ImportRowSkipped:
+			report.Skipped++
+		default:
+			report.Failed++
+		}
+		report.Rows = append(report.Rows, row.ImportRow)
+	}
+	report.Total = len(rows)
+
+	return report, nil
+}
+
+func (s *UserImportService) create(checkerId int, rows []*importRow, adErr error) {
+	unavailable := adErr
+	for _, row := range rows {
+		if row.Status != classosbackend.ImportRowValid {
+			continue
+		}
+
+		if unavailable != nil {
+			row.fail(classosbackend.ImportRowSkipped, "not imported: %s", unavailable.Error())
+			continue
+		}
+
+		groupName := row.group.Name
+		created, err := s.users.Create(checkerId, int(row.group.ID), classosbackend.User{
+			Name:      row.Name,
+			Username:  row.Username,
+			Password:  row.password,
+			Role:      classosbackend.RoleClient,
+			GroupName: &groupName,
+		})
+		if err != nil {
+			row.fail(classosbackend.ImportRowFailed, "%s", err.Error())
+			if isADUnavailable(err) {
+				unavailable = err
+			}
+			continue
+		}
+
+		row.Status = classosbackend.ImportRowCreated
+		row.UserID = created.ID
+		row.Password = created.Password
+	}
+}
+
+// parseImportRows сопоставляет столбцы по заголовку первой строки; пустые строки пропускаются
+func parseImportRows(records []tableRecord) ([]*importRow, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", classosbackend.ErrInvalidImport)
+	}
+
+	columns := make(map[string]int)
+	for i, header := range records[0].fields {
+		header = strings.ToLower(strings.TrimSpace(header))
+		for column, aliases := range importColumns {
+			for _, alias := range aliases {
+				if header == alias {
+					columns[column] = i
+				}
+			}
+		}
+	}
+
+	for _, required := range []string{"name", "group"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: missing %q column", classosbackend.ErrInvalidImport, required)
+		}
+	}
+
+	field := func(record tableRecord, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record.fields) {
+			return ""
+		}
+		return strings.TrimSpace(record.fields[i])
+	}
+
+	rows := make([]*importRow, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := &importRow{
+			ImportRow: classosbackend.ImportRow{
+				Row:      record.line,
+				Name:     field(record, "name"),
+				Username: field(record, "username"),
+				Group:    field(record, "group"),
+				Status:   classosbackend.ImportRowValid,
+			},
+			password: field(record, "password"),
+		}
+
+		if row.Name == "" && row.Username == "" && row.Group == "" && row.password == "" {
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: file has no data rows", classosbackend.ErrInvalidImport)
+	}
+	if len(rows) > classosbackend.MaxImportRows {
+		return nil, fmt.Errorf("%w: at most %d rows per import", classosbackend.ErrInvalidImport, classosbackend.MaxImportRows)
+	}
+
+	return rows, nil
+}
+
+// validateLocal проверяет заполненность полей и повторы логинов внутри файла
+func (s *UserImportService) validateLocal(rows []*importRow) {
+	seen := make(map[string]int)
+	for _, row := range rows {
+		switch {
+		case row.Name == "":
+			row.fail(classosbackend.ImportRowInvalid, "name is required")
+		case row.Group == "":
+			row.fail(classosbackend.ImportRowInvalid, "group is required")
+		case row.password != "" && utf8.RuneCountInString(row.password) < minImportPasswordLength:
+			row.fail(classosbackend.ImportRowInvalid, "password must be at least %d characters", minImportPasswordLength)
+		}
+		if row.Status != classosbackend.ImportRowValid {
+			continue
+		}
+
+		if row.Username == "" {
+			row.generated = true
+			continue
+		}
+
+		if err := classosbackend.ValidateUsername(row.Username); err != nil {
+			row.fail(classosbackend.ImportRowInvalid, "%s", err.Error())
+			continue
+		}
+
+		key := strings.ToLower(row.Username)
+		if line, ok := seen[key]; ok {
+			row.fail(classosbackend.ImportRowInvalid, "username %s is already used in row %d", row.Username, line)
+			continue
+		}
+		seen[key] = row.Row
+	}
+}
+
+// validateDB находит группы и проверяет, что логины свободны и checkerId управляет группами
+func (s *UserImportService) validateDB(checkerId int, rows []*importRow) {
+	type groupResult struct {
+		group classosbackend.Group
+		err   error
+	}
+	groups := make(map[string]groupResult)
+	explicit := make([]*importRow, 0)
+	usernames := make([]string, 0)
+
+	for _, row := range rows {
+		if row.Status != classosbackend.ImportRowValid {
+			continue
+		}
+
+		result, ok := groups[row.Group]
+		if !ok {
+			result.group, result.err = s.groupRepo.GetByName(row.Group)
+			if errors.Is(result.err, sql.ErrNoRows) {
+				result.err = fmt.Errorf("group %s does not exist", row.Group)
+			} else if result.err == nil {
+				result.err = checkGroup(s.groupRepo, checkerId, int(result.group.ID))
+			}
+			groups[row.Group] = result
+		}
+		if result.err != nil {
+			row.fail(classosbackend.ImportRowInvalid, "%s", result.err.Error())
+			continue
+		}
+		row.group = result.group
+
+		if !row.generated {
+			explicit = append(explicit, row)
+			usernames = append(usernames, row.Username)
+		}
+	}
+
+	if len(explicit) == 0 {
+		return
+	}
+
+	taken, err := s.userRepo.ExistingUsernames(usernames)
+	for _, row := range explicit {
+		if err != nil {
+			row.fail(classosbackend.ImportRowInvalid, "failed to check username: %s", err.Error())
+		} else if taken[strings.ToLower(row.Username)] {
+			row.fail(classosbackend.ImportRowInvalid, "username %s already exists", row.Username)
+		}
+	}
+}
+
+// validateAD проверяет занятость логинов и наличие групп в AD. Ошибка означает, что AD недоступен
+func (s *UserImportService) validateAD(rows []*importRow) error {
+	usernames := make([]string, 0, len(rows))
+	groupNames := make([]string, 0)
+	seenGroups := make(map[string]bool)
+	for _, row := range rows {
+		if row.Status != classosbackend.ImportRowValid {
+			continue
+		}
+		if !row.generated {
+			usernames = append(usernames, row.Username)
+		}
+		if !seenGroups[row.group.Name] {
+			seenGroups[row.group.Name] = true
+			groupNames = append(groupNames, row.group.Name)
+		}
+	}
+
+	if len(groupNames) == 0 {
+		return nil
+	}
+
+	takenUsers, err := s.directory.ExistingUsers(usernames)
+	if err != nil {
+		return err
+	}
+
+	existingGroups, err := s.directory.ExistingGroups(groupNames)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if row.Status != classosbackend.ImportRowValid {
+			continue
+		}
+
+		if !row.generated && takenUsers[strings.ToLower(row.Username)] {
+			row.fail(classosbackend.ImportRowInvalid, "username %s already exists in AD", row.Username)
+		} else if !existingGroups[strings.ToLower(row.group.Name)] {
+			row.fail(classosbackend.ImportRowInvalid, "group %s does not exist in AD", row.group.Name)
+		}
+	}
+
+	return nil
+}
+
+// generateUsernames подбирает логины строкам без них. Логины, указанные в файле, считаются занятыми,
+// даже если их строки не прошли проверку. Если AD недоступен, занятость проверяется только по БД
+func (s *UserImportService) generateUsernames(rows []*importRow, checkAD bool) {
+	reserved := make(map[string]bool)
+	for _, row := range rows {
+		if row.Username != "" {
+			reserved[strings.ToLower(row.Username)] = true
+		}
+	}
+
+	generated := make([]*importRow, 0)
+	names := make([]string, 0)
+	for _, row := range rows {
+		if row.Status == classosbackend.ImportRowValid && row.generated {
+			generated = append(generated, row)
+			names = append(names, row.Name)
+		}
+	}
+	if len(generated) == 0 {
+		return
+	}
+
+	usernames, errs := s.generator.Usernames(names, reserved, checkAD)
+	for i, row := range generated {
+		if errs[i] != nil {
+			row.fail(classosbackend.ImportRowInvalid, "%s", errs[i].Error())
+			continue
+		}
+		row.Username = usernames[i]
+	}
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	classosbackend "github.com/rinat0880/classOS_backend"
+	"github.com/rinat0880/classOS_backend/pkg/repository"
+)
+
+var (
+	ErrGroupNotFound          = errors.New("group not found")
+	ErrWhitelistEntryNotFound = errors.New("whitelist entry not found")
+)
+
+// PolicyInvalidator получает уведомления об изменении whitelist, чтобы сбросить кеши
+type PolicyInvalidator interface {
+	Invalidate(groupId int)
+	InvalidateAll()
+}
+
+type WhitelistService struct {
+	repo      repository.Whitelist
+	groupRepo repository.Group
+	policy    PolicyInvalidator
+}
+
+func NewWhitelistService(repo repository.Whitelist, groupRepo repository.Group, policy PolicyInvalidator) *WhitelistService {
+	return &WhitelistService{repo: repo, groupRepo: groupRepo, policy: policy}
+}
+
+func (s *WhitelistService) GetAll(checkerId, groupId int, entrySet string) ([]classosbackend.WhitelistEntry, error) {
+	if entrySet != "" {
+		if err := classosbackend.ValidateEntrySet(entrySet); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetAll(checkerId, groupId, entrySet)
+}
+
+func (s *WhitelistService) Add(checkerId, groupId int, input classosbackend.WhitelistInput) ([]classosbackend.WhitelistEntry, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	entrySet, err := input.Set()
+	if err != nil {
+		return nil, err
+	}
+
+	action, err := input.EntryAction()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := input.Normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+		return nil, err
+	}
+
+	defer s.policy.Invalidate(groupId)
+	return s.repo.Add(checkerId, groupId, entrySet, action, values)
+}
+
+func (s *WhitelistService) Delete(checkerId, groupId int, entryId int64) error {
+	if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+		return err
+	}
+
+	defer s.policy.Invalidate(groupId)
+	err := s.repo.Delete(checkerId, groupId, entryId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWhitelistEntryNotFound
+	}
+
+	return err
+}
+
+func (s *WhitelistService) DeleteValues(checkerId, groupId int, input classosbackend.WhitelistInput) (int64, error) {
+	if err := input.Validate(); err != nil {
+		return 0, err
+	}
+
+	entrySet, err := input.Set()
+	if err != nil {
+		return 0, err
+	}
+
+	values, err := input.Normalized()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+		return 0, err
+	}
+
+	defer s.policy.Invalidate(groupId)
+	return s.repo.DeleteValues(checkerId, groupId, entrySet, values)
+}
+
+// Replace полностью заменяет записи группы с заданным action в наборе; пустой список очищает их
+func (s *WhitelistService) Replace(checkerId, groupId int, input classosbackend.WhitelistInput) ([]classosbackend.WhitelistEntry, error) {
+	entrySet, err := input.Set()
+	if err != nil {
+		return nil, err
+	}
+
+	action, err := input.EntryAction()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := input.Normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkGroup(s.groupRepo, checkerId, groupId); err != nil {
+		return nil, err
+	}
+
+	defer s.policy.Invalidate(groupId)
+	return s.repo.Replace(checkerId, groupId, entrySet, action, values)
+}
+
+func (s *WhitelistService) GetGlobal() ([]classosbackend.GlobalWhitelistEntry, error) {
+	return s.repo.GetGlobal()
+}
+
+func (s *WhitelistService) AddGlobal(input classosbackend.WhitelistInput) ([]classosbackend.GlobalWhitelistEntry, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	action, err := input.EntryAction()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := input.Normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.policy.InvalidateAll()
+	return s.repo.AddGlobal(action, values)
+}
+
+func (s *WhitelistService) DeleteGlobal(entryId int64) error {
+	defer s.policy.InvalidateAll()
+	err := s.repo.DeleteGlobal(entryId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWhitelistEntryNotFound
+	}
+
+	return err
+}
+
+func (s *WhitelistService) DeleteGlobalValues(input classosbackend.WhitelistInput) (int64, error) {
+	if err := input.Validate(); err != nil {
+		return 0, err
+	}
+
+	values, err := input.Normalized()
+	if err != nil {
+		return 0, err
+	}
+
+	defer s.policy.InvalidateAll()
+	return s.repo.DeleteGlobalValues(values)
+}
+
+func (s *WhitelistService) ReplaceGlobal(input classosbackend.WhitelistInput) ([]classosbackend.GlobalWhitelistEntry, error) {
+	action, err := input.EntryAction()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := input.Normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.policy.InvalidateAll()
+	return s.repo.ReplaceGlobal(action, values)
+}
+
+// checkGroup проверяет, что группа существует и checkerId может ею управлять
+func checkGroup(groupRepo repository.Group, checkerId, groupId int) error {
+	scope, err := resolveScope(groupRepo, checkerId)
+	if err != nil {
+		return err
+	}
+
+	if !scope.Allows(groupId) {
+		return ErrForbidden
+	}
+
+	if _, err := groupRepo.GetById(checkerId, groupId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrGroupNotFound
+		}
+		return fmt.Errorf("failed to get group: %w", err)
+	}
+
+	return nil
+}
+
+// resolveWhitelist объединяет глобальный whitelist с набором записей группы.
+// Если значение есть в обоих списках, оно отображается как запись группы
+func resolveWhitelist(repo repository.Whitelist, groupId int, entrySet string) ([]classosbackend.ResolvedWhitelistEntry, error) {
+	global, err := repo.GetGlobal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get global whitelist: %w", err)
+	}
+
+	// groupId 0 - пользователь без группы, для него действует только глобальный whitelist
+	var own []classosbackend.WhitelistEntry
+	if groupId != 0 {
+		own, err = repo.GetAll(0, groupId, entrySet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get group whitelist: %w", err)
+		}
+	}
+
+	ownValues := make(map[string]struct{}, len(own))
+	for _, entry := range own {
+		ownValues[entry.Value] = struct{}{}
+	}
+
+	resolved := make([]classosbackend.ResolvedWhitelistEntry, 0, len(global)+len(own))
+	for _, entry := range global {
+		if _, ok := ownValues[entry.Value]; ok {
+			continue
+		}
+		resolved = append(resolved, classosbackend.ResolvedWhitelistEntry{
+			ID:     entry.ID,
+			Value:  entry.Value,
+			Source: classosbackend.WhitelistSourceGlobal,
+			Action: entry.Action,
+		})
+	}
+
+	for _, entry := range own {
+		resolved = append(resolved, classosbackend.ResolvedWhitelistEntry{
+			ID:     entry.ID,
+			Value:  entry.Value,
+			Source: classosbackend.WhitelistSourceGroup,
+			Action: entry.Action,
+		})
+	}
+
+	sort.Slice(resolved, func(i, j int) bool {
+		return resolved[i].Value < resolved[j].Value
+	})
+
+	return resolved, nil
+}
@@ -0,0 +1,36 @@
+package classosbackend
+
+import "time"
+
+type PolicyCheckInput struct {
+	UserID   int       `form:"user_id"`
+	Username string    `form:"username"`
+	URL      string    `form:"url" binding:"required"`
+	At       time.Time `form:"at" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// PolicyDecision - результат проверки доступа пользователя к URL
+type PolicyDecision struct {
+	Allowed  bool                    `json:"allowed"`
+	UserID   int                     `json:"user_id"`
+	GroupID  int                     `json:"group_id,omitempty"`
+	EntrySet string                  `json:"entry_set,omitempty"`
+	Host     string                  `json:"host"`
+	Path     string                  `json:"path"`
+	Matched  *ResolvedWhitelistEntry `json:"matched,omitempty"`
+	Reason   string                  `json:"reason"`
+}
+
+const (
+	ExportFormatSquid   = "squid"
+	ExportFormatDnsmasq = "dnsmasq"
+	ExportFormatPAC     = "pac"
+	ExportFormatHosts   = "hosts"
+	ExportFormatJSON    = "json"
+)
+
+type PolicyExport struct {
+	ContentType string
+	ETag        string
+	Body        []byte
+}
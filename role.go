@@ -0,0 +1,135 @@
+package classosbackend
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+const (
+	PermissionUsersRead            = "users.read"
+	PermissionUsersWrite           = "users.write"
+	PermissionGroupsRead           = "groups.read"
+	PermissionGroupsManage         = "groups.manage"
+	PermissionGroupsAll            = "groups.all"
+	PermissionWhitelistRead        = "whitelist.read"
+	PermissionWhitelistEdit        = "whitelist.edit"
+	PermissionWhitelistGlobal      = "whitelist.global"
+	PermissionPolicyRead           = "policy.read"
+	PermissionAccessRequestsCreate = "access_requests.create"
+	PermissionAccessRequestsDecide = "access_requests.decide"
+	PermissionADSync               = "ad.sync"
+	PermissionSettingsRead         = "settings.read"
+	PermissionSettingsWrite        = "settings.write"
+	PermissionTeachersManage       = "teachers.manage"
+	PermissionRolesManage          = "roles.manage"
+)
+
+// PermissionDefinition описывает право, которое можно включить в роль
+type PermissionDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+var permissionDefinitions = map[string]string{
+	PermissionUsersRead:            "View users of accessible groups",
+	PermissionUsersWrite:           "Create, edit and delete users of accessible groups",
+	PermissionGroupsRead:           "View accessible groups",
+	PermissionGroupsManage:         "Create, rename and delete groups",
+	PermissionGroupsAll:            "Access every group instead of only the assigned ones",
+	PermissionWhitelistRead:        "View whitelists, schedules and global whitelist",
+	PermissionWhitelistEdit:        "Edit whitelists and schedules of accessible groups",
+	PermissionWhitelistGlobal:      "Edit the global whitelist shared by all groups",
+	PermissionPolicyRead:           "Preview, export and check effective policies",
+	PermissionAccessRequestsCreate: "Request access to blocked resources",
+	PermissionAccessRequestsDecide: "Review and decide access requests of accessible groups",
+	PermissionADSync:               "Check the AD connection and run synchronization",
+	PermissionSettingsRead:         "View application settings",
+	PermissionSettingsWrite:        "Change application settings",
+	PermissionTeachersManage:       "Assign groups to teachers",
+	PermissionRolesManage:          "Create and edit roles and their permissions",
+}
+
+// PermissionDefinitions возвращает все известные права, отсортированные по имени
+func PermissionDefinitions() []PermissionDefinition {
+	definitions := make([]PermissionDefinition, 0, len(permissionDefinitions))
+	for name, description := range permissionDefinitions {
+		definitions = append(definitions, PermissionDefinition{Name: name, Description: description})
+	}
+
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Name < definitions[j].Name
+	})
+
+	return definitions
+}
+
+// AllPermissions возвращает имена всех прав; роль admin всегда получает полный набор
+func AllPermissions() []string {
+	names := make([]string, 0, len(permissionDefinitions))
+	for name := range permissionDefinitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NormalizePermissions проверяет, что все права известны, и убирает повторы
+func NormalizePermissions(permissions []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(permissions))
+	normalized := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		permission = strings.TrimSpace(permission)
+		if _, ok := permissionDefinitions[permission]; !ok {
+			return nil, fmt.Errorf("%w: unknown permission %q", ErrInvalidRole, permission)
+		}
+		if _, ok := seen[permission]; ok {
+			continue
+		}
+		seen[permission] = struct{}{}
+		normalized = append(normalized, permission)
+	}
+	sort.Strings(normalized)
+
+	return normalized, nil
+}
+
+// Role - именованный набор прав. Встроенные роли admin, teacher и client нельзя удалить,
+// а права admin нельзя изменить
+type Role struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name" binding:"required"`
+	Description string    `json:"description" db:"description"`
+	Builtin     bool      `json:"builtin" db:"builtin"`
+	Permissions []string  `json:"permissions" db:"-"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,31}$`)
+
+func (r Role) Validate() error {
+	if !roleNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("%w: name must be 2-32 lowercase latin letters, digits or underscores", ErrInvalidRole)
+	}
+
+	return nil
+}
+
+type UpdateRoleInput struct {
+	Description *string   `json:"description"`
+	Permissions *[]string `json:"permissions"`
+}
+
+func (i UpdateRoleInput) Validate() error {
+	if i.Description == nil && i.Permissions == nil {
+		return errors.New("update structure has no values")
+	}
+
+	return nil
+}
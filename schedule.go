@@ -0,0 +1,72 @@
+package classosbackend
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("invalid schedule rule")
+
+// ScheduleRule включает набор записей EntrySet для группы в заданный день недели
+// с StartTime (включительно) до EndTime (не включительно) по времени Timezone
+type ScheduleRule struct {
+	ID        int64     `json:"id" db:"id"`
+	GroupID   int64     `json:"group_id" db:"group_id"`
+	Weekday   int       `json:"weekday" db:"weekday"`
+	StartTime string    `json:"start_time" db:"start_time" binding:"required"`
+	EndTime   string    `json:"end_time" db:"end_time" binding:"required"`
+	Timezone  string    `json:"timezone" db:"timezone" binding:"required"`
+	EntrySet  string    `json:"entry_set" db:"entry_set" binding:"required"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+func (r ScheduleRule) Validate() error {
+	if r.Weekday < 0 || r.Weekday > 6 {
+		return fmt.Errorf("%w: weekday must be between 0 (Sunday) and 6 (Saturday)", ErrInvalidSchedule)
+	}
+
+	start, err := ParseClock(r.StartTime)
+	if err != nil {
+		return fmt.Errorf("%w: start_time: %s", ErrInvalidSchedule, err.Error())
+	}
+
+	end, err := ParseClock(r.EndTime)
+	if err != nil {
+		return fmt.Errorf("%w: end_time: %s", ErrInvalidSchedule, err.Error())
+	}
+
+	if end <= start {
+		return fmt.Errorf("%w: end_time must be after start_time", ErrInvalidSchedule)
+	}
+
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, r.Timezone)
+	}
+
+	if r.EntrySet != EntrySetOpen {
+		if err := ValidateEntrySet(r.EntrySet); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSchedule, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// ParseClock переводит время "HH:MM" в минуты от начала суток; "24:00" допустимо как конец дня
+func ParseClock(value string) (int, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(value, "%02d:%02d", &hours, &minutes); err != nil || len(value) != 5 {
+		return 0, fmt.Errorf("time %q must be in HH:MM format", value)
+	}
+
+	if hours == 24 && minutes == 0 {
+		return 24 * 60, nil
+	}
+
+	if hours < 0 || hours > 23 || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("time %q is out of range", value)
+	}
+
+	return hours*60 + minutes, nil
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS whitelist_group_resource_idx;
+
+ALTER TABLE whitelist DROP COLUMN created_at;
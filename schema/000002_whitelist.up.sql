@@ -0,0 +1,4 @@
+ALTER TABLE whitelist
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT now();
+
+CREATE UNIQUE INDEX whitelist_group_resource_idx ON whitelist (group_id, resource);
@@ -0,0 +1 @@
+DROP TABLE whitelist_global;
@@ -0,0 +1,6 @@
+CREATE TABLE
+    whitelist_global (
+        id SERIAL PRIMARY KEY,
+        resource TEXT NOT NULL UNIQUE,
+        created_at TIMESTAMP NOT NULL DEFAULT now()
+    );
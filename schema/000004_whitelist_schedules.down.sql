@@ -0,0 +1,9 @@
+DROP TABLE whitelist_schedules;
+
+DROP INDEX whitelist_group_set_resource_idx;
+
+DELETE FROM whitelist WHERE entry_set <> 'default';
+
+CREATE UNIQUE INDEX whitelist_group_resource_idx ON whitelist (group_id, resource);
+
+ALTER TABLE whitelist DROP COLUMN entry_set;
@@ -0,0 +1,20 @@
+ALTER TABLE whitelist
+    ADD COLUMN entry_set VARCHAR(64) NOT NULL DEFAULT 'default';
+
+DROP INDEX whitelist_group_resource_idx;
+
+CREATE UNIQUE INDEX whitelist_group_set_resource_idx ON whitelist (group_id, entry_set, resource);
+
+CREATE TABLE
+    whitelist_schedules (
+        id SERIAL PRIMARY KEY,
+        group_id INT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+        weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+        start_time TIME NOT NULL,
+        end_time TIME NOT NULL CHECK (end_time > start_time),
+        timezone TEXT NOT NULL,
+        entry_set VARCHAR(64) NOT NULL,
+        created_at TIMESTAMP NOT NULL DEFAULT now()
+    );
+
+CREATE INDEX whitelist_schedules_group_idx ON whitelist_schedules (group_id);
@@ -0,0 +1,7 @@
+DELETE FROM whitelist WHERE action = 'deny';
+
+DELETE FROM whitelist_global WHERE action = 'deny';
+
+ALTER TABLE whitelist DROP COLUMN action;
+
+ALTER TABLE whitelist_global DROP COLUMN action;
@@ -0,0 +1,5 @@
+ALTER TABLE whitelist
+    ADD COLUMN action VARCHAR(8) NOT NULL DEFAULT 'allow' CHECK (action IN ('allow', 'deny'));
+
+ALTER TABLE whitelist_global
+    ADD COLUMN action VARCHAR(8) NOT NULL DEFAULT 'allow' CHECK (action IN ('allow', 'deny'));
@@ -0,0 +1,22 @@
+CREATE TABLE
+    access_requests (
+        id BIGSERIAL PRIMARY KEY,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        group_id INT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+        url TEXT NOT NULL,
+        resource TEXT NOT NULL,
+        justification TEXT NOT NULL,
+        status VARCHAR(16) NOT NULL DEFAULT 'pending'
+            CHECK (status IN ('pending', 'approved_once', 'approved', 'rejected')),
+        comment TEXT NOT NULL DEFAULT '',
+        decided_by INT REFERENCES users(id) ON DELETE SET NULL,
+        decided_at TIMESTAMPTZ,
+        expires_at TIMESTAMPTZ,
+        created_at TIMESTAMP NOT NULL DEFAULT now()
+    );
+
+CREATE INDEX access_requests_group_status_idx ON access_requests (group_id, status);
+
+CREATE INDEX access_requests_user_idx ON access_requests (user_id, created_at DESC);
+
+CREATE UNIQUE INDEX access_requests_pending_idx ON access_requests (user_id, resource) WHERE status = 'pending';
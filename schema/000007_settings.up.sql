@@ -0,0 +1,7 @@
+CREATE TABLE
+    settings (
+        id SERIAL PRIMARY KEY,
+        key VARCHAR(128) NOT NULL UNIQUE,
+        value TEXT NOT NULL,
+        updated_at TIMESTAMP NOT NULL DEFAULT now()
+    );
@@ -0,0 +1,18 @@
+ALTER TABLE users
+    ADD COLUMN token_version INT NOT NULL DEFAULT 1;
+
+CREATE TABLE
+    refresh_tokens (
+        id BIGSERIAL PRIMARY KEY,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        token_hash CHAR(64) NOT NULL UNIQUE,
+        family VARCHAR(64) NOT NULL,
+        token_version INT NOT NULL,
+        expires_at TIMESTAMPTZ NOT NULL,
+        revoked_at TIMESTAMPTZ,
+        created_at TIMESTAMP NOT NULL DEFAULT now()
+    );
+
+CREATE INDEX refresh_tokens_user_idx ON refresh_tokens (user_id);
+
+CREATE INDEX refresh_tokens_family_idx ON refresh_tokens (family);
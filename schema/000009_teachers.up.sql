@@ -0,0 +1,14 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+
+ALTER TABLE users
+    ADD CONSTRAINT users_role_check CHECK (role IN ('admin', 'teacher', 'client'));
+
+CREATE TABLE
+    teacher_groups (
+        teacher_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        group_id INT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+        created_at TIMESTAMP NOT NULL DEFAULT now(),
+        PRIMARY KEY (teacher_id, group_id)
+    );
+
+CREATE INDEX teacher_groups_group_idx ON teacher_groups (group_id);
@@ -0,0 +1,44 @@
+CREATE TABLE
+    roles (
+        id SERIAL PRIMARY KEY,
+        name VARCHAR(32) NOT NULL UNIQUE,
+        description TEXT NOT NULL DEFAULT '',
+        builtin BOOLEAN NOT NULL DEFAULT false,
+        created_at TIMESTAMP NOT NULL DEFAULT now()
+    );
+
+CREATE TABLE
+    role_permissions (
+        role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+        permission VARCHAR(64) NOT NULL,
+        PRIMARY KEY (role_id, permission)
+    );
+
+INSERT INTO roles (name, description, builtin)
+VALUES
+    ('admin', 'Full access to every group and setting', true),
+    ('teacher', 'Manages students and whitelists of assigned groups', true),
+    ('client', 'Student account', true)
+ON CONFLICT (name) DO NOTHING;
+
+-- Права admin в таблице не хранятся: роль всегда получает полный набор
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.permission
+FROM roles r
+JOIN (
+    VALUES
+        ('teacher', 'users.read'),
+        ('teacher', 'users.write'),
+        ('teacher', 'groups.read'),
+        ('teacher', 'whitelist.read'),
+        ('teacher', 'whitelist.edit'),
+        ('teacher', 'policy.read'),
+        ('teacher', 'access_requests.decide'),
+        ('client', 'access_requests.create')
+) AS p (role, permission) ON p.role = r.name
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+
+ALTER TABLE users
+    ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
@@ -0,0 +1,3 @@
+-- Зеркало флага AD "сменить пароль при следующем входе" (pwdLastSet=0)
+ALTER TABLE users
+    ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+-- Отключённый пользователь сохраняет данные и членство в группе, но не может войти
+ALTER TABLE users
+    ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT true;
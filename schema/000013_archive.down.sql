@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS groups_archived_at_idx;
+DROP INDEX IF EXISTS users_archived_at_idx;
+
+ALTER TABLE groups
+    DROP COLUMN archived_from,
+    DROP COLUMN archived_at;
+
+ALTER TABLE users
+    DROP COLUMN archived_from,
+    DROP COLUMN archived_at;
@@ -0,0 +1,12 @@
+-- Архивированные пользователи и группы скрыты из списков и удаляются окончательно
+-- по истечении срока хранения. archived_from - исходный DN объекта в AD для восстановления
+ALTER TABLE users
+    ADD COLUMN archived_at TIMESTAMPTZ,
+    ADD COLUMN archived_from TEXT;
+
+ALTER TABLE groups
+    ADD COLUMN archived_at TIMESTAMPTZ,
+    ADD COLUMN archived_from TEXT;
+
+CREATE INDEX users_archived_at_idx ON users (archived_at) WHERE archived_at IS NOT NULL;
+CREATE INDEX groups_archived_at_idx ON groups (archived_at) WHERE archived_at IS NOT NULL;
@@ -0,0 +1,10 @@
+-- Журнал операций каталога, пропущенных в режиме DB-only; replayed_at заполняется после повтора
+CREATE TABLE directory_journal (
+    id BIGSERIAL PRIMARY KEY,
+    operation TEXT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    replayed_at TIMESTAMPTZ
+);
+
+CREATE INDEX directory_journal_pending_idx ON directory_journal (id) WHERE replayed_at IS NULL;
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS directory_journal_failed_idx;
+DROP INDEX IF EXISTS directory_journal_pending_idx;
+
+ALTER TABLE directory_journal
+    DROP COLUMN IF EXISTS secret,
+    DROP COLUMN IF EXISTS result,
+    DROP COLUMN IF EXISTS last_error,
+    DROP COLUMN IF EXISTS next_attempt_at,
+    DROP COLUMN IF EXISTS attempts,
+    DROP COLUMN IF EXISTS status;
+
+ALTER TABLE directory_journal RENAME COLUMN applied_at TO replayed_at;
+
+CREATE INDEX directory_journal_pending_idx ON directory_journal (id) WHERE replayed_at IS NULL;
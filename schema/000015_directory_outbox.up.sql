@@ -0,0 +1,19 @@
+-- Журнал операций каталога становится очередью (outbox): сервисы пишут операцию в одной
+-- транзакции с изменением в БД, обработчик применяет её к AD с повторами. secret - пароль,
+-- зашифрованный ключом приложения, стирается после применения. result - прежний DN объекта,
+-- который вернула архивация: по нему восстановление возвращает объект на место
+ALTER TABLE directory_journal RENAME COLUMN replayed_at TO applied_at;
+
+ALTER TABLE directory_journal
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'done', 'failed')),
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN last_error TEXT,
+    ADD COLUMN result TEXT,
+    ADD COLUMN secret BYTEA;
+
+UPDATE directory_journal SET status = 'done' WHERE applied_at IS NOT NULL;
+
+DROP INDEX directory_journal_pending_idx;
+CREATE INDEX directory_journal_pending_idx ON directory_journal (id) WHERE status = 'pending';
+CREATE INDEX directory_journal_failed_idx ON directory_journal (id) WHERE status = 'failed';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS directory_journal_pending_keys_idx;
+
+ALTER TABLE directory_journal
+    DROP COLUMN IF EXISTS locked_until,
+    DROP COLUMN IF EXISTS object_keys;
@@ -0,0 +1,16 @@
+-- Операции очереди упорядочиваются по объектам каталога, а не глобально: object_keys - логины
+-- и группы, которые операция затрагивает ("user:<логин>", "group:<имя>"). Операция ждёт только
+-- более ранних операций с общими объектами. locked_until - срок захвата операции обработчиком:
+-- блокировка строки не держится, пока идёт обращение к каталогу
+ALTER TABLE directory_journal
+    ADD COLUMN object_keys TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN locked_until TIMESTAMPTZ;
+
+UPDATE directory_journal SET object_keys = array_remove(ARRAY[
+    'user:' || lower(payload->>'username'),
+    'group:' || lower(payload->>'group'),
+    CASE WHEN operation = 'update_group' THEN 'group:' ELSE 'user:' END || lower(payload->>'new_name')
+], NULL)
+WHERE status = 'pending';
+
+CREATE INDEX directory_journal_pending_keys_idx ON directory_journal USING gin (object_keys) WHERE status = 'pending';
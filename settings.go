@@ -0,0 +1,313 @@
+package classosbackend
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSetting = errors.New("invalid setting value")
+	ErrUnknownSetting = errors.New("unknown setting")
+)
+
+// Settings - значение настройки, сохранённое администратором
+type Settings struct {
+	ID        int64     `json:"id" db:"id"`
+	Key       string    `json:"key" db:"key"`
+	Value     string    `json:"value" db:"value"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+const (
+	SettingTypeBool       = "bool"
+	SettingTypeInt        = "int"
+	SettingTypeDuration   = "duration"
+	SettingTypeString     = "string"
+	SettingTypeStringList = "string_list"
+)
+
+const (
+	SettingAuthTokenTTL        = "auth.token_ttl"
+	SettingAuthRefreshTokenTTL = "auth.refresh_token_ttl"
+	SettingADDefaultOU         = "ad.default_ou"
+	SettingADGroupsOU          = "ad.groups_ou"
+	SettingADUPNSuffix         = "ad.upn_suffix"
+	SettingADArchiveOU         = "ad.archive_ou"
+	SettingArchiveRetention    = "archive.retention"
+	SettingAccessGrantDuration = "access_requests.default_grant_minutes"
+	SettingUsernameTemplate    = "users.username_template"
+	SettingUsersNameOrder      = "users.name_order"
+	SettingUsersLoginURL       = "users.login_url"
+)
+
+// SettingDefinition описывает известную настройку. Validate получает уже разобранное по Type значение
+type SettingDefinition struct {
+	Key         string
+	Type        string
+	Default     string
+	Description string
+	Validate    func(value interface{}) error
+}
+
+var settingDefinitions = map[string]SettingDefinition{
+	SettingAuthTokenTTL: {
+		Key:         SettingAuthTokenTTL,
+		Type:        SettingTypeDuration,
+		Default:     "15m",
+		Description: "Lifetime of access tokens; clients renew them with a refresh token",
+		Validate:    durationBetween(time.Minute, 24*time.Hour),
+	},
+	SettingAuthRefreshTokenTTL: {
+		Key:         SettingAuthRefreshTokenTTL,
+		Type:        SettingTypeDuration,
+		Default:     "720h",
+		Description: "Lifetime of refresh tokens issued at sign-in and on every refresh",
+		Validate:    durationBetween(time.Hour, 90*24*time.Hour),
+	},
+	SettingADDefaultOU: {
+		Key:         SettingADDefaultOU,
+		Type:        SettingTypeString,
+		Default:     "classos_users",
+		Description: "Organizational unit under the base DN where new AD users are created",
+		Validate:    validateOUName,
+	},
+	SettingADGroupsOU: {
+		Key:         SettingADGroupsOU,
+		Type:        SettingTypeString,
+		Default:     "classos_groups",
+		Description: "Organizational unit under the base DN where new AD groups are created",
+		Validate:    validateOUName,
+	},
+	SettingADUPNSuffix: {
+		Key:         SettingADUPNSuffix,
+		Type:        SettingTypeString,
+		Default:     "school.local",
+		Description: "Domain appended to sAMAccountName to build userPrincipalName",
+		Validate:    validateUPNSuffix,
+	},
+	SettingADArchiveOU: {
+		Key:         SettingADArchiveOU,
+		Type:        SettingTypeString,
+		Default:     "classos_archive",
+		Description: "Organizational unit under the base DN where archived users and groups are moved",
+		Validate:    validateOUName,
+	},
+	SettingArchiveRetention: {
+		Key:         SettingArchiveRetention,
+		Type:        SettingTypeDuration,
+		Default:     "720h",
+		Description: "How long archived users and groups can be restored before they are deleted permanently",
+		Validate:    durationBetween(24*time.Hour, 365*24*time.Hour),
+	},
+	SettingAccessGrantDuration: {
+		Key:         SettingAccessGrantDuration,
+		Type:        SettingTypeInt,
+		Default:     strconv.Itoa(DefaultAccessGrantMinutes),
+		Description: "Lifetime in minutes of a one-time access approval when the teacher does not set one",
+		Validate:    intBetween(1, MaxAccessGrantMinutes),
+	},
+	SettingUsernameTemplate: {
+		Key:         SettingUsernameTemplate,
+		Type:        SettingTypeString,
+		Default:     "{first}.{last}{n}",
+		Description: "Template for generated usernames: {first}, {last}, initials {f} and {l}, {n} for a number on collision",
+		Validate:    validateUsernameTemplate,
+	},
+	SettingUsersNameOrder: {
+		Key:         SettingUsersNameOrder,
+		Type:        SettingTypeString,
+		Default:     NameOrderLastFirst,
+		Description: "Order of words in a full name used for username generation: last_first or first_last",
+		Validate:    oneOf(NameOrderLastFirst, NameOrderFirstLast),
+	},
+	SettingUsersLoginURL: {
+		Key:         SettingUsersLoginURL,
+		Type:        SettingTypeString,
+		Default:     "",
+		Description: "Sign-in page printed as a QR code on credential sheets; empty omits the QR code",
+		Validate:    validateLoginURL,
+	},
+}
+
+// LookupSetting возвращает описание настройки по ключу
+func LookupSetting(key string) (SettingDefinition, error) {
+	definition, ok := settingDefinitions[key]
+	if !ok {
+		return SettingDefinition{}, fmt.Errorf("%w: %q", ErrUnknownSetting, key)
+	}
+
+	return definition, nil
+}
+
+// SettingDefinitions возвращает все известные настройки, отсортированные по ключу
+func SettingDefinitions() []SettingDefinition {
+	definitions := make([]SettingDefinition, 0, len(settingDefinitions))
+	for _, definition := range settingDefinitions {
+		definitions = append(definitions, definition)
+	}
+
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Key < definitions[j].Key
+	})
+
+	return definitions
+}
+
+// Parse разбирает строковое значение по типу настройки и проверяет его
+func (d SettingDefinition) Parse(value string) (interface{}, error) {
+	var parsed interface{}
+	var err error
+
+	value = strings.TrimSpace(value)
+	switch d.Type {
+	case SettingTypeBool:
+		parsed, err = strconv.ParseBool(value)
+	case SettingTypeInt:
+		parsed, err = strconv.Atoi(value)
+	case SettingTypeDuration:
+		parsed, err = time.ParseDuration(value)
+	case SettingTypeString:
+		parsed = value
+	case SettingTypeStringList:
+		parsed = splitSettingList(value)
+	default:
+		err = fmt.Errorf("unsupported type %q", d.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalidSetting, d.Key, err.Error())
+	}
+
+	if d.Validate != nil {
+		if err := d.Validate(parsed); err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidSetting, d.Key, err.Error())
+		}
+	}
+
+	return parsed, nil
+}
+
+// Normalize проверяет значение и приводит его к виду, в котором оно хранится
+func (d SettingDefinition) Normalize(value string) (string, error) {
+	parsed, err := d.Parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := parsed.(type) {
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case []string:
+		return strings.Join(v, ","), nil
+	default:
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// SettingValue - действующее значение настройки вместе с её описанием
+type SettingValue struct {
+	Key         string     `json:"key"`
+	Type        string     `json:"type"`
+	Value       string     `json:"value"`
+	Default     string     `json:"default"`
+	Description string     `json:"description"`
+	IsDefault   bool       `json:"is_default"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// UpdateSettingsInput - новые значения по ключам; null сбрасывает настройку к значению по умолчанию
+type UpdateSettingsInput map[string]*string
+
+func (i UpdateSettingsInput) Validate() error {
+	if len(i) == 0 {
+		return errors.New("update structure has no values")
+	}
+
+	return nil
+}
+
+func splitSettingList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func durationBetween(min, max time.Duration) func(interface{}) error {
+	return func(value interface{}) error {
+		if d := value.(time.Duration); d < min || d > max {
+			return fmt.Errorf("must be between %s and %s", min, max)
+		}
+		return nil
+	}
+}
+
+func intBetween(min, max int) func(interface{}) error {
+	return func(value interface{}) error {
+		if n := value.(int); n < min || n > max {
+			return fmt.Errorf("must be between %d and %d", min, max)
+		}
+		return nil
+	}
+}
+
+func oneOf(allowed ...string) func(interface{}) error {
+	return func(value interface{}) error {
+		for _, item := range allowed {
+			if value.(string) == item {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+func validateUsernameTemplate(value interface{}) error {
+	return ValidateUsernameTemplate(value.(string))
+}
+
+func validateLoginURL(value interface{}) error {
+	raw := value.(string)
+	if raw == "" {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http or https URL")
+	}
+
+	return nil
+}
+
+func validateOUName(value interface{}) error {
+	name := value.(string)
+	if name == "" {
+		return errors.New("must not be empty")
+	}
+
+	if strings.ContainsAny(name, `,=+"\<>;#`) {
+		return errors.New(`must be a single OU name without DN special characters`)
+	}
+
+	return nil
+}
+
+func validateUPNSuffix(value interface{}) error {
+	suffix := value.(string)
+	if strings.Contains(suffix, "*") {
+		return errors.New("must not contain wildcards")
+	}
+
+	return validateWhitelistHost(strings.ToLower(suffix))
+}
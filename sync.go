@@ -0,0 +1,113 @@
+package classosbackend
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidSync = errors.New("invalid sync request")
+
+// Направления сверки БД и AD: report строит план в направлении db_to_ad, но ничего не меняет
+const (
+	SyncADToDB = "ad_to_db"
+	SyncDBToAD = "db_to_ad"
+	SyncReport = "report"
+)
+
+// Объекты сверки: пользователи и группы сравниваются в OU classOS, членство - только
+// в группах из OU групп
+const (
+	SyncObjectUser       = "user"
+	SyncObjectGroup      = "group"
+	SyncObjectMembership = "membership"
+)
+
+// Действия плана относительно стороны, которую меняет направление. conflict не применяется:
+// его нужно разрешить вручную
+const (
+	SyncActionCreate   = "create"
+	SyncActionUpdate   = "update"
+	SyncActionDelete   = "delete"
+	SyncActionConflict = "conflict"
+)
+
+const (
+	SyncStatusApplied = "applied"
+	SyncStatusFailed  = "failed"
+	SyncStatusSkipped = "skipped"
+)
+
+// SyncFieldChange - расхождение одного поля объекта, присутствующего с обеих сторон
+type SyncFieldChange struct {
+	Field string `json:"field"`
+	DB    string `json:"db"`
+	AD    string `json:"ad"`
+}
+
+// SyncChange - изменение плана. Для членства Name - логин, Group - группа. Status, Error и
+// Password заполняются при применении; Password - сгенерированный пароль учётной записи,
+// созданной в AD: пароль из БД туда перенести нельзя
+type SyncChange struct {
+	Object   string            `json:"object"`
+	Action   string            `json:"action"`
+	Name     string            `json:"name"`
+	Group    string            `json:"group,omitempty"`
+	Fields   []SyncFieldChange `json:"fields,omitempty"`
+	Reason   string            `json:"reason,omitempty"`
+	Status   string            `json:"status,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Password string            `json:"password,omitempty"`
+}
+
+type SyncSummary struct {
+	Create   int `json:"create"`
+	Update   int `json:"update"`
+	Delete   int `json:"delete"`
+	Conflict int `json:"conflict"`
+	Applied  int `json:"applied"`
+	Failed   int `json:"failed"`
+	Skipped  int `json:"skipped"`
+}
+
+// SyncPlan - план сверки и, если он применялся, результат каждого изменения. ID - хеш
+// изменений плана: применяется только план, который видел администратор.
+// ConfirmationRequired - план архивирует или заново создаёт слишком много объектов
+type SyncPlan struct {
+	ID                   string       `json:"id"`
+	Direction            string       `json:"direction"`
+	Applied              bool         `json:"applied"`
+	ConfirmationRequired bool         `json:"confirmation_required"`
+	GeneratedAt          time.Time    `json:"generated_at"`
+	Summary              SyncSummary  `json:"summary"`
+	Changes              []SyncChange `json:"changes"`
+}
+
+// SyncInput - применение плана: PlanID - id из /sync/plan, Confirm подтверждает план
+// с ConfirmationRequired
+type SyncInput struct {
+	Direction string `json:"direction" binding:"required"`
+	PlanID    string `json:"plan_id"`
+	Confirm   bool   `json:"confirm"`
+}
+
+func (i SyncInput) Validate() error {
+	if err := ValidateSyncDirection(i.Direction); err != nil {
+		return err
+	}
+
+	if i.Direction != SyncReport && i.PlanID == "" {
+		return fmt.Errorf("%w: plan_id from the sync plan is required", ErrInvalidSync)
+	}
+
+	return nil
+}
+
+func ValidateSyncDirection(direction string) error {
+	switch direction {
+	case SyncADToDB, SyncDBToAD, SyncReport:
+		return nil
+	default:
+		return fmt.Errorf("%w: direction must be %q, %q or %q", ErrInvalidSync, SyncADToDB, SyncDBToAD, SyncReport)
+	}
+}
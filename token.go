@@ -0,0 +1,52 @@
+package classosbackend
+
+import "time"
+
+// TokenPair выдаётся при входе и обновлении: короткоживущий access-токен и refresh-токен для его продления
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// RefreshToken - запись о выданном refresh-токене; сам токен не хранится, только его sha256.
+// Все токены одной цепочки обновлений имеют общий Family
+type RefreshToken struct {
+	ID           int64      `db:"id"`
+	UserID       int        `db:"user_id"`
+	TokenHash    string     `db:"token_hash"`
+	Family       string     `db:"family"`
+	TokenVersion int        `db:"token_version"`
+	ExpiresAt    time.Time  `db:"expires_at"`
+	RevokedAt    *time.Time `db:"revoked_at"`
+	CreatedAt    time.Time  `db:"created_at"`
+}
+
+// Session - вход пользователя: цепочка refresh-токенов от входа до выхода или истечения.
+// ID совпадает с Family цепочки и передаётся в access-токене
+type Session struct {
+	ID         string    `json:"id" db:"family"`
+	StartedAt  time.Time `json:"started_at" db:"started_at"`
+	LastUsedAt time.Time `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+	Current    bool      `json:"current" db:"-"`
+}
+
+// Identity - пользователь, от имени которого выполняется запрос, по данным access-токена
+type Identity struct {
+	UserID      int
+	Role        string
+	Permissions []string
+	SessionID   string
+}
+
+func (i Identity) Can(permission string) bool {
+	for _, p := range i.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
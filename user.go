@@ -1,6 +1,16 @@
 package classosbackend
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	RoleAdmin   = "admin"
+	RoleTeacher = "teacher"
+	RoleClient  = "client"
+)
 
 type User struct {
 	ID        int     `json:"id" db:"id"`
@@ -10,21 +20,132 @@ type User struct {
 	Role      string  `json:"role" db:"role"`
 	GroupID   *int    `json:"group_id,omitempty" db:"group_id"`
 	GroupName *string `json:"group_name" db:"group_name"`
+	// Enabled false запрещает вход, не удаляя данные пользователя
+	Enabled bool `json:"enabled" db:"enabled"`
+	// TokenVersion увеличивается при смене пароля или роли и отзывает ранее выданные токены
+	TokenVersion int `json:"-" db:"token_version"`
+	// MustChangePassword не даёт войти, пока пользователь не сменит пароль, выданный администратором
+	MustChangePassword bool `json:"must_change_password" db:"must_change_password"`
+	// ArchivedAt задан у архивированного пользователя: вход запрещён, учётная запись AD
+	// отключена и перенесена в OU архива, ArchivedFrom хранит её прежний DN
+	ArchivedAt   *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+	ArchivedFrom *string    `json:"-" db:"archived_from"`
+}
+
+// CreateUserInput - пользователь, создаваемый администратором: пустые Username и Password
+// генерируются сервером
+type CreateUserInput struct {
+	Name     string `json:"name" binding:"required"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+func (i CreateUserInput) User() User {
+	return User{Name: i.Name, Username: i.Username, Password: i.Password, Role: i.Role}
 }
 
 type UpdateUserInput struct {
-	Name      *string `json:"name"`
-	Username  *string `json:"username"`
-	Password  *string `json:"password"`
-	Role      *string `json:"role"`
-	GroupID   *int    `json:"group_id"`
-	GroupName *string `json:"group_name"`
+	Name     *string `json:"name"`
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+	Role     *string `json:"role"`
+	GroupID  *int    `json:"group_id"`
+	// MustChangePassword выставляется только сбросом пароля и снимается сменой пароля самим пользователем
+	MustChangePassword *bool `json:"-"`
+	// Enabled меняется только через /api/users/:id/enable и /disable, чтобы AD и БД не расходились
+	Enabled *bool `json:"-"`
 }
 
 func (i UpdateUserInput) Validate() error {
-	if i.Name == nil && i.Username == nil && i.Role == nil && i.GroupID == nil {
+	if i.Name == nil && i.Username == nil && i.Password == nil && i.Role == nil && i.GroupID == nil {
 		return errors.New("update structure has no values")
 	}
 
 	return nil
 }
+
+// TeacherGroupsInput - полный список групп, закреплённых за учителем
+type TeacherGroupsInput struct {
+	GroupIDs []int `json:"group_ids" binding:"required"`
+}
+
+// Profile - данные текущего пользователя для раздела /api/me
+type Profile struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	GroupID     *int     `json:"group_id,omitempty"`
+	GroupName   *string  `json:"group_name,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+type ChangeOwnPasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+func (i ChangeOwnPasswordInput) Validate() error {
+	if i.CurrentPassword == i.NewPassword {
+		return errors.New("new password must differ from the current one")
+	}
+
+	return nil
+}
+
+// RequiredPasswordChangeInput - смена пароля до входа, когда вход вернул password_change_required
+type RequiredPasswordChangeInput struct {
+	Username        string `json:"username" binding:"required"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+func (i RequiredPasswordChangeInput) Validate() error {
+	return ChangeOwnPasswordInput{CurrentPassword: i.CurrentPassword, NewPassword: i.NewPassword}.Validate()
+}
+
+// MaxPasswordResetUsers ограничивает число пользователей в одном запросе сброса паролей
+const MaxPasswordResetUsers = 1000
+
+// PasswordResetInput - сброс паролей списку пользователей или всем ученикам группы
+type PasswordResetInput struct {
+	UserIDs            []int `json:"user_ids"`
+	GroupID            *int  `json:"group_id"`
+	MustChangePassword bool  `json:"must_change_password"`
+}
+
+func (i PasswordResetInput) Validate() error {
+	if (len(i.UserIDs) == 0) == (i.GroupID == nil) {
+		return errors.New("either user_ids or group_id is required")
+	}
+
+	if len(i.UserIDs) > MaxPasswordResetUsers {
+		return fmt.Errorf("at most %d users per request", MaxPasswordResetUsers)
+	}
+
+	return nil
+}
+
+const (
+	PasswordResetDone   = "reset"
+	PasswordResetFailed = "failed"
+)
+
+// PasswordResetResult содержит новый пароль: он показывается один раз и нигде не сохраняется
+type PasswordResetResult struct {
+	UserID   int    `json:"user_id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Status   string `json:"status"`
+	Password string `json:"password,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type PasswordResetReport struct {
+	MustChangePassword bool                  `json:"must_change_password"`
+	Total              int                   `json:"total"`
+	Succeeded          int                   `json:"succeeded"`
+	Failed             int                   `json:"failed"`
+	Results            []PasswordResetResult `json:"results"`
+}
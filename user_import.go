@@ -0,0 +1,83 @@
+package classosbackend
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+var ErrInvalidImport = errors.New("invalid import file")
+
+// MaxImportRows ограничивает размер одного импорта, чтобы запрос укладывался в разумное время
+const MaxImportRows = 5000
+
+const (
+	ImportRowValid   = "valid"
+	ImportRowInvalid = "invalid"
+	ImportRowCreated = "created"
+	ImportRowFailed  = "failed"
+	ImportRowSkipped = "skipped"
+)
+
+// ImportRow - результат обработки строки файла. В отчёт попадают только пароли,
+// сгенерированные сервером: пароли из файла администратору уже известны
+type ImportRow struct {
+	Row      int    `json:"row"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Group    string `json:"group"`
+	Status   string `json:"status"`
+	UserID   int    `json:"user_id,omitempty"`
+	Password string `json:"password,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportReport - построчный отчёт импорта. ADChecked false означает, что AD был недоступен
+// и строки проверены только по БД
+type ImportReport struct {
+	DryRun    bool        `json:"dry_run"`
+	ADChecked bool        `json:"ad_checked"`
+	Total     int         `json:"total"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Skipped   int         `json:"skipped"`
+	Rows      []ImportRow `json:"rows"`
+}
+
+// WriteCSV выводит построчный отчёт в CSV для скачивания
+func (r ImportReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"row", "name", "username", "group", "status", "user_id", "password", "error"}); err != nil {
+		return err
+	}
+
+	for _, row := range r.Rows {
+		userId := ""
+		if row.UserID != 0 {
+			userId = strconv.Itoa(row.UserID)
+		}
+
+		// Имя, логин и группа приходят из загруженного файла, ошибка может их цитировать
+		record := []string{strconv.Itoa(row.Row), csvCell(row.Name), csvCell(row.Username), csvCell(row.Group), row.Status, userId, row.Password, csvCell(row.Error)}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Ограничения sAMAccountName: до 20 символов, без пробелов и спецсимволов AD
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,19}$`)
+
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) || username[len(username)-1] == '.' {
+		return fmt.Errorf("username %q must be up to 20 latin letters, digits, dots, dashes or underscores", username)
+	}
+
+	return nil
+}
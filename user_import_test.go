@@ -0,0 +1,70 @@
+package classosbackend
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestImportReportWriteCSVEscapesFormulas(t *testing.T) {
+	report := ImportReport{Rows: []ImportRow{{
+		Row:      2,
+		Name:     "=HYPERLINK(\"http://evil\")",
+		Username: "+cmd",
+		Group:    "\t-7A",
+		Status:   ImportRowInvalid,
+		Error:    "@SUM(A1)",
+	}, {
+		Row:      3,
+		Name:     "Ivanov Ivan",
+		Username: "iivanov",
+		Group:    "7A",
+		Status:   ImportRowCreated,
+		Password: "-Secret123",
+	}}}
+
+	var b bytes.Buffer
+	if err := report.WriteCSV(&b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+
+	want := []string{"2", "'=HYPERLINK(\"http://evil\")", "'+cmd", "'\t-7A", ImportRowInvalid, "", "", "'@SUM(A1)"}
+	for i, value := range want {
+		if records[1][i] != value {
+			t.Errorf("column %s: got %q, want %q", records[0][i], records[1][i], value)
+		}
+	}
+
+	// Пароль выдаётся пользователю как есть, апостроф его бы испортил
+	if records[2][1] != "Ivanov Ivan" || records[2][6] != "-Secret123" {
+		t.Fatalf("plain row changed: %q", records[2])
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := map[string]string{
+		"":        "",
+		"7A":      "7A",
+		"a=b":     "a=b",
+		"=1+1":    "'=1+1",
+		"+1":      "'+1",
+		"-1":      "'-1",
+		"@A1":     "'@A1",
+		"\t=1+1":  "'\t=1+1",
+		"\r=1+1":  "'\r=1+1",
+		" =1+1":   " =1+1",
+		"Иванов":  "Иванов",
+		"'quoted": "'quoted",
+	}
+
+	for value, want := range tests {
+		if got := csvCell(value); got != want {
+			t.Errorf("csvCell(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package classosbackend
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	NameOrderLastFirst = "last_first"
+	NameOrderFirstLast = "first_last"
+)
+
+// MaxUsernameLength - ограничение длины sAMAccountName
+const MaxUsernameLength = 20
+
+// CreatedUser - результат создания пользователя. Password заполнен, только если пароль
+// сгенерирован сервером: иначе его больше негде узнать
+type CreatedUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+}
+
+// translit - транслитерация кириллицы (русский, казахский, узбекский алфавиты) в латиницу
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'ә': "a", 'ғ': "g", 'қ': "q", 'ң': "n", 'ө': "o", 'ұ': "u", 'ү': "u",
+	'һ': "h", 'і': "i", 'ў': "o", 'ҳ': "h",
+}
+
+// Transliterate переводит строку в нижний регистр латиницей; символы без замены отбрасываются
+func Transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '-' || r == '.' || r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteString(translit[r])
+		}
+	}
+
+	return b.String()
+}
+
+// SplitFullName выделяет имя и фамилию из ФИО; отчество и прочие слова не используются
+func SplitFullName(name, order string) (first, last string) {
+	words := strings.Fields(name)
+	switch len(words) {
+	case 0:
+		return "", ""
+	case 1:
+		return words[0], words[0]
+	}
+
+	if order == NameOrderFirstLast {
+		return words[0], words[len(words)-1]
+	}
+	return words[1], words[0]
+}
+
+var (
+	templatePlaceholder = regexp.MustCompile(`\{[^}]*\}`)
+	usernameSeparators  = regexp.MustCompile(`[._-]{2,}`)
+)
+
+var templatePlaceholders = map[string]bool{"{first}": true, "{last}": true, "{f}": true, "{l}": true, "{n}": true}
+
+// ValidateUsernameTemplate проверяет шаблон логина: {first}, {last}, первые буквы {f}, {l}
+// и номер {n}, который добавляется при совпадении логинов
+func ValidateUsernameTemplate(template string) error {
+	for _, placeholder := range templatePlaceholder.FindAllString(template, -1) {
+		if !templatePlaceholders[placeholder] {
+			return errors.New("unknown placeholder " + placeholder)
+		}
+	}
+
+	if !strings.Contains(template, "{first}") && !strings.Contains(template, "{last}") {
+		return errors.New("must contain {first} or {last}")
+	}
+
+	if Transliterate(templatePlaceholder.ReplaceAllString(template, "")) != strings.ToLower(templatePlaceholder.ReplaceAllString(template, "")) {
+		return errors.New("may contain only latin letters, digits, dots, dashes and underscores besides placeholders")
+	}
+
+	return nil
+}
+
+// RenderUsername строит логин по шаблону. n = 0 - первый вариант без номера; если в шаблоне нет {n},
+// номер дописывается в конец. Имя и фамилия укорачиваются так, чтобы логин уложился в MaxUsernameLength
+func RenderUsername(template, first, last string, n int) string {
+	first, last = Transliterate(first), Transliterate(last)
+
+	number := ""
+	if n > 0 {
+		number = strconv.Itoa(n)
+	}
+	if !strings.Contains(template, "{n}") {
+		template += "{n}"
+	}
+
+	for {
+		username := cleanUsername(strings.NewReplacer(
+			"{first}", first,
+			"{last}", last,
+			"{f}", firstLetter(first),
+			"{l}", firstLetter(last),
+			"{n}", number,
+		).Replace(template))
+
+		if len(username) <= MaxUsernameLength {
+			return username
+		}
+
+		switch {
+		case len(last) >= len(first) && len(last) > 1:
+			last = last[:len(last)-1]
+		case len(first) > 1:
+			first = first[:len(first)-1]
+		default:
+			return strings.TrimRight(username[:MaxUsernameLength], "._-")
+		}
+	}
+}
+
+func cleanUsername(username string) string {
+	username = usernameSeparators.ReplaceAllStringFunc(username, func(s string) string {
+		return s[:1]
+	})
+
+	return strings.Trim(username, "._-")
+}
+
+func firstLetter(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	return s[:1]
+}
@@ -0,0 +1,246 @@
+package classosbackend
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrInvalidWhitelistValue = errors.New("invalid whitelist value")
+
+const (
+	// EntrySetDefault действует, когда ни одно правило расписания не активно
+	EntrySetDefault = "default"
+	// EntrySetOpen - зарезервированный набор без ограничений, записей в нём нет
+	EntrySetOpen = "open"
+)
+
+const (
+	WhitelistActionAllow = "allow"
+	WhitelistActionDeny  = "deny"
+)
+
+type WhitelistInput struct {
+	Value    string   `json:"value"`
+	Values   []string `json:"values"`
+	EntrySet string   `json:"entry_set"`
+	Action   string   `json:"action"`
+}
+
+func (i WhitelistInput) Validate() error {
+	if i.Value == "" && len(i.Values) == 0 {
+		return fmt.Errorf("%w: input has no values", ErrInvalidWhitelistValue)
+	}
+
+	return nil
+}
+
+// Set возвращает набор записей, к которому относится запрос
+func (i WhitelistInput) Set() (string, error) {
+	if i.EntrySet == "" {
+		return EntrySetDefault, nil
+	}
+
+	if i.EntrySet == EntrySetOpen {
+		return "", fmt.Errorf("%w: entry set %q is unrestricted and cannot hold entries", ErrInvalidWhitelistValue, EntrySetOpen)
+	}
+
+	if err := ValidateEntrySet(i.EntrySet); err != nil {
+		return "", err
+	}
+
+	return i.EntrySet, nil
+}
+
+// EntryAction возвращает действие записей из запроса, по умолчанию allow
+func (i WhitelistInput) EntryAction() (string, error) {
+	switch i.Action {
+	case "":
+		return WhitelistActionAllow, nil
+	case WhitelistActionAllow, WhitelistActionDeny:
+		return i.Action, nil
+	default:
+		return "", fmt.Errorf("%w: action must be %q or %q", ErrInvalidWhitelistValue, WhitelistActionAllow, WhitelistActionDeny)
+	}
+}
+
+func ValidateEntrySet(name string) error {
+	if len(name) == 0 || len(name) > 64 {
+		return fmt.Errorf("%w: entry set name length must be between 1 and 64", ErrInvalidWhitelistValue)
+	}
+
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("%w: entry set %q may contain only a-z, 0-9, '-' and '_'", ErrInvalidWhitelistValue, name)
+		}
+	}
+
+	return nil
+}
+
+// Normalized возвращает все значения из запроса в каноническом виде без дублей
+func (i WhitelistInput) Normalized() ([]string, error) {
+	raw := i.Values
+	if i.Value != "" {
+		raw = append([]string{i.Value}, raw...)
+	}
+
+	return NormalizeWhitelistValues(raw)
+}
+
+func NormalizeWhitelistValues(values []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(values))
+	result := make([]string, 0, len(values))
+
+	for _, value := range values {
+		normalized, err := NormalizeWhitelistValue(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := seen[normalized]; ok {
+			continue
+		}
+		seen[normalized] = struct{}{}
+		result = append(result, normalized)
+	}
+
+	return result, nil
+}
+
+// NormalizeWhitelistValue приводит домен, URL, wildcard-шаблон, IP или подсеть к каноническому виду:
+// "HTTPS://Www.Example.com/Docs/?q=1" -> "www.example.com/Docs", "*.Example.com." -> "*.example.com",
+// "10.1.2.3/8" -> "10.0.0.0/8"
+func NormalizeWhitelistValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("%w: empty value", ErrInvalidWhitelistValue)
+	}
+
+	// IP-адреса и подсети храним в каноническом виде без пути
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return prefix.Masked().String(), nil
+	}
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap().String(), nil
+	}
+
+	var host, path string
+	if strings.Contains(value, "://") {
+		u, err := url.Parse(value)
+		if err != nil {
+			return "", fmt.Errorf("%w: %q: %s", ErrInvalidWhitelistValue, value, err.Error())
+		}
+
+		scheme := strings.ToLower(u.Scheme)
+		if scheme != "http" && scheme != "https" {
+			return "", fmt.Errorf("%w: %q: unsupported scheme %q", ErrInvalidWhitelistValue, value, u.Scheme)
+		}
+
+		host = u.Hostname()
+		path = u.EscapedPath()
+	} else {
+		if idx := strings.IndexAny(value, "?#"); idx >= 0 {
+			value = value[:idx]
+		}
+
+		host = value
+		if idx := strings.Index(value, "/"); idx >= 0 {
+			host, path = value[:idx], value[idx:]
+		}
+
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		host = addr.Unmap().String()
+	} else if err := validateWhitelistHost(host); err != nil {
+		return "", fmt.Errorf("%w: %q: %s", ErrInvalidWhitelistValue, value, err.Error())
+	}
+
+	path = strings.TrimRight(path, "/")
+	if strings.Contains(path, "*") {
+		return "", fmt.Errorf("%w: %q: wildcards are not allowed in path", ErrInvalidWhitelistValue, value)
+	}
+
+	return host + path, nil
+}
+
+func validateWhitelistHost(host string) error {
+	domain := strings.TrimPrefix(host, "*.")
+	if strings.Contains(domain, "*") {
+		return errors.New("wildcard is only allowed as the leftmost label (*.example.com)")
+	}
+
+	if len(domain) == 0 || len(domain) > 253 {
+		return errors.New("domain length must be between 1 and 253")
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return errors.New("domain must contain at least two labels")
+	}
+
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 {
+			return errors.New("domain label length must be between 1 and 63")
+		}
+
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("label %q must not start or end with '-'", label)
+		}
+
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return fmt.Errorf("label %q contains invalid character %q", label, r)
+			}
+		}
+	}
+
+	return nil
+}
+
+const (
+	WhitelistSourceGlobal = "global"
+	WhitelistSourceGroup  = "group"
+	// WhitelistSourceGrant - разовое разрешение пользователю по одобренному запросу доступа
+	WhitelistSourceGrant = "grant"
+)
+
+type GlobalWhitelistEntry struct {
+	ID        int64     `json:"id" db:"id"`
+	Value     string    `json:"value" db:"resource"`
+	Action    string    `json:"action" db:"action"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// ResolvedWhitelistEntry - запись итоговой политики группы с указанием источника
+type ResolvedWhitelistEntry struct {
+	ID     int64  `json:"id"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Action string `json:"action"`
+}
+
+// PolicyPreview - итоговая политика группы, действующая в момент At
+type PolicyPreview struct {
+	GroupID      int                      `json:"group_id"`
+	At           time.Time                `json:"at"`
+	EntrySet     string                   `json:"entry_set"`
+	Unrestricted bool                     `json:"unrestricted"`
+	Schedule     *ScheduleRule            `json:"schedule,omitempty"`
+	Data         []ResolvedWhitelistEntry `json:"data"`
+}
+
+// MyWhitelist - политика группы пользователя вместе с его действующими разовыми разрешениями
+type MyWhitelist struct {
+	PolicyPreview
+	Grants []AccessRequest `json:"grants"`
+}